@@ -5,16 +5,28 @@ export interface FileInfo {
   name: string; // Basename (e.g., "main.go")
   isDir: boolean; // True if directory
   size: number; // File size in bytes
+  mtime: string; // RFC 3339
+  perm: string; // Octal permissions, e.g. "0644"
+  isSymlink: boolean; // The entry itself is a symlink
+  // Only in detailed listings
+  mode?: string; // e.g. "-rw-r--r--"
+  owner?: string;
+  group?: string;
 }
 
 /**
  * List all files in the container's filesystem
- * Returns a flat list of all files recursively
+ * Returns a flat list of all files recursively, or only `depth` levels deep
  */
 export async function listContainerFiles(
-  computerName: string
+  computerName: string,
+  options: { detailed?: boolean; depth?: number } = {}
 ): Promise<FileInfo[]> {
-  const response = await fetch(`/api/computer/${computerName}/files`);
+  const params = new URLSearchParams({ depth: String(options.depth ?? -1) });
+  if (options.detailed) {
+    params.set("detailed", "true");
+  }
+  const response = await fetch(`/api/computer/${computerName}/files?${params}`);
 
   if (!response.ok) {
     throw new Error(`Failed to list files: ${response.statusText}`);
@@ -23,6 +35,36 @@ export async function listContainerFiles(
   return await response.json();
 }
 
+export interface TreeNode {
+  name: string;
+  isDir: boolean;
+  // Directories only; missing past the requested depth (not loaded yet)
+  children?: TreeNode[];
+}
+
+/**
+ * Get a directory as a nested tree, `depth` levels deep (1 to 16)
+ */
+export async function getContainerFileTree(
+  computerName: string,
+  options: { path?: string; depth?: number } = {}
+): Promise<TreeNode> {
+  const params = new URLSearchParams();
+  if (options.path) {
+    params.set("path", options.path);
+  }
+  if (options.depth) {
+    params.set("depth", String(options.depth));
+  }
+  const response = await fetch(`/api/computer/${computerName}/files/tree?${params}`);
+
+  if (!response.ok) {
+    throw new Error(`Failed to get file tree: ${response.statusText}`);
+  }
+
+  return await response.json();
+}
+
 /**
  * Get the content of a file from the container
  */
@@ -63,14 +105,50 @@ export async function putContainerFile(
   }
 }
 
+export interface UploadedFile {
+  path: string;
+  size: number;
+}
+
+/**
+ * Upload several files into a directory in one request
+ * Names may include subdirectories (e.g. a File's webkitRelativePath).
+ * The batch is all or nothing: one bad name or failed file stores none.
+ */
+export async function uploadContainerFiles(
+  computerName: string,
+  dir: string,
+  files: { name: string; content: Blob }[]
+): Promise<UploadedFile[]> {
+  const form = new FormData();
+  for (const file of files) {
+    form.append("files", file.content, file.name);
+  }
+  const params = new URLSearchParams({ path: dir });
+  const response = await fetch(`/api/computer/${computerName}/files/upload?${params}`, {
+    method: "POST",
+    body: form,
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to upload files: ${response.statusText}`);
+  }
+
+  const { files: uploaded } = await response.json();
+  return uploaded;
+}
+
 /**
  * Delete a file from the container
+ * Non-empty directories are only deleted with recursive set.
  */
 export async function deleteContainerFile(
   computerName: string,
-  filepath: string
+  filepath: string,
+  options: { recursive?: boolean } = {}
 ): Promise<void> {
-  const response = await fetch(`/api/computer/${computerName}/files/${filepath}`, {
+  const query = options.recursive ? "?recursive=true" : "";
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}${query}`, {
     method: "DELETE",
   });
 
@@ -81,13 +159,17 @@ export async function deleteContainerFile(
 
 /**
  * Move or rename a file in the container
+ * With autorename, a taken destination becomes "name (n).ext" instead of
+ * being overwritten. Returns the final path used.
  */
 export async function moveContainerFile(
   computerName: string,
   from: string,
-  to: string
-): Promise<void> {
-  const response = await fetch(`/api/computer/${computerName}/files/move`, {
+  to: string,
+  options: { autorename?: boolean } = {}
+): Promise<string> {
+  const query = options.autorename ? "?autorename=true" : "";
+  const response = await fetch(`/api/computer/${computerName}/files/move${query}`, {
     method: "POST",
     body: JSON.stringify({ from, to }),
     headers: {
@@ -98,4 +180,183 @@ export async function moveContainerFile(
   if (!response.ok) {
     throw new Error(`Failed to move file: ${response.statusText}`);
   }
+
+  const { path } = await response.json();
+  return path;
+}
+
+/**
+ * Copy a file, or a directory recursively, in the container
+ * A taken destination is an error unless autorename is set, in which case
+ * it becomes "name (n).ext". Returns the final path used.
+ */
+export async function copyContainerFile(
+  computerName: string,
+  from: string,
+  to: string,
+  options: { autorename?: boolean } = {}
+): Promise<string> {
+  const query = options.autorename ? "?autorename=true" : "";
+  const response = await fetch(`/api/computer/${computerName}/files/copy${query}`, {
+    method: "POST",
+    body: JSON.stringify({ from, to }),
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to copy file: ${response.statusText}`);
+  }
+
+  const { path } = await response.json();
+  return path;
+}
+
+/**
+ * Create a directory (and any missing parents) in the container
+ * Succeeds if it already exists; fails if a file is in the way. With a
+ * template it must be new, and is seeded with a copy of the template.
+ */
+export async function createContainerDirectory(
+  computerName: string,
+  path: string,
+  template?: string // Name from config.json's "templates" to seed it from
+): Promise<void> {
+  const response = await fetch(`/api/computer/${computerName}/files/mkdir`, {
+    method: "POST",
+    body: JSON.stringify({ path, template }),
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to create directory: ${response.statusText}`);
+  }
+}
+
+export interface FileLock {
+  path: string;
+  locked: boolean;
+  holder?: string; // Client holding the lock
+  expiresAt?: string; // ISO timestamp
+}
+
+/**
+ * Get the advisory editor lock on a file
+ */
+export async function getFileLock(
+  computerName: string,
+  filepath: string
+): Promise<FileLock> {
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}/lock`);
+
+  if (!response.ok) {
+    throw new Error(`Failed to get file lock: ${response.statusText}`);
+  }
+
+  return await response.json();
+}
+
+/**
+ * Acquire or renew the advisory editor lock on a file
+ * Locks don't block writes; if another client holds it, the returned lock
+ * names them so the editor can warn about concurrent edits. Renew before
+ * ttlSeconds runs out to keep it.
+ */
+export async function acquireFileLock(
+  computerName: string,
+  filepath: string,
+  holder: string,
+  ttlSeconds?: number
+): Promise<{ acquired: boolean; lock: FileLock }> {
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}/lock`, {
+    method: "POST",
+    body: JSON.stringify({ holder, ttl: ttlSeconds }),
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+
+  if (!response.ok && response.status !== 409) {
+    throw new Error(`Failed to acquire file lock: ${response.statusText}`);
+  }
+
+  return { acquired: response.ok, lock: await response.json() };
+}
+
+/**
+ * Release an advisory editor lock
+ */
+export async function releaseFileLock(
+  computerName: string,
+  filepath: string,
+  holder: string
+): Promise<void> {
+  const response = await fetch(
+    `/api/computer/${computerName}/files/${filepath}/lock?holder=${encodeURIComponent(holder)}`,
+    { method: "DELETE" }
+  );
+
+  if (!response.ok && response.status !== 409) {
+    throw new Error(`Failed to release file lock: ${response.statusText}`);
+  }
+}
+
+export interface FileVersion {
+  id: string; // Pass to getFileVersion/restoreFileVersion
+  size: number;
+  saved: string; // ISO timestamp
+}
+
+/**
+ * List a file's saved versions, newest first
+ * Only saved when versioning is on in config.json
+ */
+export async function listFileVersions(
+  computerName: string,
+  filepath: string
+): Promise<FileVersion[]> {
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}/versions`);
+
+  if (!response.ok) {
+    throw new Error(`Failed to list file versions: ${response.statusText}`);
+  }
+
+  return await response.json();
+}
+
+/**
+ * Get the content of a saved version of a file
+ */
+export async function getFileVersion(
+  computerName: string,
+  filepath: string,
+  id: string
+): Promise<string> {
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}/versions/${id}`);
+
+  if (!response.ok) {
+    throw new Error(`Failed to get file version: ${response.statusText}`);
+  }
+
+  return await response.text();
+}
+
+/**
+ * Restore a saved version of a file, replacing its current content
+ */
+export async function restoreFileVersion(
+  computerName: string,
+  filepath: string,
+  id: string
+): Promise<void> {
+  const response = await fetch(`/api/computer/${computerName}/files/${filepath}/versions/${id}`, {
+    method: "POST",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to restore file version: ${response.statusText}`);
+  }
 }
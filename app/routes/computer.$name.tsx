@@ -141,12 +141,20 @@ export default function Computer() {
       terminalRef.current = term;
       fitAddonRef.current = fitAddon;
 
+      // Set when the session ended in a way that waits for the user
+      let sessionEnded = false;
+      // Once this page has had the session, reconnects take it back even if
+      // the server hasn't noticed the old connection drop. Before that, a
+      // session that's connected elsewhere (another tab) is refused with a
+      // 1013.
+      let takeover = false;
+
       function connect() {
         setStatus("connecting");
         setStatusText("Connecting...");
 
         const protocol = window.location.protocol === "https:" ? "wss:" : "ws:";
-        const wsUrl = `${protocol}//${window.location.host}/ws?name=${encodeURIComponent(computerName)}&cols=${term.cols}&rows=${term.rows}`;
+        const wsUrl = `${protocol}//${window.location.host}/ws?name=${encodeURIComponent(computerName)}&cols=${term.cols}&rows=${term.rows}${takeover ? "&takeover=true" : ""}`;
         const ws = new WebSocket(wsUrl);
 
         ws.onopen = () => {
@@ -156,11 +164,30 @@ export default function Computer() {
         };
 
         ws.onmessage = (event) => {
+          // Output means the session is ours
+          takeover = true;
           term.write(event.data);
         };
 
-        ws.onclose = () => {
+        ws.onclose = (event) => {
           setStatus("disconnected");
+          // The session is connected elsewhere, most likely in another
+          // tab. Taking it over is the user's call.
+          if (event.code === 1013) {
+            setStatusText("Not connected");
+            setReconnectMessage("The terminal may be open in another tab. Press any key to use it here");
+            sessionEnded = true;
+            takeover = true;
+            return;
+          }
+          // The shell exited (1000) or hit the session limit (1008): a new
+          // shell is the user's call. Anything else is worth retrying.
+          if (event.code === 1000 || event.code === 1008) {
+            setStatusText(event.reason ? `Session ended (${event.reason})` : "Session ended");
+            setReconnectMessage("Press any key to start a new session");
+            sessionEnded = true;
+            return;
+          }
           setStatusText("Disconnected");
           setReconnectMessage("Reconnecting in 2s...");
           setTimeout(connect, 2000);
@@ -179,6 +206,9 @@ export default function Computer() {
       term.onData((data: string) => {
         if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
           wsRef.current.send(data);
+        } else if (sessionEnded && mounted) {
+          sessionEnded = false;
+          connect();
         }
       });
 
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressAPI gzips API responses for clients that accept it, once they
+// pass the compression threshold (compression.minBytes, 1 KB by default).
+// Unlike static files this is on without a compression config: API
+// responses like big listings are compressible JSON built on the fly
+// anyway. compression.maxBytes doesn't apply, since responses are
+// compressed as they stream rather than in one go.
+//
+// Only complete 200 responses with a compressible Content-Type are
+// compressed, never partial content, already-encoded bodies or WebSocket
+// upgrades. A streaming response that flushes before reaching the
+// threshold is compressed from then on, flushing the gzip stream along
+// with it; Server-Sent Events are left alone since proxies and browsers
+// handle them better uncompressed.
+func compressAPI(h http.HandlerFunc) http.HandlerFunc {
+	// Indented before it's compressed, see prettyjson.go
+	h = prettyJSON(h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			h(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsEncoding(r, "gzip") {
+			h(w, r)
+			return
+		}
+
+		var minBytes int64 = defaultCompressionMinBytes
+		if config, err := loadConfig(); err == nil {
+			minBytes = config.Compression.minBytes()
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minBytes: int(minBytes)}
+		defer gw.close()
+		h(gw, r)
+	}
+}
+
+// gzipResponseWriter holds back the start of a response until it knows
+// whether it's worth compressing
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes    int
+	status      int
+	wroteHeader bool   // The handler called WriteHeader
+	decided     bool   // The real header has been sent, with or without gzip
+	buf         []byte // Body held back until decided
+	gz          *gzip.Writer
+}
+
+// eligible reports whether the response could be compressed, based on its
+// status and headers
+func (g *gzipResponseWriter) eligible() bool {
+	h := g.Header()
+	if g.status != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "text/event-stream" || !compressibleType(ct) {
+		return false
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < g.minBytes {
+		return false
+	}
+	return true
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.status = status
+	if !g.eligible() {
+		g.decided = true
+		g.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= g.minBytes {
+		if err := g.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// startGzip sends the header for a compressed response, then anything
+// held back
+func (g *gzipResponseWriter) startGzip() error {
+	g.decided = true
+	h := g.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	// The gzip body isn't byte-for-byte what a strong ETag promises (it
+	// names the identity bytes, which ranges are served from). Weak still
+	// revalidates, since If-None-Match compares weakly.
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	g.gz = gzip.NewWriter(g.ResponseWriter)
+	buf := g.buf
+	g.buf = nil
+	_, err := g.gz.Write(buf)
+	return err
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if !g.decided {
+		g.startGzip()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close finishes the response: small ones go out as they are
+func (g *gzipResponseWriter) close() {
+	if g.gz != nil {
+		g.gz.Close()
+		return
+	}
+	if g.wroteHeader && !g.decided {
+		g.ResponseWriter.WriteHeader(g.status)
+		g.ResponseWriter.Write(g.buf)
+	}
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
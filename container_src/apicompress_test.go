@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestAPIListingCompression(t *testing.T) {
+	files := map[string]string{"config.json": `{"static": "."}`, "small/a.txt": "a"}
+	for i := range 100 {
+		files[fmt.Sprintf("big/file-%03d.txt", i)] = "x"
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, files)
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	get := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// A big listing is compressed
+	w := get("/api/files?path=big", "gzip, br")
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("big listing: %d, encoding %q, vary %q", w.Code, w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+	}
+	var listed []FileInfo
+	if err := json.Unmarshal(gunzip(t, w.Body.Bytes()), &listed); err != nil || len(listed) != 100 {
+		t.Fatalf("decompressed listing: %d entries, %v", len(listed), err)
+	}
+
+	// The same listing uncompressed for clients that don't accept gzip
+	plain := get("/api/files?path=big", "")
+	if plain.Header().Get("Content-Encoding") != "" || plain.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("identity: encoding %q, vary %q", plain.Header().Get("Content-Encoding"), plain.Header().Get("Vary"))
+	}
+	if plain.Body.Len() <= w.Body.Len() {
+		t.Errorf("compressed %d bytes, identity %d", w.Body.Len(), plain.Body.Len())
+	}
+
+	// Below the threshold it isn't worth it
+	small := get("/api/files?path=small", "gzip")
+	if small.Header().Get("Content-Encoding") != "" || !strings.Contains(small.Body.String(), "small/a.txt") {
+		t.Errorf("small listing: encoding %q, body %q", small.Header().Get("Content-Encoding"), small.Body.String())
+	}
+
+	// Errors aren't compressed
+	if w := get("/api/files?path=missing", "gzip"); w.Code != 404 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("error: %d, encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressAPIStreaming(t *testing.T) {
+	useDataDir(t, t.TempDir())
+	handler := compressAPI(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := range 3 {
+			fmt.Fprintf(w, "{\"n\":%d}\n", i)
+			w.(http.Flusher).Flush()
+		}
+	})
+	req := httptest.NewRequest("GET", "/api/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" || !w.Flushed {
+		t.Fatalf("encoding %q, flushed %v", w.Header().Get("Content-Encoding"), w.Flushed)
+	}
+	if got := string(gunzip(t, w.Body.Bytes())); got != "{\"n\":0}\n{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("stream = %q", got)
+	}
+}
+
+func TestCompressAPISkips(t *testing.T) {
+	useDataDir(t, t.TempDir())
+	big := strings.Repeat("x", 4096)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"partial content", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Range", "bytes 0-4095/10000")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, big)
+		}},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/gzip")
+			io.WriteString(w, big)
+		}},
+		{"event stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, big)
+		}},
+		{"small with length", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2")
+			io.WriteString(w, "{}")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/x", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			compressAPI(tt.handler)(w, req)
+			if enc := w.Header().Get("Content-Encoding"); enc == "gzip" {
+				t.Errorf("compressed")
+			}
+			if w.Body.Len() == 0 {
+				t.Error("empty body")
+			}
+		})
+	}
+}
+
+func TestCompressAPIETag(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"big.txt":     strings.Repeat("compressible ", 1000),
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/files/big.txt", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	plain := get("", "")
+	strong := plain.Header().Get("ETag")
+	if plain.Header().Get("Content-Encoding") != "" || strong == "" || strings.HasPrefix(strong, "W/") {
+		t.Fatalf("identity response: encoding %q, ETag %q", plain.Header().Get("Content-Encoding"), strong)
+	}
+	gz := get("gzip", "")
+	if gz.Header().Get("Content-Encoding") != "gzip" || gz.Header().Get("ETag") != "W/"+strong {
+		t.Fatalf("gzip response: encoding %q, ETag %q, want W/%s", gz.Header().Get("Content-Encoding"), gz.Header().Get("ETag"), strong)
+	}
+
+	// Either tag still revalidates
+	for _, tag := range []string{strong, "W/" + strong} {
+		if w := get("gzip", tag); w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: status = %d, want 304", tag, w.Code)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+// APIIndex is the discovery document at GET /api, so clients (the UI
+// included) can adapt to how this server is configured rather than
+// finding out endpoint by endpoint
+type APIIndex struct {
+	Endpoints []APIEndpoint `json:"endpoints"`
+	Features  APIFeatures   `json:"features"`
+}
+
+// APIEndpoint describes one endpoint
+type APIEndpoint struct {
+	Path        string   `json:"path"`
+	Methods     []string `json:"methods"`
+	Description string   `json:"description"`
+	// Feature is the config switch the endpoint depends on, "terminal" or
+	// "fileApi", if any
+	Feature string `json:"feature,omitempty"`
+	// Auth is set for endpoints that need "Authorization: Bearer <token>"
+	Auth bool `json:"auth,omitempty"`
+	// Available is false when its feature is off. Turning a feature on
+	// that was off at startup only takes effect after a restart.
+	Available bool `json:"available"`
+}
+
+// APIFeatures summarizes the active config
+type APIFeatures struct {
+	Terminal bool `json:"terminal"`
+	FileAPI  bool `json:"fileApi"`
+	// Compression of static files on the fly. API responses are always
+	// gzipped for clients that accept it.
+	Compression bool `json:"compression"`
+	DevMode     bool `json:"devMode"`
+	// Logs is whether /api/logs can be used at all, i.e. a token is set
+	Logs             bool  `json:"logs"`
+	MaxUploadBytes   int64 `json:"maxUploadBytes"`
+	MaxJSONBodyBytes int64 `json:"maxJsonBodyBytes"`
+	// VersionsKept per file on overwrite, 0 if versioning is off
+	VersionsKept int `json:"versionsKept"`
+	// ReconnectGraceSeconds a terminal session waits for its owner to
+	// reconnect, 0 if sessions end with their connection
+	ReconnectGraceSeconds float64 `json:"reconnectGraceSeconds"`
+	MaxSessionsPerIP      int     `json:"maxSessionsPerIp,omitempty"` // 0 is unlimited
+}
+
+// apiEndpoints lists the endpoints newServeMux registers, for the index.
+// Paths ending in "/" take a path or ID after them.
+var apiEndpoints = []APIEndpoint{
+	{Path: "/api", Methods: []string{"GET"}, Description: "This discovery document"},
+	{Path: "/healthz", Methods: []string{"GET"}, Description: "Readiness check: 503 until the config loads and storage is mounted"},
+	{Path: "/api/selfcheck", Methods: []string{"GET"}, Description: "Summary of the container environment"},
+	{Path: "/api/logs", Methods: []string{"GET"}, Description: "Recent server logs, or a stream of them with ?follow=true", Auth: true},
+	{Path: "/api/config/reload", Methods: []string{"POST"}, Description: "Re-read the config file"},
+	{Path: "/ws/echo", Methods: []string{"GET"}, Description: "WebSocket connectivity check"},
+	{Path: liveReloadPath, Methods: []string{"GET"}, Description: "Page reload events in dev mode"},
+
+	{Path: "/ws", Methods: []string{"GET"}, Description: "Terminal session over WebSocket", Feature: "terminal"},
+	{Path: "/ws/exec", Methods: []string{"GET"}, Description: "Run a command, streaming its output over WebSocket", Feature: "terminal"},
+	{Path: "/api/exec", Methods: []string{"POST"}, Description: "Run a command", Feature: "terminal"},
+	{Path: "/api/exec/", Methods: []string{"GET", "DELETE"}, Description: "Poll or cancel a command", Feature: "terminal"},
+	{Path: "/api/sessions", Methods: []string{"GET"}, Description: "Running terminal sessions", Feature: "terminal"},
+	{Path: "/api/schedule", Methods: []string{"GET"}, Description: "Scheduled commands and their last runs", Feature: "terminal"},
+
+	{Path: "/api/files", Methods: []string{"GET"}, Description: "List files", Feature: "fileApi"},
+	{Path: "/api/files/", Methods: []string{"GET", "HEAD", "PUT", "POST", "DELETE"}, Description: "Read, write or delete a file; <path>/lock and <path>/versions also take POST", Feature: "fileApi"},
+	{Path: "/api/files/move", Methods: []string{"POST"}, Description: "Move or rename a file or directory", Feature: "fileApi"},
+	{Path: "/api/files/copy", Methods: []string{"POST"}, Description: "Copy a file or directory", Feature: "fileApi"},
+	{Path: "/api/files/mkdir", Methods: []string{"POST"}, Description: "Create a directory, optionally from a template", Feature: "fileApi"},
+	{Path: "/api/files/tree", Methods: []string{"GET"}, Description: "Nested directory tree", Feature: "fileApi"},
+	{Path: "/api/files/exists", Methods: []string{"GET"}, Description: "Check whether a path exists", Feature: "fileApi"},
+	{Path: "/api/files/fetch", Methods: []string{"POST"}, Description: "Download a URL into a file", Feature: "fileApi"},
+	{Path: "/api/files/manifest", Methods: []string{"GET"}, Description: "Size and mtime of every file, and SHA-256 checksums with ?checksum=true", Feature: "fileApi"},
+	{Path: "/api/files/transaction", Methods: []string{"POST"}, Description: "Write several files together, rolling back if any fail", Feature: "fileApi"},
+	{Path: "/api/files/upload", Methods: []string{"POST"}, Description: "Upload files as multipart/form-data", Feature: "fileApi"},
+	{Path: "/api/files/stat", Methods: []string{"GET"}, Description: "Metadata for one path", Feature: "fileApi"},
+	{Path: "/api/files/chtimes", Methods: []string{"POST"}, Description: "Set a file's modification time", Feature: "fileApi"},
+	{Path: "/api/files/delete-glob", Methods: []string{"POST"}, Description: "Delete files matching a pattern", Feature: "fileApi"},
+	{Path: "/api/files/resolve", Methods: []string{"GET"}, Description: "Where a file API ?path= resolves to, or why it's rejected", Feature: "fileApi"},
+	{Path: "/api/search", Methods: []string{"GET"}, Description: "Find files by name", Feature: "fileApi"},
+	{Path: "/api/watch", Methods: []string{"GET"}, Description: "Stream file changes as Server-Sent Events", Feature: "fileApi"},
+	{Path: "/ws/upload", Methods: []string{"GET"}, Description: "Upload a file over WebSocket with progress", Feature: "fileApi"},
+}
+
+// apiIndexHandler serves GET /api. registered is the config newServeMux
+// ran with, which decided what was registered at all. A site that proxies
+// /api/ to its own backend keeps /api going there too.
+func apiIndexHandler(registered *Config) http.HandlerFunc {
+	serveIndex := compressAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		config, err := loadConfig()
+		if err != nil {
+			config = &Config{}
+		}
+
+		enabled := map[string]bool{
+			"":         true,
+			"terminal": registered.terminalEnabled() && config.terminalEnabled(),
+			"fileApi":  registered.fileAPIEnabled() && config.fileAPIEnabled(),
+		}
+		index := APIIndex{
+			Endpoints: make([]APIEndpoint, len(apiEndpoints)),
+			Features: APIFeatures{
+				Terminal:              enabled["terminal"],
+				FileAPI:               enabled["fileApi"],
+				Compression:           config.Compression == nil || config.Compression.Enabled == nil || *config.Compression.Enabled,
+				DevMode:               config.devModeEnabled(),
+				Logs:                  os.Getenv("LOGS_TOKEN") != "",
+				MaxUploadBytes:        maxUploadBytes,
+				MaxJSONBodyBytes:      config.maxJSONBodyBytes(),
+				VersionsKept:          config.versionsKeep(),
+				ReconnectGraceSeconds: config.Terminal.reconnectGrace().Seconds(),
+				MaxSessionsPerIP:      config.Terminal.maxSessionsPerIP(),
+			},
+		}
+		for i, endpoint := range apiEndpoints {
+			endpoint.Available = enabled[endpoint.Feature]
+			if endpoint.Path == "/api/logs" {
+				endpoint.Available = index.Features.Logs
+			}
+			index.Endpoints[i] = endpoint
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(index)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config, err := loadConfig(); err == nil {
+			if _, ok := config.Proxy.proxyFor(r.URL.Path); ok {
+				handleHTTP(w, r)
+				return
+			}
+		}
+		serveIndex(w, r)
+	}
+}
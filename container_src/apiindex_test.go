@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIIndex(t *testing.T) {
+	off := false
+	tests := []struct {
+		name         string
+		config       string
+		startup      *Config // newServeMux's config
+		wantTerminal bool
+		wantFileAPI  bool
+	}{
+		{name: "defaults", config: `{"static": "."}`, startup: &Config{}, wantTerminal: true, wantFileAPI: true},
+		{name: "terminal disabled", config: `{"static": ".", "terminal": {"enabled": false}}`, startup: &Config{}, wantTerminal: false, wantFileAPI: true},
+		{
+			name:         "file API enabled since startup",
+			config:       `{"static": "."}`,
+			startup:      &Config{FileAPI: &FileAPIConfig{Enabled: &off}},
+			wantTerminal: true,
+			wantFileAPI:  false, // Not registered until a restart
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{"config.json": tt.config})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(tt.startup)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			var index APIIndex
+			if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+				t.Fatal(err)
+			}
+			if index.Features.Terminal != tt.wantTerminal || index.Features.FileAPI != tt.wantFileAPI {
+				t.Errorf("features = %+v", index.Features)
+			}
+			if len(index.Endpoints) != len(apiEndpoints) {
+				t.Fatalf("%d endpoints, want %d", len(index.Endpoints), len(apiEndpoints))
+			}
+
+			for _, endpoint := range index.Endpoints {
+				want := true
+				switch endpoint.Feature {
+				case "terminal":
+					want = tt.wantTerminal
+				case "fileApi":
+					want = tt.wantFileAPI
+				}
+				if endpoint.Path == "/api/logs" {
+					want = false // No LOGS_TOKEN
+				}
+				if endpoint.Available != want {
+					t.Errorf("%s: available = %v, want %v", endpoint.Path, endpoint.Available, want)
+				}
+
+				// Available endpoints really are there, not the static
+				// file handler
+				if endpoint.Available {
+					_, pattern := mux.Handler(httptest.NewRequest(endpoint.Methods[0], endpoint.Path, nil))
+					if pattern != endpoint.Path {
+						t.Errorf("%s is routed to %q", endpoint.Path, pattern)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAPIIndexFeatures(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{
+		"static": ".",
+		"compression": {"enabled": false},
+		"maxJsonBodyBytes": 2048,
+		"versions": {"keep": 3},
+		"terminal": {"reconnectGrace": "90s", "maxSessionsPerIp": 2}
+	}`})
+	useDataDir(t, tmpDir)
+	t.Setenv("LOGS_TOKEN", "secret-token")
+
+	w := httptest.NewRecorder()
+	newServeMux(&Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	var index APIIndex
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	want := APIFeatures{
+		Terminal:              true,
+		FileAPI:               true,
+		Compression:           false,
+		Logs:                  true,
+		MaxUploadBytes:        maxUploadBytes,
+		MaxJSONBodyBytes:      2048,
+		VersionsKept:          3,
+		ReconnectGraceSeconds: 90,
+		MaxSessionsPerIP:      2,
+	}
+	if index.Features != want {
+		t.Errorf("features = %+v\nwant %+v", index.Features, want)
+	}
+	for _, endpoint := range index.Endpoints {
+		if endpoint.Path == "/api/logs" && (!endpoint.Available || !endpoint.Auth) {
+			t.Errorf("logs endpoint = %+v", endpoint)
+		}
+	}
+}
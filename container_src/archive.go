@@ -0,0 +1,297 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultArchiveCacheTTL      = time.Hour
+	defaultArchiveCacheMaxBytes = 1024 * 1024 * 1024 // 1 GB
+)
+
+// Archive cache metrics, exposed at /debug/vars
+var (
+	archiveCacheHits   = expvar.NewInt("archive_cache_hits")
+	archiveCacheBuilds = expvar.NewInt("archive_cache_builds")
+)
+
+// ArchiveCacheConfig makes directory downloads (?archive=tar.gz) resumable.
+// Without it archives are streamed as they're generated, which is cheap
+// but has no size, ETag or Range support, so an interrupted download
+// starts over. With it the archive is first written to a temp file, keyed
+// by a hash of the directory's contents, and served from there; the cost
+// is disk space (bounded by MaxBytes) and a delay before the first byte.
+type ArchiveCacheConfig struct {
+	TTL      Duration `json:"ttl,omitempty"`      // Drop archives unused for this long, default 1h
+	MaxBytes int64    `json:"maxBytes,omitempty"` // Total disk budget, default 1 GB
+}
+
+func (c *ArchiveCacheConfig) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return defaultArchiveCacheTTL
+	}
+	return time.Duration(c.TTL)
+}
+
+func (c *ArchiveCacheConfig) maxBytes() int64 {
+	if c.MaxBytes <= 0 {
+		return defaultArchiveCacheMaxBytes
+	}
+	return c.MaxBytes
+}
+
+// archiveEntry is a materialized archive on disk
+type archiveEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// archiveCache tracks materialized archives by content key
+type archiveCache struct {
+	mu      sync.Mutex
+	buildMu sync.Mutex // Builds are serialized so a key is only built once
+	dir     string     // Created on first use
+	entries map[string]*archiveEntry
+}
+
+var directoryArchives = &archiveCache{entries: make(map[string]*archiveEntry)}
+
+// archiveFiles lists what goes into a directory's archive, sorted so the
+// archive (and its key) is deterministic
+func archiveFiles(dirPath string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dirPath {
+			return nil
+		}
+		if d.IsDir() || d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+// archiveKey hashes the directory's path and each file's name, size, mode
+// and mtime. Hashing the contents themselves would mean reading the whole
+// tree on every request; a changed file almost always has a new mtime.
+func archiveKey(dirPath string, paths []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", dirPath)
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%o\x00%d\n", path, info.Size(), info.Mode(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeArchive writes a tar.gz of paths, named relative to dirPath
+func writeArchive(w io.Writer, dirPath string, paths []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dirPath, path)
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyN(tw, f, info.Size())
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// get returns the archive for key, building it with build if needed
+func (c *archiveCache) get(key string, cfg *ArchiveCacheConfig, build func(io.Writer) error) (*archiveEntry, bool, error) {
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		entry.lastUsed = time.Now()
+		c.mu.Unlock()
+		return entry, true, nil
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		dir, err := os.MkdirTemp("", "cute-archives-")
+		if err != nil {
+			return nil, false, err
+		}
+		c.dir = dir
+	}
+
+	path := filepath.Join(c.dir, key+".tar.gz")
+	tmp, err := os.CreateTemp(c.dir, key+".tmp-*")
+	if err != nil {
+		return nil, false, err
+	}
+	if err := build(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, false, err
+	}
+	info, err := tmp.Stat()
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, false, err
+	}
+	archiveCacheBuilds.Add(1)
+
+	entry := &archiveEntry{path: path, size: info.Size(), lastUsed: time.Now()}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	c.evict(cfg, key)
+	return entry, false, nil
+}
+
+// evict removes archives unused for longer than the TTL, then the least
+// recently used ones until the cache fits its budget. keep is never
+// evicted (it's about to be served).
+func (c *archiveCache) evict(cfg *ArchiveCacheConfig, keep string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-cfg.ttl())
+	var total int64
+	keys := make([]string, 0, len(c.entries))
+	for key, entry := range c.entries {
+		if key != keep && entry.lastUsed.Before(cutoff) {
+			c.remove(key)
+			continue
+		}
+		total += entry.size
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+	for _, key := range keys {
+		if total <= cfg.maxBytes() {
+			break
+		}
+		if key == keep {
+			continue
+		}
+		total -= c.entries[key].size
+		c.remove(key)
+	}
+}
+
+// remove deletes an archive. Callers hold mu. A download still reading the
+// file keeps its open handle, so removal never breaks one in progress.
+func (c *archiveCache) remove(key string) {
+	if err := os.Remove(c.entries[key].path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cached archive: %v", err)
+	}
+	delete(c.entries, key)
+}
+
+// serveDirectoryArchive sends a directory as a tar.gz download
+func serveDirectoryArchive(w http.ResponseWriter, r *http.Request, dirPath string) {
+	name := filepath.Base(dirPath)
+	if dirPath == dataDir {
+		name = "home"
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar.gz"`, strings.ReplaceAll(name, `"`, "")))
+
+	paths, err := archiveFiles(dirPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	config, err := loadConfig()
+	if err != nil || config.ArchiveCache == nil {
+		// Stream as we go: no size, so no Range support
+		if r.Method == "HEAD" {
+			return
+		}
+		if err := writeArchive(w, dirPath, paths); err != nil {
+			log.Printf("Failed to stream archive of %s: %v", dirPath, err)
+		}
+		return
+	}
+
+	key, err := archiveKey(dirPath, paths)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, hit, err := directoryArchives.get(key, config.ArchiveCache, func(out io.Writer) error {
+		return writeArchive(out, dirPath, paths)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if hit {
+		archiveCacheHits.Add(1)
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// ServeContent handles Range, If-Range and If-None-Match, which is
+	// what lets browsers and curl -C resume an interrupted download
+	w.Header().Set("ETag", `"`+key+`"`)
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useArchiveCache gives the test its own archive cache
+func useArchiveCache(t *testing.T) {
+	old := directoryArchives
+	directoryArchives = &archiveCache{dir: t.TempDir(), entries: make(map[string]*archiveEntry)}
+	t.Cleanup(func() { directoryArchives = old })
+}
+
+func untar(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+}
+
+func TestDirectoryArchive(t *testing.T) {
+	for _, cached := range []bool{false, true} {
+		name := "streamed"
+		config := `{"static": "."}`
+		if cached {
+			name = "cached"
+			config = `{"static": ".", "archiveCache": {}}`
+		}
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":         config,
+				"project/a.txt":       "alpha",
+				"project/sub/b.txt":   "bravo",
+				"project/sub/c/d.txt": "delta",
+			})
+			useDataDir(t, tmpDir)
+			useArchiveCache(t)
+
+			w := httptest.NewRecorder()
+			handleAPIFilesGet(w, httptest.NewRequest("GET", "/api/files/project?archive=tar.gz", nil), "project")
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="project.tar.gz"` {
+				t.Errorf("Content-Disposition = %q", cd)
+			}
+			if (w.Header().Get("ETag") != "") != cached {
+				t.Errorf("ETag = %q", w.Header().Get("ETag"))
+			}
+
+			files := untar(t, w.Body.Bytes())
+			want := map[string]string{"a.txt": "alpha", "sub/": "", "sub/b.txt": "bravo", "sub/c/": "", "sub/c/d.txt": "delta"}
+			if len(files) != len(want) {
+				t.Fatalf("archive = %v", files)
+			}
+			for name, content := range want {
+				if files[name] != content {
+					t.Errorf("%s = %q, want %q", name, files[name], content)
+				}
+			}
+		})
+	}
+
+	t.Run("without archive param", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		writeTestFiles(t, tmpDir, map[string]string{"project/a.txt": "alpha"})
+		useDataDir(t, tmpDir)
+		w := httptest.NewRecorder()
+		handleAPIFilesGet(w, httptest.NewRequest("GET", "/api/files/project", nil), "project")
+		if w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestDirectoryArchiveCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":     `{"static": ".", "archiveCache": {}}`,
+		"project/a.txt":   "alpha",
+		"project/big.bin": string(bytes.Repeat([]byte("0123456789"), 10000)),
+	})
+	useDataDir(t, tmpDir)
+	useArchiveCache(t)
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/files/project?archive=tar.gz", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handleAPIFilesGet(w, req, "project")
+		return w
+	}
+
+	builds, hits := archiveCacheBuilds.Value(), archiveCacheHits.Value()
+	full := get(nil)
+	etag := full.Header().Get("ETag")
+	if full.Code != 200 || etag == "" || full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("status = %d, ETag = %q, Accept-Ranges = %q", full.Code, etag, full.Header().Get("Accept-Ranges"))
+	}
+
+	// Resume partway through: served from the cache, same bytes
+	ranged := get(map[string]string{"Range": "bytes=100-", "If-Range": etag})
+	if ranged.Code != 206 {
+		t.Fatalf("ranged status = %d", ranged.Code)
+	}
+	if !bytes.Equal(ranged.Body.Bytes(), full.Body.Bytes()[100:]) {
+		t.Error("ranged body doesn't match the tail of the full archive")
+	}
+	if got := archiveCacheBuilds.Value() - builds; got != 1 {
+		t.Errorf("builds = %d, want 1", got)
+	}
+	if got := archiveCacheHits.Value() - hits; got != 1 {
+		t.Errorf("hits = %d, want 1", got)
+	}
+
+	if w := get(map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("If-None-Match status = %d, want 304", w.Code)
+	}
+
+	// Changing the directory changes the archive, so a stale If-Range gets
+	// the whole new archive rather than a mismatched range
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(tmpDir, "project/a.txt"), future, future)
+	changed := get(map[string]string{"Range": "bytes=100-", "If-Range": etag})
+	if changed.Code != 200 || changed.Header().Get("ETag") == etag {
+		t.Errorf("after change: status = %d, ETag = %q", changed.Code, changed.Header().Get("ETag"))
+	}
+	if got := archiveCacheBuilds.Value() - builds; got != 2 {
+		t.Errorf("builds = %d, want 2", got)
+	}
+}
+
+func TestArchiveCacheEviction(t *testing.T) {
+	useArchiveCache(t)
+	c := directoryArchives
+	build := func(size int) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := w.Write(make([]byte, size))
+			return err
+		}
+	}
+
+	cfg := &ArchiveCacheConfig{MaxBytes: 250, TTL: Duration(time.Hour)}
+	for _, key := range []string{"a", "b"} {
+		if _, _, err := c.get(key, cfg, build(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Touch "a" so "b" is least recently used
+	c.entries["a"].lastUsed = time.Now().Add(time.Second)
+	c.get("c", cfg, build(100))
+	if _, ok := c.entries["b"]; ok {
+		t.Error("least recently used archive wasn't evicted")
+	}
+	if _, ok := c.entries["a"]; !ok {
+		t.Error("recently used archive was evicted")
+	}
+
+	// Expired archives go regardless of size
+	c.entries["a"].lastUsed = time.Now().Add(-2 * time.Hour)
+	c.get("d", cfg, build(10))
+	if _, ok := c.entries["a"]; ok {
+		t.Error("expired archive wasn't evicted")
+	}
+	entries, _ := os.ReadDir(c.dir)
+	if len(entries) != len(c.entries) {
+		t.Errorf("%d files on disk for %d entries", len(entries), len(c.entries))
+	}
+}
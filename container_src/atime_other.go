@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime falls back to the mtime where we don't read the atime
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
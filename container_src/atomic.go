@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// errTooLarge is returned when a write exceeds its size cap
+var errTooLarge = errors.New("content exceeds size limit")
+
+// errChecksumMismatch is returned when written content doesn't hash to the
+// checksum the client sent
+var errChecksumMismatch = errors.New("content does not match X-Content-SHA256")
+
+// writeFileAtomic streams r into absPath via a temp file in the same
+// directory that's renamed into place once complete, so readers never see
+// a partially written file and a failed write leaves no trace. Memory use
+// doesn't depend on the size of the content. An existing file keeps its
+// permissions; new files are 0644. A maxBytes > 0 caps the size, returning
+// errTooLarge (and leaving any existing file untouched) if r has more.
+func writeFileAtomic(absPath string, r io.Reader, maxBytes int64) (int64, error) {
+	return writeFileAtomicChecked(absPath, r, maxBytes, nil)
+}
+
+// writeFileAtomicChecked is writeFileAtomic that also hashes the content as
+// it's written and, when wantSHA256 is set, returns errChecksumMismatch
+// (leaving any existing file untouched) if it doesn't match.
+func writeFileAtomicChecked(absPath string, r io.Reader, maxBytes int64, wantSHA256 []byte) (int64, error) {
+	tmpPath, n, err := stageFileAtomic(absPath, r, maxBytes, wantSHA256)
+	if err != nil {
+		return n, err
+	}
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		return n, fmt.Errorf("failed to move file into place: %w", err)
+	}
+	// Uploads over the WebSocket don't go through the file API's write methods
+	listingsCache.invalidate()
+	return n, nil
+}
+
+// stageFileAtomic does the first half of writeFileAtomicChecked: it streams
+// r into a temp file next to absPath and returns its path, complete and
+// ready to rename over absPath. On error nothing is left behind; otherwise
+// the caller renames or removes it.
+func stageFileAtomic(absPath string, r io.Reader, maxBytes int64, wantSHA256 []byte) (string, int64, error) {
+	dir := filepath.Dir(absPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create parent directories: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(absPath)+".tmp-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	n, err := fillTempFile(tmp, absPath, r, maxBytes, wantSHA256)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", n, err
+	}
+	return tmp.Name(), n, nil
+}
+
+// fillTempFile writes r to tmp and closes it, checking the size and
+// checksum and copying absPath's permissions
+func fillTempFile(tmp *os.File, absPath string, r io.Reader, maxBytes int64, wantSHA256 []byte) (int64, error) {
+	if maxBytes > 0 {
+		// Read one extra byte so we can tell "exactly at the cap" from "over"
+		r = io.LimitReader(r, maxBytes+1)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if maxBytes > 0 && n > maxBytes {
+		tmp.Close()
+		return n, errTooLarge
+	}
+	if wantSHA256 != nil && !bytes.Equal(h.Sum(nil), wantSHA256) {
+		tmp.Close()
+		return n, errChecksumMismatch
+	}
+	// Overwriting run.sh shouldn't make it non-executable
+	var perm os.FileMode = 0644
+	if info, err := os.Stat(absPath); err == nil && info.Mode().IsRegular() {
+		perm = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return n, err
+	}
+	return n, tmp.Close()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutChecksum(t *testing.T) {
+	content := "hello, world\n"
+	sum := sha256.Sum256([]byte(content))
+	good := hex.EncodeToString(sum[:])
+	bad := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name        string
+		checksum    string
+		wantStatus  int
+		wantContent string
+	}{
+		{name: "no checksum", wantStatus: 200, wantContent: content},
+		{name: "matching", checksum: good, wantStatus: 200, wantContent: content},
+		{name: "uppercase", checksum: strings.ToUpper(good), wantStatus: 200, wantContent: content},
+		{name: "mismatched", checksum: bad, wantStatus: 422, wantContent: "original"},
+		{name: "malformed", checksum: "abc", wantStatus: 400, wantContent: "original"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":    `{}`,
+				"notes/todo.txt": "original",
+			})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(&Config{})
+
+			req := httptest.NewRequest("PUT", "/api/files/notes/todo.txt", strings.NewReader(content))
+			if tt.checksum != "" {
+				req.Header.Set("X-Content-SHA256", tt.checksum)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			got, err := os.ReadFile(filepath.Join(tmpDir, "notes/todo.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+			// No temp files are left behind either way
+			entries, _ := os.ReadDir(filepath.Join(tmpDir, "notes"))
+			if len(entries) != 1 {
+				t.Errorf("notes/ has %d entries, want 1", len(entries))
+			}
+		})
+	}
+}
+
+// failingReader returns some data, then fails like a dropped connection
+type failingReader struct {
+	data []byte
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func TestPutStreaming(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`, "video.mp4": "original"})
+	if err := os.WriteFile(filepath.Join(tmpDir, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	put := func(path string, body io.Reader) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("PUT", "/api/files/"+path, body))
+		return w.Code
+	}
+	noTempFiles := func(dir string) {
+		t.Helper()
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if strings.Contains(e.Name(), ".tmp-") {
+				t.Errorf("temp file left behind: %s", e.Name())
+			}
+		}
+	}
+
+	// An upload that dies halfway fails and leaves the old file alone
+	if code := put("video.mp4", &failingReader{data: bytes.Repeat([]byte("x"), 100000)}); code != 500 {
+		t.Errorf("aborted upload: status %d, want 500", code)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "video.mp4")); string(got) != "original" {
+		t.Errorf("file after aborted upload = %q", got)
+	}
+	noTempFiles(tmpDir)
+
+	// Or doesn't create one at all
+	if code := put("new/clip.mp4", &failingReader{data: []byte("partial")}); code != 500 {
+		t.Errorf("aborted new upload: status %d, want 500", code)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "new/clip.mp4")); !os.IsNotExist(err) {
+		t.Errorf("truncated file created: %v", err)
+	}
+	noTempFiles(filepath.Join(tmpDir, "new"))
+
+	// A big upload goes through in full, into new parent directories
+	big := bytes.Repeat([]byte("0123456789abcdef"), 1<<20) // 16 MB
+	if code := put("media/big.bin", bytes.NewReader(big)); code != 200 {
+		t.Fatalf("big upload: status %d", code)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "media/big.bin")); !bytes.Equal(got, big) {
+		t.Errorf("big upload: got %d bytes, want %d", len(got), len(big))
+	}
+
+	// Overwriting keeps the file's permissions
+	if code := put("run.sh", strings.NewReader("#!/bin/sh\necho hi\n")); code != 200 {
+		t.Fatalf("overwrite: status %d", code)
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "run.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh mode after overwrite = %v, %v", info.Mode(), err)
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "media/big.bin")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("new file mode = %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// serveDirectoryListing renders the entries of dirPath, a directory inside
+// the static root served at urlPath. Browsers get an HTML page, clients that
+// ask for application/json get a FileInfo array with paths relative to the
+// static root. Symlinks are listed as what they point to, and left out if
+// that's outside root, so the listing never leads out of the static root.
+func serveDirectoryListing(w http.ResponseWriter, r *http.Request, root, dirPath, urlPath string) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	urlPath = path.Clean("/" + urlPath)
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err = symlinkInRoot(root, filepath.Join(dirPath, entry.Name()))
+		}
+		if err != nil {
+			// Entry vanished between ReadDir and Info, or leads outside
+			continue
+		}
+		// Links are listed as what they point to, under their own name
+		file := newFileInfo(strings.TrimPrefix(path.Join(urlPath, entry.Name()), "/"), info)
+		file.Name = entry.Name()
+		file.IsSymlink = entry.Type()&fs.ModeSymlink != 0
+		files = append(files, file)
+	}
+
+	// Directories first, then alphabetical
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+		return files[i].Name < files[j].Name
+	})
+
+	w.Header().Set("Vary", "Accept")
+	if negotiate(r.Header.Get("Accept"), "text/html", "application/json") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+		return
+	}
+
+	var rows strings.Builder
+	if urlPath != "/" {
+		rows.WriteString(`<tr><td><a href="../">../</a></td><td class="size"></td></tr>`)
+	}
+	for _, f := range files {
+		name, size := f.Name, formatBytes(f.Size)
+		if f.IsDir {
+			name, size = name+"/", ""
+		}
+		href := (&url.URL{Path: path.Join(urlPath, f.Name)}).String()
+		if f.IsDir {
+			href += "/"
+		}
+		fmt.Fprintf(&rows, `<tr><td><a href="%s">%s</a></td><td class="size">%s</td></tr>`,
+			html.EscapeString(href), html.EscapeString(name), size)
+	}
+
+	title := "Index of " + urlPath
+	body := fmt.Sprintf(`<h1>%s</h1>
+        <table class="listing">%s</table>`, html.EscapeString(title), rows.String())
+	servePage(w, http.StatusOK, html.EscapeString(title), body)
+}
+
+// errOutsideRoot is returned for symlinks that resolve outside the static root
+var errOutsideRoot = errors.New("symlink target is outside the static root")
+
+// symlinkInRoot stats the target of the symlink at linkPath, as long as it
+// resolves to somewhere inside root
+func symlinkInRoot(root, linkPath string) (os.FileInfo, error) {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	target, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return nil, err
+	}
+	if !pathWithin(target, resolvedRoot) {
+		return nil, errOutsideRoot
+	}
+	return os.Stat(target)
+}
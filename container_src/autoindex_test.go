@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirectoryListingNegotiation(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":         `{"static": ".", "autoIndex": true}`,
+		"files/readme.txt":    "hello",
+		"files/sub/inner.txt": "inner",
+	})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{"browser", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html"},
+		{"explicit html", "text/html", "text/html"},
+		{"no accept header", "", "text/html"},
+		{"json", "application/json", "application/json"},
+		{"json preferred", "text/html;q=0.5, application/json", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/files/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+
+			if w.Code != 200 {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, tt.wantContentType) {
+				t.Fatalf("content-type = %q, want %q", ct, tt.wantContentType)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("vary = %q, want %q", vary, "Accept")
+			}
+
+			if tt.wantContentType == "application/json" {
+				var files []FileInfo
+				if err := json.Unmarshal(w.Body.Bytes(), &files); err != nil {
+					t.Fatal(err)
+				}
+				if len(files) != 2 {
+					t.Fatalf("got %d entries, want 2: %+v", len(files), files)
+				}
+				want := []FileInfo{
+					{Path: "files/sub", Name: "sub", IsDir: true, Size: files[0].Size, Perm: "0755", ModTime: files[0].ModTime},
+					{Path: "files/readme.txt", Name: "readme.txt", Size: 5, Perm: "0644", ModTime: files[1].ModTime},
+				}
+				for i := range want {
+					if files[i].ModTime.IsZero() {
+						t.Errorf("entry %d has no mtime", i)
+					}
+					if files[i] != want[i] {
+						t.Errorf("entry %d = %+v, want %+v", i, files[i], want[i])
+					}
+				}
+				return
+			}
+
+			body := w.Body.String()
+			for _, want := range []string{`href="/files/sub/"`, `href="/files/readme.txt"`, `href="../"`} {
+				if !strings.Contains(body, want) {
+					t.Errorf("body doesn't contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectoryListingLinks(t *testing.T) {
+	tmpDir, outside, mounted := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTestFiles(t, outside, map[string]string{"secret.txt": "secret"})
+	writeTestFiles(t, mounted, map[string]string{"guide/intro.txt": "intro"})
+	t.Setenv(mountsEnv, `[{"prefix": "docs", "path": "`+mounted+`"}]`)
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":             `{"static": "site", "autoIndex": true}`,
+		"site/files/readme.txt":   "hello",
+		"site/files/a b#1?.txt":   "odd name",
+		"site/files/zz/inner.txt": "inner",
+	})
+	for link, target := range map[string]string{
+		"site/files/inside":  filepath.Join(tmpDir, "site/files/readme.txt"),
+		"site/files/outside": outside,
+		"site/files/dangles": filepath.Join(tmpDir, "nope"),
+	} {
+		if err := os.Symlink(target, filepath.Join(tmpDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useDataDir(t, tmpDir)
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		handleHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Fatalf("GET %s: status = %d", path, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	body := get("/files/")
+	for _, want := range []string{
+		`href="/files/a%20b%231%3F.txt"`,
+		`a b#1?.txt`,
+		`href="/files/inside">inside</a></td><td class="size">5 B`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing doesn't contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"outside", "dangles"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("listing includes %q", unwanted)
+		}
+	}
+	// Directories first, then alphabetical
+	if dir, file := strings.Index(body, "zz/"), strings.Index(body, "a b#1?.txt"); dir > file {
+		t.Error("directories aren't listed first")
+	}
+
+	// Mounted directories link under their prefix
+	if body := get("/docs/"); !strings.Contains(body, `href="/docs/guide/"`) {
+		t.Errorf("mount listing = %q", body)
+	}
+
+	// Off by default
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "site"}`})
+	useDataDir(t, tmpDir)
+	w := httptest.NewRecorder()
+	handleHTTP(w, httptest.NewRequest("GET", "/files/", nil))
+	if w.Code != 404 {
+		t.Errorf("without autoIndex: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"container/list"
+	"expvar"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxFileSize = 64 * 1024        // 64 KB
+	defaultCacheMaxBytes    = 16 * 1024 * 1024 // 16 MB
+)
+
+// Static file cache metrics, exposed at /debug/vars
+var (
+	staticCacheHits   = expvar.NewInt("static_cache_hits")
+	staticCacheMisses = expvar.NewInt("static_cache_misses")
+	staticFileReads   = expvar.NewInt("static_file_reads")
+)
+
+// CacheConfig controls the in-memory cache for small static files
+type CacheConfig struct {
+	MaxFileSize int64 `json:"maxFileSize"` // Largest file (in bytes) eligible for caching
+	MaxBytes    int64 `json:"maxBytes"`    // Total cache budget in bytes
+}
+
+// DropPageCacheConfig makes large static files bypass the kernel page
+// cache by advising it (posix_fadvise DONTNEED) to drop their pages once
+// served. This keeps big, rarely requested files from evicting everything
+// else on a memory-constrained container, at the cost of re-reading them
+// from the mount (i.e. from S3) every time. Filesystems that ignore the
+// hint behave as if this were off.
+type DropPageCacheConfig struct {
+	MinBytes int64 `json:"minBytes"` // Only files at least this big, default 1 MB
+}
+
+const defaultDropPageCacheMinBytes = 1024 * 1024 // 1 MB
+
+// applies reports whether a file of the given size should skip the page cache
+func (c *DropPageCacheConfig) applies(size int64) bool {
+	if c == nil {
+		return false
+	}
+	minBytes := c.MinBytes
+	if minBytes <= 0 {
+		minBytes = defaultDropPageCacheMinBytes
+	}
+	return size >= minBytes
+}
+
+// cacheEntry is a cached file's content along with the stat data it was read at
+type cacheEntry struct {
+	path    string
+	content []byte
+	modTime time.Time
+	size    int64
+}
+
+// fileCache is an LRU cache of file contents keyed by absolute path
+type fileCache struct {
+	mu          sync.Mutex
+	ll          *list.List
+	items       map[string]*list.Element
+	used        int64
+	maxFileSize int64
+	maxBytes    int64
+}
+
+var staticCache = newFileCache()
+
+func newFileCache() *fileCache {
+	return &fileCache{
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// configure applies limits from config, evicting as needed. A nil config
+// disables the cache and drops everything in it.
+func (c *fileCache) configure(cfg *CacheConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cfg == nil {
+		c.maxFileSize, c.maxBytes = 0, 0
+	} else {
+		c.maxFileSize, c.maxBytes = cfg.MaxFileSize, cfg.MaxBytes
+		if c.maxFileSize <= 0 {
+			c.maxFileSize = defaultCacheMaxFileSize
+		}
+		if c.maxBytes <= 0 {
+			c.maxBytes = defaultCacheMaxBytes
+		}
+	}
+	c.evict()
+}
+
+// get returns cached content if it's still current for the given stat info
+func (c *fileCache) get(path string, info os.FileInfo) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+		// Stale, the file changed since we cached it
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.content, true
+}
+
+// add stores content for path if it fits under the configured limits
+func (c *fileCache) add(path string, info os.FileInfo, content []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := int64(len(content))
+	if size > c.maxFileSize || size > c.maxBytes {
+		return
+	}
+	if el, ok := c.items[path]; ok {
+		c.remove(el)
+	}
+	c.items[path] = c.ll.PushFront(&cacheEntry{
+		path:    path,
+		content: content,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	})
+	c.used += size
+	c.evict()
+}
+
+// evict drops least recently used entries until we're within budget
+func (c *fileCache) evict() {
+	for c.used > c.maxBytes {
+		el := c.ll.Back()
+		if el == nil {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+func (c *fileCache) remove(el *list.Element) {
+	entry := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, entry.path)
+	c.used -= int64(len(entry.content))
+}
+
+// readStaticFile reads a file, serving it from the in-memory cache when
+// enabled. info is the stat result the caller already has for path, so a
+// cache hit doesn't touch the filesystem at all.
+func readStaticFile(path string, info os.FileInfo, config *Config) ([]byte, error) {
+	staticCache.configure(config.Cache)
+	if config.Cache != nil {
+		if content, ok := staticCache.get(path, info); ok {
+			staticCacheHits.Add(1)
+			return content, nil
+		}
+		staticCacheMisses.Add(1)
+	}
+
+	staticFileReads.Add(1)
+	content, err := readFile(path, config.DropPageCache.applies(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Cache != nil {
+		staticCache.add(path, info, content)
+	}
+	return content, nil
+}
+
+// readFile reads a whole file like os.ReadFile, optionally asking the
+// kernel to drop it from the page cache afterwards
+func readFile(path string, dropCache bool) ([]byte, error) {
+	if !dropCache {
+		return os.ReadFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	dropPageCache(f)
+	return content, nil
+}
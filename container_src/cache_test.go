@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticFileCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "cache": {"maxFileSize": 100, "maxBytes": 250}}`,
+		"a.txt":       strings.Repeat("a", 100),
+		"b.txt":       strings.Repeat("b", 100),
+		"c.txt":       strings.Repeat("c", 100),
+		"big.txt":     strings.Repeat("x", 101),
+	})
+	useDataDir(t, tmpDir)
+	t.Cleanup(func() { staticCache.configure(nil) })
+
+	get := func(path string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Fatalf("GET %s: status = %d, want 200", path, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// expectReads runs fn and checks how many times the filesystem was read
+	expectReads := func(name string, want int64, fn func()) {
+		t.Helper()
+		before := staticFileReads.Value()
+		fn()
+		if got := staticFileReads.Value() - before; got != want {
+			t.Errorf("%s: file reads = %d, want %d", name, got, want)
+		}
+	}
+
+	expectReads("first request", 1, func() { get("/a.txt") })
+	expectReads("cache hit", 0, func() { get("/a.txt") })
+	expectReads("over size threshold", 2, func() {
+		get("/big.txt")
+		get("/big.txt")
+	})
+
+	// Modifying the file must invalidate the cached copy
+	aPath := filepath.Join(tmpDir, "a.txt")
+	if err := os.WriteFile(aPath, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(aPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	expectReads("after modification", 1, func() {
+		if body := get("/a.txt"); body != "changed" {
+			t.Errorf("body = %q, want %q", body, "changed")
+		}
+	})
+
+	// a.txt (7 bytes) + b.txt + c.txt fits the 250 byte budget, but a
+	// fourth 100 byte entry pushes out the least recently used
+	expectReads("fill cache", 2, func() {
+		get("/b.txt")
+		get("/c.txt")
+	})
+	expectReads("all cached", 0, func() {
+		get("/a.txt")
+		get("/b.txt")
+		get("/c.txt")
+	})
+	if err := os.WriteFile(filepath.Join(tmpDir, "d.txt"), []byte(strings.Repeat("d", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectReads("evict oldest", 2, func() {
+		get("/d.txt") // evicts a.txt
+		get("/a.txt")
+	})
+	if staticCache.used > 250 {
+		t.Errorf("cache uses %d bytes, budget is 250", staticCache.used)
+	}
+}
+
+func BenchmarkStaticFileCache(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		config string
+	}{
+		{"uncached", `{"static": "."}`},
+		{"cached", `{"static": ".", "cache": {}}`},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			tmpDir := b.TempDir()
+			writeTestFiles(b, tmpDir, map[string]string{
+				"config.json": bc.config,
+				"index.html":  strings.Repeat("<p>hello</p>", 100),
+			})
+			useDataDir(b, tmpDir)
+			b.Cleanup(func() { staticCache.configure(nil) })
+
+			before := staticFileReads.Value()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					w := httptest.NewRecorder()
+					handleHTTP(w, httptest.NewRequest("GET", "/", nil))
+				}
+			})
+			b.ReportMetric(float64(staticFileReads.Value()-before)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func TestDropPageCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	large := strings.Repeat("0123456789", 20000)
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "dropPageCache": {"minBytes": 1000}}`,
+		"large.bin":   large,
+		"small.txt":   "small",
+	})
+	useDataDir(t, tmpDir)
+
+	for path, want := range map[string]string{"/large.bin": large, "/small.txt": "small"} {
+		w := httptest.NewRecorder()
+		handleHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Fatalf("GET %s: status = %d, want 200", path, w.Code)
+		}
+		if w.Body.String() != want {
+			t.Errorf("GET %s: got %d bytes, want %d", path, w.Body.Len(), len(want))
+		}
+	}
+}
+
+func BenchmarkDropPageCache(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		config string
+	}{
+		{"default", `{"static": "."}`},
+		{"dropPageCache", `{"static": ".", "dropPageCache": {}}`},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			tmpDir := b.TempDir()
+			writeTestFiles(b, tmpDir, map[string]string{
+				"config.json": bc.config,
+				"large.bin":   strings.Repeat("x", 4*1024*1024),
+			})
+			useDataDir(b, tmpDir)
+
+			b.ResetTimer()
+			for range b.N {
+				w := httptest.NewRecorder()
+				handleHTTP(w, httptest.NewRequest("GET", "/large.bin", nil))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// defaultNoCache lists files that break PWAs when cached aggressively: a
+// stale service worker or manifest can pin users to an old site for good
+var defaultNoCache = []string{
+	"sw.js",
+	"service-worker.js",
+	"serviceworker.js",
+	"manifest.json",
+	"manifest.webmanifest",
+	"site.webmanifest",
+}
+
+// CacheControlConfig sets the Cache-Control header on static files. The
+// first rule that matches wins, in this order:
+//
+//  1. NoCache: matching files always get "no-cache"
+//  2. Config.ImmutablePaths: a year-long immutable policy
+//  3. ByType: by file extension (".js") or MIME type ("text/html")
+//  4. Default
+//
+// so a "public, max-age=31536000, immutable" default or ".js" rule never
+// applies to sw.js. Files matching no rule get no Cache-Control header.
+type CacheControlConfig struct {
+	Default string            `json:"default,omitempty"`
+	ByType  map[string]string `json:"byType,omitempty"`
+	// NoCache patterns (path.Match syntax) are matched against the file
+	// name, or against the path within the static directory if they
+	// contain a "/". Replaces the built-in list when set, so [] turns it off.
+	NoCache []string `json:"noCache,omitempty"`
+}
+
+// noCachePatterns returns the configured no-cache list, or the defaults
+func (c *CacheControlConfig) noCachePatterns() []string {
+	if c == nil || c.NoCache == nil {
+		return defaultNoCache
+	}
+	return c.NoCache
+}
+
+// immutableCacheControl is for files whose names include a content hash,
+// so a given URL's content never changes
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// staticCacheControl returns the Cache-Control value for a static file,
+// given its path relative to the static directory and its MIME type. The
+// no-cache list wins, then ImmutablePaths, then the CacheControl rules.
+func (c *Config) staticCacheControl(relPath, mimeType string) string {
+	relPath = strings.TrimPrefix(path.Clean("/"+relPath), "/")
+	if c.CacheControl.noCache(relPath) {
+		return "no-cache"
+	}
+	for _, pattern := range c.ImmutablePaths {
+		if matchPathGlob(pattern, relPath) {
+			return immutableCacheControl
+		}
+	}
+	return c.CacheControl.rule(relPath, mimeType)
+}
+
+// noCache reports whether relPath is on the no-cache list
+func (c *CacheControlConfig) noCache(relPath string) bool {
+	for _, pattern := range c.noCachePatterns() {
+		subject := path.Base(relPath)
+		if strings.Contains(pattern, "/") {
+			subject = relPath
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rule returns the ByType or Default value for a file
+func (c *CacheControlConfig) rule(relPath, mimeType string) string {
+	if c == nil {
+		return ""
+	}
+	if value, ok := c.ByType[strings.ToLower(path.Ext(relPath))]; ok {
+		return value
+	}
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	if value, ok := c.ByType[strings.TrimSpace(mediaType)]; ok {
+		return value
+	}
+	return c.Default
+}
+
+// matchPathGlob matches a path within the static directory against a
+// pattern in path.Match syntax, where a trailing "/**" (or just "/")
+// matches everything below a directory: "/assets/**", "assets/",
+// "/js/*.js"
+func matchPathGlob(pattern, relPath string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		pattern = dir + "/"
+	}
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		if ok, _ := path.Match(dir, relPath); ok {
+			return true
+		}
+		for p := path.Dir(relPath); p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(dir, p); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(pattern, relPath)
+	return ok
+}
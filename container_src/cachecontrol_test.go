@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCacheControl(t *testing.T) {
+	immutable := `"default": "public, max-age=31536000, immutable"`
+	tests := []struct {
+		name   string
+		config string
+		path   string
+		want   string
+	}{
+		{name: "no config leaves other files alone", config: `{"static": "."}`, path: "/app.js", want: ""},
+		{name: "built-in list applies without config", config: `{"static": "."}`, path: "/sw.js", want: "no-cache"},
+		{name: "sw.js beats immutable default", config: `{"static": ".", "cacheControl": {` + immutable + `}}`, path: "/sw.js", want: "no-cache"},
+		{name: "sw.js beats .js type rule", config: `{"static": ".", "cacheControl": {"byType": {".js": "max-age=31536000, immutable"}}}`, path: "/sw.js", want: "no-cache"},
+		{name: "nested manifest", config: `{"static": ".", "cacheControl": {` + immutable + `}}`, path: "/pwa/manifest.json", want: "no-cache"},
+		{name: "default applies", config: `{"static": ".", "cacheControl": {` + immutable + `}}`, path: "/app.js", want: "public, max-age=31536000, immutable"},
+		{name: "type by extension beats default", config: `{"static": ".", "cacheControl": {` + immutable + `, "byType": {".html": "no-store"}}}`, path: "/index.html", want: "no-store"},
+		{name: "type by mime type", config: `{"static": ".", "cacheControl": {"byType": {"text/css": "max-age=60"}}}`, path: "/style.css", want: "max-age=60"},
+		{name: "directory index", config: `{"static": ".", "cacheControl": {"byType": {".html": "no-store"}}}`, path: "/", want: "no-store"},
+		{name: "custom list replaces built-in", config: `{"static": ".", "cacheControl": {` + immutable + `, "noCache": ["*.html"]}}`, path: "/sw.js", want: "public, max-age=31536000, immutable"},
+		{name: "custom pattern", config: `{"static": ".", "cacheControl": {` + immutable + `, "noCache": ["*.html"]}}`, path: "/index.html", want: "no-cache"},
+		{name: "path pattern", config: `{"static": ".", "cacheControl": {` + immutable + `, "noCache": ["/pwa/*"]}}`, path: "/pwa/manifest.json", want: "no-cache"},
+		{name: "path pattern only matches its directory", config: `{"static": ".", "cacheControl": {` + immutable + `, "noCache": ["/pwa/*"]}}`, path: "/app.js", want: "public, max-age=31536000, immutable"},
+		{name: "empty list disables built-in", config: `{"static": ".", "cacheControl": {` + immutable + `, "noCache": []}}`, path: "/sw.js", want: "public, max-age=31536000, immutable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":       tt.config,
+				"index.html":        "<h1>hi</h1>",
+				"app.js":            "app",
+				"sw.js":             "self.addEventListener('fetch', () => {})",
+				"style.css":         "body {}",
+				"pwa/manifest.json": "{}",
+			})
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+
+			// Revalidations keep the policy
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			w = httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != 304 || w.Header().Get("Cache-Control") != tt.want {
+				t.Errorf("304: status = %d, Cache-Control = %q", w.Code, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestImmutablePaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		path   string
+		want   string
+	}{
+		{name: "matched directory", config: `{"static": ".", "immutablePaths": ["/assets/**"]}`, path: "/assets/app.3f9a1c.js", want: immutableCacheControl},
+		{name: "matched nested", config: `{"static": ".", "immutablePaths": ["/assets/**"]}`, path: "/assets/img/logo.ab12.png", want: immutableCacheControl},
+		{name: "trailing slash form", config: `{"static": ".", "immutablePaths": ["assets/"]}`, path: "/assets/img/logo.ab12.png", want: immutableCacheControl},
+		{name: "file glob", config: `{"static": ".", "immutablePaths": ["/assets/*.js"]}`, path: "/assets/app.3f9a1c.js", want: immutableCacheControl},
+		{name: "file glob doesn't recurse", config: `{"static": ".", "immutablePaths": ["/assets/*.js"]}`, path: "/assets/img/logo.ab12.png", want: ""},
+		{name: "unmatched", config: `{"static": ".", "immutablePaths": ["/assets/**"]}`, path: "/index.html", want: ""},
+		{name: "similar prefix unmatched", config: `{"static": ".", "immutablePaths": ["/assets/**"]}`, path: "/assets-old/app.js", want: ""},
+		{name: "beats type rule", config: `{"static": ".", "immutablePaths": ["/assets/**"], "cacheControl": {"byType": {".js": "max-age=60"}}}`, path: "/assets/app.3f9a1c.js", want: immutableCacheControl},
+		{name: "type rule for the rest", config: `{"static": ".", "immutablePaths": ["/assets/**"], "cacheControl": {"byType": {".html": "no-store"}}}`, path: "/index.html", want: "no-store"},
+		{name: "no-cache list still wins", config: `{"static": ".", "immutablePaths": ["/assets/**"]}`, path: "/assets/sw.js", want: "no-cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":              tt.config,
+				"index.html":               "<h1>hi</h1>",
+				"assets/app.3f9a1c.js":     "app",
+				"assets/sw.js":             "sw",
+				"assets/img/logo.ab12.png": "png",
+				"assets-old/app.js":        "old",
+			})
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileStat describes a file, including its timestamps
+type FileStat struct {
+	Path       string    `json:"path"`
+	IsDir      bool      `json:"isDir"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	AccessTime time.Time `json:"atime"`
+	Perm       string    `json:"perm"`      // Octal permissions, e.g. "0644"
+	IsSymlink  bool      `json:"isSymlink"` // The path is a symlink (the rest describes its target)
+}
+
+// fileTimestamp is a time from JSON, either an RFC 3339 string or Unix
+// seconds (fractions allowed)
+type fileTimestamp struct {
+	time.Time
+}
+
+func (t *fileTimestamp) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return fmt.Errorf("timestamp must be RFC 3339: %w", err)
+		}
+		t.Time = parsed
+		return nil
+	}
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return errors.New("timestamp must be an RFC 3339 string or Unix seconds")
+	}
+	whole, frac := math.Modf(seconds)
+	t.Time = time.Unix(int64(whole), int64(frac*1e9))
+	return nil
+}
+
+// ChtimesRequest sets a file's timestamps. Either may be left out to keep
+// its current value.
+type ChtimesRequest struct {
+	Path  string         `json:"path"`
+	MTime *fileTimestamp `json:"mtime,omitempty"`
+	ATime *fileTimestamp `json:"atime,omitempty"`
+}
+
+// statFile builds the FileStat for absPath
+func statFile(absPath string) (FileStat, error) {
+	linkInfo, err := os.Lstat(absPath)
+	if err != nil {
+		return FileStat{}, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return FileStat{}, err
+	}
+	return FileStat{
+		Path:       toRelativePath(absPath),
+		IsDir:      info.IsDir(),
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		AccessTime: accessTime(info),
+		Perm:       permString(info.Mode()),
+		IsSymlink:  linkInfo.Mode()&os.ModeSymlink != 0,
+	}, nil
+}
+
+// writeFileStat responds with absPath's FileStat
+func writeFileStat(w http.ResponseWriter, absPath string) {
+	stat, err := statFile(absPath)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stat)
+}
+
+// handleAPIFilesStat returns a file's size and timestamps (?path=)
+func handleAPIFilesStat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	absPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeFileStat(w, absPath)
+}
+
+// handleAPIFilesChtimes sets a file's mtime and/or atime, e.g. to restore
+// build timestamps after an upload, and returns the resulting FileStat
+func handleAPIFilesChtimes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ChtimesRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	if req.MTime == nil && req.ATime == nil {
+		http.Error(w, "mtime or atime is required", http.StatusBadRequest)
+		return
+	}
+	absPath, err := validateAndResolveWritePath(req.Path)
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mtime, atime := info.ModTime(), accessTime(info)
+	if req.MTime != nil {
+		mtime = req.MTime.Time
+	}
+	if req.ATime != nil {
+		atime = req.ATime.Time
+	}
+	if err := os.Chtimes(absPath, atime, mtime); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to set times: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeFileStat(w, absPath)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIFilesChtimes(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"src/app.js":  "app",
+	})
+	useDataDir(t, tmpDir)
+
+	mux := newServeMux(&Config{})
+	do := func(method, target, body string) (int, FileStat) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var stat FileStat
+		if w.Code == 200 {
+			if err := json.Unmarshal(w.Body.Bytes(), &stat); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, stat
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	// RFC 3339 mtime and Unix atime
+	code, stat := do("POST", "/api/files/chtimes",
+		`{"path": "src/app.js", "mtime": "2020-01-02T03:04:05Z", "atime": 1623053350}`)
+	if code != 200 || !stat.ModTime.Equal(mtime) || !stat.AccessTime.Equal(atime) {
+		t.Fatalf("chtimes: %d %+v", code, stat)
+	}
+
+	// Read back through stat
+	code, stat = do("GET", "/api/files/stat?path=src/app.js", "")
+	if code != 200 || stat.Path != "src/app.js" || stat.Size != 3 || stat.IsDir {
+		t.Fatalf("stat: %d %+v", code, stat)
+	}
+	if !stat.ModTime.Equal(mtime) || !stat.AccessTime.Equal(atime) {
+		t.Errorf("stat times = %v, %v; want %v, %v", stat.ModTime, stat.AccessTime, mtime, atime)
+	}
+	if stat.Perm != "0644" || stat.IsSymlink {
+		t.Errorf("stat perm = %q, symlink = %v", stat.Perm, stat.IsSymlink)
+	}
+
+	// Symlinks are flagged, and otherwise describe their target
+	if err := os.Symlink("app.js", filepath.Join(tmpDir, "src/link.js")); err != nil {
+		t.Fatal(err)
+	}
+	if code, stat := do("GET", "/api/files/stat?path=src/link.js", ""); code != 200 || !stat.IsSymlink || stat.Size != 3 || stat.Perm != "0644" {
+		t.Errorf("symlink stat: %d %+v", code, stat)
+	}
+
+	// Setting only one keeps the other
+	code, stat = do("POST", "/api/files/chtimes", `{"path": "src/app.js", "mtime": 1700000000.5}`)
+	if code != 200 || !stat.ModTime.Equal(time.Unix(1700000000, 5e8)) || !stat.AccessTime.Equal(atime) {
+		t.Errorf("mtime only: %d %+v", code, stat)
+	}
+
+	// Directories work too
+	if code, stat := do("POST", "/api/files/chtimes", `{"path": "src", "mtime": "2020-01-02T03:04:05Z"}`); code != 200 || !stat.IsDir || !stat.ModTime.Equal(mtime) {
+		t.Errorf("directory: %d %+v", code, stat)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"no times", "POST", "/api/files/chtimes", `{"path": "src/app.js"}`, 400},
+		{"no path", "POST", "/api/files/chtimes", `{"mtime": 0}`, 400},
+		{"bad time", "POST", "/api/files/chtimes", `{"path": "src/app.js", "mtime": "yesterday"}`, 400},
+		{"outside sandbox", "POST", "/api/files/chtimes", `{"path": "../etc/passwd", "mtime": 0}`, 400},
+		{"missing", "POST", "/api/files/chtimes", `{"path": "nope.js", "mtime": 0}`, 404},
+		{"under a file", "POST", "/api/files/chtimes", `{"path": "src/app.js/x", "mtime": 0}`, 404},
+		{"wrong method", "GET", "/api/files/chtimes", "", 405},
+		{"stat missing", "GET", "/api/files/stat?path=nope.js", "", 404},
+		{"stat outside sandbox", "GET", "/api/files/stat?path=../etc", "", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := do(tt.method, tt.target, tt.body); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
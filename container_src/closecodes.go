@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Terminal sessions (/ws) end with a close code saying why, so the client
+// can decide whether to reconnect:
+//
+//   - 1000 (normal closure): the shell exited by itself, e.g. the user
+//     typed exit. The reason is "exit status N". Reconnecting starts a new
+//     shell, so it's best left to the user. A connection replaced by a
+//     reconnect to its session (see resume.go) also gets 1000.
+//   - 1008 (policy violation): the session hit terminal.maxSessionDuration,
+//     see sessionlimit.go. Also best left to the user.
+//   - 1012 (service restart): the server is shutting down. Reconnect after
+//     a short wait.
+//   - 1013 (try again later): the session is connected elsewhere (another
+//     tab, say), see attach in resume.go. Best left to the user, who can
+//     take it over with ?takeover=true.
+//   - 4000 (closeTerminalError): the PTY failed, or the shell was killed
+//     by a signal. The reason has the details. Reconnect.
+//
+// A connection that drops without a close frame (1006 in browsers) means
+// the server or the network went away, and is worth reconnecting too.
+// Viewers get the same code as the session's owner.
+const closeTerminalError = 4000
+
+// closeWriteWait bounds how long sending a close frame can take
+const closeWriteWait = time.Second
+
+// liveSessions holds every running terminal session, so they can all be
+// closed on shutdown. Unlike terminalSessions, sessions sharing a name are
+// all here.
+var liveSessions = struct {
+	sync.Mutex
+	set map[*ptySession]struct{}
+}{set: make(map[*ptySession]struct{})}
+
+// trackSession adds session to liveSessions, returning a func that removes
+// it again
+func trackSession(session *ptySession) func() {
+	liveSessions.Lock()
+	liveSessions.set[session] = struct{}{}
+	liveSessions.Unlock()
+	return func() {
+		liveSessions.Lock()
+		defer liveSessions.Unlock()
+		delete(liveSessions.set, session)
+	}
+}
+
+// shutdownReason is the close frame reason for sessions ended because the
+// server is stopping
+const shutdownReason = "server shutting down"
+
+// endAllSessions ends every running terminal session with a service
+// restart close code, before the server exits. Shells are hung up first
+// and get hangupWait to exit by themselves.
+func endAllSessions() {
+	liveSessions.Lock()
+	sessions := make([]*ptySession, 0, len(liveSessions.set))
+	for session := range liveSessions.set {
+		sessions = append(sessions, session)
+	}
+	liveSessions.Unlock()
+
+	for _, session := range sessions {
+		session.hangUp()
+	}
+	deadline := time.After(hangupWait)
+wait:
+	for _, session := range sessions {
+		if session.done == nil {
+			continue
+		}
+		select {
+		case <-session.done:
+		case <-deadline:
+			break wait
+		}
+	}
+	for _, session := range sessions {
+		session.end(websocket.CloseServiceRestart, shutdownReason)
+	}
+}
+
+// shellExitClose picks the close code and reason for a shell that has
+// exited, from its Wait result
+func shellExitClose(state *os.ProcessState) (int, string) {
+	if state == nil {
+		return closeTerminalError, "shell failed"
+	}
+	if !state.Exited() {
+		return closeTerminalError, state.String() // e.g. "signal: killed"
+	}
+	return websocket.CloseNormalClosure, state.String() // "exit status N"
+}
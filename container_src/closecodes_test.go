@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readClose reads until the connection closes, returning its close frame
+func readClose(t *testing.T, ws *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("closed without a close frame: %v", err)
+		}
+		return closeErr
+	}
+}
+
+func TestTerminalCloseCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string // Typed once the shell is ready; "" ends the session via shutdown
+		wantCode   int
+		wantReason string
+	}{
+		{name: "shell exits", input: "exit 3\n", wantCode: websocket.CloseNormalClosure, wantReason: "exit status 3"},
+		{name: "shell killed", input: "kill -9 $$\n", wantCode: closeTerminalError, wantReason: "signal: killed"},
+		{name: "server shutdown", wantCode: websocket.CloseServiceRestart, wantReason: "server shutting down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+			useDataDir(t, tmpDir)
+			ws := dialTerminal(t)
+
+			// The quotes keep the marker out of the echoed command line
+			ws.WriteMessage(websocket.TextMessage, []byte("echo RE''ADY\n"))
+			readUntil(t, ws, "READY")
+			if tt.input != "" {
+				ws.WriteMessage(websocket.TextMessage, []byte(tt.input))
+			} else {
+				endAllSessions()
+			}
+
+			closeErr := readClose(t, ws)
+			if closeErr.Code != tt.wantCode || closeErr.Text != tt.wantReason {
+				t.Errorf("close = %d %q, want %d %q", closeErr.Code, closeErr.Text, tt.wantCode, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestTerminalCloseShellFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	t.Setenv("SHELL", "/nonexistent/shell")
+
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer server.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	closeErr := readClose(t, ws)
+	if closeErr.Code != closeTerminalError || closeErr.Text != "failed to start shell" {
+		t.Errorf("close = %d %q", closeErr.Code, closeErr.Text)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultCompressionMinBytes = 1024             // 1 KB
+	defaultCompressionMaxBytes = 10 * 1024 * 1024 // 10 MB
+)
+
+// CompressionConfig tunes on-the-fly compression of text files for clients
+// that accept it, which is on by default. Files under MinBytes aren't worth
+// it (the encoding's overhead eats the savings), and files over MaxBytes
+// would tie up the request compressing them, so both are served as-is.
+// Precompressed sidecars cost nothing to serve, so they only honour
+// MinBytes, and only when it's configured.
+//
+// Encodings lists the encodings to compress with, most preferred first
+// (zstd then gzip by default). The client's q-values still come first; the
+// order only breaks ties. There's no brotli: nobody has a Go encoder worth
+// running per request, but a precompressed sidecar gets most of the benefit.
+type CompressionConfig struct {
+	Enabled   *bool    `json:"enabled,omitempty"`   // Default true
+	MinBytes  int64    `json:"minBytes,omitempty"`  // Default 1 KB
+	MaxBytes  int64    `json:"maxBytes,omitempty"`  // Default 10 MB
+	Encodings []string `json:"encodings,omitempty"` // Default ["zstd", "gzip"]
+}
+
+// compressionEncodings are the encodings files can be compressed with on
+// the fly, in the default order of preference
+var compressionEncodings = []string{"zstd", "gzip"}
+
+func (c *CompressionConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, encoding := range c.Encodings {
+		if !slices.Contains(compressionEncodings, encoding) {
+			return fmt.Errorf("compression.encodings: unsupported encoding %q (want %s)",
+				encoding, strings.Join(compressionEncodings, " or "))
+		}
+	}
+	return nil
+}
+
+func (c *CompressionConfig) encodings() []string {
+	if c == nil || len(c.Encodings) == 0 {
+		return compressionEncodings
+	}
+	return c.Encodings
+}
+
+// negotiateEncoding picks the configured encoding the request prefers, or
+// "" if it accepts none of them. Unlike other Accept headers, a missing
+// Accept-Encoding means identity only.
+func (c *CompressionConfig) negotiateEncoding(r *http.Request) string {
+	header := r.Header.Get("Accept-Encoding")
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+	return negotiate(header, c.encodings()...)
+}
+
+func (c *CompressionConfig) minBytes() int64 {
+	if c == nil || c.MinBytes <= 0 {
+		return defaultCompressionMinBytes
+	}
+	return c.MinBytes
+}
+
+func (c *CompressionConfig) maxBytes() int64 {
+	if c == nil || c.MaxBytes <= 0 {
+		return defaultCompressionMaxBytes
+	}
+	return c.MaxBytes
+}
+
+// compresses reports whether a file of the given size and MIME type
+// should be compressed on the fly
+func (c *CompressionConfig) compresses(size int64, mimeType string) bool {
+	enabled := c == nil || c.Enabled == nil || *c.Enabled
+	return enabled && size >= c.minBytes() && size <= c.maxBytes() && compressibleType(mimeType)
+}
+
+// servesSidecar reports whether a precompressed sidecar should be used for
+// a file of the given size (always, without a compression config)
+func (c *CompressionConfig) servesSidecar(size int64) bool {
+	return c == nil || size >= c.minBytes()
+}
+
+// compressibleType reports whether a MIME type is text-like. Images, video
+// and archives are already compressed.
+func compressibleType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.TrimSpace(mimeType)
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml") {
+		return true
+	}
+	switch mimeType {
+	case "application/javascript", "application/json", "application/xml",
+		"application/wasm", "image/svg+xml", "application/manifest+json",
+		"application/x-ndjson", "application/ndjson":
+		return true
+	}
+	return false
+}
+
+// compressStaticFile compresses a static file's content, keeping the result
+// in the static file cache (when enabled) next to the identity version, so
+// a popular bundle is only compressed once per change and encoding
+func compressStaticFile(path string, info os.FileInfo, content []byte, encoding string, config *Config) ([]byte, error) {
+	key := path + "\x00" + encoding
+	if config.Cache != nil {
+		if compressed, ok := staticCache.get(key, info); ok {
+			return compressed, nil
+		}
+	}
+	var compressed []byte
+	var err error
+	switch encoding {
+	case "gzip":
+		compressed, err = gzipBytes(content)
+	case "zstd":
+		compressed = zstdEncoder().EncodeAll(content, nil)
+	default:
+		err = fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Cache != nil {
+		staticCache.add(key, info, compressed)
+	}
+	return compressed, nil
+}
+
+// zstdEncoder is shared by every request; EncodeAll is safe to call
+// concurrently
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err) // Only fails on bad options
+	}
+	return enc
+})
+
+// gzipBytes compresses content in memory
+func gzipBytes(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressionThresholds(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "precompressed": true, "compression": {"minBytes": 100, "maxBytes": 200}}`,
+		"under.js":    strings.Repeat("a", 99),
+		"min.js":      strings.Repeat("a", 100),
+		"max.js":      strings.Repeat("a", 200),
+		"over.js":     strings.Repeat("a", 201),
+		"image.png":   strings.Repeat("a", 150),
+		"tiny.css":    strings.Repeat("a", 10),
+		"tiny.css.gz": "fake gzip bytes",
+		"big.css":     strings.Repeat("a", 300),
+		"big.css.gz":  "fake gzip bytes",
+	})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		path          string
+		wantGzip      bool
+		wantVary      bool
+		precompressed bool
+	}{
+		{path: "/under.js"},
+		{path: "/min.js", wantGzip: true, wantVary: true},
+		{path: "/max.js", wantGzip: true, wantVary: true},
+		{path: "/over.js"},
+		{path: "/image.png"},
+		// Sidecars skip the minimum, but not the maximum
+		{path: "/tiny.css"},
+		{path: "/big.css", wantGzip: true, wantVary: true, precompressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != 200 {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Errorf("gzipped = %v, want %v", got, tt.wantGzip)
+			}
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("vary = %q", w.Header().Get("Vary"))
+			}
+			if tt.wantGzip && !tt.precompressed {
+				zr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(zr)
+				if len(body) < 100 || strings.Trim(string(body), "a") != "" {
+					t.Errorf("decompressed body = %q", body)
+				}
+			}
+		})
+	}
+
+	// Clients that don't accept gzip get identity, with a distinct ETag
+	identity := httptest.NewRecorder()
+	handleHTTP(identity, httptest.NewRequest("GET", "/min.js", nil))
+	gz := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/min.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handleHTTP(gz, req)
+	if identity.Header().Get("Content-Encoding") != "" || identity.Body.Len() != 100 {
+		t.Errorf("identity: encoding = %q, %d bytes", identity.Header().Get("Content-Encoding"), identity.Body.Len())
+	}
+	if identity.Header().Get("ETag") == gz.Header().Get("ETag") {
+		t.Error("gzip and identity share an ETag")
+	}
+}
+
+func TestCompressionDefaults(t *testing.T) {
+	var c CompressionConfig
+	if c.minBytes() != 1024 || c.maxBytes() != 10*1024*1024 {
+		t.Errorf("defaults = %d..%d", c.minBytes(), c.maxBytes())
+	}
+	// On by default, with the default thresholds
+	var unset *CompressionConfig
+	if !unset.compresses(4096, "text/html") || unset.compresses(512, "text/html") {
+		t.Error("without a config: want gzip for text over 1 KB only")
+	}
+	disabled := false
+	off := &CompressionConfig{Enabled: &disabled}
+	if off.compresses(4096, "text/html") {
+		t.Error("compressing with enabled: false")
+	}
+}
+
+func TestCompressionByDefault(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundle := strings.Repeat("console.log('hello');\n", 200)
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "cache": {}}`,
+		"app.js":      bundle,
+	})
+	useDataDir(t, tmpDir)
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set("Accept-Encoding", "br, gzip")
+		w := httptest.NewRecorder()
+		handleHTTP(w, req)
+		return w
+	}
+	w := get()
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("encoding = %q, vary = %q", w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Content-Length = %s, body is %d bytes", got, w.Body.Len())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != bundle {
+		t.Errorf("decompressed body doesn't match")
+	}
+
+	// The compressed variant comes out of the static cache the second time
+	hits := staticCacheHits.Value()
+	if w := get(); w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("second request not gzipped")
+	}
+	if staticCacheHits.Value() == hits {
+		t.Error("second request missed the cache")
+	}
+
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "compression": {"enabled": false}}`,
+	})
+	useDataDir(t, tmpDir)
+	if w := get(); w.Header().Get("Content-Encoding") != "" || w.Body.String() != bundle {
+		t.Errorf("enabled: false: encoding = %q", w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressionZstd(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundle := strings.Repeat("console.log('hello');\n", 200)
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":            `{"static": "."}`,
+		"app.js":                 bundle,
+		"gzip-first/config.json": `{"static": ".", "compression": {"encodings": ["gzip", "zstd"]}}`,
+		"gzip-first/app.js":      bundle,
+	})
+
+	tests := []struct {
+		name           string
+		dir            string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{name: "zstd preferred by default", dir: tmpDir, acceptEncoding: "gzip, deflate, br, zstd", wantEncoding: "zstd"},
+		{name: "zstd only", dir: tmpDir, acceptEncoding: "zstd", wantEncoding: "zstd"},
+		{name: "gzip only", dir: tmpDir, acceptEncoding: "gzip", wantEncoding: "gzip"},
+		{name: "client q-values win", dir: tmpDir, acceptEncoding: "zstd;q=0.5, gzip", wantEncoding: "gzip"},
+		{name: "zstd refused", dir: tmpDir, acceptEncoding: "zstd;q=0, *", wantEncoding: "gzip"},
+		{name: "config order breaks ties", dir: filepath.Join(tmpDir, "gzip-first"), acceptEncoding: "zstd, gzip", wantEncoding: "gzip"},
+		{name: "no Accept-Encoding", dir: tmpDir, wantEncoding: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDataDir(t, tt.dir)
+			req := httptest.NewRequest("GET", "/app.js", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != 200 {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("vary = %q", w.Header().Get("Vary"))
+			}
+			if tt.wantEncoding != "" && !strings.HasSuffix(w.Header().Get("ETag"), "-"+tt.wantEncoding+`"`) {
+				t.Errorf("ETag %s doesn't name the encoding", w.Header().Get("ETag"))
+			}
+
+			var body []byte
+			switch tt.wantEncoding {
+			case "zstd":
+				zr, err := zstd.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				body, err = io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ = io.ReadAll(zr)
+			default:
+				body = w.Body.Bytes()
+			}
+			if string(body) != bundle {
+				t.Errorf("decoded body doesn't match (%d bytes)", len(body))
+			}
+		})
+	}
+}
+
+func TestCompressionEncodingsValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "compression": {"encodings": ["zstd", "br"]}}`,
+	})
+	useDataDir(t, tmpDir)
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), `"br"`) {
+		t.Errorf("err = %v, want unsupported br", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigReloadMimeTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "mimeTypes": {".foo": "text/x-foo"}}`,
+		"data.foo":    "foo",
+		"page.md":     "# hi",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	contentType := func(path string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Header().Get("Content-Type")
+	}
+	reload := func() int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/config/reload", nil))
+		return w.Code
+	}
+	// Rewrite the config without changing its mtime, like a FUSE mount
+	// that hasn't caught up, so only an explicit reload picks it up
+	configPath := filepath.Join(tmpDir, "config.json")
+	rewrite := func(content string) {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(configPath, time.Now(), info.ModTime())
+	}
+
+	if got := contentType("/data.foo"); got != "text/x-foo; charset=utf-8" {
+		t.Fatalf("Content-Type = %q, want text/x-foo; charset=utf-8", got)
+	}
+
+	rewrite(`{"static": ".", "mimeTypes": {".foo": "application/x-foo", "md": "text/plain; charset=utf-8"}}`)
+	if got := contentType("/data.foo"); got != "text/x-foo; charset=utf-8" {
+		t.Fatalf("before reload: Content-Type = %q", got)
+	}
+	if code := reload(); code != 200 {
+		t.Fatalf("reload status = %d", code)
+	}
+	if got := contentType("/data.foo"); got != "application/x-foo" {
+		t.Errorf("after reload: Content-Type = %q, want application/x-foo", got)
+	}
+	if got := contentType("/page.md"); got != "text/plain; charset=utf-8" {
+		t.Errorf("extension without dot: Content-Type = %q", got)
+	}
+
+	// A broken config is rejected and the last good one stays in effect
+	rewrite(`{"static": ".", "mimeTypes": {`)
+	if code := reload(); code != 400 {
+		t.Errorf("invalid reload status = %d, want 400", code)
+	}
+	if got := contentType("/data.foo"); got != "application/x-foo" {
+		t.Errorf("after failed reload: Content-Type = %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/config/reload", nil))
+	if w.Code != 405 {
+		t.Errorf("GET status = %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// expandConfigEnv substitutes environment variables in the config's
+// strings, so secrets and per-deploy paths needn't be committed:
+//
+//   - "${VAR}" is VAR's value. An unset variable is "", which fails
+//     validation where a value is required (e.g. "static").
+//   - "${VAR:-default}" is default when VAR is unset or empty.
+//
+// Anything else with a "$" in it, like "$HOME" or "${not a name}", is left
+// as is, so a scheduled command that wants its shell to expand a variable
+// can write "$VAR". Variables are read when the config is loaded, so
+// changing one takes a config reload. data is JSON, after sanitizeJSONC.
+func expandConfigEnv(data []byte) []byte {
+	if !bytes.Contains(data, []byte("${")) {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if !inString {
+			inString = c == '"'
+			out = append(out, c)
+			continue
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inString = false
+		case c == '$':
+			if value, n, ok := expandEnvRef(data[i:]); ok {
+				out = append(out, value...)
+				i += n - 1
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// expandEnvRef expands the "${...}" reference at the start of s, if it is
+// one, returning its value (escaped for a JSON string) and length
+func expandEnvRef(s []byte) (value []byte, n int, ok bool) {
+	if !bytes.HasPrefix(s, []byte("${")) {
+		return nil, 0, false
+	}
+	end := bytes.IndexAny(s, `}"`)
+	if end < 0 || s[end] != '}' {
+		return nil, 0, false
+	}
+	ref := s[2:end]
+	name, fallback, hasFallback := bytes.Cut(ref, []byte(":-"))
+	if !isEnvName(name) {
+		return nil, 0, false
+	}
+	if v := os.Getenv(string(name)); v != "" || !hasFallback {
+		// Marshaling a string can't fail
+		quoted, _ := json.Marshal(v)
+		return quoted[1 : len(quoted)-1], end + 1, true
+	}
+	// The default is already part of the JSON string
+	return fallback, end + 1, true
+}
+
+// isEnvName reports whether name is a valid environment variable name
+func isEnvName(name []byte) bool {
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandConfigEnv(t *testing.T) {
+	t.Setenv("SITE_DIR", "dist")
+	t.Setenv("QUOTED", `a"b\c`)
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"variable", `{"static": "${SITE_DIR}"}`, `{"static": "dist"}`},
+		{"in the middle", `{"static": "sites/${SITE_DIR}/www"}`, `{"static": "sites/dist/www"}`},
+		{"default unused", `{"static": "${SITE_DIR:-public}"}`, `{"static": "dist"}`},
+		{"default for unset", `{"static": "${CUTE_UNSET_VAR:-public}"}`, `{"static": "public"}`},
+		{"default for empty", `{"static": "${EMPTY:-public}"}`, `{"static": "public"}`},
+		{"unset is empty", `{"static": "${CUTE_UNSET_VAR}"}`, `{"static": ""}`},
+		{"value escaped", `{"token": "${QUOTED}"}`, `{"token": "a\"b\\c"}`},
+		{"bare dollar", `{"cmd": "echo $HOME $"}`, `{"cmd": "echo $HOME $"}`},
+		{"not a name", `{"cmd": "${1x} ${a b} ${}"}`, `{"cmd": "${1x} ${a b} ${}"}`},
+		{"unclosed", `{"cmd": "${SITE_DIR", "x": "}"}`, `{"cmd": "${SITE_DIR", "x": "}"}`},
+		{"escaped quote before", `{"cmd": "\"${SITE_DIR}\""}`, `{"cmd": "\"dist\""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(expandConfigEnv([]byte(tt.input))); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": "{\n  // Where the site is\n  \"static\": \"${SITE_DIR:-public}\",\n}",
+	})
+	useDataDir(t, tmpDir)
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Static.String(); got != "public" {
+		t.Errorf("static = %q, want public", got)
+	}
+
+	t.Setenv("SITE_DIR", "dist")
+	if config, _, err = reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Static.String(); got != "dist" {
+		t.Errorf("static = %q, want dist", got)
+	}
+
+	// An unset variable without a default fails validation
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "${CUTE_UNSET_VAR}"}`})
+	if _, _, err := reloadConfig(); err == nil || !strings.Contains(err.Error(), "static") {
+		t.Errorf("unset static: err = %v", err)
+	}
+}
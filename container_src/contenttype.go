@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffContentType types a file from its first 512 bytes, for when the
+// extension doesn't say. Text (a README, a LICENSE, a shell script) is
+// served as text/plain so browsers show it, everything else as
+// application/octet-stream so it downloads. Sniffed HTML is deliberately
+// served as text/plain too: a user's file shouldn't turn into a page
+// just because it starts with a tag.
+func sniffContentType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "application/octet-stream"
+	}
+	if strings.HasPrefix(http.DetectContentType(head[:n]), "text/") {
+		return "text/plain"
+	}
+	return "application/octet-stream"
+}
+
+// textType reports whether a MIME type is text that a charset applies to.
+// Unlike compressibleType, that leaves out wasm.
+func textType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/javascript", "application/x-javascript",
+		"application/xml", "application/x-ndjson", "application/ndjson":
+		return true
+	}
+	return false
+}
+
+// withCharset adds "; charset=<charset>" (utf-8 if unset) to text types
+// that don't already name one. charset "none" leaves every type alone.
+func withCharset(mimeType, charset string) string {
+	if charset == "" {
+		charset = "utf-8"
+	}
+	if charset == "none" || !textType(mimeType) || strings.Contains(strings.ToLower(mimeType), "charset=") {
+		return mimeType
+	}
+	return mimeType + "; charset=" + charset
+}
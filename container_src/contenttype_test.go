@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtensionlessContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		file     string
+		wantType string
+	}{
+		{name: "text", config: `{"static": "."}`, file: "README", wantType: "text/plain; charset=utf-8"},
+		{name: "binary", config: `{"static": "."}`, file: "program", wantType: "application/octet-stream"},
+		{name: "html isn't rendered", config: `{"static": "."}`, file: "page", wantType: "text/plain; charset=utf-8"},
+		{name: "unknown extension", config: `{"static": "."}`, file: "notes.zzz", wantType: "text/plain; charset=utf-8"},
+		{name: "configured default", config: `{"static": ".", "defaultContentType": "text/markdown"}`, file: "README", wantType: "text/markdown; charset=utf-8"},
+		{name: "configured default for binary", config: `{"static": ".", "defaultContentType": "text/markdown"}`, file: "program", wantType: "text/markdown; charset=utf-8"},
+		{name: "extension still wins", config: `{"static": ".", "defaultContentType": "text/markdown"}`, file: "style.css", wantType: "text/css; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"README":      "# Hello\n\nJust some text.\n",
+				"program":     "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+				"page":        "<html><body>hi</body></html>",
+				"notes.zzz":   "plain notes",
+				"style.css":   "body {}",
+			})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(&Config{})
+
+			// The static server and the file API agree
+			for _, path := range []string{"/" + tt.file, "/api/files/" + tt.file} {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+				if w.Code != 200 {
+					t.Fatalf("GET %s: status = %d", path, w.Code)
+				}
+				if got := w.Header().Get("Content-Type"); got != tt.wantType {
+					t.Errorf("GET %s: Content-Type = %q, want %q", path, got, tt.wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultCharset(t *testing.T) {
+	files := map[string]string{
+		"index.html": "<p>héllo</p>",
+		"style.css":  "body {}",
+		"app.js":     "console.log('hi')",
+		"data.json":  `{"a": 1}`,
+		"icon.svg":   "<svg></svg>",
+		"notes.txt":  "notes",
+		"photo.png":  "\x89PNG\r\n\x1a\n",
+		"photo.jpg":  "\xff\xd8\xff",
+		"app.wasm":   "\x00asm",
+		"README":     "plain text",
+		"feed.xml":   "<rss/>",
+		"latin.txt":  "x",
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		want   map[string]string
+	}{
+		{
+			name:   "utf-8 by default",
+			config: `{"static": ".", "mimeTypes": {".txt": "text/plain"}}`,
+			want: map[string]string{
+				"index.html": "text/html; charset=utf-8",
+				"style.css":  "text/css; charset=utf-8",
+				"app.js":     "text/javascript; charset=utf-8",
+				"data.json":  "application/json; charset=utf-8",
+				"icon.svg":   "image/svg+xml; charset=utf-8",
+				"notes.txt":  "text/plain; charset=utf-8",
+				"README":     "text/plain; charset=utf-8",
+				"photo.png":  "image/png",
+				"photo.jpg":  "image/jpeg",
+				"app.wasm":   "application/wasm",
+			},
+		},
+		{
+			name:   "configured charset",
+			config: `{"static": ".", "defaultCharset": "iso-8859-1", "mimeTypes": {".txt": "text/plain; charset=windows-1252"}}`,
+			want: map[string]string{
+				"data.json": "application/json; charset=iso-8859-1",
+				"README":    "text/plain; charset=iso-8859-1",
+				"photo.png": "image/png",
+				// A charset in the type itself wins
+				"latin.txt": "text/plain; charset=windows-1252",
+			},
+		},
+		{
+			name:   "none",
+			config: `{"static": ".", "defaultCharset": "none"}`,
+			want: map[string]string{
+				"data.json": "application/json",
+				"icon.svg":  "image/svg+xml",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, files)
+			writeTestFiles(t, tmpDir, map[string]string{"config.json": tt.config})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(&Config{})
+			for file, want := range tt.want {
+				for _, path := range []string{"/" + file, "/api/files/" + file} {
+					w := httptest.NewRecorder()
+					mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+					if got := w.Header().Get("Content-Type"); got != want {
+						t.Errorf("GET %s: Content-Type = %q, want %q", path, got, want)
+					}
+				}
+			}
+		})
+	}
+}
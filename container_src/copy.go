@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// CopyRequest duplicates a file or directory
+type CopyRequest struct {
+	From string `json:"from"` // Source path (relative to base directory)
+	To   string `json:"to"`   // Destination path, which must not exist yet
+}
+
+// handleAPIFilesCopy copies a file, or a directory recursively. Unlike move
+// it never overwrites: an existing destination is a 409, unless
+// ?autorename=true picks a free name as move does.
+func handleAPIFilesCopy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CopyRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	// Read-only mounts are fine as a source
+	fromPath, err := validateAndResolvePath(req.From)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid source path: %v", err), pathErrorStatus(err))
+		return
+	}
+	toPath, err := validateAndResolveWritePath(req.To)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid destination path: %v", err), pathErrorStatus(err))
+		return
+	}
+
+	info, err := os.Stat(fromPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Source file not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() && pathWithin(toPath, fromPath) {
+		http.Error(w, "Cannot copy a directory into itself", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("autorename") == "true" {
+		if toPath, err = autoRenamePath(toPath); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	} else if _, err := os.Lstat(toPath); err == nil {
+		http.Error(w, "Destination already exists", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toPath), 0755); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create destination directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		err = copyDir(fromPath, toPath)
+	} else {
+		err = copyFile(fromPath, toPath)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to copy: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MoveResponse{Path: toRelativePath(toPath)})
+}
+
+// copyDir recursively copies the directory fromPath to toPath, which must
+// not exist yet. Symlinks are recreated as symlinks rather than followed,
+// and special files (sockets, devices, ...) are skipped.
+func copyDir(fromPath, toPath string) error {
+	return filepath.WalkDir(fromPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(fromPath, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(toPath, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			// Mkdir rather than MkdirAll, so a destination that appeared
+			// since the 409 check isn't merged into
+			return os.Mkdir(dest, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dest)
+		case d.Type().IsRegular():
+			return copyFile(path, dest)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIFilesCopy(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		query      string
+		wantStatus int
+		wantPath   string
+		wantFiles  map[string]string // Expected content after the copy
+	}{
+		{
+			name: "file", from: "notes.txt", to: "notes copy.txt",
+			wantStatus: 201, wantPath: "notes copy.txt",
+			wantFiles: map[string]string{"notes.txt": "notes", "notes copy.txt": "notes"},
+		},
+		{
+			name: "creates parents", from: "notes.txt", to: "archive/2024/notes.txt",
+			wantStatus: 201, wantPath: "archive/2024/notes.txt",
+			wantFiles: map[string]string{"archive/2024/notes.txt": "notes"},
+		},
+		{
+			name: "directory", from: "site", to: "site-backup",
+			wantStatus: 201, wantPath: "site-backup",
+			wantFiles: map[string]string{
+				"site/index.html":           "home",
+				"site-backup/index.html":    "home",
+				"site-backup/css/style.css": "body {}",
+			},
+		},
+		{
+			name: "existing destination", from: "notes.txt", to: "todo.txt",
+			wantStatus: 409,
+			wantFiles:  map[string]string{"todo.txt": "todo"},
+		},
+		{
+			name: "existing directory", from: "notes.txt", to: "site",
+			wantStatus: 409,
+		},
+		{
+			name: "autorename", from: "notes.txt", to: "todo.txt", query: "?autorename=true",
+			wantStatus: 201, wantPath: "todo (1).txt",
+			wantFiles: map[string]string{"todo.txt": "todo", "todo (1).txt": "notes"},
+		},
+		{name: "missing source", from: "nope.txt", to: "copy.txt", wantStatus: 404},
+		{name: "into itself", from: "site", to: "site/nested", wantStatus: 400},
+		{name: "outside the data directory", from: "notes.txt", to: "../escape.txt", wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"notes.txt":          "notes",
+				"todo.txt":           "todo",
+				"site/index.html":    "home",
+				"site/css/style.css": "body {}",
+			})
+			useDataDir(t, tmpDir)
+
+			body := fmt.Sprintf(`{"from": %q, "to": %q}`, tt.from, tt.to)
+			w := httptest.NewRecorder()
+			handleAPIFilesCopy(w, httptest.NewRequest("POST", "/api/files/copy"+tt.query, strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantPath != "" {
+				var resp MoveResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Path != tt.wantPath {
+					t.Errorf("path = %q, want %q", resp.Path, tt.wantPath)
+				}
+			}
+			for path, want := range tt.wantFiles {
+				content, err := os.ReadFile(filepath.Join(tmpDir, path))
+				if err != nil {
+					t.Errorf("%s: %v", path, err)
+					continue
+				}
+				if string(content) != want {
+					t.Errorf("%s = %q, want %q", path, content, want)
+				}
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIFilesCopy(w, httptest.NewRequest("GET", "/api/files/copy", nil))
+	if w.Code != 405 {
+		t.Errorf("GET status = %d, want 405", w.Code)
+	}
+}
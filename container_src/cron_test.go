@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "*/15 * * * *"},
+		{spec: "0 9-17 * * 1-5"},
+		{spec: "0,30 0 1,15 * *"},
+		{spec: "5 4 * * 7"},
+		{spec: "0-30/10 * * * *"},
+		{spec: "@daily"},
+		{spec: "@hourly"},
+		{spec: "* * * *", wantErr: true},
+		{spec: "* * * * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* 24 * * *", wantErr: true},
+		{spec: "* * 0 * *", wantErr: true},
+		{spec: "* * * 13 *", wantErr: true},
+		{spec: "* * * * 8", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "a * * * *", wantErr: true},
+		{spec: "@fortnightly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseCron(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, 1, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{spec: "* * * * *", want: time.Date(2025, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2025, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{spec: "0 * * * *", want: time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 9 * * 1-5", want: time.Date(2025, 1, 16, 9, 30, 0, 0, time.UTC)},
+		{spec: "0 0 * * 0", want: time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 * *", want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted: either matches
+		{spec: "0 0 20 * 5", want: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		// Never fires
+		{spec: "0 0 31 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(from); !got.Equal(tt.want) {
+				t.Errorf("next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIFilesDeleteRecursive(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantGone   string // Relative to the data directory
+		wantKept   string
+	}{
+		{name: "file", target: "/api/files/full/a.txt", wantStatus: 204, wantGone: "full/a.txt"},
+		{name: "empty directory", target: "/api/files/empty", wantStatus: 204, wantGone: "empty"},
+		{name: "non-empty directory without the flag", target: "/api/files/full", wantStatus: 409, wantKept: "full/sub/b.txt"},
+		{name: "non-empty directory", target: "/api/files/full?recursive=true", wantStatus: 204, wantGone: "full"},
+		{name: "file with the flag", target: "/api/files/full/a.txt?recursive=true", wantStatus: 204, wantGone: "full/a.txt"},
+		{name: "missing", target: "/api/files/nope?recursive=true", wantStatus: 204},
+		{name: "root", target: "/api/files/?recursive=true", wantStatus: 400, wantKept: "full/a.txt"},
+		{name: "mount root", target: "/api/files/scratch?recursive=true", wantStatus: 400},
+		{name: "inside a mount", target: "/api/files/scratch/tmp?recursive=true", wantStatus: 204},
+		{name: "contains a protected path", target: "/api/files/data?recursive=true", wantStatus: 403, wantKept: "data/app.db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scratchDir := t.TempDir()
+			writeTestFiles(t, scratchDir, map[string]string{"tmp/x.txt": "x"})
+			t.Setenv(mountsEnv, fmt.Sprintf(`[{"prefix": "scratch", "path": %q, "readOnly": false}]`, scratchDir))
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":    `{"static": ".", "protectedPaths": ["data/*.db"]}`,
+				"full/a.txt":     "a",
+				"full/sub/b.txt": "b",
+				"data/app.db":    "db",
+				"data/cache.txt": "c",
+			})
+			if err := os.Mkdir(filepath.Join(tmpDir, "empty"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			newServeMux(&Config{}).ServeHTTP(w, httptest.NewRequest("DELETE", tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantGone != "" {
+				if _, err := os.Lstat(filepath.Join(tmpDir, tt.wantGone)); !os.IsNotExist(err) {
+					t.Errorf("%s still exists", tt.wantGone)
+				}
+			}
+			if tt.wantKept != "" {
+				if _, err := os.Lstat(filepath.Join(tmpDir, tt.wantKept)); err != nil {
+					t.Errorf("%s was deleted: %v", tt.wantKept, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "config.json")); err != nil {
+				t.Error("config.json was deleted")
+			}
+		})
+	}
+}
+
+func TestAPIFilesDeleteRecursiveRootSpellings(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`, "a.txt": "a"})
+	useDataDir(t, tmpDir)
+
+	// The mux would clean these up; the handler must not rely on it
+	for _, filePath := range []string{"", ".", "/", "full/..", "./", "a/../."} {
+		w := httptest.NewRecorder()
+		handleAPIFilesDelete(w, httptest.NewRequest("DELETE", "/?recursive=true", nil), filePath)
+		if w.Code != 400 {
+			t.Errorf("%q: status = %d, want 400", filePath, w.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "a.txt")); err != nil {
+		t.Fatal("root was deleted")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxGlobDeleteMatches caps how many files one delete-glob may remove (a
+// var so tests can lower it). Over the cap nothing is deleted, so a
+// pattern that's broader than intended can't do much damage.
+var maxGlobDeleteMatches = 1000
+
+// DeleteGlobRequest deletes every file under Path matching Pattern
+type DeleteGlobRequest struct {
+	Path    string `json:"path"`    // Base directory, default the root
+	Pattern string `json:"pattern"` // Relative to Path, see matchGlob
+	DryRun  bool   `json:"dryRun,omitempty"`
+}
+
+// DeleteGlobResponse lists what was (or, for a dry run, would be) deleted
+type DeleteGlobResponse struct {
+	Deleted   []string `json:"deleted"`
+	Protected []string `json:"protected,omitempty"` // Matched but kept, see Config.protects
+	DryRun    bool     `json:"dryRun"`
+}
+
+// handleAPIFilesDeleteGlob deletes the files under a directory matching a
+// glob, e.g. "**/*.tmp" to clean up build artifacts. Only files are
+// deleted; directories are left in place, even if emptied.
+func handleAPIFilesDeleteGlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteGlobRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Pattern == "" {
+		http.Error(w, "pattern is required", http.StatusBadRequest)
+		return
+	}
+	if !validGlob(req.Pattern) {
+		http.Error(w, fmt.Sprintf("Invalid pattern %q", req.Pattern), http.StatusBadRequest)
+		return
+	}
+	basePath, err := validateAndResolveWritePath(req.Path)
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+	if info, err := os.Stat(basePath); err != nil || !info.IsDir() {
+		http.Error(w, "Base path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	config, _ := loadConfig()
+	resp := DeleteGlobResponse{Deleted: []string{}, DryRun: req.DryRun}
+	var matches []string
+	errTooMany := errors.New("too many matches")
+	err = filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil || !matchGlob(req.Pattern, filepath.ToSlash(rel)) {
+			return nil
+		}
+		if config.protects(path) {
+			resp.Protected = append(resp.Protected, toRelativePath(path))
+			return nil
+		}
+		if len(matches) == maxGlobDeleteMatches {
+			return errTooMany
+		}
+		matches = append(matches, path)
+		return nil
+	})
+	if errors.Is(err, errTooMany) {
+		http.Error(w, fmt.Sprintf("Pattern matches more than %d files, nothing was deleted", maxGlobDeleteMatches), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, path := range matches {
+		if !req.DryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				http.Error(w, fmt.Sprintf("Failed to delete %s after deleting %d files: %v", toRelativePath(path), len(resp.Deleted), err), http.StatusInternalServerError)
+				return
+			}
+		}
+		resp.Deleted = append(resp.Deleted, toRelativePath(path))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "dir/a.tmp", false},
+		{"**/*.tmp", "a.tmp", true},
+		{"**/*.tmp", "dir/sub/a.tmp", true},
+		{"**/*.tmp", "dir/a.tmpx", false},
+		{"dist/**", "dist/app.js", true},
+		{"dist/**", "dist/js/app.js", true},
+		{"dist/**", "src/dist/app.js", false},
+		{"src/**/test_*.go", "src/test_a.go", true},
+		{"src/**/test_*.go", "src/x/y/test_a.go", true},
+		{"src/**/test_*.go", "lib/test_a.go", false},
+		{"build/?.o", "build/a.o", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAPIFilesDeleteGlob(t *testing.T) {
+	files := map[string]string{
+		"config.json":       `{"static": ".", "protectedPaths": ["keep/**"]}`,
+		"a.tmp":             "",
+		"src/b.tmp":         "",
+		"src/deep/c.tmp":    "",
+		"src/main.go":       "",
+		"keep/d.tmp":        "",
+		"dist/app.js":       "",
+		"dist/js/vendor.js": "",
+		"settings.json":     "{}",
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, files)
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	do := func(body string) (int, DeleteGlobResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/files/delete-glob", strings.NewReader(body)))
+		var resp DeleteGlobResponse
+		if w.Code == 200 {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(tmpDir, rel))
+		return err == nil
+	}
+
+	// A dry run lists matches but keeps them, including protected ones
+	code, resp := do(`{"pattern": "**/*.tmp", "dryRun": true}`)
+	want := []string{"a.tmp", "src/b.tmp", "src/deep/c.tmp"}
+	if code != 200 || !resp.DryRun || !slices.Equal(resp.Deleted, want) || !slices.Equal(resp.Protected, []string{"keep/d.tmp"}) {
+		t.Fatalf("dry run: %d %+v", code, resp)
+	}
+	for _, rel := range want {
+		if !exists(rel) {
+			t.Errorf("dry run deleted %s", rel)
+		}
+	}
+
+	// Relative to the base path
+	code, resp = do(`{"path": "src", "pattern": "**/*.tmp"}`)
+	if code != 200 || resp.DryRun || !slices.Equal(resp.Deleted, []string{"src/b.tmp", "src/deep/c.tmp"}) {
+		t.Fatalf("delete: %d %+v", code, resp)
+	}
+	if exists("src/b.tmp") || exists("src/deep/c.tmp") || !exists("a.tmp") || !exists("src/main.go") {
+		t.Error("wrong files deleted")
+	}
+	if !exists("src/deep") {
+		t.Error("directory removed")
+	}
+
+	// The config file and protectedPaths are never deleted
+	code, resp = do(`{"pattern": "**/*.json"}`)
+	if code != 200 || !slices.Equal(resp.Deleted, []string{"settings.json"}) || !slices.Equal(resp.Protected, []string{"config.json"}) {
+		t.Errorf("protected: %d %+v", code, resp)
+	}
+	if !exists("config.json") || exists("settings.json") {
+		t.Error("config.json deleted or settings.json kept")
+	}
+	if code, _ := do(`{"pattern": "keep/**"}`); code != 200 || !exists("keep/d.tmp") {
+		t.Errorf("protectedPaths: %d, exists = %v", code, exists("keep/d.tmp"))
+	}
+
+	// Over the cap, nothing is deleted
+	old := maxGlobDeleteMatches
+	maxGlobDeleteMatches = 1
+	t.Cleanup(func() { maxGlobDeleteMatches = old })
+	if code, _ := do(`{"pattern": "dist/**"}`); code != 400 || !exists("dist/app.js") || !exists("dist/js/vendor.js") {
+		t.Errorf("over cap: %d", code)
+	}
+	maxGlobDeleteMatches = old
+
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{}`, 400},
+		{`{"pattern": "[x"}`, 400},
+		{`{"pattern": "*", "path": "../etc"}`, 400},
+		{`{"pattern": "*", "path": "src/main.go"}`, 400},
+	} {
+		if code, _ := do(tt.body); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.body, code, tt.want)
+		}
+	}
+}
+
+func TestDeleteProtectedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"page.html":   "hi",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	for path, want := range map[string]int{"config.json": 403, "page.html": 204} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/files/"+path, nil))
+		if w.Code != want {
+			t.Errorf("DELETE %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
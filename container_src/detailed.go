@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// FileDetails is the extra, `ls -la` style information in a
+// ?detailed=true listing
+type FileDetails struct {
+	Mode  string `json:"mode"`  // e.g. "-rw-r--r--"
+	Owner string `json:"owner"` // User name, or the UID if it has none
+	Group string `json:"group"` // Group name, or the GID if it has none
+}
+
+// fileDetails builds the FileDetails for info
+func fileDetails(info os.FileInfo) *FileDetails {
+	uid, gid, ok := fileOwner(info)
+	details := &FileDetails{Mode: lsMode(info.Mode())}
+	if ok {
+		details.Owner = ownerNames.user(uid)
+		details.Group = ownerNames.group(gid)
+	}
+	return details
+}
+
+// permString formats a file's permission bits in octal, e.g. "0755"
+func permString(mode fs.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// lsMode formats a file mode the way `ls -l` does. fs.FileMode.String
+// is close, but uses its own letters for the file type and special bits.
+func lsMode(mode fs.FileMode) string {
+	buf := []byte("----------")
+	switch {
+	case mode.IsDir():
+		buf[0] = 'd'
+	case mode&fs.ModeSymlink != 0:
+		buf[0] = 'l'
+	case mode&fs.ModeNamedPipe != 0:
+		buf[0] = 'p'
+	case mode&fs.ModeSocket != 0:
+		buf[0] = 's'
+	case mode&fs.ModeCharDevice != 0:
+		buf[0] = 'c'
+	case mode&fs.ModeDevice != 0:
+		buf[0] = 'b'
+	}
+
+	const rwx = "rwxrwxrwx"
+	for i := range 9 {
+		if mode&(1<<(8-i)) != 0 {
+			buf[i+1] = rwx[i]
+		}
+	}
+
+	// setuid, setgid and sticky replace the matching execute bit, in
+	// uppercase if that bit isn't set
+	special := func(pos int, set bool, lower byte) {
+		if !set {
+			return
+		}
+		if buf[pos] == 'x' {
+			buf[pos] = lower
+		} else {
+			buf[pos] = lower - 'a' + 'A'
+		}
+	}
+	special(3, mode&fs.ModeSetuid != 0, 's')
+	special(6, mode&fs.ModeSetgid != 0, 's')
+	special(9, mode&fs.ModeSticky != 0, 't')
+	return string(buf)
+}
+
+// nameCache resolves UIDs and GIDs to names. Lookups read /etc/passwd and
+// /etc/group, and a listing repeats the same few IDs for every file, so
+// results (including misses) are kept for the life of the process.
+type nameCache struct {
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+var ownerNames = &nameCache{
+	users:  make(map[uint32]string),
+	groups: make(map[uint32]string),
+}
+
+func (c *nameCache) user(uid uint32) string {
+	return c.lookup(c.users, uid, func(id string) (string, error) {
+		u, err := user.LookupId(id)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	})
+}
+
+func (c *nameCache) group(gid uint32) string {
+	return c.lookup(c.groups, gid, func(id string) (string, error) {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return "", err
+		}
+		return g.Name, nil
+	})
+}
+
+// lookup returns the cached name for id, falling back to the number itself
+// if it has no name
+func (c *nameCache) lookup(names map[uint32]string, id uint32, find func(string) (string, error)) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := names[id]; ok {
+		return name
+	}
+	idStr := strconv.FormatUint(uint64(id), 10)
+	name, err := find(idStr)
+	if err != nil {
+		name = idStr
+	}
+	names[id] = name
+	return name
+}
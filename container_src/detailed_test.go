@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLsMode(t *testing.T) {
+	tests := []struct {
+		mode fs.FileMode
+		want string
+	}{
+		{0644, "-rw-r--r--"},
+		{0600, "-rw-------"},
+		{0755, "-rwxr-xr-x"},
+		{fs.ModeDir | 0755, "drwxr-xr-x"},
+		{fs.ModeDir | fs.ModeSticky | 0777, "drwxrwxrwt"},
+		{fs.ModeDir | fs.ModeSticky | 0770, "drwxrwx--T"},
+		{fs.ModeSymlink | 0777, "lrwxrwxrwx"},
+		{fs.ModeSetuid | 0755, "-rwsr-xr-x"},
+		{fs.ModeSetuid | 0644, "-rwSr--r--"},
+		{fs.ModeSetgid | 0755, "-rwxr-sr-x"},
+		{fs.ModeNamedPipe | 0644, "prw-r--r--"},
+		{fs.ModeDevice | fs.ModeCharDevice | 0666, "crw-rw-rw-"},
+		{fs.ModeDevice | 0660, "brw-rw----"},
+	}
+	for _, tt := range tests {
+		if got := lsMode(tt.mode); got != tt.want {
+			t.Errorf("lsMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAPIFilesListDetailed(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"readme.txt":   "hello",
+		"bin/build.sh": "#!/bin/sh",
+	})
+	if err := os.Chmod(filepath.Join(tmpDir, "readme.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tmpDir, "bin/build.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+
+	list := func(query string) map[string]FileInfo {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files"+query, nil))
+		if w.Code != 200 {
+			t.Fatalf("status = %d", w.Code)
+		}
+		var files []FileInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &files); err != nil {
+			t.Fatal(err)
+		}
+		byPath := make(map[string]FileInfo)
+		for _, f := range files {
+			byPath[f.Path] = f
+		}
+		return byPath
+	}
+
+	// The basic listing stays basic
+	for path, f := range list("") {
+		if f.FileDetails != nil {
+			t.Errorf("%s has details without ?detailed=true: %+v", path, f.FileDetails)
+		}
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := list("?detailed=true&depth=-1")
+	for path, want := range map[string]string{
+		"readme.txt":   "-rw-r--r--",
+		"bin":          "drwxr-xr-x",
+		"bin/build.sh": "-rwxr-xr-x",
+	} {
+		f, ok := files[path]
+		if !ok || f.FileDetails == nil {
+			t.Fatalf("%s missing details: %+v", path, f)
+		}
+		if f.Mode != want {
+			t.Errorf("%s mode = %q, want %q", path, f.Mode, want)
+		}
+		if f.Owner != current.Username {
+			t.Errorf("%s owner = %q, want %q", path, f.Owner, current.Username)
+		}
+		if f.Group == "" || f.ModTime.IsZero() {
+			t.Errorf("%s group = %q, mtime = %v", path, f.Group, f.ModTime)
+		}
+	}
+	if files["readme.txt"].Size != 5 {
+		t.Errorf("size = %d", files["readme.txt"].Size)
+	}
+}
+
+func TestNameCacheFallsBackToID(t *testing.T) {
+	c := &nameCache{users: make(map[uint32]string), groups: make(map[uint32]string)}
+	const unused = 4000000000
+	if got := c.user(unused); got != strconv.Itoa(unused) {
+		t.Errorf("unknown uid = %q", got)
+	}
+	if got := c.user(0); got != "root" {
+		t.Errorf("uid 0 = %q, want root", got)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "net/http"
+
+// sendEarlyHints sends a 103 Early Hints response carrying the Link
+// headers already set, so the browser (or Cloudflare) can start fetching
+// preloads while the page itself is read from the mount. The Link headers
+// stay on the final response too, for clients and proxies that drop 103s.
+// HTTP/1.0 has no informational responses, so it only gets the latter.
+func sendEarlyHints(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	links := h.Values("Link")
+	if len(links) == 0 || !r.ProtoAtLeast(1, 1) {
+		return
+	}
+
+	// A 1xx carries every header set so far; only the links belong in it
+	saved := h.Clone()
+	clear(h)
+	h["Link"] = links
+	w.WriteHeader(http.StatusEarlyHints)
+	clear(h)
+	for k, v := range saved {
+		h[k] = v
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"slices"
+	"testing"
+)
+
+func TestEarlyHints(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "preload": [{"href": "/app.js", "as": "script"}]}`,
+		"index.html":  "<h1>home</h1>",
+		"app.js":      "console.log(1)",
+	})
+	useDataDir(t, tmpDir)
+
+	server := httptest.NewServer(http.HandlerFunc(handleHTTP))
+	defer server.Close()
+
+	get := func(path string) ([]textproto.MIMEHeader, *http.Response) {
+		t.Helper()
+		var hints []textproto.MIMEHeader
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				if code == http.StatusEarlyHints {
+					hints = append(hints, header)
+				}
+				return nil
+			},
+		}
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return hints, resp
+	}
+
+	wantLinks := []string{"</app.js>; rel=preload; as=script"}
+	hints, resp := get("/")
+	if len(hints) != 1 {
+		t.Fatalf("got %d early hints, want 1", len(hints))
+	}
+	if got := hints[0].Values("Link"); !slices.Equal(got, wantLinks) {
+		t.Errorf("103 Link = %q, want %q", got, wantLinks)
+	}
+	if hints[0].Get("Etag") != "" || hints[0].Get("Content-Type") != "" {
+		t.Errorf("103 carries other headers: %v", hints[0])
+	}
+	// The final response keeps its headers, links included
+	if resp.StatusCode != 200 || resp.Header.Get("ETag") == "" || !slices.Equal(resp.Header.Values("Link"), wantLinks) {
+		t.Errorf("final response: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Assets have no preloads, so no hints
+	if hints, _ := get("/app.js"); len(hints) != 0 {
+		t.Errorf("asset got early hints: %v", hints)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoMessage is a frame on the echo WebSocket
+type echoMessage struct {
+	Type       string    `json:"type"`           // "echo" or "pong"
+	Data       string    `json:"data,omitempty"` // The message being echoed
+	ServerTime time.Time `json:"serverTime"`
+}
+
+// handleEchoWebSocket is a diagnostic endpoint for checking that
+// WebSockets make it through the tunnel, independently of the PTY. Text
+// messages come back as {"type":"echo","data":...,"serverTime":...},
+// {"type":"ping"} gets {"type":"pong","serverTime":...} and binary
+// messages are echoed unchanged.
+func handleEchoWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	// Keep the connection alive like the terminal does, so idle echo
+	// sessions also show whether pings survive the tunnel
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		if msgType == websocket.BinaryMessage {
+			if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return
+			}
+			continue
+		}
+
+		reply := echoMessage{Type: "echo", Data: string(data), ServerTime: time.Now()}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(data, &msg) == nil && msg.Type == "ping" {
+			reply = echoMessage{Type: "pong", ServerTime: time.Now()}
+		}
+		if err := ws.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEchoWebSocket(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleEchoWebSocket))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	before := time.Now()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("hello tunnel")); err != nil {
+		t.Fatal(err)
+	}
+	var echo echoMessage
+	if err := ws.ReadJSON(&echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo.Type != "echo" || echo.Data != "hello tunnel" || echo.ServerTime.Before(before.Add(-time.Second)) {
+		t.Errorf("echo = %+v", echo)
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`))
+	var pong echoMessage
+	if err := ws.ReadJSON(&pong); err != nil {
+		t.Fatal(err)
+	}
+	if pong.Type != "pong" || pong.ServerTime.IsZero() || pong.Data != "" {
+		t.Errorf("pong = %+v", pong)
+	}
+
+	ws.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2, 255})
+	msgType, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != websocket.BinaryMessage || string(data) != string([]byte{0, 1, 2, 255}) {
+		t.Errorf("binary echo = %d %v", msgType, data)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultExecTimeout  = 10 * time.Minute
+	maxExecTimeout      = time.Hour
+	defaultExecMaxBytes = 10 * 1024 * 1024  // 10 MB
+	maxExecMaxBytes     = 100 * 1024 * 1024 // 100 MB
+)
+
+// errOutputLimit is returned by cappedWriter once the byte cap is reached
+var errOutputLimit = errors.New("output limit reached")
+
+// execExitMessage is the final text frame sent when a one-shot command ends
+type execExitMessage struct {
+	Type      string `json:"type"`                // Always "exit"
+	Code      int    `json:"code"`                // Process exit code, -1 if killed
+	TimedOut  bool   `json:"timedOut,omitempty"`  // Killed after exceeding the timeout
+	Truncated bool   `json:"truncated,omitempty"` // Output stopped at maxBytes
+	Canceled  bool   `json:"canceled,omitempty"`  // Stopped by DELETE /api/exec/<id>
+	Error     string `json:"error,omitempty"`     // Set if the command couldn't run
+}
+
+// cappedWriter passes command output on to out, stopping once max bytes
+// have been written
+type cappedWriter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	written   int64
+	max       int64
+	truncated bool
+	onLimit   func()
+}
+
+func (cw *cappedWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.truncated {
+		return 0, errOutputLimit
+	}
+	n := len(p)
+	if remaining := cw.max - cw.written; int64(len(p)) > remaining {
+		p = p[:remaining]
+		cw.truncated = true
+	}
+	if len(p) > 0 {
+		if _, err := cw.out.Write(p); err != nil {
+			return 0, err
+		}
+		cw.written += int64(len(p))
+	}
+	if cw.truncated {
+		cw.onLimit()
+		return len(p), errOutputLimit
+	}
+	return n, nil
+}
+
+// wsBinaryWriter sends each write as a binary WebSocket frame
+type wsBinaryWriter struct {
+	ws *websocket.Conn
+}
+
+func (w wsBinaryWriter) Write(p []byte) (int, error) {
+	if err := w.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// parseExecLimits reads ?timeout= (seconds) and ?maxBytes= from the query,
+// applying defaults and clamping to the upper bounds
+func parseExecLimits(r *http.Request) (time.Duration, int64, error) {
+	timeout := defaultExecTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 {
+			return 0, 0, fmt.Errorf("invalid timeout: %q", v)
+		}
+		timeout = min(time.Duration(secs*float64(time.Second)), maxExecTimeout)
+	}
+
+	maxBytes := int64(defaultExecMaxBytes)
+	if v := r.URL.Query().Get("maxBytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid maxBytes: %q", v)
+		}
+		maxBytes = min(n, maxExecMaxBytes)
+	}
+	return timeout, maxBytes, nil
+}
+
+// handleExecWebSocket runs a single command (?cmd= plus repeated ?arg=)
+// without a PTY, streams its combined output as binary frames and finishes
+// with an execExitMessage text frame before closing.
+func handleExecWebSocket(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("cmd")
+	if name == "" {
+		http.Error(w, "cmd query parameter is required", http.StatusBadRequest)
+		return
+	}
+	args := r.URL.Query()["arg"]
+
+	timeout, maxBytes, err := parseExecLimits(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The ID lets another client cancel the command, see execjobs.go
+	job, ctx := newExecJob(context.Background(), timeout)
+	defer job.unregister()
+	ws, err := upgrader.Upgrade(w, r, http.Header{"X-Exec-Id": {job.id}})
+	if err != nil {
+		close(job.done) // It never runs
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	// Kill the command if the client goes away. We don't take input, but
+	// reading is what surfaces close frames and dropped connections.
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				job.cancel()
+				return
+			}
+		}
+	}()
+
+	output := &cappedWriter{out: wsBinaryWriter{ws}, max: maxBytes, onLimit: job.cancel}
+	exitMsg := job.run(ctx, name, args, output)
+
+	closeReason := ""
+	switch {
+	case exitMsg.Truncated:
+		closeReason = fmt.Sprintf("output truncated after %d bytes", maxBytes)
+	case exitMsg.TimedOut:
+		closeReason = fmt.Sprintf("timed out after %s", timeout)
+	case exitMsg.Canceled:
+		closeReason = "canceled"
+	}
+
+	data, _ := json.Marshal(exitMsg)
+	ws.WriteMessage(websocket.TextMessage, data)
+	ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, closeReason),
+		time.Now().Add(time.Second))
+}
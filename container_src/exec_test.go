@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// runExec runs a one-shot command over the exec WebSocket, returning the
+// streamed output, the exit frame and the close frame
+func runExec(t *testing.T, query url.Values) (string, execExitMessage, *websocket.CloseError) {
+	t.Helper()
+	useDataDir(t, t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(handleExecWebSocket))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/exec?" + query.Encode()
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	var output strings.Builder
+	var exitMsg execExitMessage
+	for {
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			closeErr, ok := err.(*websocket.CloseError)
+			if !ok {
+				t.Fatalf("read error: %v", err)
+			}
+			return output.String(), exitMsg, closeErr
+		}
+		switch msgType {
+		case websocket.BinaryMessage:
+			output.Write(data)
+		case websocket.TextMessage:
+			if err := json.Unmarshal(data, &exitMsg); err != nil {
+				t.Fatalf("bad exit frame %q: %v", data, err)
+			}
+		}
+	}
+}
+
+func TestExecWebSocket(t *testing.T) {
+	output, exitMsg, closeErr := runExec(t, url.Values{
+		"cmd": {"sh"},
+		"arg": {"-c", "echo hello; exit 3"},
+	})
+	if output != "hello\n" {
+		t.Errorf("output = %q, want %q", output, "hello\n")
+	}
+	if exitMsg.Type != "exit" || exitMsg.Code != 3 || exitMsg.TimedOut || exitMsg.Truncated {
+		t.Errorf("exit frame = %+v, want plain exit with code 3", exitMsg)
+	}
+	if closeErr.Code != websocket.CloseNormalClosure {
+		t.Errorf("close code = %d, want %d", closeErr.Code, websocket.CloseNormalClosure)
+	}
+}
+
+func TestExecWebSocketTimeout(t *testing.T) {
+	start := time.Now()
+	_, exitMsg, closeErr := runExec(t, url.Values{
+		"cmd":     {"sleep"},
+		"arg":     {"30"},
+		"timeout": {"0.2"},
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command ran for %s, expected it to be killed after 0.2s", elapsed)
+	}
+	if !exitMsg.TimedOut {
+		t.Errorf("exit frame = %+v, want timedOut", exitMsg)
+	}
+	if !strings.Contains(closeErr.Text, "timed out") {
+		t.Errorf("close reason = %q, want timeout notice", closeErr.Text)
+	}
+}
+
+func TestExecWebSocketMaxBytes(t *testing.T) {
+	output, exitMsg, closeErr := runExec(t, url.Values{
+		"cmd":      {"yes"},
+		"maxBytes": {"1000"},
+	})
+	if len(output) != 1000 {
+		t.Errorf("got %d bytes of output, want 1000", len(output))
+	}
+	if !exitMsg.Truncated {
+		t.Errorf("exit frame = %+v, want truncated", exitMsg)
+	}
+	if !strings.Contains(closeErr.Text, "truncated") {
+		t.Errorf("close reason = %q, want truncation notice", closeErr.Text)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// execKillGrace is how long a canceled or timed-out command has to exit
+// after SIGTERM before it's killed (a var so tests can shorten it)
+var execKillGrace = 5 * time.Second
+
+// execJobRetention is how long an async command's result stays around for
+// GET /api/exec/<id> after it finishes
+const execJobRetention = 10 * time.Minute
+
+// execJobs indexes running commands (and finished async ones) by ID, so
+// they can be looked up and canceled
+var execJobs = struct {
+	sync.Mutex
+	byID map[string]*execJob
+}{byID: make(map[string]*execJob)}
+
+// execJob is one command run through /api/exec or /ws/exec
+type execJob struct {
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the command has exited
+
+	mu       sync.Mutex
+	canceled bool
+	output   *cappedWriter // Writes to buf, for HTTP execs
+	buf      *bytes.Buffer
+	exit     *execExitMessage
+}
+
+// ExecRequest is the body of POST /api/exec
+type ExecRequest struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args,omitempty"`
+}
+
+// ExecStatus describes a command started through the exec API
+type ExecStatus struct {
+	ID      string           `json:"id"`
+	Running bool             `json:"running"`
+	Output  *string          `json:"output,omitempty"` // Combined stdout and stderr so far
+	Exit    *execExitMessage `json:"exit,omitempty"`   // Set once it's finished
+}
+
+// newExecJob registers a job for a command that will run under the
+// returned context, which ends after timeout, when parent does, or when
+// the job is canceled
+func newExecJob(parent context.Context, timeout time.Duration) (*execJob, context.Context) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	id := make([]byte, 8)
+	rand.Read(id)
+	job := &execJob{id: hex.EncodeToString(id), cancel: cancel, done: make(chan struct{})}
+
+	execJobs.Lock()
+	execJobs.byID[job.id] = job
+	execJobs.Unlock()
+	return job, ctx
+}
+
+// lookupExecJob returns the job with the given ID, if it's still known
+func lookupExecJob(id string) *execJob {
+	execJobs.Lock()
+	defer execJobs.Unlock()
+	return execJobs.byID[id]
+}
+
+func (j *execJob) unregister() {
+	j.cancel()
+	execJobs.Lock()
+	defer execJobs.Unlock()
+	if execJobs.byID[j.id] == j {
+		delete(execJobs.byID, j.id)
+	}
+}
+
+// run runs the command in the data directory, as the terminal's user, with
+// output going to output, and records how it ended. When ctx ends first
+// the command gets SIGTERM, then SIGKILL if it's still around
+// execKillGrace later.
+func (j *execJob) run(ctx context.Context, name string, args []string, output *cappedWriter) execExitMessage {
+	defer close(j.done)
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dataDir
+	cmd.Env = commandEnv()
+	// Not as root, see terminalCredential
+	runAsTerminalUser(cmd)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	// Also bounds the wait for grandchildren holding the output pipe open
+	cmd.WaitDelay = execKillGrace
+
+	exitMsg := execExitMessage{Type: "exit", Code: -1}
+	if err := cmd.Run(); err != nil && cmd.ProcessState == nil {
+		// Never started, e.g. the program doesn't exist
+		exitMsg.Error = err.Error()
+	}
+	if cmd.ProcessState != nil {
+		exitMsg.Code = cmd.ProcessState.ExitCode()
+	}
+
+	output.mu.Lock()
+	exitMsg.Truncated = output.truncated
+	output.mu.Unlock()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	exitMsg.Canceled = j.canceled
+	exitMsg.TimedOut = !exitMsg.Truncated && !j.canceled && errors.Is(ctx.Err(), context.DeadlineExceeded)
+	j.exit = &exitMsg
+	return exitMsg
+}
+
+// stop cancels the command, waiting for it to exit
+func (j *execJob) stop() {
+	j.mu.Lock()
+	if j.exit == nil {
+		j.canceled = true
+	}
+	j.mu.Unlock()
+	j.cancel()
+	<-j.done
+}
+
+func (j *execJob) status() ExecStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := ExecStatus{ID: j.id, Running: j.exit == nil, Exit: j.exit}
+	if j.output != nil {
+		j.output.mu.Lock()
+		output := j.buf.String()
+		j.output.mu.Unlock()
+		status.Output = &output
+	}
+	return status
+}
+
+// handleAPIExec runs a command (POST {"cmd": "make", "args": ["test"]}),
+// with the same ?timeout= and ?maxBytes= as /ws/exec. By default it
+// responds once the command has finished, and the command is killed if
+// the client goes away first. With ?async=true it responds straight away
+// with a 202 and the command's ID, to poll with GET /api/exec/<id>.
+// DELETE /api/exec/<id> cancels a command, including /ws/exec ones.
+func handleAPIExec(w http.ResponseWriter, r *http.Request) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/api/exec/"); ok {
+		handleAPIExecJob(w, r, id)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExecRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Cmd == "" {
+		http.Error(w, "cmd is required", http.StatusBadRequest)
+		return
+	}
+	timeout, maxBytes, err := parseExecLimits(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	async := r.URL.Query().Get("async") == "true"
+
+	// A synchronous command lives as long as the request
+	parent := r.Context()
+	if async {
+		parent = context.Background()
+	}
+	job, ctx := newExecJob(parent, timeout)
+	job.buf = &bytes.Buffer{}
+	job.output = &cappedWriter{out: job.buf, max: maxBytes, onLimit: job.cancel}
+
+	if async {
+		go func() {
+			job.run(ctx, req.Cmd, req.Args, job.output)
+			time.AfterFunc(execJobRetention, job.unregister)
+		}()
+		w.Header().Set("Location", "/api/exec/"+job.id)
+		writeExecStatus(w, http.StatusAccepted, job.status())
+		return
+	}
+
+	defer job.unregister()
+	job.run(ctx, req.Cmd, req.Args, job.output)
+	writeExecStatus(w, http.StatusOK, job.status())
+}
+
+// handleAPIExecJob reports on (GET) or cancels (DELETE) a command. Canceling
+// waits for the command to exit, then returns its final status.
+func handleAPIExecJob(w http.ResponseWriter, r *http.Request, id string) {
+	job := lookupExecJob(id)
+	if job == nil {
+		http.Error(w, "No such command", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		writeExecStatus(w, http.StatusOK, job.status())
+	case "DELETE":
+		job.stop()
+		writeExecStatus(w, http.StatusOK, job.status())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeExecStatus(w http.ResponseWriter, code int, status ExecStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,196 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAPIExec(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	old := execKillGrace
+	execKillGrace = 200 * time.Millisecond
+	t.Cleanup(func() { execKillGrace = old })
+	server := httptest.NewServer(newServeMux(&Config{}))
+	t.Cleanup(server.Close)
+
+	do := func(method, target, body string) (int, ExecStatus) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+target, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var status ExecStatus
+		json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, status
+	}
+	waitForOutput := func(id, want string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			_, status := do("GET", "/api/exec/"+id, "")
+			if status.Output != nil && strings.Contains(*status.Output, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("output never contained %q: %+v", want, status)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	t.Run("synchronous", func(t *testing.T) {
+		code, status := do("POST", "/api/exec", `{"cmd": "sh", "args": ["-c", "echo hello; exit 2"]}`)
+		if code != 200 || status.Running || status.Exit == nil || status.Exit.Code != 2 || *status.Output != "hello\n" {
+			t.Fatalf("%d %+v", code, status)
+		}
+		// Finished synchronous commands aren't kept around
+		if code, _ := do("GET", "/api/exec/"+status.ID, ""); code != 404 {
+			t.Errorf("GET finished command: status %d, want 404", code)
+		}
+	})
+
+	t.Run("async runs to completion", func(t *testing.T) {
+		code, status := do("POST", "/api/exec?async=true", `{"cmd": "sh", "args": ["-c", "echo done"]}`)
+		if code != 202 || status.ID == "" || !status.Running {
+			t.Fatalf("%d %+v", code, status)
+		}
+		waitForOutput(status.ID, "done")
+		deadline := time.Now().Add(10 * time.Second)
+		for status.Running && time.Now().Before(deadline) {
+			_, status = do("GET", "/api/exec/"+status.ID, "")
+		}
+		if status.Exit == nil || status.Exit.Code != 0 || status.Exit.Canceled {
+			t.Errorf("finished: %+v", status)
+		}
+	})
+
+	t.Run("cancel sends SIGTERM", func(t *testing.T) {
+		_, status := do("POST", "/api/exec?async=true",
+			`{"cmd": "sh", "args": ["-c", "trap 'echo TERM; exit 7' TERM; echo started; while :; do sleep 0.05; done"]}`)
+		waitForOutput(status.ID, "started")
+		code, status := do("DELETE", "/api/exec/"+status.ID, "")
+		if code != 200 || status.Running || status.Exit == nil || !status.Exit.Canceled {
+			t.Fatalf("%d %+v", code, status)
+		}
+		// The command got to clean up
+		if status.Exit.Code != 7 || !strings.Contains(*status.Output, "TERM") {
+			t.Errorf("exit = %+v, output = %q", status.Exit, *status.Output)
+		}
+		// Canceling again is harmless
+		if code, again := do("DELETE", "/api/exec/"+status.ID, ""); code != 200 || again.Exit.Code != 7 {
+			t.Errorf("second DELETE: %d %+v", code, again)
+		}
+	})
+
+	t.Run("then SIGKILL", func(t *testing.T) {
+		_, status := do("POST", "/api/exec?async=true",
+			`{"cmd": "sh", "args": ["-c", "trap '' TERM; echo started; while :; do sleep 0.05; done"]}`)
+		waitForOutput(status.ID, "started")
+		start := time.Now()
+		code, status := do("DELETE", "/api/exec/"+status.ID, "")
+		if code != 200 || status.Exit == nil || status.Exit.Code != -1 || !status.Exit.Canceled {
+			t.Fatalf("%d %+v", code, status)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("took %s to kill", elapsed)
+		}
+	})
+
+	t.Run("client disconnect", func(t *testing.T) {
+		pidFile := filepath.Join(tmpDir, "pid")
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/api/exec",
+			strings.NewReader(`{"cmd": "sh", "args": ["-c", "echo $$ > pid; while :; do sleep 0.05; done"]}`))
+		errc := make(chan error, 1)
+		go func() {
+			_, err := http.DefaultClient.Do(req)
+			errc <- err
+		}()
+
+		var pid int
+		deadline := time.Now().Add(10 * time.Second)
+		for pid == 0 {
+			if data, err := os.ReadFile(pidFile); err == nil {
+				pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("command never started")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		if err := <-errc; err == nil {
+			t.Fatal("request finished without being canceled")
+		}
+		for !errors.Is(syscall.Kill(pid, 0), syscall.ESRCH) {
+			if time.Now().After(deadline) {
+				t.Fatalf("process %d still running after the client went away", pid)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("websocket exec", func(t *testing.T) {
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/exec?cmd=sleep&arg=30"
+		ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		id := resp.Header.Get("X-Exec-Id")
+		if id == "" {
+			t.Fatal("no X-Exec-Id")
+		}
+		if code, status := do("DELETE", "/api/exec/"+id, ""); code != 200 || !status.Exit.Canceled || status.Output != nil {
+			t.Fatalf("%d %+v", code, status)
+		}
+		ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var exitMsg execExitMessage
+		for {
+			msgType, data, err := ws.ReadMessage()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) || closeErr.Text != "canceled" {
+					t.Errorf("close = %v", err)
+				}
+				break
+			}
+			if msgType == websocket.TextMessage {
+				json.Unmarshal(data, &exitMsg)
+			}
+		}
+		if !exitMsg.Canceled {
+			t.Errorf("exit frame = %+v", exitMsg)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if code, _ := do("DELETE", "/api/exec/nope", ""); code != 404 {
+			t.Errorf("unknown ID: %d", code)
+		}
+		if code, _ := do("POST", "/api/exec", `{}`); code != 400 {
+			t.Errorf("no cmd: %d", code)
+		}
+		if code, _ := do("GET", "/api/exec", ""); code != 405 {
+			t.Errorf("GET /api/exec: %d", code)
+		}
+	})
+}
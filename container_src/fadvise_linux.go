@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// posixFadvDontNeed is POSIX_FADV_DONTNEED from <fcntl.h>
+const posixFadvDontNeed = 4
+
+// dropPageCache hints to the kernel that f's cached pages won't be needed
+// again. Errors are ignored since filesystems (FUSE included) may not
+// support the hint.
+func dropPageCache(f *os.File) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, posixFadvDontNeed, 0, 0)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// dropPageCache is a no-op where posix_fadvise isn't available
+func dropPageCache(f *os.File) {}
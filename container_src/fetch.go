@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const fetchTimeout = 5 * time.Minute
+
+// maxFetchBytes caps downloads made by the fetch endpoint (a var so tests
+// can lower it)
+var maxFetchBytes int64 = 512 * 1024 * 1024 // 512 MB
+
+// fetchAllowedIP decides which addresses the fetch endpoint may connect to
+// (swapped out in tests, which fetch from a loopback test server)
+var fetchAllowedIP = isPublicIP
+
+// FetchRequest asks the container to download a URL into a file
+type FetchRequest struct {
+	URL  string `json:"url"`
+	Dest string `json:"dest"` // Destination path (relative to base directory)
+}
+
+// FetchResponse describes a completed download
+type FetchResponse struct {
+	Path        string `json:"path"`
+	Bytes       int64  `json:"bytes"`
+	ContentType string `json:"contentType"`
+}
+
+// reservedPrefixes are the special-purpose ranges (RFC 6890 and friends)
+// that net.IP has no method for. Carrier-grade NAT space especially is
+// often used for internal and VPC addressing.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:2::/48"),     // Benchmarking
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// isPublicIP reports whether ip is a globally routable address, i.e. not
+// loopback, private, link-local (which covers the 169.254.169.254 cloud
+// metadata address) or otherwise internal
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchClient checks every address it connects to, after DNS resolution
+// and on each redirect, so hostnames pointing at internal IPs are caught too
+var fetchClient = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		// Fresh connections only, so a pooled connection never skips the check
+		DisableKeepAlives: true,
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !fetchAllowedIP(ip) {
+					return errBlockedAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+var errBlockedAddress = errors.New("refusing to fetch from an internal address")
+
+// handleAPIFilesFetch downloads a URL straight into a file
+func handleAPIFilesFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FetchRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+
+	if req.Dest == "" {
+		http.Error(w, "dest is required", http.StatusBadRequest)
+		return
+	}
+	destPath, err := validateAndResolveWritePath(req.Dest)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid destination path: %v", err), pathErrorStatus(err))
+		return
+	}
+
+	fetchReq, err := http.NewRequestWithContext(r.Context(), "GET", u.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := fetchClient.Do(fetchReq)
+	if err != nil {
+		if errors.Is(err, errBlockedAddress) {
+			http.Error(w, errBlockedAddress.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to fetch URL: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, fmt.Sprintf("Fetch failed: upstream returned %s", resp.Status), http.StatusBadGateway)
+		return
+	}
+	if resp.ContentLength > maxFetchBytes {
+		http.Error(w, fmt.Sprintf("File too large (limit %s)", formatBytes(maxFetchBytes)), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Prefer the server's Content-Type, sniffing the first bytes otherwise
+	body := bufio.NewReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		head, _ := body.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+
+	n, err := writeFileAtomic(destPath, body, maxFetchBytes)
+	if err != nil {
+		if errors.Is(err, errTooLarge) {
+			http.Error(w, fmt.Sprintf("File too large (limit %s)", formatBytes(maxFetchBytes)), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to write file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FetchResponse{
+		Path:        toRelativePath(destPath),
+		Bytes:       n,
+		ContentType: contentType,
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIFilesFetch(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello.txt":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "hello from the internet")
+		case "/big":
+			w.Write([]byte(strings.Repeat("x", 2000)))
+		case "/big-chunked":
+			// Flushing forces chunked encoding, so there's no Content-Length
+			for range 20 {
+				w.Write([]byte(strings.Repeat("x", 100)))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	oldMax := maxFetchBytes
+	maxFetchBytes = 1000
+	t.Cleanup(func() { maxFetchBytes = oldMax })
+
+	tests := []struct {
+		name        string
+		allowLocal  bool
+		url, dest   string
+		wantStatus  int
+		wantContent string
+	}{
+		{name: "success", allowLocal: true, url: upstream.URL + "/hello.txt", dest: "downloads/hello.txt", wantStatus: 200, wantContent: "hello from the internet"},
+		{name: "size cap from content-length", allowLocal: true, url: upstream.URL + "/big", dest: "big", wantStatus: 413},
+		{name: "size cap while streaming", allowLocal: true, url: upstream.URL + "/big-chunked", dest: "big", wantStatus: 413},
+		{name: "upstream error", allowLocal: true, url: upstream.URL + "/missing", dest: "missing", wantStatus: 502},
+		{name: "blocked loopback", url: upstream.URL + "/hello.txt", dest: "hello.txt", wantStatus: 403},
+		{name: "blocked metadata address", url: "http://169.254.169.254/latest/meta-data/", dest: "meta", wantStatus: 403},
+		{name: "non-http scheme", url: "file:///etc/passwd", dest: "passwd", wantStatus: 400},
+		{name: "dest outside home", allowLocal: true, url: upstream.URL + "/hello.txt", dest: "../escape", wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			useDataDir(t, tmpDir)
+			if tt.allowLocal {
+				fetchAllowedIP = func(net.IP) bool { return true }
+				t.Cleanup(func() { fetchAllowedIP = isPublicIP })
+			}
+
+			body := fmt.Sprintf(`{"url": %q, "dest": %q}`, tt.url, tt.dest)
+			w := httptest.NewRecorder()
+			handleAPIFilesFetch(w, httptest.NewRequest("POST", "/api/files/fetch", strings.NewReader(body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantStatus != 200 {
+				// Failed fetches must not leave anything behind, temp files included
+				entries, _ := os.ReadDir(tmpDir)
+				if len(entries) != 0 {
+					t.Errorf("left files behind: %v", entries)
+				}
+				return
+			}
+
+			var resp FetchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Path != tt.dest || resp.Bytes != int64(len(tt.wantContent)) || !strings.HasPrefix(resp.ContentType, "text/plain") {
+				t.Errorf("response = %+v", resp)
+			}
+			content, err := os.ReadFile(filepath.Join(tmpDir, tt.dest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"192.0.0.8", false},
+		{"192.0.2.1", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"198.20.0.1", true},
+		{"198.51.100.7", false},
+		{"203.0.113.9", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:100.64.0.1", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"2001:db8::1", false},
+		{"100::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listingFields are the FileInfo fields ?fields= can select, mapped to
+// whether they need a detailed listing
+var listingFields = map[string]bool{
+	"path":      false,
+	"name":      false,
+	"isDir":     false,
+	"size":      false,
+	"mtime":     false,
+	"perm":      false,
+	"isSymlink": false,
+	"mode":      true,
+	"owner":     true,
+	"group":     true,
+}
+
+// listingOptions shape a listing response
+type listingOptions struct {
+	detailed bool     // Include FileDetails
+	fields   []string // Only these fields, sorted; nil for all
+	depth    int      // Levels below the directory to list; -1 for all
+}
+
+// cacheKey distinguishes listings of the same directory
+func (o listingOptions) cacheKey(absPath string) string {
+	key := absPath + "?depth=" + strconv.Itoa(o.depth)
+	if o.detailed {
+		key += "?detailed"
+	}
+	if o.fields != nil {
+		key += "?fields=" + strings.Join(o.fields, ",")
+	}
+	return key
+}
+
+// parseListingFields parses a ?fields=name,size value. Asking for any of
+// the detailed fields implies a detailed listing.
+func parseListingFields(param string, opts *listingOptions) error {
+	if param == "" {
+		return nil
+	}
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		detailed, ok := listingFields[field]
+		if !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		opts.detailed = opts.detailed || detailed
+		opts.fields = append(opts.fields, field)
+	}
+	slices.Sort(opts.fields)
+	opts.fields = slices.Compact(opts.fields)
+	return nil
+}
+
+// parseListingDepth parses a ?depth= value: 1 (the default) lists just the
+// directory's children, and -1 lists the whole tree
+func parseListingDepth(param string, opts *listingOptions) error {
+	opts.depth = 1
+	if param == "" {
+		return nil
+	}
+	depth, err := strconv.Atoi(param)
+	if err != nil || depth == 0 || depth < -1 {
+		return fmt.Errorf("invalid depth %q: must be a positive number or -1", param)
+	}
+	opts.depth = depth
+	return nil
+}
+
+// projectFields picks the selected fields out of info
+func projectFields(info FileInfo, fields []string) map[string]any {
+	out := make(map[string]any, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "path":
+			out[field] = info.Path
+		case "name":
+			out[field] = info.Name
+		case "isDir":
+			out[field] = info.IsDir
+		case "size":
+			out[field] = info.Size
+		case "mtime":
+			out[field] = info.ModTime
+		case "perm":
+			out[field] = info.Perm
+		case "isSymlink":
+			out[field] = info.IsSymlink
+		}
+		if d := info.FileDetails; d != nil {
+			switch field {
+			case "mode":
+				out[field] = d.Mode
+			case "owner":
+				out[field] = d.Owner
+			case "group":
+				out[field] = d.Group
+			}
+		}
+	}
+	return out
+}
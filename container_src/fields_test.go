@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAPIFilesListFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"a.txt":     "hello",
+		"src/b.txt": "hi",
+	})
+	useDataDir(t, tmpDir)
+
+	list := func(query string) (int, []map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files"+query, nil))
+		if w.Code != 200 {
+			return w.Code, nil
+		}
+		var entries []map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, entries
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []map[string]any
+	}{
+		{
+			name:  "single field",
+			query: "?fields=name&depth=-1",
+			want:  []map[string]any{{"name": "a.txt"}, {"name": "src"}, {"name": "b.txt"}},
+		},
+		{
+			name:  "multiple fields",
+			query: "?fields=name,size&depth=-1",
+			want:  []map[string]any{{"name": "a.txt", "size": 5.0}, {"name": "src", "size": nil}, {"name": "b.txt", "size": 2.0}},
+		},
+		{
+			name:  "spaces and duplicates",
+			query: "?fields=path,%20isDir,path&depth=-1",
+			want:  []map[string]any{{"path": "a.txt", "isDir": false}, {"path": "src", "isDir": true}, {"path": "src/b.txt", "isDir": false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, got := list(tt.query)
+			if code != 200 || len(got) != len(tt.want) {
+				t.Fatalf("%d %v", code, got)
+			}
+			for i := range got {
+				want := tt.want[i]
+				// Directory sizes vary by filesystem
+				if size, ok := want["size"]; ok && size == nil {
+					want["size"] = got[i]["size"]
+				}
+				if !reflect.DeepEqual(got[i], want) {
+					t.Errorf("entry %d = %v, want %v", i, got[i], want)
+				}
+			}
+		})
+	}
+
+	// Detailed fields imply a detailed listing
+	_, got := list("?fields=path,mode")
+	if mode, _ := got[0]["mode"].(string); len(mode) != 10 || mode[0] != '-' || len(got[0]) != 2 {
+		t.Errorf("detailed field: %v", got)
+	}
+
+	// The full listing is unaffected, even with the listing cache
+	if _, got := list(""); len(got) == 0 || len(got[0]) != 7 {
+		t.Errorf("full listing: %v", got)
+	}
+
+	if code, _ := list("?fields=name,secret"); code != 400 {
+		t.Errorf("unknown field: status %d, want 400", code)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tigrisfs exiting (when the S3 connection drops, say) doesn't take the
+// container down: the mount is cleaned up and tigrisfs started again,
+// waiting longer after each failure. Only failing maxMountFailures times in
+// a row, each mount lasting less than stableMountAfter, is fatal. These are
+// vars so tests can shorten them.
+var (
+	remountBackoff    = time.Second // Doubling after each failure
+	maxRemountBackoff = 30 * time.Second
+	maxMountFailures  = 5
+	// stableMountAfter is how long a mount has to last for its exit to
+	// count as a new problem rather than another failure in a row
+	stableMountAfter = time.Minute
+	mountTimeout     = 10 * time.Second
+)
+
+// storageReconnecting is set while tigrisfs is being restarted, when the
+// data directory can't be used
+var storageReconnecting atomic.Bool
+
+// The steps of running tigrisfs (swapped out in tests)
+var (
+	tigrisfsCommand = func(bucket, dir, s3Token string) *exec.Cmd {
+		cmd := exec.Command("/usr/local/bin/tigrisfs",
+			"--endpoint", "https://cute.maxmcd.com/",
+			"--debug_s3",
+			"--debug",
+			"-f",
+			bucket,
+			dir)
+		// Pass JWT token as AWS access key ID
+		// tigrisfs will include this in the Authorization header's Credential field
+		// Format: "AWS4-HMAC-SHA256 Credential=<jwt>/20231201/auto/s3/aws4_request, ..."
+		// Our S3 DO extracts the JWT from the Credential field
+		cmd.Env = append(os.Environ(),
+			"AWS_ACCESS_KEY_ID="+s3Token,
+			"AWS_SECRET_ACCESS_KEY=not-used", // Required by tigrisfs but ignored by S3 DO
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd
+	}
+	awaitMount = waitForMount
+	// detachMount clears what a dead tigrisfs left behind, which otherwise
+	// fails every access with "transport endpoint is not connected"
+	detachMount = func(dir string) error {
+		if out, err := exec.Command("fusermount", "-u", "-z", dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+		return nil
+	}
+	mountGaveUp = func(err error) { log.Fatalf("tigrisfs keeps failing, giving up: %v", err) }
+)
+
+// fuseMount is the tigrisfs process serving the data directory
+type fuseMount struct {
+	bucket, dir, s3Token string
+	done                 chan struct{} // Closed once tigrisfs has exited for good
+
+	mu sync.Mutex
+	// stopping is set once we're unmounting, when tigrisfs exiting is
+	// expected and it isn't started again
+	stopping bool
+	cmd      *exec.Cmd
+}
+
+// mountFUSE runs tigrisfs to mount bucket at dir, returning once the mount
+// is ready. From then on it's restarted whenever it exits, until unmounted.
+func mountFUSE(bucket, dir, s3Token string) (*fuseMount, error) {
+	m := &fuseMount{bucket: bucket, dir: dir, s3Token: s3Token, done: make(chan struct{})}
+	exited, err := m.start()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for FUSE mount to be ready before proceeding
+	log.Printf("Waiting for FUSE mount at %s...", dir)
+	if err := awaitMount(dir, mountTimeout); err != nil {
+		return nil, err
+	}
+	go m.supervise(exited)
+	return m, nil
+}
+
+// start launches tigrisfs, returning a channel that gets its exit error
+func (m *fuseMount) start() (<-chan error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return nil, fmt.Errorf("unmounting")
+	}
+	cmd := tigrisfsCommand(m.bucket, m.dir, m.s3Token)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting tigrisfs: %w", err)
+	}
+	m.cmd = cmd
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	return exited, nil
+}
+
+// isStopping reports whether unmount has been called
+func (m *fuseMount) isStopping() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopping
+}
+
+// supervise restarts tigrisfs each time it exits, until it's unmounted or
+// has failed too often, see the vars above
+func (m *fuseMount) supervise(exited <-chan error) {
+	defer close(m.done)
+	defer storageReconnecting.Store(false)
+	started := time.Now()
+	failures := 0
+	backoff := remountBackoff
+	for {
+		err := <-exited
+		if m.isStopping() {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("exited unexpectedly")
+		}
+		storageReconnecting.Store(true)
+		if time.Since(started) >= stableMountAfter {
+			failures, backoff = 0, remountBackoff
+		}
+		failures++
+		if failures >= maxMountFailures {
+			mountGaveUp(err)
+			return
+		}
+		log.Printf("tigrisfs failed (%v), remounting %s in %s", err, m.dir, backoff)
+
+		if err := detachMount(m.dir); err != nil {
+			log.Printf("Cleaning up %s: %v", m.dir, err)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRemountBackoff)
+
+		started = time.Now()
+		exited, err = m.start()
+		if err != nil {
+			if m.isStopping() {
+				return
+			}
+			// Counts as another failure
+			failed := make(chan error, 1)
+			failed <- err
+			exited = failed
+			continue
+		}
+		if err := awaitMount(m.dir, mountTimeout); err != nil {
+			// Not mounted after all, so start over
+			log.Printf("Remounting %s: %v", m.dir, err)
+			m.mu.Lock()
+			m.cmd.Process.Kill()
+			m.mu.Unlock()
+			continue
+		}
+		storageReconnecting.Store(false)
+		log.Printf("Remounted %s", m.dir)
+	}
+}
+
+// unmount unmounts the data directory and waits for tigrisfs to exit,
+// which it does once it has flushed. A mount that's still busy (a process
+// with a file open, say) is detached lazily instead, which still lets
+// tigrisfs finish.
+func (m *fuseMount) unmount(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopping = true
+	m.mu.Unlock()
+	if out, err := exec.CommandContext(ctx, "fusermount", "-u", m.dir).CombinedOutput(); err != nil {
+		log.Printf("Unmounting %s failed, detaching it instead: %v: %s", m.dir, err, out)
+		if out, err := exec.CommandContext(ctx, "fusermount", "-u", "-z", m.dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("fusermount: %v: %s", err, out)
+		}
+	}
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for tigrisfs to exit: %w", ctx.Err())
+	}
+}
+
+// requireStorage answers 503 while the data directory is being remounted,
+// rather than whatever errors touching it would give
+func requireStorage(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if storageReconnecting.Load() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Storage reconnecting, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTigrisfs swaps out running tigrisfs: the nth start runs commands[n]
+// (the last one once they run out), and mounts are ready at once. It
+// returns how many times tigrisfs was started and the mount cleaned up.
+func fakeTigrisfs(t *testing.T, commands ...string) (starts, detaches func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	started, detached := 0, 0
+	oldCommand, oldAwait, oldDetach := tigrisfsCommand, awaitMount, detachMount
+	oldBackoff, oldFailures := remountBackoff, maxMountFailures
+	tigrisfsCommand = func(bucket, dir, s3Token string) *exec.Cmd {
+		mu.Lock()
+		defer mu.Unlock()
+		command := commands[min(started, len(commands)-1)]
+		started++
+		return exec.Command("sh", "-c", command)
+	}
+	awaitMount = func(string, time.Duration) error { return nil }
+	detachMount = func(string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		detached++
+		return nil
+	}
+	remountBackoff = time.Millisecond
+	maxMountFailures = 3
+	t.Cleanup(func() {
+		tigrisfsCommand, awaitMount, detachMount = oldCommand, oldAwait, oldDetach
+		remountBackoff, maxMountFailures = oldBackoff, oldFailures
+		storageReconnecting.Store(false)
+	})
+	count := func(n *int) func() int {
+		return func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return *n
+		}
+	}
+	return count(&started), count(&detached)
+}
+
+// stopMount stops a fake tigrisfs without fusermount
+func stopMount(t *testing.T, m *fuseMount) {
+	t.Helper()
+	m.mu.Lock()
+	m.stopping = true
+	m.cmd.Process.Kill()
+	m.mu.Unlock()
+	select {
+	case <-m.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor didn't stop")
+	}
+}
+
+func TestRemount(t *testing.T) {
+	// Two quick failures, then a mount that stays up
+	starts, detaches := fakeTigrisfs(t, "exit 1", "exit 1", "sleep 30")
+	m, err := mountFUSE("bucket", t.TempDir(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopMount(t, m)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for starts() < 3 || storageReconnecting.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("started %d times, reconnecting = %v", starts(), storageReconnecting.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := detaches(); n != 2 {
+		t.Errorf("cleaned up the mount %d times, want 2", n)
+	}
+}
+
+func TestRemountGivesUp(t *testing.T) {
+	starts, _ := fakeTigrisfs(t, "exit 1")
+	gaveUp := make(chan error, 1)
+	oldGaveUp := mountGaveUp
+	mountGaveUp = func(err error) { gaveUp <- err }
+	t.Cleanup(func() { mountGaveUp = oldGaveUp })
+
+	if _, err := mountFUSE("bucket", t.TempDir(), "token"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-gaveUp:
+		if err == nil {
+			t.Error("gave up without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't give up")
+	}
+	if n := starts(); n != maxMountFailures {
+		t.Errorf("started %d times, want %d", n, maxMountFailures)
+	}
+}
+
+func TestStorageReconnecting(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"index.html":  "hello",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	storageReconnecting.Store(true)
+	t.Cleanup(func() { storageReconnecting.Store(false) })
+	for _, path := range []string{"/", "/index.html", "/api/files", "/api/files/index.html"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s while reconnecting: status = %d", path, w.Code)
+		}
+	}
+
+	// Endpoints that don't touch the data directory still work
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/selfcheck", nil))
+	if w.Code != 200 {
+		t.Errorf("/api/selfcheck while reconnecting: status = %d", w.Code)
+	}
+
+	storageReconnecting.Store(false)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/index.html", nil))
+	if w.Code != 200 {
+		t.Errorf("after reconnecting: status = %d", w.Code)
+	}
+}
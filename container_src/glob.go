@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob matches a slash-separated relative path against a pattern in
+// path.Match syntax, where a "**" segment matches any number of
+// directories: "**/*.tmp" is every .tmp file, "dist/**" everything under
+// dist. Patterns are anchored, so "*.tmp" only matches at the top level.
+func matchGlob(pattern, relPath string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(segments) + 1 {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// validGlob reports whether every segment of pattern is well-formed
+func validGlob(pattern string) bool {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
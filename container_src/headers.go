@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// serverOnlyHeaders frame the response, so they can't be configured: a
+// wrong value would corrupt it
+var serverOnlyHeaders = []string{"Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range"}
+
+// HeadersConfig adds response headers to static files. String values apply
+// to every file; object values are overrides for files matching a glob:
+//
+//	"headers": {
+//	  "X-Frame-Options": "DENY",
+//	  "*.js": {"Cache-Control": "public, max-age=31536000"},
+//	  "/assets/**": {"Cache-Control": "public, max-age=31536000, immutable"}
+//	}
+//
+// Globs match like CacheControlConfig.NoCache: against the file name, or
+// against the path within the static directory if they contain a "/". The
+// global headers go first, then matching globs from least to most specific
+// (one with a "/" beats a bare name, then the longer literal text wins), so
+// the most specific glob has the final say.
+//
+// Configured headers override the server's own, like Cache-Control, and a
+// Content-Type replaces the detected one. The ones that frame the response
+// (Content-Length, Content-Encoding, ...) can't be set, and validators
+// (ETag, Last-Modified) and dev mode's no-store are always the server's.
+type HeadersConfig struct {
+	Global map[string]string
+	Globs  map[string]map[string]string
+}
+
+func (h *HeadersConfig) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("headers must be an object")
+	}
+	h.Global = make(map[string]string)
+	h.Globs = make(map[string]map[string]string)
+	for key, value := range raw {
+		var header string
+		if err := json.Unmarshal(value, &header); err == nil {
+			h.Global[key] = header
+			continue
+		}
+		var headers map[string]string
+		if err := json.Unmarshal(value, &headers); err != nil {
+			return fmt.Errorf("headers.%s must be a string, or an object of headers for files matching it", key)
+		}
+		h.Globs[key] = headers
+	}
+	return nil
+}
+
+// validate rejects headers that can't be set and malformed globs
+func (h *HeadersConfig) validate() error {
+	if h == nil {
+		return nil
+	}
+	check := func(prefix string, headers map[string]string) error {
+		for name := range headers {
+			if !validHeaderName(name) {
+				return fmt.Errorf("%s%q is not a valid header name", prefix, name)
+			}
+			if slices.Contains(serverOnlyHeaders, http.CanonicalHeaderKey(name)) {
+				return fmt.Errorf("%s%s is set by the server", prefix, name)
+			}
+		}
+		return nil
+	}
+	if err := check("headers: ", h.Global); err != nil {
+		return err
+	}
+	for pattern, headers := range h.Globs {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("headers: bad pattern %q", pattern)
+		}
+		if err := check(fmt.Sprintf("headers.%s: ", pattern), headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// forPath returns the headers for a file, given its path relative to the
+// static directory
+func (h *HeadersConfig) forPath(relPath string) http.Header {
+	if h == nil {
+		return nil
+	}
+	headers := make(http.Header)
+	for name, value := range h.Global {
+		headers.Set(name, value)
+	}
+	var matched []string
+	for pattern := range h.Globs {
+		if matchHeaderGlob(pattern, relPath) {
+			matched = append(matched, pattern)
+		}
+	}
+	slices.SortFunc(matched, func(a, b string) int {
+		if c := globSpecificity(a) - globSpecificity(b); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	for _, pattern := range matched {
+		for name, value := range h.Globs[pattern] {
+			headers.Set(name, value)
+		}
+	}
+	return headers
+}
+
+// matchHeaderGlob matches a bare pattern against the file name and one
+// with a "/" against the whole path
+func matchHeaderGlob(pattern, relPath string) bool {
+	if strings.Contains(pattern, "/") {
+		return matchPathGlob(pattern, relPath)
+	}
+	ok, _ := path.Match(pattern, path.Base(relPath))
+	return ok
+}
+
+// globSpecificity ranks patterns for forPath: any with a "/" above bare
+// names, then by how much literal text they have
+func globSpecificity(pattern string) int {
+	literal := 0
+	for _, c := range pattern {
+		if !strings.ContainsRune(`*?[]\`, c) {
+			literal++
+		}
+	}
+	if strings.Contains(pattern, "/") {
+		return 1<<16 + literal
+	}
+	return literal
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStaticHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{
+			"static": ".",
+			"cacheControl": {"default": "no-cache"},
+			"headers": {
+				"X-Frame-Options": "DENY",
+				"Content-Security-Policy": "default-src 'self'",
+				"*.js": {"Cache-Control": "public, max-age=31536000"},
+				"/assets/**": {"Cache-Control": "public, max-age=31536000, immutable", "X-Frame-Options": "SAMEORIGIN"},
+				"/assets/legacy.js": {"X-Frame-Options": "ALLOW"},
+				"*.data": {"Content-Type": "application/x-custom"}
+			}
+		}`,
+		"index.html":       "<p>hi</p>",
+		"app.js":           "js",
+		"assets/app.js":    "js",
+		"assets/legacy.js": "js",
+		"blob.data":        "data",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	tests := []struct {
+		path            string
+		wantCache       string
+		wantFrame       string
+		wantContentType string
+	}{
+		{"/index.html", "no-cache", "DENY", "text/html; charset=utf-8"},
+		{"/app.js", "public, max-age=31536000", "DENY", "text/javascript; charset=utf-8"},
+		{"/assets/app.js", "public, max-age=31536000, immutable", "SAMEORIGIN", "text/javascript; charset=utf-8"},
+		{"/assets/legacy.js", "public, max-age=31536000, immutable", "ALLOW", "text/javascript; charset=utf-8"},
+		{"/blob.data", "no-cache", "DENY", "application/x-custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != 200 {
+				t.Fatalf("status = %d", w.Code)
+			}
+			h := w.Header()
+			if got := h.Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+			if got := h.Get("X-Frame-Options"); got != tt.wantFrame {
+				t.Errorf("X-Frame-Options = %q, want %q", got, tt.wantFrame)
+			}
+			if got := h.Get("Content-Type"); !strings.EqualFold(got, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if h.Get("Content-Security-Policy") != "default-src 'self'" {
+				t.Errorf("global header missing: %v", h)
+			}
+			if h.Get("Content-Length") == "" || h.Get("ETag") == "" {
+				t.Errorf("server headers missing: %v", h)
+			}
+		})
+	}
+}
+
+func TestHeadersConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		wantErr string
+	}{
+		{"valid", `{"X-A": "1", "*.js": {"X-B": "2"}}`, ""},
+		{"framing header", `{"content-length": "5"}`, "set by the server"},
+		{"framing header in a glob", `{"*.js": {"Content-Encoding": "gzip"}}`, "set by the server"},
+		{"bad name", `{"X A": "1"}`, "not a valid header name"},
+		{"bad glob", `{"[.js": {"X-A": "1"}}`, "bad pattern"},
+		{"bad value", `{"X-A": 1}`, "must be a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": `{"static": ".", "headers": ` + tt.headers + `}`,
+			})
+			useDataDir(t, tmpDir)
+			_, err := loadConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
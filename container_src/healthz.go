@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// storageMounted is set when the data directory is FUSE-mounted, which
+// /healthz then checks is still live
+var storageMounted bool
+
+// Health is the /healthz response
+type Health struct {
+	Status string `json:"status"`           // "ok" or "unavailable"
+	Reason string `json:"reason,omitempty"` // Why it's unavailable
+}
+
+// handleHealthz serves GET /healthz, a readiness check for orchestration
+// and monitoring: 200 when the config loads and, when mounted, the data
+// directory is a live FUSE mount; 503 otherwise. It's a stat and a config
+// read, so cheap enough to poll every few seconds.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	reason := ""
+	if storageMounted && storageReconnecting.Load() {
+		reason = "storage reconnecting"
+	} else if storageMounted && !isFuseMount(dataDir) {
+		reason = "storage not mounted"
+	} else if _, err := loadConfig(); err != nil {
+		reason = "config failed to load: " + err.Error()
+	}
+	if reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Health{Status: "unavailable", Reason: reason})
+		return
+	}
+	json.NewEncoder(w).Encode(Health{Status: "ok"})
+}
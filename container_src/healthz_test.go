@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		mounted      bool
+		reconnecting bool
+		wantStatus   int
+		wantReason   string
+	}{
+		{name: "ready", config: `{"static": "."}`, wantStatus: 200},
+		{name: "bad config", config: `{"static": `, wantStatus: 503, wantReason: "config failed to load"},
+		{name: "mount missing", config: `{"static": "."}`, mounted: true, wantStatus: 503, wantReason: "storage not mounted"},
+		{name: "remounting", config: `{"static": "."}`, mounted: true, reconnecting: true, wantStatus: 503, wantReason: "storage reconnecting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{"config.json": tt.config})
+			useDataDir(t, tmpDir)
+			storageMounted = tt.mounted
+			storageReconnecting.Store(tt.reconnecting)
+			t.Cleanup(func() {
+				storageMounted = false
+				storageReconnecting.Store(false)
+			})
+
+			w := httptest.NewRecorder()
+			newServeMux(&Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var health Health
+			if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(health.Reason, tt.wantReason) {
+				t.Errorf("reason = %q, want %q", health.Reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const historySize = "10000"
+
+// historyFile is where shell history is kept when persistence is on. It
+// lives on the mount rather than in $HOME (/home/cutie), which is wiped
+// whenever the container restarts.
+func historyFile() string {
+	return filepath.Join(dataDir, ".bash_history")
+}
+
+// historyEnv returns the environment for persistent shell history, or nil
+// if it's off or the history file can't be written.
+//
+// The shell runs with --norc --noprofile, so nothing in a bashrc sets up
+// history; everything it needs comes from the environment. An interactive
+// bash still reads HISTFILE on startup with --norc. PROMPT_COMMAND appends
+// each command as it runs, since a PTY torn down by a closed WebSocket
+// doesn't give bash the chance to save history on exit.
+func historyEnv(config *Config) []string {
+	if config == nil || config.Terminal == nil || !config.Terminal.PersistHistory {
+		return nil
+	}
+
+	path := historyFile()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Shell history disabled, can't write %s: %v", path, err)
+		return nil
+	}
+	f.Close()
+	// The server creates it, but the shell has to append to it
+	if err := giveToTerminalUser(path); err != nil {
+		log.Printf("Shell history may not be saved, can't hand %s to the terminal's user: %v", path, err)
+	}
+
+	return []string{
+		"HISTFILE=" + path,
+		"HISTSIZE=" + historySize,
+		"HISTFILESIZE=" + historySize,
+		"HISTCONTROL=ignoreboth",
+		"PROMPT_COMMAND=history -a",
+	}
+}
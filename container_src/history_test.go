@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	useDataDir(t, tmpDir)
+
+	if env := historyEnv(&Config{}); env != nil {
+		t.Errorf("history on by default: %v", env)
+	}
+	if env := historyEnv(&Config{Terminal: &TerminalConfig{}}); env != nil {
+		t.Errorf("history on without persistHistory: %v", env)
+	}
+
+	env := historyEnv(&Config{Terminal: &TerminalConfig{PersistHistory: true}})
+	want := "HISTFILE=" + filepath.Join(tmpDir, ".bash_history")
+	found := false
+	for _, kv := range env {
+		if kv == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("env = %v, want %s", env, want)
+	}
+
+	// The file exists and the shell can append to it
+	f, err := os.OpenFile(filepath.Join(tmpDir, ".bash_history"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("history file isn't writable: %v", err)
+	}
+	f.Close()
+}
+
+func TestHistoryPersistsAcrossShells(t *testing.T) {
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	tmpDir := t.TempDir()
+	useDataDir(t, tmpDir)
+	env := append(os.Environ(), historyEnv(&Config{Terminal: &TerminalConfig{PersistHistory: true}})...)
+
+	// Two separate interactive shells, as two terminal sessions would be
+	run := func(input string) string {
+		cmd := exec.Command("/bin/bash", "--norc", "--noprofile", "-i")
+		cmd.Env = env
+		cmd.Stdin = strings.NewReader(input)
+		out, _ := cmd.CombinedOutput()
+		return string(out)
+	}
+	run("echo from-first-session\n")
+	if out := run("history\n"); !strings.Contains(out, "echo from-first-session") {
+		t.Errorf("second session history = %q", out)
+	}
+}
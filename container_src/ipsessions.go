@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ipSessions counts the live terminal sessions per client IP, for
+// terminal.maxSessionsPerIp. IPs are dropped from the map when their last
+// session ends, so it only ever holds current clients.
+var ipSessions = struct {
+	sync.Mutex
+	count map[string]int
+}{count: make(map[string]int)}
+
+// maxSessionsPerIP returns the cap on one client's concurrent terminal
+// sessions, or 0 for none
+func (c *TerminalConfig) maxSessionsPerIP() int {
+	if c == nil || c.MaxSessionsPerIP <= 0 {
+		return 0
+	}
+	return c.MaxSessionsPerIP
+}
+
+// acquireIPSession counts a new session for ip, reporting false (and
+// counting nothing) if ip already has limit sessions. A limit of 0 means
+// no limit; sessions are still counted.
+func acquireIPSession(ip string, limit int) bool {
+	ipSessions.Lock()
+	defer ipSessions.Unlock()
+	if limit > 0 && ipSessions.count[ip] >= limit {
+		return false
+	}
+	ipSessions.count[ip]++
+	return true
+}
+
+// releaseIPSession uncounts a session acquired for ip
+func releaseIPSession(ip string) {
+	ipSessions.Lock()
+	defer ipSessions.Unlock()
+	if ipSessions.count[ip] <= 1 {
+		delete(ipSessions.count, ip)
+		return
+	}
+	ipSessions.count[ip]--
+}
+
+// clientIP returns the IP a request came from. Behind a proxy that's the
+// last X-Forwarded-For entry, the one the proxy itself added: earlier
+// entries come from the client and can say anything.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTerminalSessionsPerIP(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"maxSessionsPerIp": 2}}`,
+	})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	// Addresses of their own, so sessions other tests leave behind on
+	// 127.0.0.1 don't count
+	dial := func(ip string) (*websocket.Conn, int) {
+		t.Helper()
+		ws, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"X-Forwarded-For": {ip}})
+		if err != nil {
+			if resp == nil {
+				t.Fatal(err)
+			}
+			return nil, resp.StatusCode
+		}
+		t.Cleanup(func() { ws.Close() })
+		ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+		readUntil(t, ws, "Welcome")
+		return ws, http.StatusSwitchingProtocols
+	}
+	count := func(ip string) int {
+		ipSessions.Lock()
+		defer ipSessions.Unlock()
+		return ipSessions.count[ip]
+	}
+
+	const ip = "203.0.113.7"
+	first, status := dial(ip)
+	if status != 101 {
+		t.Fatalf("first session: status %d", status)
+	}
+	if _, status := dial(ip); status != 101 {
+		t.Fatalf("second session: status %d", status)
+	}
+	if _, status := dial(ip); status != http.StatusTooManyRequests {
+		t.Fatalf("third session: status %d, want 429", status)
+	}
+	if got := count(ip); got != 2 {
+		t.Errorf("count = %d, want 2 (a rejected session isn't counted)", got)
+	}
+
+	// Other clients have their own budget
+	if _, status := dial("198.51.100.1"); status != 101 {
+		t.Errorf("other IP: status %d", status)
+	}
+
+	// Ending a session frees its slot
+	first.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for count(ip) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("count = %d after closing a session, want 1", count(ip))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, status := dial(ip); status != 101 {
+		t.Errorf("after closing one: status %d", status)
+	}
+}
+
+func TestIPSessionAccounting(t *testing.T) {
+	const ip = "192.0.2.1"
+	if !acquireIPSession(ip, 1) || acquireIPSession(ip, 1) {
+		t.Fatal("limit of 1 not enforced")
+	}
+	releaseIPSession(ip)
+	ipSessions.Lock()
+	_, ok := ipSessions.count[ip]
+	ipSessions.Unlock()
+	if ok {
+		t.Error("zero-count entry wasn't evicted")
+	}
+	// No limit
+	for range 5 {
+		if !acquireIPSession(ip, 0) {
+			t.Fatal("unlimited session refused")
+		}
+	}
+	for range 5 {
+		releaseIPSession(ip)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{remoteAddr: "10.0.0.1:5000", want: "10.0.0.1"},
+		{remoteAddr: "[::1]:5000", want: "::1"},
+		{remoteAddr: "10.0.0.1:5000", forwarded: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		// Only the hop the proxy added is trusted
+		{remoteAddr: "10.0.0.1:5000", forwarded: []string{"1.1.1.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{remoteAddr: "10.0.0.1:5000", forwarded: []string{"1.1.1.1", "203.0.113.7"}, want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, f := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s %v: clientIP = %q, want %q", tt.remoteAddr, tt.forwarded, got, tt.want)
+		}
+	}
+}
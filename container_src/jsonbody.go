@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const defaultMaxJSONBodyBytes = 1024 * 1024 // 1 MB
+
+// maxJSONBodyBytes returns the configured limit for JSON request bodies
+func (c *Config) maxJSONBodyBytes() int64 {
+	if c.MaxJSONBodyBytes <= 0 {
+		return defaultMaxJSONBodyBytes
+	}
+	return c.MaxJSONBodyBytes
+}
+
+// decodeJSONBody decodes a JSON control request (move, fetch, ...) into v,
+// capping the body so a huge or never-ending one can't exhaust memory.
+// This is separate from the file upload limit: these bodies only ever
+// hold a few paths. On failure it writes a 413 or 400 and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	limit := int64(defaultMaxJSONBodyBytes)
+	if config, err := loadConfig(); err == nil {
+		limit = config.maxJSONBodyBytes()
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body too large (limit %s)", formatBytes(limit)), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONBodyLimit(t *testing.T) {
+	huge := `{"from": "a.txt", "to": "b.txt", "padding": "` + strings.Repeat("x", defaultMaxJSONBodyBytes) + `"}`
+	tests := []struct {
+		name       string
+		config     string
+		body       string
+		wantStatus int
+	}{
+		{name: "normal body", config: `{"static": "."}`, body: `{"from": "a.txt", "to": "b.txt"}`, wantStatus: 200},
+		{name: "oversized body", config: `{"static": "."}`, body: huge, wantStatus: 413},
+		{name: "malformed body", config: `{"static": "."}`, body: `{"from": `, wantStatus: 400},
+		{name: "configured limit", config: `{"static": ".", "maxJsonBodyBytes": 16}`, body: `{"from": "a.txt", "to": "b.txt"}`, wantStatus: 413},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"a.txt":       "a",
+			})
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleAPIFilesMove(w, httptest.NewRequest("POST", "/api/files/move", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -10,14 +10,22 @@ const (
 	_checkNext
 )
 
+// sanitizeJSONC turns JSONC (JSON with comments and trailing commas) into
+// JSON
 func sanitizeJSONC(data []byte) []byte {
 	var state byte
-	return bytes.Map(func(r rune) rune {
+	return removeTrailingCommas(bytes.Map(func(r rune) rune {
 		checkNext := state&_checkNext != 0
 		state &^= _checkNext
 		switch r {
 		case '\n':
 			state &^= _isCommentLine
+		case '\uFEFF':
+			// Byte order marks (leading, or mid-file from concatenated
+			// files) aren't valid JSON, drop them outside of strings
+			if state&_isString == 0 {
+				return -1
+			}
 		case '\\':
 			if state&_isString != 0 {
 				state |= _checkNext
@@ -64,5 +72,34 @@ func sanitizeJSONC(data []byte) []byte {
 			return -1 // mark rune for skip
 		}
 		return r
-	}, data)
+	}, data))
+}
+
+// removeTrailingCommas blanks out, in place, commas outside of strings
+// that have nothing but whitespace before a closing } or ]
+func removeTrailingCommas(data []byte) []byte {
+	inString, escaped := false, false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case ',':
+			rest := bytes.TrimLeft(data[i+1:], " \t\r\n")
+			if len(rest) > 0 && (rest[0] == '}' || rest[0] == ']') {
+				data[i] = ' '
+			}
+		}
+	}
+	return data
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeJSONC(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{"plain JSON", `{"a": [1, 2]}`, map[string]any{"a": []any{1.0, 2.0}}},
+		{"comments", "{\n  // line\n  \"a\": 1 /* block */\n}", map[string]any{"a": 1.0}},
+		{"trailing comma in object", `{"a": 1,}`, map[string]any{"a": 1.0}},
+		{"trailing comma in array", `[1, 2,]`, []any{1.0, 2.0}},
+		{
+			"nested trailing commas",
+			"{\n  \"mounts\": [\n    {\"path\": \"/x\",},\n  ],\n  \"spa\": {\"fallback\": \"index.html\",\n  },\n}",
+			map[string]any{
+				"mounts": []any{map[string]any{"path": "/x"}},
+				"spa":    map[string]any{"fallback": "index.html"},
+			},
+		},
+		{
+			"comma before a commented-out line",
+			"{\n  \"a\": 1,\n  // \"b\": 2\n}",
+			map[string]any{"a": 1.0},
+		},
+		{
+			"commas in strings kept",
+			`{"a": ",}", "b": "x, ]", "c": "\",}",}`,
+			map[string]any{"a": ",}", "b": "x, ]", "c": `",}`},
+		},
+		{"escaped backslash ends the string", `{"a": "\\",}`, map[string]any{"a": `\`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got any
+			if err := json.Unmarshal(sanitizeJSONC([]byte(tt.input)), &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// A comma with nothing after it is still an error
+	var v any
+	if err := json.Unmarshal(sanitizeJSONC([]byte(`{"a": 1,, }`)), &v); err == nil {
+		t.Error("double comma parsed")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// maxListingBytes caps the serialized size of a file listing response (a
+// var so tests can lower it)
+var maxListingBytes = 8 * 1024 * 1024 // 8 MB
+
+// listingEntry is one encoded FileInfo
+type listingEntry struct {
+	path string
+	data []byte
+}
+
+// listingEncoder serializes FileInfo entries into a JSON array sorted by
+// path, refusing entries once the output would exceed max bytes. Sorting
+// and de-duplicating make the output stable: a directory walk interleaves
+// files and subdirectories, and can see a path twice if the tree changes
+// while it runs.
+type listingEncoder struct {
+	entries   []listingEntry
+	size      int // Encoded size so far, brackets and commas included
+	max       int
+	truncated bool
+	fields    []string // Encode only these fields, see projectFields
+}
+
+func newListingEncoder(max int) *listingEncoder {
+	return &listingEncoder{max: max, size: len("[]\n")}
+}
+
+// add appends an entry, returning false (and marking the listing
+// truncated) if it doesn't fit under the cap
+func (e *listingEncoder) add(info FileInfo) bool {
+	if e.truncated {
+		return false
+	}
+	var v any = info
+	if e.fields != nil {
+		v = projectFields(info, e.fields)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return true // skip unencodable entries rather than failing the listing
+	}
+	// +1 for the separating comma
+	if e.size+len(data)+1 > e.max {
+		e.truncated = true
+		return false
+	}
+	e.entries = append(e.entries, listingEntry{path: info.Path, data: data})
+	e.size += len(data) + 1
+	return true
+}
+
+// bytes returns the finished JSON array
+func (e *listingEncoder) bytes() []byte {
+	slices.SortStableFunc(e.entries, func(a, b listingEntry) int {
+		return strings.Compare(a.path, b.path)
+	})
+	e.entries = slices.CompactFunc(e.entries, func(a, b listingEntry) bool {
+		return a.path == b.path
+	})
+
+	var buf bytes.Buffer
+	buf.Grow(e.size)
+	buf.WriteByte('[')
+	for i, entry := range e.entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(entry.data)
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes()
+}
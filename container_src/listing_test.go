@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIFilesListByteCap(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{}
+	for i := range 200 {
+		files[fmt.Sprintf("wide/file-%03d.txt", i)] = "x"
+	}
+	writeTestFiles(t, tmpDir, files)
+	useDataDir(t, tmpDir)
+
+	oldMax := maxListingBytes
+	maxListingBytes = 2000
+	t.Cleanup(func() { maxListingBytes = oldMax })
+
+	list := func(path string) ([]FileInfo, *httptest.ResponseRecorder) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files?path="+path, nil))
+		if w.Code != 200 {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		var got []FileInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("truncated listing isn't valid JSON: %v", err)
+		}
+		return got, w
+	}
+
+	got, w := list("wide")
+	if w.Header().Get("X-Listing-Truncated") != "true" {
+		t.Errorf("missing truncation header")
+	}
+	if w.Body.Len() > maxListingBytes {
+		t.Errorf("body is %d bytes, cap is %d", w.Body.Len(), maxListingBytes)
+	}
+	if len(got) == 0 || len(got) >= 200 {
+		t.Errorf("got %d entries, want a partial listing", len(got))
+	}
+
+	// A listing under the cap is untouched
+	maxListingBytes = oldMax
+	got, w = list("wide")
+	if w.Header().Get("X-Listing-Truncated") != "" {
+		t.Errorf("unexpected truncation header")
+	}
+	if len(got) != 200 {
+		t.Errorf("got %d entries, want 200", len(got))
+	}
+}
+
+func TestAPIFilesListOrdering(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"b.txt":         "b",
+		"a/z.txt":       "z",
+		"a-b/file.txt":  "x",
+		"a/sub/y.txt":   "y",
+		"A.txt":         "A",
+		"c/d/e/f.txt":   "f",
+		"a/.hidden.txt": "h",
+	})
+	useDataDir(t, tmpDir)
+
+	list := func() []byte {
+		w := httptest.NewRecorder()
+		handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files?depth=-1", nil))
+		if w.Code != 200 {
+			t.Fatalf("status = %d", w.Code)
+		}
+		return w.Body.Bytes()
+	}
+
+	first := list()
+	var got []FileInfo
+	if err := json.Unmarshal(first, &got); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range got {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"A.txt", "a", "a-b", "a-b/file.txt", "a/.hidden.txt", "a/sub", "a/sub/y.txt", "a/z.txt", "b.txt", "c", "c/d", "c/d/e", "c/d/e/f.txt"}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("paths = %v\nwant    %v", paths, want)
+	}
+
+	for range 5 {
+		if again := list(); string(again) != string(first) {
+			t.Fatalf("listing changed between calls:\n%s\n%s", first, again)
+		}
+	}
+}
+
+func TestListingEncoderDeduplicates(t *testing.T) {
+	e := newListingEncoder(maxListingBytes)
+	e.add(FileInfo{Path: "b", Name: "b"})
+	e.add(FileInfo{Path: "a", Name: "a", Size: 1})
+	e.add(FileInfo{Path: "a", Name: "a", Size: 2})
+
+	var got []FileInfo
+	if err := json.Unmarshal(e.bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Path != "a" || got[0].Size != 1 || got[1].Path != "b" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAPIFilesListDepth(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"top.txt":           "t",
+		"a/one.txt":         "1",
+		"a/b/two.txt":       "2",
+		"a/b/c/three.txt":   "3",
+		"node_modules/x.js": "x",
+	})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		want       string
+	}{
+		{query: "", wantStatus: 200, want: "[a node_modules top.txt]"},
+		{query: "?depth=1", wantStatus: 200, want: "[a node_modules top.txt]"},
+		{query: "?depth=2", wantStatus: 200, want: "[a a/b a/one.txt node_modules node_modules/x.js top.txt]"},
+		{query: "?depth=-1", wantStatus: 200, want: "[a a/b a/b/c a/b/c/three.txt a/b/two.txt a/one.txt node_modules node_modules/x.js top.txt]"},
+		{query: "?path=a&depth=2", wantStatus: 200, want: "[a/b a/b/c a/b/two.txt a/one.txt]"},
+		{query: "?depth=0", wantStatus: 400},
+		{query: "?depth=-2", wantStatus: 400},
+		{query: "?depth=all", wantStatus: 400},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tt.query, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != 200 {
+			continue
+		}
+		var got []FileInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, f := range got {
+			paths = append(paths, f.Path)
+		}
+		if fmt.Sprint(paths) != tt.want {
+			t.Errorf("%q: paths = %v, want %s", tt.query, paths, tt.want)
+		}
+	}
+}
+
+func TestAPIFilesListModeAndTimes(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"run.sh":     "#!/bin/sh",
+		"secret.txt": "s",
+		"dir/a.txt":  "a",
+	})
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for name, perm := range map[string]os.FileMode{"run.sh": 0755, "secret.txt": 0600} {
+		if err := os.Chmod(filepath.Join(tmpDir, name), perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(tmpDir, "secret.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+
+	w := httptest.NewRecorder()
+	handleAPIFilesList(w, httptest.NewRequest("GET", "/api/files", nil))
+	var got []FileInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]FileInfo)
+	for _, f := range got {
+		byPath[f.Path] = f
+	}
+
+	tests := []struct {
+		path        string
+		wantPerm    string
+		wantSymlink bool
+		wantDir     bool
+		wantMTime   time.Time // Zero to only check it's set
+	}{
+		{path: "run.sh", wantPerm: "0755"},
+		{path: "secret.txt", wantPerm: "0600", wantMTime: mtime},
+		{path: "dir", wantPerm: "0755", wantDir: true},
+		// The link itself, not what it points to
+		{path: "link", wantPerm: "0777", wantSymlink: true},
+	}
+	for _, tt := range tests {
+		f, ok := byPath[tt.path]
+		if !ok {
+			t.Errorf("%s missing from listing", tt.path)
+			continue
+		}
+		if f.Perm != tt.wantPerm || f.IsSymlink != tt.wantSymlink || f.IsDir != tt.wantDir {
+			t.Errorf("%s: perm %q, symlink %v, dir %v", tt.path, f.Perm, f.IsSymlink, f.IsDir)
+		}
+		if f.ModTime.IsZero() || (!tt.wantMTime.IsZero() && !f.ModTime.Equal(tt.wantMTime)) {
+			t.Errorf("%s: mtime %v, want %v", tt.path, f.ModTime, tt.wantMTime)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+const (
+	defaultListingCacheTTL      = 2 * time.Second
+	defaultListingCacheMaxBytes = 32 * 1024 * 1024 // 32 MB
+	maxConcurrentListingWalks   = 4
+)
+
+// listingWalks counts directory walks done for listings, exposed at
+// /debug/vars. Cache hits don't walk.
+var listingWalks = expvar.NewInt("listing_walks")
+
+// ListingCacheConfig caches file listings briefly, so a UI polling the same
+// large directory doesn't re-walk it on every request. Writes through the
+// file API clear the cache; changes made any other way (e.g. in the
+// terminal) show up once the TTL runs out.
+type ListingCacheConfig struct {
+	TTL      Duration `json:"ttl,omitempty"`      // Default 2s
+	MaxBytes int64    `json:"maxBytes,omitempty"` // Default 32 MB
+}
+
+func (c *ListingCacheConfig) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return defaultListingCacheTTL
+	}
+	return time.Duration(c.TTL)
+}
+
+func (c *ListingCacheConfig) maxBytes() int64 {
+	if c.MaxBytes <= 0 {
+		return defaultListingCacheMaxBytes
+	}
+	return c.MaxBytes
+}
+
+// listing is an encoded listing response
+type listing struct {
+	data      []byte
+	truncated bool
+}
+
+// listingCacheEntry is a cached listing, or one being walked (ready is
+// closed once it's done)
+type listingCacheEntry struct {
+	listing
+	err     error
+	expires time.Time
+	ready   chan struct{}
+}
+
+// listingCache holds recent listings by key (the directory plus anything
+// else that shapes the response). Concurrent requests for the same key
+// share one walk, and at most maxConcurrentListingWalks walks run at once.
+type listingCache struct {
+	mu      sync.Mutex
+	entries map[string]*listingCacheEntry
+	size    int64
+	gen     uint64 // Bumped by invalidate, so walks already running aren't cached
+	walks   chan struct{}
+}
+
+func newListingCache() *listingCache {
+	return &listingCache{
+		entries: make(map[string]*listingCacheEntry),
+		walks:   make(chan struct{}, maxConcurrentListingWalks),
+	}
+}
+
+var listingsCache = newListingCache()
+
+// walk runs fn under the concurrency limit
+func (c *listingCache) walk(fn func() (listing, error)) (listing, error) {
+	c.walks <- struct{}{}
+	defer func() { <-c.walks }()
+	listingWalks.Add(1)
+	return fn()
+}
+
+// get returns the listing for key, walking with fn if it isn't cached
+func (c *listingCache) get(key string, cfg *ListingCacheConfig, fn func() (listing, error)) (listing, error) {
+	if cfg == nil {
+		return c.walk(fn)
+	}
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		select {
+		case <-entry.ready:
+			if time.Now().Before(entry.expires) {
+				c.mu.Unlock()
+				return entry.listing, nil
+			}
+			c.remove(key)
+		default:
+			// Someone else is walking it, wait for their result
+			c.mu.Unlock()
+			<-entry.ready
+			return entry.listing, entry.err
+		}
+	}
+	entry := &listingCacheEntry{ready: make(chan struct{})}
+	c.entries[key] = entry
+	gen := c.gen
+	c.mu.Unlock()
+
+	result, err := c.walk(fn)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.listing, entry.err = result, err
+	entry.expires = time.Now().Add(cfg.ttl())
+	close(entry.ready)
+
+	if c.entries[key] == entry {
+		if err != nil || gen != c.gen || int64(len(result.data)) > cfg.maxBytes() {
+			delete(c.entries, key)
+		} else {
+			c.size += int64(len(result.data))
+			c.evict(cfg.maxBytes(), key)
+		}
+	}
+	return result, err
+}
+
+// evict drops expired entries, then the soonest to expire, until the cache
+// fits in maxBytes. Callers hold mu.
+func (c *listingCache) evict(maxBytes int64, keep string) {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if key != keep && isReady(entry) && !now.Before(entry.expires) {
+			c.remove(key)
+		}
+	}
+	for c.size > maxBytes {
+		oldest := ""
+		for key, entry := range c.entries {
+			if key != keep && isReady(entry) && (oldest == "" || entry.expires.Before(c.entries[oldest].expires)) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		c.remove(oldest)
+	}
+}
+
+// remove drops a finished entry. Callers hold mu.
+func (c *listingCache) remove(key string) {
+	c.size -= int64(len(c.entries[key].data))
+	delete(c.entries, key)
+}
+
+// invalidate forgets every listing, e.g. after a write through the file
+// API. Any write can change the listing of every ancestor directory, so
+// there's no point being selective.
+func (c *listingCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key, entry := range c.entries {
+		if isReady(entry) {
+			c.remove(key)
+		} else {
+			delete(c.entries, key) // Not counted in size until it's done
+		}
+	}
+}
+
+func isReady(entry *listingCacheEntry) bool {
+	select {
+	case <-entry.ready:
+		return true
+	default:
+		return false
+	}
+}
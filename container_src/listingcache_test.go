@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListingCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":   `{"static": ".", "listingCache": {"ttl": "1h"}}`,
+		"big/a.txt":     "a",
+		"big/sub/b.txt": "b",
+	})
+	useDataDir(t, tmpDir)
+	old := listingsCache
+	listingsCache = newListingCache()
+	t.Cleanup(func() { listingsCache = old })
+	mux := newServeMux(&Config{})
+
+	list := func(path string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files?path="+path, nil))
+		if w.Code != 200 {
+			t.Fatalf("status = %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	walks := listingWalks.Value()
+	first := list("big")
+	if second := list("big"); second != first {
+		t.Errorf("cached listing differs:\n%s\n%s", first, second)
+	}
+	if got := listingWalks.Value() - walks; got != 1 {
+		t.Errorf("walks = %d, want 1 (second listing should hit the cache)", got)
+	}
+
+	// Keyed by path
+	list("big/sub")
+	if got := listingWalks.Value() - walks; got != 2 {
+		t.Errorf("walks = %d, want 2", got)
+	}
+
+	// A write through the file API clears it
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/api/files/big/c.txt", strings.NewReader("c")))
+	if w.Code != 200 {
+		t.Fatalf("PUT status = %d", w.Code)
+	}
+	if after := list("big"); !strings.Contains(after, "big/c.txt") {
+		t.Errorf("listing after write is stale: %s", after)
+	}
+	if got := listingWalks.Value() - walks; got != 3 {
+		t.Errorf("walks = %d, want 3", got)
+	}
+}
+
+func TestListingCacheExpiryAndSharing(t *testing.T) {
+	c := newListingCache()
+	cfg := &ListingCacheConfig{TTL: Duration(50 * time.Millisecond)}
+	walks := 0
+	var mu sync.Mutex
+	release := make(chan struct{})
+	fn := func() (listing, error) {
+		mu.Lock()
+		walks++
+		mu.Unlock()
+		<-release
+		return listing{data: []byte("[]")}, nil
+	}
+
+	// Concurrent requests for the same key share one walk
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.get("dir", cfg, fn)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if walks != 1 {
+		t.Errorf("walks = %d, want 1", walks)
+	}
+
+	// And the result expires
+	time.Sleep(60 * time.Millisecond)
+	c.get("dir", cfg, fn)
+	if walks != 2 {
+		t.Errorf("walks after expiry = %d, want 2", walks)
+	}
+
+	// Listings bigger than the budget aren't kept
+	small := &ListingCacheConfig{TTL: Duration(time.Hour), MaxBytes: 1}
+	c.get("big", small, fn)
+	c.get("big", small, fn)
+	if walks != 4 {
+		t.Errorf("walks for oversized listing = %d, want 4", walks)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// liveReloadPath is the SSE endpoint the injected script listens on
+const liveReloadPath = "/__livereload"
+
+// liveReloadInterval is how often a connected page's static files are
+// rescanned (a var so tests can shorten it)
+var liveReloadInterval = time.Second
+
+// liveReloadScript reloads the page when the server says files changed.
+// EventSource reconnects by itself, e.g. across a server restart.
+const liveReloadScript = `<script>
+new EventSource("` + liveReloadPath + `").addEventListener("reload", () => location.reload());
+</script>
+`
+
+// devModeEnabled reports whether dev mode is on, via "devMode" in config
+// or DEV_MODE=true. Dev mode rewrites the HTML being served, so it must
+// never be on for a real site.
+func (c *Config) devModeEnabled() bool {
+	if c.DevMode {
+		return true
+	}
+	v, _ := strconv.ParseBool(os.Getenv("DEV_MODE"))
+	return v
+}
+
+// injectLiveReload adds the live-reload script to an HTML page, before
+// </body> if it has one. It returns a new slice: content may be shared
+// with the static file cache.
+func injectLiveReload(content []byte) []byte {
+	at := bytes.LastIndex(bytes.ToLower(content), []byte("</body>"))
+	if at < 0 {
+		at = len(content)
+	}
+	out := make([]byte, 0, len(content)+len(liveReloadScript))
+	out = append(out, content[:at]...)
+	out = append(out, liveReloadScript...)
+	return append(out, content[at:]...)
+}
+
+// staticFingerprint summarizes every file's path, size and mtime under the
+// static directories, so any change to them changes the result.
+//
+// This polls rather than using inotify because the S3 mount doesn't emit
+// change events. That's a walk per connected page per interval, which is
+// fine for a dev server and another reason dev mode is opt-in.
+func staticFingerprint(staticDirs []string) uint64 {
+	h := fnv.New64a()
+	for _, dir := range staticDirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // Vanished mid-walk, the next scan will see it
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return h.Sum64()
+}
+
+// handleLiveReload sends a "reload" Server-Sent Event whenever the static
+// files change. It 404s unless dev mode is on, including when the config
+// can't be loaded.
+func handleLiveReload(w http.ResponseWriter, r *http.Request) {
+	config, err := loadConfig()
+	if err != nil || !config.devModeEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	staticDirs, err := resolveStaticDirs(config.Static, config.Mounts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, ": watching\n\n")
+	flusher.Flush()
+
+	last := staticFingerprint(staticDirs)
+	ticker := time.NewTicker(liveReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if current := staticFingerprint(staticDirs); current != last {
+				last = current
+				fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
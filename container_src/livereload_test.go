@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveReloadInjection(t *testing.T) {
+	t.Setenv("DEV_MODE", "")
+	page := "<html><body><h1>hi</h1></BODY></html>"
+
+	tests := []struct {
+		name       string
+		config     string
+		env        string
+		path       string
+		wantScript bool
+	}{
+		{name: "off by default", config: `{"static": "."}`, path: "/"},
+		{name: "dev mode config", config: `{"static": ".", "devMode": true}`, path: "/", wantScript: true},
+		{name: "DEV_MODE env", config: `{"static": "."}`, env: "true", path: "/", wantScript: true},
+		{name: "not html", config: `{"static": ".", "devMode": true}`, path: "/app.js"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"index.html":  page,
+				"app.js":      "console.log('</body>')",
+			})
+			useDataDir(t, tmpDir)
+			t.Setenv("DEV_MODE", tt.env)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			body := w.Body.String()
+			if got := strings.Contains(body, liveReloadPath); got != tt.wantScript {
+				t.Fatalf("script injected = %v, want %v:\n%s", got, tt.wantScript, body)
+			}
+			if !tt.wantScript {
+				if w.Header().Get("ETag") == "" {
+					t.Error("missing ETag")
+				}
+				return
+			}
+			if !strings.HasSuffix(body, "</BODY></html>") || !strings.HasPrefix(body, "<html><body><h1>hi</h1><script>") {
+				t.Errorf("script not placed before </body>:\n%s", body)
+			}
+			if w.Header().Get("Content-Length") != strconv.Itoa(len(body)) {
+				t.Errorf("content-length = %s, body is %d bytes", w.Header().Get("Content-Length"), len(body))
+			}
+			if w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("etag = %q, cache-control = %q", w.Header().Get("ETag"), w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestInjectLiveReloadWithoutBody(t *testing.T) {
+	content := []byte("<p>fragment</p>")
+	got := string(injectLiveReload(content))
+	if got != "<p>fragment</p>"+liveReloadScript {
+		t.Errorf("got %q", got)
+	}
+	if string(content) != "<p>fragment</p>" {
+		t.Errorf("input modified: %q", content)
+	}
+}
+
+func TestLiveReloadEvents(t *testing.T) {
+	t.Setenv("DEV_MODE", "")
+	old := liveReloadInterval
+	liveReloadInterval = 10 * time.Millisecond
+	t.Cleanup(func() { liveReloadInterval = old })
+
+	// Off unless dev mode is on
+	off := t.TempDir()
+	writeTestFiles(t, off, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, off)
+	w := httptest.NewRecorder()
+	handleLiveReload(w, httptest.NewRequest("GET", liveReloadPath, nil))
+	if w.Code != 404 {
+		t.Fatalf("dev mode off: status = %d, want 404", w.Code)
+	}
+
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":     `{"static": "site", "devMode": true}`,
+		"site/index.html": "<body></body>",
+	})
+	useDataDir(t, tmpDir)
+
+	server := httptest.NewServer(newServeMux(&Config{}))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + liveReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	if line := <-lines; line != ": watching" {
+		t.Fatalf("first line = %q", line)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "site/new.css"), []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if line == "event: reload" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no reload event after a file changed")
+		}
+	}
+}
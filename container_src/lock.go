@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockTTL = time.Minute
+	maxLockTTL     = 10 * time.Minute
+)
+
+// lockNow is the lock clock (swapped in tests)
+var lockNow = time.Now
+
+// FileLock describes the advisory lock on a file
+type FileLock struct {
+	Path      string     `json:"path"`
+	Locked    bool       `json:"locked"`
+	Holder    string     `json:"holder,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// LockRequest acquires or renews a lock
+type LockRequest struct {
+	Holder string  `json:"holder"`        // Identifies the client, e.g. a per-tab ID
+	TTL    float64 `json:"ttl,omitempty"` // Seconds, default 60, max 600
+}
+
+// fileLock is a held lock
+type fileLock struct {
+	holder  string
+	expires time.Time
+}
+
+// fileLocks tracks which client has each file open in an editor. Locks are
+// advisory: writes never check them, they only let the UI warn about
+// concurrent edits. They expire unless renewed, so a crashed client can't
+// hold one forever.
+type fileLocks struct {
+	mu    sync.Mutex
+	locks map[string]fileLock // By absolute path
+}
+
+var editorLocks = &fileLocks{locks: make(map[string]fileLock)}
+
+// current returns the live lock on path, dropping it if it has expired.
+// Callers hold mu.
+func (l *fileLocks) current(path string) (fileLock, bool) {
+	lock, ok := l.locks[path]
+	if ok && !lockNow().Before(lock.expires) {
+		delete(l.locks, path)
+		return fileLock{}, false
+	}
+	return lock, ok
+}
+
+// acquire takes or renews the lock for holder, returning the lock that is
+// now in effect and whether holder has it
+func (l *fileLocks) acquire(path, holder string, ttl time.Duration) (fileLock, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lock, ok := l.current(path); ok && lock.holder != holder {
+		return lock, false
+	}
+	lock := fileLock{holder: holder, expires: lockNow().Add(ttl)}
+	l.locks[path] = lock
+	return lock, true
+}
+
+// release drops holder's lock, reporting false if someone else holds it
+func (l *fileLocks) release(path, holder string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.current(path)
+	if !ok {
+		return true
+	}
+	if lock.holder != holder {
+		return false
+	}
+	delete(l.locks, path)
+	return true
+}
+
+// get returns the live lock on path, if any
+func (l *fileLocks) get(path string) (fileLock, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current(path)
+}
+
+// lockTarget reports whether a /api/files/ path addresses the lock on a
+// file, i.e. "<file>/lock" where <file> is a regular file. That can't
+// collide with a real file named "lock", since a file has no children.
+func lockTarget(filePath string) (string, bool) {
+	target, ok := strings.CutSuffix(filePath, "/lock")
+	if !ok {
+		return "", false
+	}
+	absPath, err := validateAndResolvePath(target)
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(absPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return absPath, true
+}
+
+// writeLock responds with the lock state for absPath
+func writeLock(w http.ResponseWriter, status int, absPath string, lock fileLock, locked bool) {
+	resp := FileLock{Path: toRelativePath(absPath), Locked: locked}
+	if locked {
+		resp.Holder = lock.holder
+		resp.ExpiresAt = &lock.expires
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAPIFileLock serves /api/files/<path>/lock: GET shows the holder,
+// POST acquires or renews (409 with the current holder if someone else has
+// it) and DELETE ?holder= releases
+func handleAPIFileLock(w http.ResponseWriter, r *http.Request, absPath string) {
+	switch r.Method {
+	case "GET":
+		lock, locked := editorLocks.get(absPath)
+		writeLock(w, http.StatusOK, absPath, lock, locked)
+
+	case "POST":
+		var req LockRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Holder == "" {
+			http.Error(w, "holder is required", http.StatusBadRequest)
+			return
+		}
+		ttl := defaultLockTTL
+		if req.TTL < 0 {
+			http.Error(w, "ttl must be positive", http.StatusBadRequest)
+			return
+		}
+		if req.TTL > 0 {
+			ttl = min(time.Duration(req.TTL*float64(time.Second)), maxLockTTL)
+		}
+
+		lock, acquired := editorLocks.acquire(absPath, req.Holder, ttl)
+		status := http.StatusOK
+		if !acquired {
+			status = http.StatusConflict
+		}
+		writeLock(w, status, absPath, lock, true)
+
+	case "DELETE":
+		holder := r.URL.Query().Get("holder")
+		if holder == "" {
+			http.Error(w, "holder query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if !editorLocks.release(absPath, holder) {
+			lock, locked := editorLocks.get(absPath)
+			writeLock(w, http.StatusConflict, absPath, lock, locked)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
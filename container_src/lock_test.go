@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIFileLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"src/app.js":  "app",
+	})
+	useDataDir(t, tmpDir)
+
+	now := time.Now()
+	lockNow = func() time.Time { return now }
+	t.Cleanup(func() { lockNow = time.Now })
+	old := editorLocks
+	editorLocks = &fileLocks{locks: make(map[string]fileLock)}
+	t.Cleanup(func() { editorLocks = old })
+
+	mux := newServeMux(&Config{})
+	do := func(method, target, body string) (int, FileLock) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var lock FileLock
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			if err := json.Unmarshal(w.Body.Bytes(), &lock); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, lock
+	}
+
+	// Unlocked to start with
+	if code, lock := do("GET", "/api/files/src/app.js/lock", ""); code != 200 || lock.Locked || lock.Path != "src/app.js" {
+		t.Fatalf("initial: %d %+v", code, lock)
+	}
+
+	// Acquire
+	if code, lock := do("POST", "/api/files/src/app.js/lock", `{"holder": "tab-a", "ttl": 30}`); code != 200 || !lock.Locked || lock.Holder != "tab-a" {
+		t.Fatalf("acquire: %d %+v", code, lock)
+	}
+	if code, lock := do("GET", "/api/files/src/app.js/lock", ""); code != 200 || lock.Holder != "tab-a" || !lock.ExpiresAt.Equal(now.Add(30*time.Second)) {
+		t.Errorf("holder query: %d %+v", code, lock)
+	}
+
+	// Someone else is told who has it
+	if code, lock := do("POST", "/api/files/src/app.js/lock", `{"holder": "tab-b"}`); code != 409 || lock.Holder != "tab-a" {
+		t.Errorf("conflicting acquire: %d %+v", code, lock)
+	}
+	if code, _ := do("DELETE", "/api/files/src/app.js/lock?holder=tab-b", ""); code != 409 {
+		t.Errorf("release by non-holder: %d", code)
+	}
+
+	// Release, then the other client can take it
+	if code, _ := do("DELETE", "/api/files/src/app.js/lock?holder=tab-a", ""); code != 204 {
+		t.Errorf("release: %d", code)
+	}
+	if code, lock := do("POST", "/api/files/src/app.js/lock", `{"holder": "tab-b", "ttl": 5}`); code != 200 || lock.Holder != "tab-b" {
+		t.Errorf("acquire after release: %d %+v", code, lock)
+	}
+
+	// Renewing extends the expiry
+	now = now.Add(4 * time.Second)
+	if code, _ := do("POST", "/api/files/src/app.js/lock", `{"holder": "tab-b", "ttl": 5}`); code != 200 {
+		t.Errorf("renew: %d", code)
+	}
+	now = now.Add(4 * time.Second)
+	if _, lock := do("GET", "/api/files/src/app.js/lock", ""); !lock.Locked {
+		t.Error("renewed lock expired early")
+	}
+
+	// A crashed client's lock expires
+	now = now.Add(2 * time.Second)
+	if _, lock := do("GET", "/api/files/src/app.js/lock", ""); lock.Locked {
+		t.Errorf("lock didn't expire: %+v", lock)
+	}
+	if code, lock := do("POST", "/api/files/src/app.js/lock", `{"holder": "tab-a"}`); code != 200 || lock.Holder != "tab-a" {
+		t.Errorf("acquire after expiry: %d %+v", code, lock)
+	}
+
+	// Locks are advisory: writes still go through
+	if code, _ := do("PUT", "/api/files/src/app.js", "new content"); code != 200 {
+		t.Errorf("write to locked file: %d", code)
+	}
+
+	if code, _ := do("POST", "/api/files/src/app.js/lock", `{}`); code != 400 {
+		t.Errorf("missing holder: %d", code)
+	}
+	// Only regular files have locks; anything else is a normal file path
+	if code, _ := do("GET", "/api/files/src/lock", ""); code != 404 {
+		t.Errorf("directory lock: %d", code)
+	}
+	if code, _ := do("GET", "/api/files/missing.js/lock", ""); code != 404 {
+		t.Errorf("missing file lock: %d", code)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// logQueueSize caps entries waiting to be sent. Past it, the oldest are
+	// dropped, so an endpoint that's down for good can't use up memory.
+	logQueueSize = 1000
+	// maxLogBatch is how many entries go in one request at most
+	maxLogBatch = 100
+	// logSendAttempts is how many times a batch is tried before it's given
+	// up on
+	logSendAttempts = 3
+	// logSendTimeout bounds each attempt, so a hung endpoint can't stall
+	// the logger
+	logSendTimeout = 5 * time.Second
+)
+
+// logRetryBackoff is the wait before the first retry, doubling for each
+// one after (a var so tests can shorten it)
+var logRetryBackoff = 500 * time.Millisecond
+
+// LogEntry is one line for the Logs Durable Object, which takes a JSON
+// array of them
+type LogEntry struct {
+	TS  string `json:"ts"` // Nanoseconds since the epoch
+	Log string `json:"log"`
+}
+
+// errLogRejected is a send that won't work however often it's retried,
+// like a 401 for a bad token
+var errLogRejected = errors.New("log write rejected")
+
+// logQueue holds entries for the Logs Durable Object and sends them from a
+// single goroutine, in order and in batches. Network errors and 5xx
+// responses are retried with exponential backoff, since the Durable Object
+// may just be starting up; entries logged meanwhile wait in the queue.
+type logQueue struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	dropped int
+	sending bool
+	wake    chan struct{}
+	idle    *sync.Cond // Broadcast when the queue is empty and nothing is being sent
+	start   sync.Once
+	// send posts a batch (swapped in tests)
+	send func([]LogEntry) error
+}
+
+func newLogQueue(send func([]LogEntry) error) *logQueue {
+	q := &logQueue{wake: make(chan struct{}, 1), send: send}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+var logShipper = newLogQueue(postLogs)
+
+// enqueue adds an entry, starting the sender if it isn't running yet
+func (q *logQueue) enqueue(entry LogEntry) {
+	q.start.Do(func() { go q.loop() })
+	q.mu.Lock()
+	if len(q.entries) >= logQueueSize {
+		q.entries = q.entries[1:]
+		q.dropped++
+	}
+	q.entries = append(q.entries, entry)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sends whatever is queued, one batch at a time
+func (q *logQueue) loop() {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			if dropped := q.dropped; dropped > 0 {
+				q.dropped = 0
+				log.Printf("Log queue full, dropped %d entries", dropped)
+			}
+			if len(q.entries) == 0 {
+				q.sending = false
+				q.idle.Broadcast()
+				q.mu.Unlock()
+				break
+			}
+			batch := q.entries[:min(len(q.entries), maxLogBatch)]
+			q.entries = q.entries[len(batch):]
+			q.sending = true
+			q.mu.Unlock()
+
+			if err := q.sendWithRetries(batch); err != nil {
+				log.Printf("Failed to send %d log entries: %v", len(batch), err)
+			}
+		}
+	}
+}
+
+// sendWithRetries sends batch, retrying transient failures
+func (q *logQueue) sendWithRetries(batch []LogEntry) error {
+	backoff := logRetryBackoff
+	var err error
+	for attempt := 1; attempt <= logSendAttempts; attempt++ {
+		if err = q.send(batch); err == nil || errors.Is(err, errLogRejected) {
+			return err
+		}
+		if attempt < logSendAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// flush waits up to timeout for everything queued to be sent (or given
+// up on), reporting whether it was
+func (q *logQueue) flush(timeout time.Duration) bool {
+	timer := time.AfterFunc(timeout, func() {
+		q.mu.Lock()
+		q.idle.Broadcast()
+		q.mu.Unlock()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(timeout)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.entries) > 0 || q.sending {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		q.idle.Wait()
+	}
+	return true
+}
+
+// postLogs sends a batch to the Logs Durable Object's /write endpoint.
+// Failures worth retrying are returned as is; the rest wrap
+// errLogRejected.
+func postLogs(entries []LogEntry) error {
+	logsEndpoint := logsEndpointURL()
+	logsToken := os.Getenv("LOGS_TOKEN")
+	if logsEndpoint == "" || logsToken == "" {
+		return nil // Unconfigured since it was queued
+	}
+
+	jsonData, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLogRejected, err)
+	}
+	req, err := http.NewRequest("POST", logsEndpoint+"/write", strings.NewReader(string(jsonData)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLogRejected, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+logsToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: logSendTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%d - %s", resp.StatusCode, string(body))
+		if resp.StatusCode < 500 {
+			return fmt.Errorf("%w: %v", errLogRejected, err)
+		}
+		return err
+	}
+	return nil
+}
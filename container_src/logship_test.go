@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogShipping(t *testing.T) {
+	oldBackoff := logRetryBackoff
+	logRetryBackoff = time.Millisecond
+	t.Cleanup(func() { logRetryBackoff = oldBackoff })
+
+	tests := []struct {
+		name string
+		// statuses are the responses to each request in turn, 200 after
+		statuses     []int
+		wantAttempts int
+		wantLogs     []string
+	}{
+		{"delivered", nil, 1, []string{"a", "b"}},
+		{"retried after 503", []int{503, 502}, 3, []string{"a", "b"}},
+		{"given up after 3 attempts", []int{500, 500, 500}, 3, nil},
+		{"rejected token not retried", []int{401}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			var logs []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.URL.Path != "/write" || r.Header.Get("Authorization") != "Bearer secret" {
+					t.Errorf("request to %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				attempts++
+				if attempts <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[attempts-1])
+					return
+				}
+				var entries []LogEntry
+				json.NewDecoder(r.Body).Decode(&entries)
+				for _, entry := range entries {
+					logs = append(logs, entry.Log)
+				}
+			}))
+			defer server.Close()
+			t.Setenv("LOGS_ENDPOINT", server.URL)
+			t.Setenv("LOGS_TOKEN", "secret")
+			t.Setenv("LOGS_HOST_REWRITE", "false")
+
+			q := newLogQueue(postLogs)
+			q.enqueue(LogEntry{TS: "1", Log: "a"})
+			q.enqueue(LogEntry{TS: "2", Log: "b"})
+			if !q.flush(5 * time.Second) {
+				t.Fatal("flush timed out")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// Both entries are usually one batch, but the first can go alone
+			if attempts < tt.wantAttempts || attempts > tt.wantAttempts*2 {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if len(logs) != len(tt.wantLogs) || (len(logs) > 0 && (logs[0] != "a" || logs[1] != "b")) {
+				t.Errorf("logs = %q, want %q", logs, tt.wantLogs)
+			}
+		})
+	}
+}
+
+func TestLogQueueKeepsEntriesWhileDown(t *testing.T) {
+	oldBackoff := logRetryBackoff
+	logRetryBackoff = time.Millisecond
+	t.Cleanup(func() { logRetryBackoff = oldBackoff })
+
+	// The endpoint is down until release is closed
+	release := make(chan struct{})
+	sending := make(chan struct{}, 1)
+	var mu sync.Mutex
+	var sent []string
+	q := newLogQueue(func(entries []LogEntry) error {
+		select {
+		case sending <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			sent = append(sent, entry.Log)
+		}
+		return nil
+	})
+
+	q.enqueue(LogEntry{Log: "first"})
+	<-sending
+	for i := 0; i < logQueueSize+10; i++ {
+		q.enqueue(LogEntry{Log: "queued"})
+	}
+	if q.flush(50 * time.Millisecond) {
+		t.Fatal("flush succeeded while the endpoint was down")
+	}
+	close(release)
+	if !q.flush(5 * time.Second) {
+		t.Fatal("flush timed out")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// "first" was already being sent; of the rest, only the newest fit
+	if len(sent) != 1+logQueueSize || sent[0] != "first" {
+		t.Errorf("sent %d entries, want %d", len(sent), 1+logQueueSize)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"mime"
@@ -16,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,9 +32,17 @@ import (
 const (
 	pongWait   = 60 * time.Second
 	pingPeriod = (pongWait * 9) / 10
-	dataDir    = "/data"
+
+	// serverPort is the port the container's HTTP server listens on
+	serverPort = 8283
+
+	// maxAutoRenameAttempts caps the "name (n).ext" search on collisions
+	maxAutoRenameAttempts = 1000
 )
 
+// dataDir is the root of the user's files (a var so tests can point it elsewhere)
+var dataDir = "/data"
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow all origins for development
@@ -38,12 +52,29 @@ var upgrader = websocket.Upgrader{
 }
 
 type ptySession struct {
-	cmd  *exec.Cmd
-	ptmx *os.File
-	ws   *websocket.Conn
+	// The name it's registered under in terminalSessions, see sessions.go
+	name    string
+	started time.Time
+	cmd     *exec.Cmd
+	ptmx    *os.File
+	ws      *websocket.Conn
 	// Do we really need this?
 	mu     sync.Mutex
 	closed bool
+	// Read-only connections watching the session, see share.go
+	viewers map[*websocket.Conn]struct{}
+	// Uncounts the session from its client's IP, see ipsessions.go
+	release func()
+	// Closed once the shell has exited and been reaped
+	done chan struct{}
+	// Set when the shell was sent SIGHUP for a shutdown, see shutdown.go
+	hungUp bool
+
+	// Set when the session outlives its connection for reconnects, see
+	// resume.go. ws is nil while it's waiting for one.
+	grace       time.Duration
+	scrollback  *scrollback
+	orphanTimer *time.Timer
 }
 
 type resizeMessage struct {
@@ -54,10 +85,29 @@ type resizeMessage struct {
 
 // FileInfo represents file metadata for API responses
 type FileInfo struct {
-	Path  string `json:"path"`  // Relative to base directory
-	Name  string `json:"name"`  // Basename of file
-	IsDir bool   `json:"isDir"` // True if directory
-	Size  int64  `json:"size"`  // File size in bytes
+	Path      string    `json:"path"`      // Relative to base directory
+	Name      string    `json:"name"`      // Basename of file
+	IsDir     bool      `json:"isDir"`     // True if directory
+	Size      int64     `json:"size"`      // File size in bytes
+	ModTime   time.Time `json:"mtime"`     // RFC 3339
+	Perm      string    `json:"perm"`      // Octal permissions, e.g. "0644"
+	IsSymlink bool      `json:"isSymlink"` // The entry itself is a symlink
+	// Mode, owner and group, only in ?detailed=true listings
+	*FileDetails
+}
+
+// newFileInfo builds the FileInfo for a file at relPath. info comes from
+// Lstat (or a DirEntry), so symlinks describe the link itself.
+func newFileInfo(relPath string, info os.FileInfo) FileInfo {
+	return FileInfo{
+		Path:      relPath,
+		Name:      info.Name(),
+		IsDir:     info.IsDir(),
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Perm:      permString(info.Mode()),
+		IsSymlink: info.Mode()&os.ModeSymlink != 0,
+	}
 }
 
 // MoveRequest represents a file move/rename operation
@@ -66,36 +116,252 @@ type MoveRequest struct {
 	To   string `json:"to"`   // Destination path (relative to base directory)
 }
 
+// MoveResponse is returned after a successful move
+type MoveResponse struct {
+	Path string `json:"path"` // Final destination path (relative to base directory)
+}
+
+// ExistsResponse is returned by the existence check endpoint
+type ExistsResponse struct {
+	Exists bool `json:"exists"`
+	IsDir  bool `json:"isDir"`
+}
+
 // Config represents the user's configuration file
 type Config struct {
-	Static string `json:"static"`
+	// Static is the directory to serve, or an ordered list of directories
+	// to layer (e.g. ["overrides", "dist"]) where the first match wins
+	Static StaticDirs   `json:"static"`
+	Cache  *CacheConfig `json:"cache,omitempty"` // Optional in-memory cache for small files
+	// AutoIndex lists directories that have no index.html instead of 404ing
+	AutoIndex bool `json:"autoIndex,omitempty"`
+	// Precompressed serves "file.gz" sidecars to clients that accept gzip
+	Precompressed bool `json:"precompressed,omitempty"`
+	// Compression tunes compressing text files on the fly, see compression.go
+	Compression *CompressionConfig `json:"compression,omitempty"`
+	// DropPageCache keeps large files out of the kernel page cache
+	DropPageCache *DropPageCacheConfig `json:"dropPageCache,omitempty"`
+	// SlowRequestThreshold (e.g. "500ms") only logs requests slower than
+	// this, plus errors. Everything else is summarized periodically.
+	SlowRequestThreshold Duration `json:"slowRequestThreshold,omitempty"`
+	// Terminal controls the shell endpoints (/ws, /ws/exec)
+	Terminal *TerminalConfig `json:"terminal,omitempty"`
+	// FileAPI controls the /api/files endpoints
+	FileAPI *FileAPIConfig `json:"fileApi,omitempty"`
+	// SPA falls back to the app's index.html for missing routes, see spa.go
+	SPA *SPAConfig `json:"spa,omitempty"`
+	// ImmutablePaths (e.g. ["/assets/**"]) get a year-long immutable
+	// Cache-Control, for build output with content hashes in the names.
+	// Only the no-cache list takes precedence, see cachecontrol.go.
+	ImmutablePaths []string `json:"immutablePaths,omitempty"`
+	// MimeTypes adds or overrides MIME types by extension, e.g.
+	// {".wasm": "application/wasm", ".md": "text/plain; charset=utf-8"}
+	MimeTypes map[string]string `json:"mimeTypes,omitempty"`
+	// DefaultContentType is the Content-Type for files with no or an
+	// unknown extension. Unset, they're sniffed: text is served as
+	// text/plain, anything else as application/octet-stream.
+	DefaultContentType string `json:"defaultContentType,omitempty"`
+	// DefaultCharset is added to text Content-Types (text/*, JSON,
+	// JavaScript, SVG, ...) that don't name one, so browsers don't have to
+	// guess. Default "utf-8"; "none" leaves them as they are.
+	DefaultCharset string `json:"defaultCharset,omitempty"`
+	// CacheControl sets Cache-Control on static files, see cachecontrol.go
+	CacheControl *CacheControlConfig `json:"cacheControl,omitempty"`
+	// Headers adds response headers to static files, globally or by glob,
+	// see headers.go
+	Headers *HeadersConfig `json:"headers,omitempty"`
+	// Redirects send old URLs to new ones, first match wins, see redirect.go
+	Redirects []RedirectRule `json:"redirects,omitempty"`
+	// CanonicalHost (e.g. "example.com") redirects requests for any other
+	// host, like www.example.com, to it with a 301
+	CanonicalHost string `json:"canonicalHost,omitempty"`
+	// ForceHTTPS redirects plain http requests (per X-Forwarded-Proto) to https
+	ForceHTTPS bool `json:"forceHTTPS,omitempty"`
+	// MaxJSONBodyBytes caps JSON request bodies on control endpoints like
+	// move and fetch (default 1 MB). File uploads have their own limit.
+	MaxJSONBodyBytes int64 `json:"maxJsonBodyBytes,omitempty"`
+	// ListingCache briefly caches file listings, see listingcache.go
+	ListingCache *ListingCacheConfig `json:"listingCache,omitempty"`
+	// ArchiveCache makes directory downloads resumable, see archive.go
+	ArchiveCache *ArchiveCacheConfig `json:"archiveCache,omitempty"`
+	// KeepAlive tunes HTTP keep-alive for connections from the tunnel
+	KeepAlive *KeepAliveConfig `json:"keepAlive,omitempty"`
+	// Schedule runs commands periodically, see schedule.go
+	Schedule []ScheduleEntry `json:"schedule,omitempty"`
+	// DevMode injects a live-reload script into HTML, see livereload.go.
+	// Never for production: it changes the pages being served.
+	DevMode bool `json:"devMode,omitempty"`
+	// Debug adds a Server-Timing header to static responses, breaking
+	// down where the server spent its time
+	Debug bool `json:"debug,omitempty"`
+	// ProtectedPaths (e.g. ["data/**"]) can't be deleted through the file
+	// API, on top of the config files themselves. Same syntax as
+	// immutablePaths.
+	ProtectedPaths []string `json:"protectedPaths,omitempty"`
+	// Mounts expose directories outside the data directory. They're set by
+	// the operator in CUTE_MOUNTS, never by the file, see mounts.go.
+	Mounts []MountConfig `json:"-"`
+	// Preload sends Link preload headers with HTML pages, see preload.go
+	Preload []PreloadLink `json:"preload,omitempty"`
+	// Proxy forwards path prefixes to upstream servers, see proxy.go
+	Proxy ProxyConfig `json:"proxy,omitempty"`
+	// Sitemap generates /sitemap.xml from the static HTML pages, see sitemap.go
+	Sitemap *SitemapConfig `json:"sitemap,omitempty"`
+	// Versions saves the previous content of files overwritten through the
+	// file API, see versions.go
+	Versions *VersionsConfig `json:"versions,omitempty"`
+	// Templates names directories (relative to the data directory) that
+	// new directories can be seeded from, e.g. {"site": "templates/site"}.
+	// See mkdir.go.
+	Templates map[string]string `json:"templates,omitempty"`
+	// NotFound is a page in the static directory (e.g. "404.html") served
+	// with a 404 for missing files in place of the built-in one
+	NotFound string `json:"notFound,omitempty"`
+}
+
+// TerminalConfig controls the shell endpoints. They're on by default for
+// backward compatibility, but anything that's purely a static site should
+// set "enabled": false since the terminal is a shell inside the container.
+type TerminalConfig struct {
+	Enabled *bool `json:"enabled,omitempty"`
+	// PersistHistory keeps shell history across sessions in .bash_history
+	// on the mount. Off by default, so sessions are ephemeral.
+	PersistHistory bool `json:"persistHistory,omitempty"`
+	// MaxSessionDuration (e.g. "8h") ends every session after this long,
+	// active or not. SessionWarning (default 5m) is how much notice the
+	// user gets in the terminal beforehand. See sessionlimit.go.
+	MaxSessionDuration Duration `json:"maxSessionDuration,omitempty"`
+	SessionWarning     Duration `json:"sessionWarning,omitempty"`
+	// MaxSessionsPerIP caps one client's concurrent sessions, so a single
+	// client can't hog the container. Unlimited by default. See
+	// ipsessions.go.
+	MaxSessionsPerIP int `json:"maxSessionsPerIp,omitempty"`
+	// ReconnectGrace (e.g. "5m") keeps a session's shell running this long
+	// after its connection drops, so reconnecting with the same name picks
+	// up where it left off, recent output included. Off by default, so
+	// sessions end with their connection. See resume.go.
+	ReconnectGrace Duration `json:"reconnectGrace,omitempty"`
+}
+
+// FileAPIConfig controls the file API endpoints (on by default)
+type FileAPIConfig struct {
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+func (c *Config) terminalEnabled() bool {
+	return c.Terminal == nil || c.Terminal.Enabled == nil || *c.Terminal.Enabled
 }
 
-// ConfigCache holds the parsed config with its modification time
+func (c *Config) fileAPIEnabled() bool {
+	return c.FileAPI == nil || c.FileAPI.Enabled == nil || *c.FileAPI.Enabled
+}
+
+// mimeType picks the Content-Type for a file, preferring the config's
+// MimeTypes over the system table. Files the extension says nothing about
+// get DefaultContentType, or else are sniffed. Text types get the default
+// charset. See contenttype.go.
+func (c *Config) mimeType(name string) string {
+	if c == nil {
+		c = &Config{}
+	}
+	return withCharset(c.baseMimeType(name), c.DefaultCharset)
+}
+
+func (c *Config) baseMimeType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if mimeType, ok := c.MimeTypes[ext]; ok {
+		return mimeType
+	}
+	if mimeType, ok := c.MimeTypes[strings.TrimPrefix(ext, ".")]; ok && ext != "" {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		return mimeType
+	}
+	if c.DefaultContentType != "" {
+		return c.DefaultContentType
+	}
+	return sniffContentType(name)
+}
+
+// Duration is a time.Duration that reads from JSON strings like "1m30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"500ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// StaticDirs is one or more static directories, from a JSON string or array
+type StaticDirs []string
+
+func (s *StaticDirs) UnmarshalJSON(data []byte) error {
+	var dir string
+	if err := json.Unmarshal(data, &dir); err == nil {
+		*s = StaticDirs{dir}
+		if dir == "" {
+			*s = nil
+		}
+		return nil
+	}
+	var dirs []string
+	if err := json.Unmarshal(data, &dirs); err != nil {
+		return fmt.Errorf("static must be a string or an array of strings")
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			return fmt.Errorf("static directories must not be empty")
+		}
+	}
+	*s = dirs
+	return nil
+}
+
+func (s StaticDirs) String() string {
+	return strings.Join(s, ", ")
+}
+
+// ConfigCache holds the parsed config with the file's path and
+// modification time. A change to either means a reload, since switching
+// from config.json to config.jsonc can leave the mtime the same.
 type ConfigCache struct {
 	config  *Config
+	path    string // Which config file was loaded, see configCandidates
 	modTime time.Time
 	mu      sync.RWMutex
 }
 
 var configCache = &ConfigCache{}
 
+// isFuseMount reports whether path is on a FUSE filesystem
+func isFuseMount(path string) bool {
+	const FUSE_SUPER_MAGIC = 0x65735546 // FUSE filesystem magic number
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+	return stat.Type == FUSE_SUPER_MAGIC
+}
+
 // waitForMount polls until the directory is a FUSE mount (not a regular directory)
 func waitForMount(path string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
 
-	const FUSE_SUPER_MAGIC = 0x65735546 // FUSE filesystem magic number
-
 	for range ticker.C {
-		var stat syscall.Statfs_t
-		if err := syscall.Statfs(path, &stat); err == nil {
-			// Check if it's a FUSE filesystem
-			if stat.Type == FUSE_SUPER_MAGIC {
-				log.Printf("Mount at %s is ready (FUSE detected)", path)
-				return nil
-			}
+		if isFuseMount(path) {
+			log.Printf("Mount at %s is ready (FUSE detected)", path)
+			return nil
 		}
 
 		if time.Now().After(deadline) {
@@ -106,7 +372,7 @@ func waitForMount(path string, timeout time.Duration) error {
 }
 
 // validateAndResolvePath validates a relative path and converts it to absolute
-// Returns absolute path within dataDir or error if invalid
+// Returns absolute path within dataDir (or a configured mount) or error if invalid
 func validateAndResolvePath(relativePath string) (string, error) {
 	// Clean the path to remove .. and .
 	cleanPath := filepath.Clean(relativePath)
@@ -114,11 +380,16 @@ func validateAndResolvePath(relativePath string) (string, error) {
 	// Remove leading slash if present
 	cleanPath = strings.TrimPrefix(cleanPath, "/")
 
+	// Configured mounts are the only way outside dataDir
+	if absPath, _, ok := resolveMountPath(cleanPath); ok {
+		return absPath, nil
+	}
+
 	// Build absolute path
 	absPath := filepath.Join(dataDir, cleanPath)
 
 	// Security check: ensure path is within dataDir
-	if !strings.HasPrefix(absPath, dataDir+string(filepath.Separator)) && absPath != dataDir {
+	if !pathWithin(absPath, dataDir) {
 		return "", fmt.Errorf("invalid path: must be within %q", dataDir)
 	}
 
@@ -127,6 +398,9 @@ func validateAndResolvePath(relativePath string) (string, error) {
 
 // toRelativePath converts absolute path to relative (strips dataDir prefix)
 func toRelativePath(absPath string) string {
+	if rel, ok := mountRelativePath(absPath); ok {
+		return rel
+	}
 	// Remove dataDir/ prefix
 	rel := strings.TrimPrefix(absPath, dataDir+string(filepath.Separator))
 	// Also handle exact match for dataDir (root)
@@ -138,63 +412,57 @@ func toRelativePath(absPath string) string {
 	return rel
 }
 
-// writeLog sends a log entry to the Logs Durable Object
-func writeLog(logMessage string) {
-	// Get logs endpoint from environment (set by container runtime)
-	logsEndpoint := os.Getenv("LOGS_ENDPOINT")
-	logsToken := os.Getenv("LOGS_TOKEN")
-
-	// Replace entire host with host.docker.internal if URL contains localhost
-	if strings.Contains(logsEndpoint, "localhost") || strings.Contains(logsEndpoint, "127.0.0.1") {
-		if parsedURL, err := url.Parse(logsEndpoint); err == nil {
-			parsedURL.Host = strings.Replace(parsedURL.Host, parsedURL.Hostname(), "host.docker.internal", 1)
-			logsEndpoint = parsedURL.String()
-		}
-	}
+// inDocker reports whether we're running in a Docker container (a var so
+// tests can pretend either way)
+var inDocker = func() bool {
+	_, err := os.Stat("/.dockerenv")
+	return err == nil
+}
 
-	if logsEndpoint == "" || logsToken == "" {
-		// Silently skip if not configured
-		return
+// rewriteLogsHost decides whether a localhost LOGS_ENDPOINT should point at
+// host.docker.internal instead. LOGS_HOST_REWRITE=true/false forces it;
+// otherwise we only rewrite inside Docker, where localhost is the
+// container itself. Running natively, localhost already is the host.
+func rewriteLogsHost() bool {
+	if v, err := strconv.ParseBool(os.Getenv("LOGS_HOST_REWRITE")); err == nil {
+		return v
 	}
+	return inDocker()
+}
 
-	// Create log entry with nanosecond timestamp
-	ts := fmt.Sprintf("%d", time.Now().UnixNano())
-	logEntry := map[string]interface{}{
-		"ts":  ts,
-		"log": logMessage,
+// logsEndpointURL returns LOGS_ENDPOINT, with a localhost host swapped for
+// host.docker.internal when running in Docker (see rewriteLogsHost)
+func logsEndpointURL() string {
+	logsEndpoint := os.Getenv("LOGS_ENDPOINT")
+	if logsEndpoint == "" || !rewriteLogsHost() {
+		return logsEndpoint
 	}
-
-	logs := []map[string]interface{}{logEntry}
-	jsonData, err := json.Marshal(logs)
+	parsedURL, err := url.Parse(logsEndpoint)
 	if err != nil {
-		log.Printf("Failed to marshal log: %v", err)
-		return
+		return logsEndpoint
 	}
-
-	// Send to logs endpoint
-	req, err := http.NewRequest("POST", logsEndpoint+"/write", strings.NewReader(string(jsonData)))
-	if err != nil {
-		log.Printf("Failed to create log request: %v", err)
-		return
+	if host := parsedURL.Hostname(); host == "localhost" || host == "127.0.0.1" {
+		parsedURL.Host = strings.Replace(parsedURL.Host, host, "host.docker.internal", 1)
+		return parsedURL.String()
 	}
+	return logsEndpoint
+}
 
-	req.Header.Set("Authorization", "Bearer "+logsToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Failed to send log: %v", err)
+// writeLog sends a log entry to the Logs Durable Object. It's queued and
+// sent in the background, with retries, see logship.go.
+func writeLog(logMessage string) {
+	// Silently skip if not configured
+	if logsEndpointURL() == "" || os.Getenv("LOGS_TOKEN") == "" {
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Log write failed: %d - %s", resp.StatusCode, string(body))
-	}
+	logShipper.enqueue(LogEntry{TS: fmt.Sprintf("%d", time.Now().UnixNano()), Log: logMessage})
 }
 
+// defaultConfig is the config.json created for a new computer
+const defaultConfig = `{
+  "static": "."
+}`
+
 // ensureConfigExists creates a default config file if none exists
 func ensureConfigExists() error {
 	// Check for both .json and .jsonc
@@ -208,10 +476,6 @@ func ensureConfigExists() error {
 
 	// Neither exists, create default config.json
 	configPath = fmt.Sprintf("%s/config.json", dataDir)
-	defaultConfig := `{
-  "static": "."
-}`
-
 	if err := os.WriteFile(configPath, []byte(defaultConfig), 0644); err != nil {
 		return fmt.Errorf("failed to create default config: %w", err)
 	}
@@ -220,16 +484,35 @@ func ensureConfigExists() error {
 	return nil
 }
 
+// configCandidates lists config file names in priority order. Setting
+// CUTE_ENV=prod puts config.prod.json(c) ahead of the plain config.json(c).
+func configCandidates() []string {
+	names := []string{"config.json", "config.jsonc"}
+	env := os.Getenv("CUTE_ENV")
+	if env != "" && !strings.ContainsAny(env, `/\`) && env != "." && env != ".." {
+		names = append([]string{"config." + env + ".json", "config." + env + ".jsonc"}, names...)
+	}
+	return names
+}
+
+// findConfigFile returns the path of the config file in use
+func findConfigFile() (string, error) {
+	names := configCandidates()
+	for _, name := range names {
+		configPath := filepath.Join(dataDir, name)
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath, nil
+		}
+	}
+	return "", fmt.Errorf("no config file found (tried %s)", strings.Join(names, ", "))
+}
+
 // loadConfig loads the config file with caching based on modification time
 func loadConfig() (*Config, error) {
 	// Find which config file exists
-	configPath := ""
-	if _, err := os.Stat(fmt.Sprintf("%s/config.json", dataDir)); err == nil {
-		configPath = fmt.Sprintf("%s/config.json", dataDir)
-	} else if _, err := os.Stat(fmt.Sprintf("%s/config.jsonc", dataDir)); err == nil {
-		configPath = fmt.Sprintf("%s/config.jsonc", dataDir)
-	} else {
-		return nil, fmt.Errorf("no config file found (tried config.json and config.jsonc)")
+	configPath, err := findConfigFile()
+	if err != nil {
+		return nil, err
 	}
 
 	// Stat the file to check modification time
@@ -240,14 +523,35 @@ func loadConfig() (*Config, error) {
 
 	// Check cache
 	configCache.mu.RLock()
-	if configCache.config != nil && configCache.modTime.Equal(info.ModTime()) {
+	if configCache.config != nil && configCache.path == configPath && configCache.modTime.Equal(info.ModTime()) {
 		config := configCache.config
 		configCache.mu.RUnlock()
 		return config, nil
 	}
 	configCache.mu.RUnlock()
 
-	// Need to reload
+	return readConfigFile(configPath, info.ModTime())
+}
+
+// reloadConfig re-reads the config file even if its mtime hasn't changed
+// (FUSE mounts don't always update it promptly). Like any load, the new
+// config replaces the old one in a single swap, so a request in flight
+// keeps using the snapshot it started with.
+func reloadConfig() (*Config, string, error) {
+	configPath, err := findConfigFile()
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to stat config file: %w", err)
+	}
+	config, err := readConfigFile(configPath, info.ModTime())
+	return config, configPath, err
+}
+
+// readConfigFile parses and validates a config file and caches the result
+func readConfigFile(configPath string, modTime time.Time) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -255,6 +559,8 @@ func loadConfig() (*Config, error) {
 
 	// Strip comments for JSONC support
 	data = sanitizeJSONC(data)
+	// Fill in ${VAR}s, see configenv.go
+	data = expandConfigEnv(data)
 
 	// Parse JSON
 	var config Config
@@ -263,22 +569,66 @@ func loadConfig() (*Config, error) {
 	}
 
 	// Validate
-	if config.Static == "" {
+	if len(config.Static) == 0 {
 		return nil, fmt.Errorf("config.static field is required")
 	}
+	if config.Mounts, err = operatorMounts(); err != nil {
+		return nil, err
+	}
+	if err := config.Proxy.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateNotFound(config.NotFound); err != nil {
+		return nil, err
+	}
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Headers.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateRedirects(config.Redirects); err != nil {
+		return nil, err
+	}
 
 	// Update cache
 	configCache.mu.Lock()
 	configCache.config = &config
-	configCache.modTime = info.ModTime()
+	configCache.path = configPath
+	configCache.modTime = modTime
 	configCache.mu.Unlock()
 
 	log.Printf("Loaded config from %s: static=%s", configPath, config.Static)
 	return &config, nil
 }
 
-// resolveStaticPath resolves the static directory path securely
-func resolveStaticPath(staticPath string) (string, error) {
+// ConfigReloadResponse reports a successful POST /api/config/reload
+type ConfigReloadResponse struct {
+	ConfigFile string `json:"configFile"`
+}
+
+// handleAPIConfigReload re-reads the config file on demand, so changes to
+// MIME types, cache rules and the like apply without a restart (which
+// would drop terminal sessions). An invalid config is reported and the
+// previous one stays in effect until it's fixed.
+func handleAPIConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, configPath, err := reloadConfig()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload config: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigReloadResponse{ConfigFile: toRelativePath(configPath)})
+}
+
+// resolveStaticPath resolves the static directory path securely. The
+// directory may be (or be under) a symlink, so the check is on where it
+// really is: inside the data directory, or inside one of mounts.
+func resolveStaticPath(staticPath string, mounts []MountConfig) (string, error) {
 	// Resolve relative to dataDir
 	var fullPath string
 	if filepath.IsAbs(staticPath) {
@@ -290,21 +640,92 @@ func resolveStaticPath(staticPath string) (string, error) {
 	// Clean the path to remove .. and .
 	fullPath = filepath.Clean(fullPath)
 
-	// Security: ensure path is within dataDir
-	if !strings.HasPrefix(fullPath, dataDir+string(filepath.Separator)) && fullPath != dataDir {
+	// Security: a path that climbs out of dataDir is an error whatever it
+	// resolves to
+	if !filepath.IsAbs(staticPath) && !pathWithin(fullPath, dataDir) {
 		return "", fmt.Errorf("static path must be within %q (got: %s)", dataDir, fullPath)
 	}
 
 	// Check if directory exists
-	info, err := os.Stat(fullPath)
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", errStaticDirNotFound, fullPath)
+	}
+	if !staticRootAllowed(realPath, mounts) {
+		return "", fmt.Errorf("static path must be within %q (got: %s, which resolves to %s)", dataDir, fullPath, realPath)
+	}
+	info, err := os.Stat(realPath)
 	if err != nil {
-		return "", fmt.Errorf("static directory not found: %s", fullPath)
+		return "", fmt.Errorf("%w: %s", errStaticDirNotFound, fullPath)
 	}
 	if !info.IsDir() {
 		return "", fmt.Errorf("static path is not a directory: %s", fullPath)
 	}
 
-	return fullPath, nil
+	// Keep the configured path when it's in dataDir, so served files map
+	// back to the paths the file API uses
+	if pathWithin(fullPath, dataDir) {
+		return fullPath, nil
+	}
+	return realPath, nil
+}
+
+// staticRootAllowed reports whether realPath, with symlinks resolved, is
+// inside the data directory or one of mounts
+func staticRootAllowed(realPath string, mounts []MountConfig) bool {
+	roots := []string{dataDir}
+	for _, m := range mounts {
+		roots = append(roots, filepath.Clean(m.Path))
+	}
+	for _, root := range roots {
+		// The roots may be behind symlinks themselves
+		if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+			root = realRoot
+		}
+		if pathWithin(realPath, root) {
+			return true
+		}
+	}
+	return false
+}
+
+var errStaticDirNotFound = errors.New("static directory not found")
+
+// resolveStaticDirs resolves each configured static directory. Layers that
+// don't exist are skipped (an overrides/ directory may come and go), but
+// one outside the sandbox is an error, as is having none at all.
+func resolveStaticDirs(dirs StaticDirs, mounts []MountConfig) ([]string, error) {
+	var resolved []string
+	var firstErr error
+	for _, dir := range dirs {
+		fullPath, err := resolveStaticPath(dir, mounts)
+		if errors.Is(err, errStaticDirNotFound) {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, fullPath)
+	}
+	if len(resolved) == 0 {
+		if firstErr == nil {
+			firstErr = errStaticDirNotFound
+		}
+		return nil, firstErr
+	}
+	return resolved, nil
+}
+
+// commandEnv returns the base environment for processes run on behalf of the user
+func commandEnv() []string {
+	return []string{
+		"HOME=/home/cutie",
+		"USER=cutie",
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/home/cutie/.bun/bin",
+	}
 }
 
 func getShell() string {
@@ -323,11 +744,38 @@ func getShell() string {
 func (s *ptySession) close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.closeLocked(websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"))
+}
 
+// end closes the session, telling the owner and any viewers why with a
+// close frame (see closecodes.go for the codes)
+func (s *ptySession) end(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	if s.ws != nil {
+		s.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteWait))
+		// Unblocks the read loop
+		s.ws.Close()
+	}
+	s.closeLocked(msg)
+}
+
+// closeLocked ends the shell and sends viewers closeMsg. The caller holds
+// s.mu.
+func (s *ptySession) closeLocked(closeMsg []byte) {
 	if s.closed {
 		return
 	}
 	s.closed = true
+	terminalSessions.remove(s)
+	s.closeViewers(closeMsg)
+	if s.release != nil {
+		s.release()
+	}
 
 	if s.ptmx != nil {
 		s.ptmx.Close()
@@ -337,9 +785,10 @@ func (s *ptySession) close() {
 	}
 }
 
-func serveErrorPage(w http.ResponseWriter, statusCode int, title, message, details string) {
-	w.WriteHeader(statusCode)
+// servePage writes a full HTML page using the shared Cute Computer styling
+func servePage(w http.ResponseWriter, statusCode int, title, body string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
 
 	html := fmt.Sprintf(`<!DOCTYPE html>
 <html lang="en">
@@ -391,24 +840,54 @@ func serveErrorPage(w http.ResponseWriter, statusCode int, title, message, detai
             white-space: pre-wrap;
             word-break: break-word;
         }
+        .listing {
+            width: 100%%;
+            border-collapse: collapse;
+            font-size: 15px;
+        }
+        .listing td {
+            padding: 6px 10px;
+            border-bottom: 1px solid #f3e8ff;
+        }
+        .listing td.size {
+            color: #6b7280;
+            text-align: right;
+            white-space: nowrap;
+        }
+        .listing a {
+            color: #7c3aed;
+            text-decoration: none;
+        }
+        .listing a:hover {
+            text-decoration: underline;
+        }
     </style>
 </head>
 <body>
     <div class="container">
-        <h1>%s</h1>
-        <div class="message">%s</div>
         %s
     </div>
 </body>
-</html>`, title, title, message, details)
+</html>`, title, body)
 
 	w.Write([]byte(html))
 }
 
+// serveErrorPage renders an error page. All of the text is escaped, since
+// details in particular often echo the request path or an error message.
+func serveErrorPage(w http.ResponseWriter, statusCode int, title, message, details string) {
+	if details != "" {
+		details = fmt.Sprintf(`<div class="details">%s</div>`, html.EscapeString(details))
+	}
+	body := fmt.Sprintf(`<h1>%s</h1>
+        <div class="message">%s</div>
+        %s`, html.EscapeString(title), html.EscapeString(message), details)
+	servePage(w, statusCode, html.EscapeString(title), body)
+}
+
 func serve404(w http.ResponseWriter, path string) {
-	details := fmt.Sprintf(`<div class="details">%s</div>`, path)
 	serveErrorPage(w, http.StatusNotFound, "404 - File Not Found",
-		"The file you're looking for doesn't exist.", details)
+		"The file you're looking for doesn't exist.", path)
 }
 
 // handleAPIFilesList lists files in a directory
@@ -442,37 +921,80 @@ func handleAPIFilesList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Walk directory tree recursively
-	var files []FileInfo
-	err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory itself
-		if path == absPath {
-			return nil
-		}
-
-		relPath := toRelativePath(path)
-		files = append(files, FileInfo{
-			Path:  relPath,
-			Name:  info.Name(),
-			IsDir: info.IsDir(),
-			Size:  info.Size(),
-		})
-
-		return nil
+	var cacheConfig *ListingCacheConfig
+	if config, err := loadConfig(); err == nil {
+		cacheConfig = config.ListingCache
+	}
+	// Detailed listings stat owners too, so they're opt-in
+	opts := listingOptions{detailed: r.URL.Query().Get("detailed") == "true"}
+	if err := parseListingFields(r.URL.Query().Get("fields"), &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := parseListingDepth(r.URL.Query().Get("depth"), &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, err := listingsCache.get(opts.cacheKey(absPath), cacheConfig, func() (listing, error) {
+		return walkListing(absPath, opts)
 	})
-
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Return JSON response
+	// Return JSON response, flagging listings cut short by the size cap
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(files)
+	if files.truncated {
+		w.Header().Set("X-Listing-Truncated", "true")
+	}
+	w.Write(files.data)
+}
+
+// walkListing lists a directory opts.depth levels deep, stopping once the
+// response is too big. It reads directories rather than walking the whole
+// tree, so shallow listings of big trees stay cheap.
+func walkListing(absPath string, opts listingOptions) (listing, error) {
+	files := newListingEncoder(maxListingBytes)
+	files.fields = opts.fields
+	if _, err := readListingDir(files, absPath, opts, opts.depth); err != nil {
+		return listing{}, err
+	}
+	return listing{data: files.bytes(), truncated: files.truncated}, nil
+}
+
+// readListingDir adds dirPath's entries to files, descending into
+// subdirectories while depth allows. It reports false once files is full.
+func readListingDir(files *listingEncoder, dirPath string, opts listingOptions, depth int) (bool, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range entries {
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // Removed since the directory was read
+			}
+			return false, err
+		}
+
+		path := filepath.Join(dirPath, d.Name())
+		entry := newFileInfo(toRelativePath(path), info)
+		if opts.detailed {
+			entry.FileDetails = fileDetails(info)
+		}
+		if !files.add(entry) {
+			return false, nil
+		}
+
+		if info.IsDir() && depth != 1 {
+			if more, err := readListingDir(files, path, opts, depth-1); err != nil || !more {
+				return false, err
+			}
+		}
+	}
+	return true, nil
 }
 
 // handleAPIFilesGet reads a file's content
@@ -495,12 +1017,44 @@ func handleAPIFilesGet(w http.ResponseWriter, r *http.Request, filePath string)
 		return
 	}
 
-	// Don't serve directories as file content
+	// Directories can only be downloaded as an archive
 	if info.IsDir() {
+		if r.URL.Query().Get("archive") == "tar.gz" {
+			serveDirectoryArchive(w, r, absPath)
+			return
+		}
 		http.Error(w, "Path is a directory", http.StatusBadRequest)
 		return
 	}
 
+	// Detect MIME type, the same way static files do
+	config, _ := loadConfig()
+	mimeType := config.mimeType(absPath)
+
+	// Validators, so clients can revalidate instead of downloading again
+	etag := staticETag(info, "")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if notModified(r, etag, info.ModTime()) {
+		writeNotModified(w)
+		return
+	}
+
+	// Stream just the requested bytes for Range requests
+	w.Header().Set("Accept-Ranges", "bytes")
+	if r.Header.Get("Range") != "" && ifRangeMatches(r.Header.Get("If-Range"), etag, info.ModTime()) &&
+		serveFileRange(w, r, absPath, info.Size(), mimeType) {
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+
+	// HEAD probes a file without transferring it
+	if r.Method == "HEAD" {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		return
+	}
+
 	// Read file content
 	content, err := os.ReadFile(absPath)
 	if err != nil {
@@ -508,45 +1062,88 @@ func handleAPIFilesGet(w http.ResponseWriter, r *http.Request, filePath string)
 		return
 	}
 
-	// Detect MIME type
-	mimeType := mime.TypeByExtension(filepath.Ext(absPath))
-	if mimeType == "" {
-		mimeType = "text/plain"
-	}
-
 	// Return file content
-	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
 	w.Write(content)
 }
 
-// handleAPIFilesPut creates or updates a file
-func handleAPIFilesPut(w http.ResponseWriter, r *http.Request, filePath string) {
+// handleAPIFilesExists reports whether a path exists and whether it's a directory
+func handleAPIFilesExists(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	// Validate and resolve path
-	absPath, err := validateAndResolvePath(filePath)
+	absPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Read request body
-	content, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	var resp ExistsResponse
+	info, err := os.Stat(absPath)
+	if err == nil {
+		resp.Exists = true
+		resp.IsDir = info.IsDir()
+	} else if !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+		// ENOTDIR means a parent is a file, so the path can't exist either
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Create parent directories if needed
-	parentDir := filepath.Dir(absPath)
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create parent directories: %v", err), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAPIFilesPut creates or updates a file
+func handleAPIFilesPut(w http.ResponseWriter, r *http.Request, filePath string) {
+	// Validate and resolve path
+	absPath, err := validateAndResolveWritePath(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
 		return
 	}
 
-	// Write file
-	if err := os.WriteFile(absPath, content, 0644); err != nil {
+	// An optional X-Content-SHA256 lets the client catch uploads corrupted
+	// in transit
+	var wantSHA256 []byte
+	if header := r.Header.Get("X-Content-SHA256"); header != "" {
+		if wantSHA256, err = hex.DecodeString(header); err != nil || len(wantSHA256) != sha256.Size {
+			http.Error(w, "X-Content-SHA256 must be a hex-encoded SHA-256 digest", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// With versioning on, keep the content being replaced
+	config, _ := loadConfig()
+	keepVersions := config.versionsKeep()
+	var savedVersion string
+	if keepVersions > 0 && !inVersionsDir(absPath) {
+		if savedVersion, err = saveVersion(absPath); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save previous version: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Stream the body to a temp file that's renamed into place once it's
+	// complete (and verified)
+	if _, err := writeFileAtomicChecked(absPath, r.Body, 0, wantSHA256); err != nil {
+		if savedVersion != "" {
+			os.Remove(savedVersion) // Nothing was replaced
+		}
+		if errors.Is(err, errChecksumMismatch) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to write file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if savedVersion != "" {
+		if err := pruneVersions(absPath, keepVersions); err != nil {
+			log.Printf("Failed to prune versions of %s: %v", absPath, err)
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -554,9 +1151,33 @@ func handleAPIFilesPut(w http.ResponseWriter, r *http.Request, filePath string)
 // handleAPIFilesDelete deletes a file
 func handleAPIFilesDelete(w http.ResponseWriter, r *http.Request, filePath string) {
 	// Validate and resolve path
-	absPath, err := validateAndResolvePath(filePath)
+	absPath, err := validateAndResolveWritePath(filePath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+	config, _ := loadConfig()
+	if config.protects(absPath) {
+		http.Error(w, "Path is protected", http.StatusForbidden)
+		return
+	}
+
+	// Non-empty directories need ?recursive=true, so a stray click can't
+	// take out a whole tree. Even then, never the root or a mount's root.
+	if r.URL.Query().Get("recursive") == "true" {
+		if isRootPath(absPath) {
+			http.Error(w, "Refusing to recursively delete the root directory", http.StatusBadRequest)
+			return
+		}
+		if protected, ok := config.protectsWithin(absPath); ok {
+			http.Error(w, fmt.Sprintf("Directory contains a protected path: %s", protected), http.StatusForbidden)
+			return
+		}
+		if err := os.RemoveAll(absPath); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete directory: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
@@ -567,6 +1188,10 @@ func handleAPIFilesDelete(w http.ResponseWriter, r *http.Request, filePath strin
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
+		if errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) {
+			http.Error(w, "Directory not empty (delete with ?recursive=true)", http.StatusConflict)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -578,21 +1203,20 @@ func handleAPIFilesDelete(w http.ResponseWriter, r *http.Request, filePath strin
 func handleAPIFilesMove(w http.ResponseWriter, r *http.Request) {
 	// Parse JSON request body
 	var req MoveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
 	// Validate paths
-	fromPath, err := validateAndResolvePath(req.From)
+	fromPath, err := validateAndResolveWritePath(req.From)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid source path: %v", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid source path: %v", err), pathErrorStatus(err))
 		return
 	}
 
-	toPath, err := validateAndResolvePath(req.To)
+	toPath, err := validateAndResolveWritePath(req.To)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid destination path: %v", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Invalid destination path: %v", err), pathErrorStatus(err))
 		return
 	}
 
@@ -613,13 +1237,48 @@ func handleAPIFilesMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Pick a free name instead of overwriting if requested
+	if r.URL.Query().Get("autorename") == "true" {
+		toPath, err = autoRenamePath(toPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
 	// Move/rename file
 	if err := os.Rename(fromPath, toPath); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to move file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Return the final destination, which may differ from the request
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MoveResponse{Path: toRelativePath(toPath)})
+}
+
+// autoRenamePath returns absPath if nothing exists there, otherwise the first
+// free "name (n).ext" variant, e.g. "report.pdf" -> "report (1).pdf"
+func autoRenamePath(absPath string) (string, error) {
+	if _, err := os.Lstat(absPath); os.IsNotExist(err) {
+		return absPath, nil
+	}
+
+	dir, name := filepath.Split(absPath)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// Dotfiles like ".env" are all extension, number the whole name
+		base, ext = name, ""
+	}
+
+	for n := 1; n <= maxAutoRenameAttempts; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, n, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %q after %d attempts", name, maxAutoRenameAttempts)
 }
 
 // responseWriter wraps http.ResponseWriter to capture status code
@@ -630,7 +1289,10 @@ type responseWriter struct {
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	// Informational responses like 103 come before the real status
+	if code >= 200 {
+		rw.statusCode = code
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
@@ -640,6 +1302,12 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// proxied responses can flush and hijack
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // formatBytes converts bytes to human-readable format
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -668,8 +1336,35 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.2fs", d.Seconds())
 }
 
-// logRequest logs HTTP request with beautiful formatting
-func logRequest(method, path string, status int, duration time.Duration, size int64) {
+// sendLog ships a line to the Logs Durable Object (swapped out in tests)
+var sendLog = writeLog
+
+// fastRequests counts requests that were skipped by slow-request logging,
+// reported periodically by summarizeFastRequests
+var fastRequests atomic.Int64
+
+// summarizeFastRequests logs how many fast requests went unlogged every interval
+func summarizeFastRequests(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if n := fastRequests.Swap(0); n > 0 {
+			sendLog(fmt.Sprintf("%d fast requests in the last %s", n, interval))
+		}
+	}
+}
+
+// logRequest logs HTTP request with beautiful formatting. With a non-zero
+// slowThreshold only slow or unsuccessful requests are logged, the rest
+// are just counted.
+func logRequest(method, path string, status int, duration time.Duration, size int64, slowThreshold time.Duration) {
+	// 304s are a cache working as intended, not an anomaly
+	ok := (status >= 200 && status < 300) || status == http.StatusNotModified
+	if slowThreshold > 0 && ok && duration < slowThreshold {
+		fastRequests.Add(1)
+		return
+	}
+
 	statusText := http.StatusText(status)
 	durationStr := formatDuration(duration)
 	sizeStr := formatBytes(size)
@@ -678,7 +1373,7 @@ func logRequest(method, path string, status int, duration time.Duration, size in
 	logMsg := fmt.Sprintf("%s %s -> %d %s (%s, %s)",
 		method, path, status, statusText, durationStr, sizeStr)
 
-	writeLog(logMsg)
+	sendLog(logMsg)
 }
 
 // handleHTTP serves static files based on config
@@ -694,94 +1389,244 @@ func handleHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Defer logging until after response is sent
+	var slowThreshold time.Duration
 	defer func() {
 		duration := time.Since(startTime)
-		logRequest(r.Method, r.URL.Path, rw.statusCode, duration, rw.written)
+		logRequest(r.Method, r.URL.Path, rw.statusCode, duration, rw.written, slowThreshold)
 	}()
-	// Only serve GET and HEAD requests
-	if r.Method != "GET" && r.Method != "HEAD" {
-		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+	// The config and site are both in the data directory
+	if storageReconnecting.Load() {
+		rw.Header().Set("Retry-After", "5")
+		serveErrorPage(rw, http.StatusServiceUnavailable, "Storage Reconnecting",
+			"The connection to this computer's storage dropped and is being restored. Please try again in a few seconds.",
+			"")
 		return
 	}
 
 	// Load config
+	timing := newServerTiming()
 	config, err := loadConfig()
+	timing.mark("config")
 	if err != nil {
-		details := fmt.Sprintf(`<div class="details">%s</div>`, err.Error())
 		serveErrorPage(rw, http.StatusInternalServerError, "Configuration Error",
 			"There was a problem loading your config file. Please check the syntax and try again.",
-			details)
+			err.Error())
 		return
 	}
 
-	// Resolve static directory
-	staticDir, err := resolveStaticPath(config.Static)
-	if err != nil {
-		details := fmt.Sprintf(`<div class="details">%s
+	// Proxied prefixes go to their upstream with any method
+	if target, ok := config.Proxy.proxyFor(r.URL.Path); ok {
+		serveProxy(rw, r, target)
+		return
+	}
+
+	// Moved URLs, before the method check since 307 and 308 keep it
+	if rule, target := matchRedirect(config.Redirects, r); rule != nil {
+		http.Redirect(rw, r, target, rule.status())
+		return
+	}
 
-Configured path: %s</div>`, err.Error(), config.Static)
+	// Only serve GET and HEAD requests
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slowThreshold = time.Duration(config.SlowRequestThreshold)
+
+	// Send www/non-www and http traffic to the canonical URL
+	if target := canonicalRedirect(r, config); target != "" {
+		http.Redirect(rw, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	// Resolve static directories
+	staticDirs, err := resolveStaticDirs(config.Static, config.Mounts)
+	if err != nil {
+		details := fmt.Sprintf("%s\n\nConfigured path: %s", err.Error(), config.Static)
 		serveErrorPage(rw, http.StatusInternalServerError, "Static Directory Error",
 			"The configured static directory could not be found or accessed.",
 			details)
 		return
 	}
 
-	// Clean the request path
+	// Clean the request path, "/" is the static root directory itself
 	requestPath := filepath.Clean(r.URL.Path)
-	if requestPath == "/" {
-		requestPath = "/index.html"
-	}
 
 	// Remove leading slash for filepath.Join
 	requestPath = strings.TrimPrefix(requestPath, "/")
 
-	// Build full file path
-	fullPath := filepath.Join(staticDir, requestPath)
+	// Mounted directories are served under their prefix instead (but a
+	// missing file still gets the site's own 404 page, and listings still
+	// link to the full path)
+	siteDirs, urlPath := staticDirs, requestPath
+	if m, rest, ok := config.mountFor(filepath.ToSlash(requestPath)); ok {
+		staticDirs, requestPath = []string{filepath.Clean(m.Path)}, rest
+	}
 
-	// Security: ensure the resolved path is still within staticDir
-	if !strings.HasPrefix(fullPath, staticDir) {
-		serve404(rw, r.URL.Path)
+	// Look the file up in each static directory in turn
+	match, err := findStaticFile(staticDirs, requestPath)
+	if os.IsNotExist(err) && requestPath == "sitemap.xml" && config.Sitemap.enabled() {
+		serveSitemap(rw, r, config, staticDirs)
 		return
 	}
-
-	// Check if file exists
-	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		// Single-page apps route missing paths to their entry point
+		if fallback, ok := config.SPA.fallbackFor(requestPath); ok {
+			match, err = findStaticFile(staticDirs, fallback)
+		}
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
-			serve404(rw, r.URL.Path)
+			serveNotFound(rw, r, config, siteDirs)
 			return
 		}
 		http.Error(rw, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	staticDir, fullPath, info := match.root, match.path, match.info
+	timing.mark("resolve")
 
-	// If it's a directory, try to serve index.html
+	// A directory with no index.html in any layer
 	if info.IsDir() {
-		indexPath := filepath.Join(fullPath, "index.html")
-		if _, err := os.Stat(indexPath); err == nil {
-			fullPath = indexPath
-		} else {
-			serve404(rw, r.URL.Path)
+		if r.URL.Path == "/" && isFirstRun() {
+			serveOnboarding(rw)
+			return
+		}
+		if config.AutoIndex {
+			serveDirectoryListing(rw, r, staticDir, fullPath, urlPath)
+			return
+		}
+		serveNotFound(rw, r, config, siteDirs)
+		return
+	}
+
+	// Detect MIME type (from the original name, not a .gz sidecar)
+	mimeType := config.mimeType(fullPath)
+
+	// Set before any 304 so revalidations keep the same caching policy
+	if relPath, err := filepath.Rel(staticDir, fullPath); err == nil {
+		relPath = filepath.ToSlash(relPath)
+		if cacheControl := config.staticCacheControl(relPath, mimeType); cacheControl != "" {
+			rw.Header().Set("Cache-Control", cacheControl)
+		}
+		// Pages name the assets to start fetching early
+		if strings.HasPrefix(mimeType, "text/html") {
+			for _, link := range config.preloadLinks(relPath) {
+				rw.Header().Add("Link", link)
+			}
+		}
+		// Configured headers go last, to override the ones above
+		headers := config.Headers.forPath(relPath)
+		if contentType := headers.Get("Content-Type"); contentType != "" {
+			mimeType = contentType
+			headers.Del("Content-Type")
+		}
+		for name, values := range headers {
+			rw.Header()[name] = values
+		}
+	}
+
+	// In dev mode, pages get the live-reload script. They're rewritten on
+	// every request, so they're never cached or revalidated, and a .gz
+	// sidecar can't be used.
+	liveReload := config.devModeEnabled() && strings.HasPrefix(mimeType, "text/html")
+	if liveReload {
+		rw.Header().Set("Cache-Control", "no-store")
+	}
+
+	// Serve a precompressed app.js.gz in place of app.js when the client
+	// accepts gzip, or else compress it here (zstd or gzip, whichever the
+	// client and then the config prefer) if it's within the configured size
+	// range. Each variant gets its own ETag.
+	encoding, compress := "", false
+	if gzPath, gzInfo, ok := gzipSidecar(fullPath); ok && !liveReload && config.Precompressed && config.Compression.servesSidecar(info.Size()) {
+		rw.Header().Add("Vary", "Accept-Encoding")
+		if acceptsEncoding(r, "gzip") {
+			fullPath, info, encoding = gzPath, gzInfo, "gzip"
+		}
+	} else if config.Compression.compresses(info.Size(), mimeType) {
+		rw.Header().Add("Vary", "Accept-Encoding")
+		if encoding = config.Compression.negotiateEncoding(r); encoding != "" {
+			compress = true
+		}
+	}
+
+	if !liveReload {
+		etag := staticETag(info, encoding)
+		rw.Header().Set("ETag", etag)
+		rw.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+		if notModified(r, etag, info.ModTime()) {
+			timing.setHeader(rw, config)
+			writeNotModified(rw)
 			return
 		}
 	}
 
-	// Read file
-	content, err := os.ReadFile(fullPath)
+	// Seeking (video scrubbing, resumed downloads) works on the identity
+	// version only, since a byte offset into compressed output isn't
+	// useful. Say so either way, so download managers know whether to try.
+	ranges := !liveReload && encoding == "" && !compress
+	if !ranges {
+		rw.Header().Set("Accept-Ranges", "none")
+	} else {
+		rw.Header().Set("Accept-Ranges", "bytes")
+		if r.Header.Get("Range") != "" && ifRangeMatches(r.Header.Get("If-Range"), rw.Header().Get("ETag"), info.ModTime()) {
+			timing.setHeader(rw, config)
+			if serveFileRange(rw, r, fullPath, info.Size(), mimeType) {
+				return
+			}
+		}
+	}
+
+	// Let the client start on preloads while the file is read
+	sendEarlyHints(rw, r)
+
+	// Big files are streamed rather than held in memory
+	if ranges && info.Size() >= streamStaticMinBytes {
+		timing.setHeader(rw, config)
+		streamStaticFile(rw, r, fullPath, info.Size(), mimeType, config.DropPageCache.applies(info.Size()))
+		return
+	}
+
+	// HEAD only needs the size, which the stat already gave, unless the
+	// body is rewritten or compressed here
+	if r.Method == "HEAD" && !liveReload && !compress {
+		rw.Header().Set("Content-Type", mimeType)
+		rw.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		if encoding != "" {
+			rw.Header().Set("Content-Encoding", encoding)
+		}
+		timing.setHeader(rw, config)
+		return
+	}
+
+	// Read file (possibly from the in-memory cache)
+	content, err := readStaticFile(fullPath, info, config)
 	if err != nil {
 		http.Error(rw, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-
-	// Detect MIME type
-	mimeType := mime.TypeByExtension(filepath.Ext(fullPath))
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	timing.mark("read")
+	if liveReload {
+		content = injectLiveReload(content)
+	}
+	if compress {
+		if content, err = compressStaticFile(fullPath, info, content, encoding, config); err != nil {
+			http.Error(rw, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		timing.mark("compress")
 	}
 
 	// Set headers
 	rw.Header().Set("Content-Type", mimeType)
 	rw.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	if encoding != "" {
+		rw.Header().Set("Content-Encoding", encoding)
+	}
+	timing.setHeader(rw, config)
 
 	// Write content
 	rw.Write(content)
@@ -807,6 +1652,51 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Read-only viewers attach to an existing session instead
+	if r.URL.Query().Get("mode") == "view" {
+		handleViewWebSocket(w, r, computerName)
+		return
+	}
+
+	// What a new session runs: the shell, or the program in ?cmd=, see
+	// termcmd.go
+	cmd, err := terminalCommand(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Reconnecting to a session that's been kept alive for it, see
+	// resume.go. It's already counted against the client's IP.
+	resumed := terminalSessions.lookup(computerName)
+	if resumed != nil && !resumed.resumable() {
+		resumed = nil
+	}
+	// Whether to cut off whoever has it, see attach
+	takeover := r.URL.Query().Get("takeover") == "true"
+
+	// The session's settings are read once, up front
+	config, err := loadConfig()
+	if err != nil {
+		config = &Config{}
+	}
+
+	// Count a new session against the client's IP before upgrading, so a
+	// client over its limit gets a plain 429
+	maxPerIP := config.Terminal.maxSessionsPerIP()
+	ip := clientIP(r)
+	if resumed == nil && !acquireIPSession(ip, maxPerIP) {
+		http.Error(w, "Too many terminal sessions from this address", http.StatusTooManyRequests)
+		return
+	}
+	release := sync.OnceFunc(func() { releaseIPSession(ip) })
+	started := false
+	defer func() {
+		if resumed == nil && !started {
+			release() // The session never started
+		}
+	}()
+
 	// Upgrade to WebSocket
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -814,6 +1704,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer ws.Close()
+	ws.SetReadLimit(maxTerminalMessageBytes)
 
 	// Set up pong handler
 	ws.SetReadDeadline(time.Now().Add(pongWait))
@@ -822,48 +1713,71 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return nil
 	})
 
-	// Create shell command as cutie user
-	shell := getShell()
+	if resumed != nil {
+		if resumed.attach(ws, takeover) {
+			if err := pty.Setsize(resumed.ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err != nil {
+				log.Printf("Failed to set PTY size: %v", err)
+			}
+			serveTerminal(resumed, ws)
+			return
+		}
+		// Someone else has it. Told after the upgrade, since a browser
+		// can't see the status of a failed one.
+		if !takeover && resumed.connected() {
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, sessionConnectedReason),
+				time.Now().Add(closeWriteWait))
+			return
+		}
+		// It ended, so this is a new session after all
+		resumed = nil
+		if !acquireIPSession(ip, maxPerIP) {
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many terminal sessions from this address"),
+				time.Now().Add(closeWriteWait))
+			return
+		}
+	}
 
 	// Set PS1 with computer name - use raw escape codes
 	ps1 := fmt.Sprintf("\\[\\e[1;35m\\]%s\\[\\e[0m\\]:\\[\\e[1;36m\\]\\w\\[\\e[0m\\]\\$ ", computerName)
 
-	// Use bash with --norc --noprofile to prevent PS1 override
-	cmd := exec.Command(shell, "--norc", "--noprofile")
-
-	// Set user to cutie (UID 1000 is typically the first non-root user created)
-	// cmd.SysProcAttr = &syscall.SysProcAttr{
-	// 	Credential: &syscall.Credential{
-	// 		Uid: 1000, // cutie user
-	// 		Gid: 1000, // cutie group
-	// 	},
-	// }
-
 	// Start in cutie's home directory
 	cmd.Dir = dataDir
 
-	cmd.Env = []string{
-		"HOME=/home/cutie",
-		"USER=cutie",
+	cmd.Env = append(commandEnv(),
 		"TERM=xterm-256color",
-		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/home/cutie/.bun/bin",
 		"COLORTERM=truecolor",
 		fmt.Sprintf("PS1=%s", ps1),
-	}
+	)
+
+	// Opt-in persistent history
+	cmd.Env = append(cmd.Env, historyEnv(config)...)
 
-	// Start PTY
-	ptmx, err := pty.Start(cmd)
+	// Start PTY, as the cutie user rather than root, see termuser.go
+	ptmx, err := startTerminal(cmd)
 	if err != nil {
 		log.Printf("Failed to start PTY: %v", err)
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeTerminalError, "failed to start shell"),
+			time.Now().Add(closeWriteWait))
 		return
 	}
 
 	session := &ptySession{
-		cmd:  cmd,
-		ptmx: ptmx,
-		ws:   ws,
+		name:    computerName,
+		started: time.Now(),
+		cmd:     cmd,
+		ptmx:    ptmx,
+		ws:      ws,
+		release: release,
+		done:    make(chan struct{}),
+	}
+	started = true
+	if grace := config.Terminal.reconnectGrace(); grace > 0 {
+		session.grace = grace
+		session.scrollback = newScrollback(scrollbackBytes)
 	}
-	defer session.close()
 
 	// Set initial size
 	if err := pty.Setsize(ptmx, &pty.Winsize{
@@ -904,51 +1818,91 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	welcomeMsg.WriteString("\r\n\r\n")
 	ws.WriteMessage(websocket.TextMessage, []byte(welcomeMsg.String()))
 
-	// Start ping ticker to keep connection alive
-	ticker := time.NewTicker(pingPeriod)
-	defer ticker.Stop()
+	// Let viewers and reconnects find the session by name, and shutdown
+	// find it to close. Closing the session takes it out of the manager.
+	terminalSessions.register(session)
+	untrack := trackSession(session)
 
+	// Hard cap on the session's lifetime, if configured
+	stopLimit := func() {}
+	if limit := config.Terminal.maxSessionDuration(); limit > 0 {
+		stopLimit = limitSession(session, limit, config.Terminal.sessionWarning())
+	}
+
+	// The shell runs until it exits or the session is closed, which may be
+	// after this connection has gone
 	go func() {
-		for range ticker.C {
-			session.mu.Lock()
-			if session.closed {
-				session.mu.Unlock()
-				return
-			}
-			if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-				log.Printf("Ping error: %v", err)
-				session.mu.Unlock()
-				return
-			}
-			session.mu.Unlock()
-		}
+		session.run()
+		stopLimit()
+		untrack()
 	}()
+	serveTerminal(session, ws)
+}
 
-	// PTY -> WebSocket (read from PTY, send to browser)
+// run copies the shell's output to the session's connections until the
+// shell exits, keeping them alive with pings meanwhile. It reaps the shell
+// and, if it exited by itself, closes the session with its exit status.
+func (s *ptySession) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
 	go func() {
-		buf := make([]byte, 8192)
 		for {
-			n, err := ptmx.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					log.Printf("PTY read error: %v", err)
-				}
+			select {
+			case <-s.done:
 				return
+			case <-ticker.C:
+				s.ping()
 			}
+		}
+	}()
 
-			session.mu.Lock()
-			if !session.closed {
-				if err := ws.WriteMessage(websocket.TextMessage, buf[:n]); err != nil {
-					log.Printf("WebSocket write error: %v", err)
-					session.mu.Unlock()
-					return
-				}
+	buf := make([]byte, 8192)
+	for {
+		n, err := s.ptmx.Read(buf)
+		if err != nil {
+			// Linux reports EIO once the shell has exited and the PTY has
+			// no one left on the other end
+			if !errors.Is(err, io.EOF) && !errors.Is(err, syscall.EIO) {
+				log.Printf("PTY read error: %v", err)
+				s.end(closeTerminalError, "terminal error")
+			}
+			s.cmd.Wait()
+			s.mu.Lock()
+			hungUp := s.hungUp
+			s.mu.Unlock()
+			if hungUp {
+				s.end(websocket.CloseServiceRestart, shutdownReason)
+			} else {
+				s.end(shellExitClose(s.cmd.ProcessState))
 			}
-			session.mu.Unlock()
+			return
 		}
-	}()
+		s.broadcast(buf[:n])
+	}
+}
+
+// ping keeps the owner's and viewers' connections alive
+func (s *ptySession) ping() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.ws != nil {
+		if err := s.ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+			log.Printf("Ping error: %v", err)
+			s.ws.Close() // Its read loop notices and disconnects
+		}
+	}
+	s.pingViewers()
+}
 
-	// WebSocket -> PTY (read from browser, write to PTY)
+// serveTerminal passes input and resizes from ws, the session's owner
+// connection, to the shell until the connection goes away. Then the
+// session is closed, or waits for a reconnect if it's resumable.
+func serveTerminal(session *ptySession, ws *websocket.Conn) {
 	for {
 		msgType, data, err := ws.ReadMessage()
 		if err != nil {
@@ -965,7 +1919,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			if len(msg) > 0 && msg[0] == '{' {
 				var resize resizeMessage
 				if err := json.Unmarshal(data, &resize); err == nil && resize.Type == "resize" {
-					if err := pty.Setsize(ptmx, &pty.Winsize{
+					if err := pty.Setsize(session.ptmx, &pty.Winsize{
 						Rows: resize.Rows,
 						Cols: resize.Cols,
 					}); err != nil {
@@ -976,21 +1930,157 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Regular input - write to PTY
-			if _, err := ptmx.Write(data); err != nil {
+			if err := writeInput(session.ptmx, data); err != nil {
 				log.Printf("PTY write error: %v", err)
 				break
 			}
 		}
 	}
 
-	// Wait for command to finish
-	cmd.Wait()
+	// Unless the session waits for a reconnect, the connection going away
+	// ends the shell (and tells any viewers); wait for it to be reaped
+	if session.disconnect(ws) {
+		<-session.done
+	}
+}
+
+// newServeMux registers all endpoints. Endpoint groups disabled in config
+// aren't registered at all, and are also re-checked on every request so
+// disabling them takes effect without a restart.
+func newServeMux(config *Config) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// What's available, see apiindex.go
+	mux.HandleFunc("/api", apiIndexHandler(config))
+
+	// Metrics and diagnostics
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/api/selfcheck", compressAPI(handleAPISelfCheck))
+	mux.HandleFunc("/api/logs", compressAPI(handleAPILogs))
+	mux.HandleFunc("/api/config/reload", compressAPI(handleAPIConfigReload))
+
+	// WebSocket connectivity check, deliberately not tied to the terminal
+	mux.HandleFunc("/ws/echo", handleEchoWebSocket)
+
+	// Page reloads in dev mode (404s otherwise)
+	mux.HandleFunc(liveReloadPath, handleLiveReload)
+
+	if config.terminalEnabled() {
+		// WebSocket endpoint for PTY
+		mux.HandleFunc("/ws", requireFeature((*Config).terminalEnabled, handleWebSocket))
+
+		// WebSocket endpoint for one-shot commands
+		mux.HandleFunc("/ws/exec", requireFeature((*Config).terminalEnabled, handleExecWebSocket))
+
+		// One-shot commands over HTTP, and canceling any one-shot command
+		mux.HandleFunc("/api/exec", requireFeature((*Config).terminalEnabled, compressAPI(handleAPIExec)))
+		mux.HandleFunc("/api/exec/", requireFeature((*Config).terminalEnabled, compressAPI(handleAPIExec)))
+
+		// Listing the running terminal sessions
+		mux.HandleFunc("/api/sessions", requireFeature((*Config).terminalEnabled, compressAPI(handleAPISessions)))
+
+		// Scheduled commands, which run like the terminal's
+		mux.HandleFunc("/api/schedule", requireFeature((*Config).terminalEnabled, compressAPI(handleAPISchedule)))
+	}
+
+	if config.fileAPIEnabled() {
+		fileAPI := func(h http.HandlerFunc) http.HandlerFunc {
+			return requireStorage(requireFeature((*Config).fileAPIEnabled, compressAPI(func(w http.ResponseWriter, r *http.Request) {
+				// Anything but a read may have changed what listings show
+				if r.Method != "GET" && r.Method != "HEAD" {
+					defer listingsCache.invalidate()
+				}
+				h(w, r)
+			})))
+		}
+
+		// File API endpoints
+		mux.HandleFunc("/api/files", fileAPI(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET":
+				handleAPIFilesList(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))
+
+		mux.HandleFunc("/api/files/", fileAPI(func(w http.ResponseWriter, r *http.Request) {
+			// Extract file path from URL
+			filePath := strings.TrimPrefix(r.URL.Path, "/api/files/")
+
+			// Advisory editor locks live at /api/files/<path>/lock
+			if absPath, ok := lockTarget(filePath); ok {
+				handleAPIFileLock(w, r, absPath)
+				return
+			}
+			// Saved versions at /api/files/<path>/versions[/<id>]
+			if target, id, ok := versionsTarget(filePath); ok && (r.Method == "GET" || r.Method == "POST") {
+				handleAPIFileVersions(w, r, target, id)
+				return
+			}
+
+			switch r.Method {
+			case "GET", "HEAD":
+				handleAPIFilesGet(w, r, filePath)
+			case "PUT":
+				handleAPIFilesPut(w, r, filePath)
+			case "DELETE":
+				handleAPIFilesDelete(w, r, filePath)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))
+
+		mux.HandleFunc("/api/files/move", fileAPI(handleAPIFilesMove))
+		mux.HandleFunc("/api/files/copy", fileAPI(handleAPIFilesCopy))
+		mux.HandleFunc("/api/files/mkdir", fileAPI(handleAPIFilesMkdir))
+		mux.HandleFunc("/api/files/tree", fileAPI(handleAPIFilesTree))
+		mux.HandleFunc("/api/files/exists", fileAPI(handleAPIFilesExists))
+		mux.HandleFunc("/api/files/fetch", fileAPI(handleAPIFilesFetch))
+		mux.HandleFunc("/api/files/manifest", fileAPI(handleAPIFilesManifest))
+		mux.HandleFunc("/api/files/transaction", fileAPI(handleAPIFilesTransaction))
+		mux.HandleFunc("/api/files/upload", fileAPI(handleAPIFilesUpload))
+		mux.HandleFunc("/api/files/stat", fileAPI(handleAPIFilesStat))
+		mux.HandleFunc("/api/files/chtimes", fileAPI(handleAPIFilesChtimes))
+		mux.HandleFunc("/api/files/delete-glob", fileAPI(handleAPIFilesDeleteGlob))
+		mux.HandleFunc("/api/files/resolve", fileAPI(handleAPIFilesResolve))
+		mux.HandleFunc("/api/search", fileAPI(handleAPISearch))
+		mux.HandleFunc("/api/watch", fileAPI(handleAPIWatch))
+
+		// WebSocket endpoint for uploads with progress
+		mux.HandleFunc("/ws/upload", fileAPI(handleUploadWebSocket))
+	}
+
+	// All other requests go to static file handler
+	mux.HandleFunc("/", handleHTTP)
+
+	return mux
+}
+
+// requireFeature 404s requests while a feature is switched off in config.
+// If the config can't be loaded the request goes through, so a typo in
+// config.json doesn't lock the user out of the terminal they'd fix it with.
+func requireFeature(enabled func(*Config) bool, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config, err := loadConfig(); err == nil && !enabled(config) {
+			http.NotFound(w, r)
+			return
+		}
+		h(w, r)
+	}
 }
 
 func main() {
+	// Keep recent log lines for /api/logs
+	log.SetOutput(io.MultiWriter(os.Stderr, serverLogs))
 
 	loc := os.Getenv("CLOUDFLARE_LOCATION")
 
+	// Unmounted on shutdown, see shutdown.go
+	var mount *fuseMount
+	var err error
+
 	// Don't mount fuse in local docker
 	if loc != "" && loc != "loc01" {
 		// Get Durable Object ID to use as S3 bucket name for isolation
@@ -1011,39 +2101,12 @@ func main() {
 			log.Fatalf("Failed to create directory: %v", err)
 		}
 
+		// Use Durable Object ID as the S3 bucket name for per-computer isolation
 		bucket := fmt.Sprintf("s3-%s", doID)
-
-		go func() {
-			// Use Durable Object ID as the S3 bucket name for per-computer isolation
-			cmd := exec.Command("/usr/local/bin/tigrisfs",
-				"--endpoint", "https://cute.maxmcd.com/",
-				"--debug_s3",
-				"--debug",
-				"-f",
-				bucket,
-				dataDir)
-			// Pass JWT token as AWS access key ID
-			// tigrisfs will include this in the Authorization header's Credential field
-			// Format: "AWS4-HMAC-SHA256 Credential=<jwt>/20231201/auto/s3/aws4_request, ..."
-			// Our S3 DO extracts the JWT from the Credential field
-			cmd.Env = append(os.Environ(),
-				"AWS_ACCESS_KEY_ID="+s3Token,
-				"AWS_SECRET_ACCESS_KEY=not-used", // Required by tigrisfs but ignored by S3 DO
-			)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			if err := cmd.Run(); err != nil {
-				log.Fatalf("tigrisfs failed: %v", err)
-			}
-			log.Fatalf("tigrisfs exited unexpectedly")
-		}()
-
-		// Wait for FUSE mount to be ready before proceeding
-		log.Printf("Waiting for FUSE mount at %s...")
-		if err := waitForMount(dataDir, 10*time.Second); err != nil {
+		if mount, err = mountFUSE(bucket, dataDir, s3Token); err != nil {
 			log.Fatalf("Failed to wait for mount: %v", err)
 		}
+		storageMounted = true
 	}
 
 	// Ensure config file exists with defaults
@@ -1051,57 +2114,44 @@ func main() {
 		log.Printf("Warning: Failed to ensure config exists: %v", err)
 	}
 
-	// WebSocket endpoint for PTY
-	http.HandleFunc("/ws", handleWebSocket)
-
-	// File API endpoints
-	http.HandleFunc("/api/files", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case "GET":
-			handleAPIFilesList(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	http.HandleFunc("/api/files/", func(w http.ResponseWriter, r *http.Request) {
-		// Extract file path from URL
-		filePath := strings.TrimPrefix(r.URL.Path, "/api/files/")
-
-		switch r.Method {
-		case "GET":
-			handleAPIFilesGet(w, r, filePath)
-		case "PUT":
-			handleAPIFilesPut(w, r, filePath)
-		case "DELETE":
-			handleAPIFilesDelete(w, r, filePath)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+	// The terminal and file API can be left off the mux entirely by config
+	startupConfig, err := loadConfig()
+	if err != nil {
+		log.Printf("Warning: Failed to load config, enabling all endpoints: %v", err)
+		startupConfig = &Config{}
+	}
+	mux := newServeMux(startupConfig)
+	server := newServer(startupConfig, mux)
 
-	http.HandleFunc("/api/files/move", handleAPIFilesMove)
-
-	// All other requests go to static file handler
-	http.HandleFunc("/", handleHTTP)
+	runSelfCheck()
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
 	go func() {
 		<-sigChan
 		fmt.Println("\n\nShutting down...")
-		os.Exit(0)
+		shutdown(server, mount)
+		close(shutdownDone)
 	}()
+	reloadOnSIGHUP()
 
-	port := 8283
+	port := serverPort
 
 	fmt.Printf("Server running at http://0.0.0.0:%d\n", port)
 
+	go summarizeFastRequests(time.Minute)
+
+	cronScheduler.syncConfig(startupConfig)
+	go cronScheduler.loop()
+
 	writeLog("Container started successfully")
 	writeLog(fmt.Sprintf("Server listening on port %d", port))
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed: %v", err)
 	}
+	<-shutdownDone
+	log.Printf("Shut down cleanly")
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"mime"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -11,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestStaticFileServing(t *testing.T) {
@@ -128,6 +128,26 @@ func TestStaticFileServing(t *testing.T) {
 				{path: "/", wantStatus: 200, wantBody: "<h1>From dist</h1>"},
 			},
 		},
+		{
+			name:   "config with UTF-8 BOM",
+			config: "\uFEFF{\"static\": \"dist\"}",
+			files: map[string]string{
+				"dist/index.html": "<h1>From dist</h1>",
+			},
+			requests: []testRequest{
+				{path: "/", wantStatus: 200, wantBody: "<h1>From dist</h1>"},
+			},
+		},
+		{
+			name:   "JSONC config with BOM and stray mid-file BOM",
+			config: "\uFEFF// comment\n{\uFEFF\"static\": \"dist\" /* block */}",
+			files: map[string]string{
+				"dist/index.html": "<h1>From dist</h1>",
+			},
+			requests: []testRequest{
+				{path: "/", wantStatus: 200, wantBody: "<h1>From dist</h1>"},
+			},
+		},
 		{
 			name:   "HEAD request support",
 			config: `{"static": "."}`,
@@ -185,6 +205,26 @@ func TestStaticFileServing(t *testing.T) {
 				{path: "/", wantStatus: 500, wantBodyContains: "Static Directory Error"},
 			},
 		},
+		{
+			name:   "request path is escaped in the 404 page",
+			config: `{"static": "."}`,
+			files: map[string]string{
+				"index.html": "<h1>Home</h1>",
+			},
+			requests: []testRequest{
+				{path: "/%3Cscript%3Ealert(1)%3C/script%3E", wantStatus: 404,
+					wantBodyContains: "&lt;script&gt;alert(1)&lt;/script&gt;", wantBodyExcludes: "<script>"},
+				{path: `/x%22%3E%3Cimg%20src=x%20onerror=alert(1)%3E`, wantStatus: 404,
+					wantBodyContains: "&lt;img", wantBodyExcludes: "<img"},
+			},
+		},
+		{
+			name:   "config values are escaped in error pages",
+			config: `{"static": "<script>alert(1)</script>"}`,
+			requests: []testRequest{
+				{path: "/", wantStatus: 500, wantBodyContains: "&lt;script&gt;", wantBodyExcludes: "<script>"},
+			},
+		},
 		{
 			name:   "path cleaning and normalization",
 			config: `{"static": "."}`,
@@ -218,19 +258,11 @@ func TestStaticFileServing(t *testing.T) {
 			}
 
 			// Write all test files
-			for path, content := range tt.files {
-				fullPath := filepath.Join(cutieHome, path)
-				dir := filepath.Dir(fullPath)
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					t.Fatal(err)
-				}
-				if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-					t.Fatal(err)
-				}
-			}
+			writeTestFiles(t, cutieHome, tt.files)
 
-			// Create test HTTP handler that uses the test directory
-			handler := createTestHandler(cutieHome)
+			// Serve from the test directory
+			useDataDir(t, cutieHome)
+			handler := handleHTTP
 
 			// Run all requests for this test case
 			for i, req := range tt.requests {
@@ -273,6 +305,11 @@ func TestStaticFileServing(t *testing.T) {
 						i, method, req.path, req.wantBodyContains, body)
 				}
 
+				if req.wantBodyExcludes != "" && strings.Contains(body, req.wantBodyExcludes) {
+					t.Errorf("request %d (%s %s): body contains %q: %q",
+						i, method, req.path, req.wantBodyExcludes, body)
+				}
+
 				// Check content length for HEAD requests
 				if req.wantContentLength > 0 {
 					cl := resp.Header.Get("Content-Length")
@@ -293,151 +330,489 @@ type testRequest struct {
 	wantContentType   string
 	wantBody          string // exact match
 	wantBodyContains  string // substring match
+	wantBodyExcludes  string // must not appear
 	wantContentLength int    // for HEAD requests
 }
 
-// createTestHandler creates an HTTP handler for testing that uses a custom base directory
-func createTestHandler(baseDir string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" && r.Method != "HEAD" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+// useDataDir points dataDir at a test directory for the duration of the test
+func useDataDir(t testing.TB, dir string) {
+	t.Helper()
+	oldDataDir := dataDir
+	dataDir = dir
+	configCache.mu.Lock()
+	configCache.config = nil
+	configCache.mu.Unlock()
+	t.Cleanup(func() {
+		dataDir = oldDataDir
+		configCache.mu.Lock()
+		configCache.config = nil
+		configCache.mu.Unlock()
+	})
+}
 
-		// Load config from test directory
-		config, err := loadConfigFromDir(baseDir)
-		if err != nil {
-			details := fmt.Sprintf(`<div class="details">%s</div>`, err.Error())
-			serveErrorPage(w, "Configuration Error",
-				"There was a problem loading your config file. Please check the syntax and try again.",
-				details)
-			return
+// writeTestFiles writes a path -> content map into baseDir
+func writeTestFiles(t testing.TB, baseDir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(baseDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
 		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
 
-		// Resolve static directory relative to test base
-		staticDir, err := resolveStaticPathFromBase(baseDir, config.Static)
-		if err != nil {
-			details := fmt.Sprintf(`<div class="details">%s
+func TestAPIFilesMoveAutorename(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		from, to string
+		wantPath string
+	}{
+		{
+			name:     "no collision",
+			files:    map[string]string{"a.txt": "a"},
+			from:     "a.txt",
+			to:       "report.pdf",
+			wantPath: "report.pdf",
+		},
+		{
+			name:     "first collision",
+			files:    map[string]string{"a.txt": "a", "report.pdf": "old"},
+			from:     "a.txt",
+			to:       "report.pdf",
+			wantPath: "report (1).pdf",
+		},
+		{
+			name: "multiple collisions",
+			files: map[string]string{
+				"a.txt":          "a",
+				"report.pdf":     "old",
+				"report (1).pdf": "old",
+				"report (2).pdf": "old",
+			},
+			from:     "a.txt",
+			to:       "report.pdf",
+			wantPath: "report (3).pdf",
+		},
+		{
+			name:     "no extension",
+			files:    map[string]string{"a.txt": "a", "docs/Makefile": "old"},
+			from:     "a.txt",
+			to:       "docs/Makefile",
+			wantPath: "docs/Makefile (1)",
+		},
+		{
+			name:     "dotfile",
+			files:    map[string]string{"a.txt": "a", ".env": "old"},
+			from:     "a.txt",
+			to:       ".env",
+			wantPath: ".env (1)",
+		},
+	}
 
-Configured path: %s</div>`, err.Error(), config.Static)
-			serveErrorPage(w, "Static Directory Error",
-				"The configured static directory could not be found or accessed.",
-				details)
-			return
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, tt.files)
+			useDataDir(t, tmpDir)
 
-		// Clean the request path
-		requestPath := filepath.Clean(r.URL.Path)
-		if requestPath == "/" {
-			requestPath = "/index.html"
-		}
+			body := fmt.Sprintf(`{"from": %q, "to": %q}`, tt.from, tt.to)
+			req := httptest.NewRequest("POST", "/api/files/move?autorename=true", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			handleAPIFilesMove(w, req)
+
+			if w.Code != 200 {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var resp MoveResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", resp.Path, tt.wantPath)
+			}
 
-		requestPath = strings.TrimPrefix(requestPath, "/")
-		fullPath := filepath.Join(staticDir, requestPath)
+			// The moved file lands at the returned path and nothing was overwritten
+			content, err := os.ReadFile(filepath.Join(tmpDir, resp.Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.files[tt.from] {
+				t.Errorf("content = %q, want %q", content, tt.files[tt.from])
+			}
+			if old, ok := tt.files[tt.to]; ok {
+				content, _ := os.ReadFile(filepath.Join(tmpDir, tt.to))
+				if string(content) != old {
+					t.Errorf("destination was overwritten: %q", content)
+				}
+			}
+		})
+	}
+}
 
-		// Security: ensure the resolved path is still within staticDir
-		if !strings.HasPrefix(fullPath, staticDir) {
-			serve404(w, r.URL.Path)
-			return
-		}
+func TestAPIFilesExists(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"src/main.go": "package main"})
+	useDataDir(t, tmpDir)
 
-		// Check if file exists
-		info, err := os.Stat(fullPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				serve404(w, r.URL.Path)
-				return
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       ExistsResponse
+	}{
+		{path: "src/main.go", wantStatus: 200, want: ExistsResponse{Exists: true}},
+		{path: "src", wantStatus: 200, want: ExistsResponse{Exists: true, IsDir: true}},
+		{path: "", wantStatus: 200, want: ExistsResponse{Exists: true, IsDir: true}},
+		{path: "missing.txt", wantStatus: 200, want: ExistsResponse{}},
+		{path: "src/main.go/nope", wantStatus: 200, want: ExistsResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleAPIFilesExists(w, httptest.NewRequest("GET", "/api/files/exists?path="+tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
 			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+			var got ExistsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
 
-		// If it's a directory, try to serve index.html
-		if info.IsDir() {
-			indexPath := filepath.Join(fullPath, "index.html")
-			if _, err := os.Stat(indexPath); err == nil {
-				fullPath = indexPath
-			} else {
-				serve404(w, r.URL.Path)
-				return
+func TestAPIFilesGetRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"log.txt": "0123456789"})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		name             string
+		rangeHeader      string
+		wantStatus       int
+		wantBody         string
+		wantContentRange string
+	}{
+		{name: "no range", wantStatus: 200, wantBody: "0123456789"},
+		{name: "middle", rangeHeader: "bytes=2-5", wantStatus: 206, wantBody: "2345", wantContentRange: "bytes 2-5/10"},
+		{name: "open-ended", rangeHeader: "bytes=7-", wantStatus: 206, wantBody: "789", wantContentRange: "bytes 7-9/10"},
+		{name: "suffix", rangeHeader: "bytes=-3", wantStatus: 206, wantBody: "789", wantContentRange: "bytes 7-9/10"},
+		{name: "end past size", rangeHeader: "bytes=8-100", wantStatus: 206, wantBody: "89", wantContentRange: "bytes 8-9/10"},
+		{name: "start past size", rangeHeader: "bytes=10-", wantStatus: 416, wantContentRange: "bytes */10"},
+		{name: "far out of range", rangeHeader: "bytes=50-60", wantStatus: 416, wantContentRange: "bytes */10"},
+		{name: "malformed is ignored", rangeHeader: "bytes=abc", wantStatus: 200, wantBody: "0123456789"},
+		{name: "multi-range is ignored", rangeHeader: "bytes=0-1,4-5", wantStatus: 200, wantBody: "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/files/log.txt", nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
 			}
-		}
+			w := httptest.NewRecorder()
+			handleAPIFilesGet(w, req, "log.txt")
 
-		// Read file
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.wantContentRange {
+				t.Errorf("content-range = %q, want %q", got, tt.wantContentRange)
+			}
+			if tt.wantStatus == 206 {
+				if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(len(tt.wantBody)) {
+					t.Errorf("content-length = %q, want %d", cl, len(tt.wantBody))
+				}
+			}
+		})
+	}
+}
+
+func TestAPIFilesHead(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("hello world\n", 500)
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{}`, "docs/notes.txt": content})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	do := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/files/docs/notes.txt", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
 		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
 
-		// Detect MIME type
-		mimeType := mime.TypeByExtension(filepath.Ext(fullPath))
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
+	get, head := do("GET", nil), do("HEAD", nil)
+	if head.Code != 200 || head.Body.Len() != 0 {
+		t.Fatalf("HEAD status = %d, %d byte body", head.Code, head.Body.Len())
+	}
+	if got := head.Header().Get("Content-Length"); got != strconv.Itoa(len(content)) {
+		t.Errorf("HEAD Content-Length = %q, want %d", got, len(content))
+	}
+	for _, h := range []string{"Content-Type", "ETag", "Last-Modified", "Accept-Ranges"} {
+		if head.Header().Get(h) == "" || head.Header().Get(h) != get.Header().Get(h) {
+			t.Errorf("%s: HEAD %q, GET %q", h, head.Header().Get(h), get.Header().Get(h))
 		}
+	}
+	if get.Body.String() != content {
+		t.Error("GET body doesn't match the file")
+	}
 
-		// Set headers
-		w.Header().Set("Content-Type", mimeType)
-		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	// The validators work for revalidation
+	if w := do("HEAD", map[string]string{"If-None-Match": head.Header().Get("ETag")}); w.Code != 304 {
+		t.Errorf("If-None-Match status = %d, want 304", w.Code)
+	}
+	if w := do("GET", map[string]string{"If-Modified-Since": head.Header().Get("Last-Modified")}); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("If-Modified-Since status = %d, body %d bytes", w.Code, w.Body.Len())
+	}
 
-		// Write content
-		w.Write(content)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("HEAD", "/api/files/docs/missing.txt", nil))
+	if w.Code != 404 {
+		t.Errorf("HEAD missing file: status = %d, want 404", w.Code)
 	}
 }
 
-// loadConfigFromDir loads config from a specific directory
-func loadConfigFromDir(baseDir string) (*Config, error) {
-	configPath := filepath.Join(baseDir, "config.json")
-	if _, err := os.Stat(configPath); err != nil {
-		jsonc := filepath.Join(baseDir, "config.jsonc")
-		if _, err := os.Stat(jsonc); err != nil {
-			return nil, fmt.Errorf("no config file found (tried config.json and config.jsonc)")
-		}
-		configPath = jsonc
+func TestSlowRequestLogging(t *testing.T) {
+	var logged []string
+	oldSendLog := sendLog
+	sendLog = func(msg string) { logged = append(logged, msg) }
+	t.Cleanup(func() { sendLog = oldSendLog })
+
+	tests := []struct {
+		name       string
+		config     string
+		path       string
+		wantLogged bool
+	}{
+		{"no threshold logs everything", `{"static": "."}`, "/index.html", true},
+		{"fast request suppressed", `{"static": ".", "slowRequestThreshold": "1h"}`, "/index.html", false},
+		{"slow request logged", `{"static": ".", "slowRequestThreshold": "1ns"}`, "/index.html", true},
+		{"error logged even when fast", `{"static": ".", "slowRequestThreshold": "1h"}`, "/missing.html", true},
 	}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"index.html":  "<h1>Hello</h1>",
+			})
+			useDataDir(t, tmpDir)
+			logged = nil
+			fastBefore := fastRequests.Load()
+
+			handleHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			if gotLogged := len(logged) > 0; gotLogged != tt.wantLogged {
+				t.Errorf("logged = %v, want %v (%q)", gotLogged, tt.wantLogged, logged)
+			}
+			if tt.wantLogged && !strings.Contains(logged[0], "GET "+tt.path) {
+				t.Errorf("log line = %q, want it to mention the request", logged[0])
+			}
+			wantCounted := int64(1)
+			if tt.wantLogged {
+				wantCounted = 0
+			}
+			if counted := fastRequests.Load() - fastBefore; counted != wantCounted {
+				t.Errorf("fast request counter moved by %d, want %d", counted, wantCounted)
+			}
+		})
 	}
 
-	data = sanitizeJSONC(data)
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	if err := json.Unmarshal([]byte(`{"slowRequestThreshold": 500}`), &config); err == nil {
+		t.Errorf("numeric threshold should be rejected")
 	}
+}
 
-	if config.Static == "" {
-		return nil, fmt.Errorf("config.static field is required")
+func TestDisabledEndpoints(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantTerminal bool
+		wantFileAPI  bool
+	}{
+		{"defaults", `{"static": "."}`, true, true},
+		{"terminal disabled", `{"static": ".", "terminal": {"enabled": false}}`, false, true},
+		{"file api disabled", `{"static": ".", "fileApi": {"enabled": false}}`, true, false},
+		{"both disabled", `{"static": ".", "terminal": {"enabled": false}, "fileApi": {"enabled": false}}`, false, false},
 	}
 
-	return &config, nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"index.html":  "<h1>Hello</h1>",
+			})
+			useDataDir(t, tmpDir)
+
+			config, err := loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Check both a mux built from this config and one built with
+			// everything on, which must still honor the config per request
+			for _, mux := range []*http.ServeMux{newServeMux(config), newServeMux(&Config{})} {
+				status := func(method, path string) int {
+					w := httptest.NewRecorder()
+					mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+					return w.Code
+				}
+
+				// Without upgrade headers a live WebSocket endpoint answers 400
+				if got := status("GET", "/ws") != 404; got != tt.wantTerminal {
+					t.Errorf("/ws available = %v, want %v", got, tt.wantTerminal)
+				}
+				if got := status("GET", "/ws/exec?cmd=ls") != 404; got != tt.wantTerminal {
+					t.Errorf("/ws/exec available = %v, want %v", got, tt.wantTerminal)
+				}
+				if got := status("GET", "/api/schedule") == 200; got != tt.wantTerminal {
+					t.Errorf("/api/schedule available = %v, want %v", got, tt.wantTerminal)
+				}
+				if got := status("GET", "/api/files") == 200; got != tt.wantFileAPI {
+					t.Errorf("/api/files available = %v, want %v", got, tt.wantFileAPI)
+				}
+				if got := status("GET", "/api/files/index.html") == 200; got != tt.wantFileAPI {
+					t.Errorf("/api/files/index.html available = %v, want %v", got, tt.wantFileAPI)
+				}
+				// Static hosting keeps working regardless
+				if got := status("GET", "/"); got != 200 {
+					t.Errorf("static status = %d, want 200", got)
+				}
+			}
+		})
+	}
 }
 
-// resolveStaticPathFromBase resolves static path relative to a base directory
-func resolveStaticPathFromBase(baseDir, staticPath string) (string, error) {
-	var fullPath string
-	if filepath.IsAbs(staticPath) {
-		fullPath = staticPath
-	} else {
-		fullPath = filepath.Join(baseDir, staticPath)
+func TestConfigEnvSelection(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":        `{"static": "dev"}`,
+		"config.prod.jsonc":  `{"static": "prod" /* production build */}`,
+		"config.stage.json":  `{"static": "stage"}`,
+		"config.stage.jsonc": `{"static": "shadowed by config.stage.json"}`,
+	})
+	useDataDir(t, tmpDir)
+
+	// Same mtime everywhere, so only the path can tell cache entries apart
+	mtime := time.Now().Add(-time.Hour)
+	entries, _ := os.ReadDir(tmpDir)
+	for _, entry := range entries {
+		if err := os.Chtimes(filepath.Join(tmpDir, entry.Name()), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	fullPath = filepath.Clean(fullPath)
+	for _, tt := range []struct {
+		env        string
+		wantStatic string
+	}{
+		{"", "dev"},
+		{"prod", "prod"},
+		{"stage", "stage"},
+		{"missing", "dev"}, // no config.missing.json, fall back
+		{"../prod", "dev"}, // not a plain name, ignored
+		{"prod", "prod"},
+		{"", "dev"},
+	} {
+		t.Setenv("CUTE_ENV", tt.env)
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatalf("CUTE_ENV=%q: %v", tt.env, err)
+		}
+		if config.Static.String() != tt.wantStatic {
+			t.Errorf("CUTE_ENV=%q: static = %q, want %q", tt.env, config.Static, tt.wantStatic)
+		}
+	}
+}
 
-	// Security: ensure path is within baseDir
-	if !strings.HasPrefix(fullPath, baseDir+string(filepath.Separator)) && fullPath != baseDir {
-		return "", fmt.Errorf("static path must be within %q (got: %q)", baseDir, fullPath)
+func TestConfigFormatSwitch(t *testing.T) {
+	tmpDir := t.TempDir()
+	useDataDir(t, tmpDir)
+
+	// Every write gets the same mtime, so only the path shows that the
+	// config changed
+	mtime := time.Now().Add(-time.Hour)
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantStatic := func(want string) {
+		t.Helper()
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Static.String() != want {
+			t.Errorf("static = %q, want %q", config.Static, want)
+		}
 	}
 
-	// Check if directory exists
-	info, err := os.Stat(fullPath)
-	if err != nil {
-		return "", fmt.Errorf("static directory not found: %s", fullPath)
+	write("config.json", `{"static": "json"}`)
+	wantStatic("json")
+
+	// Replace config.json with config.jsonc
+	if err := os.Remove(filepath.Join(tmpDir, "config.json")); err != nil {
+		t.Fatal(err)
 	}
-	if !info.IsDir() {
-		return "", fmt.Errorf("static path is not a directory: %s", fullPath)
+	write("config.jsonc", `{"static": "jsonc" /* now with comments */}`)
+	wantStatic("jsonc")
+
+	// And back again
+	write("config.json", `{"static": "json"}`)
+	wantStatic("json")
+}
+
+func TestLogsEndpointRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		rewrite  string // LOGS_HOST_REWRITE
+		docker   bool
+		want     string
+	}{
+		{name: "docker rewrites localhost", endpoint: "http://localhost:8787/logs/c", docker: true, want: "http://host.docker.internal:8787/logs/c"},
+		{name: "docker rewrites loopback IP", endpoint: "http://127.0.0.1:8787/logs/c", docker: true, want: "http://host.docker.internal:8787/logs/c"},
+		{name: "native leaves localhost", endpoint: "http://localhost:8787/logs/c", docker: false, want: "http://localhost:8787/logs/c"},
+		{name: "forced on outside docker", endpoint: "http://localhost:8787/logs/c", rewrite: "true", docker: false, want: "http://host.docker.internal:8787/logs/c"},
+		{name: "forced off in docker", endpoint: "http://localhost:8787/logs/c", rewrite: "false", docker: true, want: "http://localhost:8787/logs/c"},
+		{name: "other hosts untouched", endpoint: "https://cute.example.com/logs/c?h=localhost", docker: true, want: "https://cute.example.com/logs/c?h=localhost"},
+		{name: "unset", endpoint: "", docker: true, want: ""},
 	}
 
-	return fullPath, nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOGS_ENDPOINT", tt.endpoint)
+			t.Setenv("LOGS_HOST_REWRITE", tt.rewrite)
+			oldInDocker := inDocker
+			inDocker = func() bool { return tt.docker }
+			t.Cleanup(func() { inDocker = oldInDocker })
+
+			if got := logsEndpointURL(); got != tt.want {
+				t.Errorf("logsEndpointURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
 }
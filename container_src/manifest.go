@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestEntry describes one file for sync clients diffing a local tree
+type ManifestEntry struct {
+	Path     string    `json:"path"` // Relative to base directory
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Checksum string    `json:"checksum,omitempty"` // Hex SHA-256, only with ?checksum=true
+}
+
+// handleAPIFilesManifest lists every regular file under a directory with
+// its size and mtime. That's enough for a quick diff; ?checksum=true also
+// hashes contents for clients that can't trust mtimes.
+func handleAPIFilesManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate and resolve path
+	absPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withChecksums := r.URL.Query().Get("checksum") == "true"
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Directory not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	entries := []ManifestEntry{}
+	err = filepath.Walk(absPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		entry := ManifestEntry{
+			Path:    toRelativePath(path),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+		}
+		if withChecksums {
+			if entry.Checksum, err = fileChecksum(path); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// fileChecksum returns the hex SHA-256 of a file's contents
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
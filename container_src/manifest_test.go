@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIFilesManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"site/index.html":    "<h1>Hi</h1>",
+		"site/css/style.css": "body {}",
+		"site/empty.txt":     "",
+		"other.txt":          "not in the manifest",
+	}
+	writeTestFiles(t, tmpDir, files)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "site/empty-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+
+	for _, withChecksums := range []bool{false, true} {
+		url := "/api/files/manifest?path=site"
+		if withChecksums {
+			url += "&checksum=true"
+		}
+		w := httptest.NewRecorder()
+		handleAPIFilesManifest(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 200 {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+
+		var entries []ManifestEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"site/css/style.css", "site/empty.txt", "site/index.html"}
+		if len(entries) != len(want) {
+			t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+		}
+		for i, entry := range entries {
+			if entry.Path != want[i] {
+				t.Errorf("entry %d path = %q, want %q", i, entry.Path, want[i])
+			}
+			info, err := os.Stat(filepath.Join(tmpDir, entry.Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+				t.Errorf("%s: size/mtime = %d/%s, want %d/%s", entry.Path, entry.Size, entry.ModTime, info.Size(), info.ModTime())
+			}
+
+			wantChecksum := ""
+			if withChecksums {
+				sum := sha256.Sum256([]byte(files[entry.Path]))
+				wantChecksum = hex.EncodeToString(sum[:])
+			}
+			if entry.Checksum != wantChecksum {
+				t.Errorf("%s: checksum = %q, want %q", entry.Path, entry.Checksum, wantChecksum)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// MkdirRequest creates a directory, along with any missing parents
+type MkdirRequest struct {
+	Path string `json:"path"` // Relative to base directory
+	// Template names one of the config's templates to copy into the new
+	// directory, e.g. a starter index.html and config.json
+	Template string `json:"template,omitempty"`
+}
+
+// handleAPIFilesMkdir creates a directory, which is otherwise only possible
+// implicitly by writing a file into it. It's 201 when the directory was
+// created, 200 when it already existed, and 409 when a file is in the way
+// (at the path or at one of its parents). With a template, the directory
+// must be new (409 otherwise), so seeding never mixes into existing files.
+func handleAPIFilesMkdir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MkdirRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	absPath, err := validateAndResolveWritePath(req.Path)
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+
+	if req.Template != "" {
+		seedDirectory(w, absPath, req.Template)
+		return
+	}
+
+	status := http.StatusCreated
+	if info, err := os.Stat(absPath); err == nil {
+		if !info.IsDir() {
+			http.Error(w, "A file already exists at this path", http.StatusConflict)
+			return
+		}
+		status = http.StatusOK
+	}
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		if errors.Is(err, syscall.ENOTDIR) || errors.Is(err, os.ErrExist) {
+			http.Error(w, "A file is in the way of this path", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(MoveResponse{Path: toRelativePath(absPath)})
+}
+
+// seedDirectory creates absPath as a copy of the named template
+func seedDirectory(w http.ResponseWriter, absPath, template string) {
+	config, _ := loadConfig()
+	var templateDir string
+	if config != nil {
+		templateDir = config.Templates[template]
+	}
+	if templateDir == "" {
+		http.Error(w, fmt.Sprintf("Unknown template %q", template), http.StatusNotFound)
+		return
+	}
+	// Read-only mounts are fine as a template
+	templatePath, err := validateAndResolvePath(templateDir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid template directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if info, err := os.Stat(templatePath); err != nil || !info.IsDir() {
+		http.Error(w, fmt.Sprintf("Template directory %q not found", templateDir), http.StatusNotFound)
+		return
+	}
+	if pathWithin(absPath, templatePath) {
+		http.Error(w, "Cannot create a directory inside its own template", http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Lstat(absPath); err == nil {
+		http.Error(w, "Path already exists", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		if errors.Is(err, syscall.ENOTDIR) || errors.Is(err, os.ErrExist) {
+			http.Error(w, "A file is in the way of this path", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := copyDir(templatePath, absPath); err != nil {
+		// Someone else created it in the meantime: leave theirs be
+		if errors.Is(err, os.ErrExist) {
+			http.Error(w, "Path already exists", http.StatusConflict)
+			return
+		}
+		// Don't leave a half-seeded directory behind
+		os.RemoveAll(absPath)
+		http.Error(w, fmt.Sprintf("Failed to copy template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MoveResponse{Path: toRelativePath(absPath)})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIFilesMkdir(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "new directory", path: "photos", wantStatus: 201},
+		{name: "nested", path: "projects/2024/site/assets", wantStatus: 201},
+		{name: "trailing slash", path: "drafts/", wantStatus: 201},
+		{name: "already exists", path: "docs", wantStatus: 200},
+		{name: "file in the way", path: "notes.txt", wantStatus: 409},
+		{name: "file in the way of a parent", path: "notes.txt/sub", wantStatus: 409},
+		{name: "outside the data directory", path: "../escape", wantStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"notes.txt":   "notes",
+				"docs/a.html": "a",
+			})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(&Config{})
+
+			body := fmt.Sprintf(`{"path": %q}`, tt.path)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/files/mkdir", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code >= 300 {
+				return
+			}
+
+			var resp MoveResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.TrimSuffix(tt.path, "/"); resp.Path != want {
+				t.Errorf("path = %q, want %q", resp.Path, want)
+			}
+			info, err := os.Stat(filepath.Join(tmpDir, tt.path))
+			if err != nil || !info.IsDir() {
+				t.Errorf("directory not created: %v", err)
+			}
+		})
+	}
+}
+
+func TestAPIFilesMkdirTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		template   string
+		wantStatus int
+	}{
+		{name: "seeded", path: "sites/blog", template: "site", wantStatus: 201},
+		{name: "unknown template", path: "blog", template: "wiki", wantStatus: 404},
+		{name: "template directory missing", path: "blog", template: "gone", wantStatus: 404},
+		{name: "template outside the data directory", path: "blog", template: "escape", wantStatus: 500},
+		{name: "already exists", path: "docs", template: "site", wantStatus: 409},
+		{name: "inside the template", path: "templates/site/copy", template: "site", wantStatus: 400},
+		{name: "destination outside the data directory", path: "../blog", template: "site", wantStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": `{"static": ".", "templates": {
+					"site": "templates/site", "gone": "templates/gone", "escape": "../"}}`,
+				"templates/site/index.html":       "<h1>Hello</h1>",
+				"templates/site/config.json":      `{"static": "."}`,
+				"templates/site/assets/style.css": "body {}",
+				"docs/a.html":                     "a",
+			})
+			useDataDir(t, tmpDir)
+			mux := newServeMux(&Config{})
+
+			body := fmt.Sprintf(`{"path": %q, "template": %q}`, tt.path, tt.template)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/files/mkdir", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code >= 300 {
+				if tt.path == "blog" {
+					if _, err := os.Stat(filepath.Join(tmpDir, "blog")); !os.IsNotExist(err) {
+						t.Errorf("directory created anyway: %v", err)
+					}
+				}
+				return
+			}
+
+			for name, want := range map[string]string{
+				"index.html":       "<h1>Hello</h1>",
+				"config.json":      `{"static": "."}`,
+				"assets/style.css": "body {}",
+			} {
+				got, err := os.ReadFile(filepath.Join(tmpDir, tt.path, name))
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+				}
+			}
+		})
+	}
+}
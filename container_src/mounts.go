@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// errReadOnlyMount is returned when resolving a path for writing that's
+// inside a read-only mount
+var errReadOnlyMount = errors.New("path is in a read-only mount")
+
+// mountsEnv holds the mounts, as a JSON array of MountConfig. They come
+// from the operator rather than the config file, which anyone with the
+// file API or a terminal can rewrite.
+const mountsEnv = "CUTE_MOUNTS"
+
+// MountConfig exposes a directory outside the data directory, e.g.
+// {"prefix": "docs", "path": "/usr/share/doc"} serves /docs/* from
+// /usr/share/doc and makes it available to the file API as docs/*. This is
+// a deliberate escape hatch from the sandbox, limited to exactly the
+// configured paths.
+type MountConfig struct {
+	Prefix string `json:"prefix"` // URL and file API path prefix
+	Path   string `json:"path"`   // Absolute directory on the host
+	// ReadOnly keeps the file API to reading it. On unless set to false.
+	ReadOnly *bool `json:"readOnly,omitempty"`
+}
+
+// prefix returns the mount's prefix without surrounding slashes
+func (m *MountConfig) prefix() string {
+	return strings.Trim(path.Clean("/"+m.Prefix), "/")
+}
+
+func (m *MountConfig) readOnly() bool {
+	return m.ReadOnly == nil || *m.ReadOnly
+}
+
+// operatorMounts reads and validates the mounts from mountsEnv
+func operatorMounts() ([]MountConfig, error) {
+	value := os.Getenv(mountsEnv)
+	if value == "" {
+		return nil, nil
+	}
+	var mounts []MountConfig
+	if err := json.Unmarshal([]byte(value), &mounts); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", mountsEnv, err)
+	}
+	if err := validateMounts(mounts); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// validateMounts checks mounts when the config is loaded
+func validateMounts(mounts []MountConfig) error {
+	for _, m := range mounts {
+		if m.prefix() == "" {
+			return fmt.Errorf("mount for %q needs a prefix", m.Path)
+		}
+		if !filepath.IsAbs(m.Path) {
+			return fmt.Errorf("mount %q: path must be absolute, got %q", m.Prefix, m.Path)
+		}
+	}
+	return nil
+}
+
+// mountFor finds the mount a clean, slash-separated relative path is in,
+// returning it along with the rest of the path below its prefix. The
+// longest matching prefix wins.
+func (c *Config) mountFor(relPath string) (*MountConfig, string, bool) {
+	var found *MountConfig
+	rest := ""
+	for i := range c.Mounts {
+		m := &c.Mounts[i]
+		prefix := m.prefix()
+		if found != nil && len(prefix) <= len(found.prefix()) {
+			continue
+		}
+		if relPath == prefix {
+			found, rest = m, ""
+		} else if r, ok := strings.CutPrefix(relPath, prefix+"/"); ok {
+			found, rest = m, r
+		}
+	}
+	return found, rest, found != nil
+}
+
+// resolveMountPath maps relPath into a mount, if it's in one
+func resolveMountPath(relPath string) (string, *MountConfig, bool) {
+	config, err := loadConfig()
+	if err != nil || len(config.Mounts) == 0 {
+		return "", nil, false
+	}
+	m, rest, ok := config.mountFor(filepath.ToSlash(relPath))
+	if !ok {
+		return "", nil, false
+	}
+	// rest is already clean, so it can't climb out of the mount
+	return filepath.Join(filepath.Clean(m.Path), rest), m, true
+}
+
+// mountRelativePath maps an absolute path inside a mount back to its
+// prefixed relative path, the inverse of resolveMountPath. It's called for
+// every file in a listing, so it uses the config already loaded for the
+// request rather than statting the config file again.
+func mountRelativePath(absPath string) (string, bool) {
+	configCache.mu.RLock()
+	config := configCache.config
+	configCache.mu.RUnlock()
+	if config == nil {
+		return "", false
+	}
+	for i := range config.Mounts {
+		m := &config.Mounts[i]
+		root := filepath.Clean(m.Path)
+		if absPath == root {
+			return m.prefix(), true
+		}
+		if rest, ok := strings.CutPrefix(absPath, root+string(filepath.Separator)); ok {
+			return m.prefix() + "/" + filepath.ToSlash(rest), true
+		}
+	}
+	return "", false
+}
+
+// isRootPath reports whether absPath is the data directory or the root of
+// a mount, which whole-tree operations must never target
+func isRootPath(absPath string) bool {
+	if absPath == filepath.Clean(dataDir) {
+		return true
+	}
+	configCache.mu.RLock()
+	config := configCache.config
+	configCache.mu.RUnlock()
+	if config == nil {
+		return false
+	}
+	for _, m := range config.Mounts {
+		if absPath == filepath.Clean(m.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAndResolveWritePath is validateAndResolvePath for paths about to
+// be modified, rejecting read-only mounts with errReadOnlyMount
+func validateAndResolveWritePath(relativePath string) (string, error) {
+	cleanPath := strings.TrimPrefix(filepath.Clean(relativePath), "/")
+	if absPath, m, ok := resolveMountPath(cleanPath); ok {
+		if m.readOnly() {
+			return "", errReadOnlyMount
+		}
+		return absPath, nil
+	}
+	return validateAndResolvePath(relativePath)
+}
+
+// pathErrorStatus is the HTTP status for a path validation error
+func pathErrorStatus(err error) int {
+	if errors.Is(err, errReadOnlyMount) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
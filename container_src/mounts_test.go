@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	docsDir := t.TempDir() // Outside the data directory
+	writeTestFiles(t, docsDir, map[string]string{
+		"readme.txt":       "system docs",
+		"guide/index.html": "<h1>guide</h1>",
+	})
+	scratchDir := t.TempDir()
+
+	t.Setenv(mountsEnv, fmt.Sprintf(`[
+		{"prefix": "/docs/", "path": %q},
+		{"prefix": "scratch", "path": %q, "readOnly": false}
+	]`, docsDir, scratchDir))
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"index.html":  "home",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	// Static serving from the mount, index.html included
+	if w := do("GET", "/docs/readme.txt", ""); w.Code != 200 || w.Body.String() != "system docs" {
+		t.Errorf("static mount file: %d %q", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/docs/guide/", ""); w.Code != 200 || w.Body.String() != "<h1>guide</h1>" {
+		t.Errorf("static mount index: %d %q", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/index.html", ""); w.Body.String() != "home" {
+		t.Errorf("regular static file: %q", w.Body.String())
+	}
+
+	// File API reads through the mount
+	if w := do("GET", "/api/files/docs/readme.txt", ""); w.Code != 200 || w.Body.String() != "system docs" {
+		t.Errorf("file API read: %d %q", w.Code, w.Body.String())
+	}
+	w := do("GET", "/api/files?path=docs&depth=-1", "")
+	var files []FileInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &files); err != nil {
+		t.Fatalf("listing: %v (%s)", err, w.Body.String())
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	if strings.Join(paths, ",") != "docs/guide,docs/guide/index.html,docs/readme.txt" {
+		t.Errorf("listing paths = %v", paths)
+	}
+
+	// Read-only, by default, is enforced for every kind of write
+	for _, tt := range []struct{ method, target, body string }{
+		{"PUT", "/api/files/docs/new.txt", "x"},
+		{"PUT", "/api/files/docs/readme.txt", "x"},
+		{"DELETE", "/api/files/docs/readme.txt", ""},
+		{"POST", "/api/files/move", `{"from": "docs/readme.txt", "to": "readme.txt"}`},
+		{"POST", "/api/files/move", `{"from": "index.html", "to": "docs/index.html"}`},
+		{"POST", "/api/files/chtimes", `{"path": "docs/readme.txt", "mtime": 0}`},
+		{"POST", "/api/files/delete-glob", `{"path": "docs", "pattern": "**"}`},
+		{"POST", "/api/files/transaction", `{"writes": [{"path": "docs/a.txt", "content": "a"}]}`},
+	} {
+		if w := do(tt.method, tt.target, tt.body); w.Code != 403 {
+			t.Errorf("%s %s %s: status %d, want 403", tt.method, tt.target, tt.body, w.Code)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(docsDir, "readme.txt")); string(data) != "system docs" {
+		t.Errorf("read-only mount modified: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "index.html")); err != nil {
+		t.Error("move into read-only mount removed the source")
+	}
+
+	// Writable mounts accept writes
+	if w := do("PUT", "/api/files/scratch/notes.txt", "hello"); w.Code != 200 && w.Code != 201 && w.Code != 204 {
+		t.Errorf("writable mount PUT: %d %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(scratchDir, "notes.txt")); string(data) != "hello" {
+		t.Errorf("writable mount content = %q", data)
+	}
+
+	// Traversal out of a mount is still rejected
+	if w := do("GET", "/api/files/docs/../../etc/passwd", ""); w.Code == 200 {
+		t.Errorf("traversal: %d", w.Code)
+	}
+	if _, err := validateAndResolvePath("docs/../../etc/passwd"); err == nil {
+		t.Error("traversal through a mount prefix resolved")
+	}
+}
+
+func TestMountsValidation(t *testing.T) {
+	for _, mounts := range []string{
+		`[{"prefix": "docs", "path": "relative/dir"}]`,
+		`[{"prefix": "/", "path": "/usr/share/doc"}]`,
+		`{"prefix": "docs", "path": "/usr/share/doc"}`,
+	} {
+		t.Setenv(mountsEnv, mounts)
+		tmpDir := t.TempDir()
+		writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+		useDataDir(t, tmpDir)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("%s: loaded", mounts)
+		}
+	}
+}
+
+func TestMountsNotFromConfigFile(t *testing.T) {
+	// The config file is writable through the file API, so it can't be what
+	// opens up the rest of the filesystem
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "mounts": [{"prefix": "host", "path": "/", "readOnly": false}]}`,
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/host/etc/hostname", nil))
+	if w.Code == 200 {
+		t.Errorf("read through a config file mount: %q", w.Body.String())
+	}
+	if config, err := loadConfig(); err != nil || len(config.Mounts) != 0 {
+		t.Errorf("mounts = %+v, err = %v", config.Mounts, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// UploadedFile is one file stored by POST /api/files/upload
+type UploadedFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// UploadResponse lists the files a multipart upload stored
+type UploadResponse struct {
+	Files []UploadedFile `json:"files"`
+}
+
+// stagedUpload is an uploaded part written to a temp file next to its target
+type stagedUpload struct {
+	target string
+	tmp    string
+}
+
+// handleAPIFilesUpload stores every file in a multipart/form-data body
+// into the directory ?path= (the base directory by default), for
+// drag-and-drop uploads of several files in one request. Each part is
+// named by its filename, which may include subdirectories ("src/a.go")
+// but must stay inside the target directory.
+//
+// Parts are streamed to temp files next to their targets as they arrive,
+// so memory use doesn't depend on the size of the batch. Nothing is moved
+// into place until the whole body has been read: a bad filename, an
+// oversized file or a broken connection part way through fails the
+// request and stores none of it (though directories created for it stay).
+func handleAPIFilesUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dirPath, err := validateAndResolveWritePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+	if info, err := os.Stat(dirPath); err == nil && !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	var staged []stagedUpload
+	defer func() {
+		for _, s := range staged {
+			os.Remove(s.tmp) // no-op once renamed
+		}
+	}()
+
+	resp := UploadResponse{Files: []UploadedFile{}}
+	seen := make(map[string]bool)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid multipart body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		name := partFilename(part.Header.Get("Content-Disposition"))
+		if name == "" {
+			part.Close()
+			continue // A plain form field, not a file
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			http.Error(w, fmt.Sprintf("Invalid filename %q", name), http.StatusBadRequest)
+			return
+		}
+		target, err := validateAndResolveWritePath(filepath.Join(toRelativePath(dirPath), filepath.FromSlash(name)))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid filename %q: %v", name, err), pathErrorStatus(err))
+			return
+		}
+		if seen[target] {
+			http.Error(w, fmt.Sprintf("Duplicate filename %q", name), http.StatusBadRequest)
+			return
+		}
+		seen[target] = true
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			http.Error(w, fmt.Sprintf("Path is a directory: %q", name), http.StatusBadRequest)
+			return
+		}
+
+		tmp, n, err := stageFileAtomic(target, part, maxUploadBytes, nil)
+		part.Close()
+		if err != nil {
+			if errors.Is(err, errTooLarge) {
+				http.Error(w, fmt.Sprintf("File %q too large (limit %s)", name, formatBytes(maxUploadBytes)), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to write %q: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		staged = append(staged, stagedUpload{target: target, tmp: tmp})
+		resp.Files = append(resp.Files, UploadedFile{Path: toRelativePath(target), Size: n})
+	}
+	if len(staged) == 0 {
+		http.Error(w, "No files in upload", http.StatusBadRequest)
+		return
+	}
+
+	for i, s := range staged {
+		if err := os.Rename(s.tmp, s.target); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to move %q into place after storing %d of %d files: %v", resp.Files[i].Path, i, len(staged), err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// partFilename returns the filename a multipart part was sent with, or ""
+// for a part that isn't a file. Unlike Part.FileName this keeps the
+// directories, both so folder uploads keep their layout and so a name like
+// "../x" is rejected rather than quietly stored as "x".
+func partFilename(contentDisposition string) string {
+	disposition, params, err := mime.ParseMediaType(contentDisposition)
+	if err != nil || disposition != "form-data" {
+		return ""
+	}
+	return params["filename"]
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// multipartBody encodes files (name, content pairs) as a multipart form,
+// plus a plain form field that uploads should ignore
+func multipartBody(t *testing.T, files ...string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("note", "not a file")
+	for i := 0; i < len(files); i += 2 {
+		fw, err := mw.CreateFormFile("files", files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(files[i+1]))
+	}
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestAPIFilesUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		files      []string
+		wantStatus int
+		wantFiles  map[string]string // Expected content afterwards ("" = must not exist)
+	}{
+		{
+			name:       "several files",
+			path:       "site",
+			files:      []string{"index.html", "<h1>hi</h1>", "css/app.css", "body {}", "old.txt", "replaced"},
+			wantStatus: 201,
+			wantFiles:  map[string]string{"site/index.html": "<h1>hi</h1>", "site/css/app.css": "body {}", "site/old.txt": "replaced"},
+		},
+		{
+			name:       "base directory by default",
+			files:      []string{"top.txt", "top"},
+			wantStatus: 201,
+			wantFiles:  map[string]string{"top.txt": "top"},
+		},
+		{
+			name:       "traversal fails the whole batch",
+			path:       "site",
+			files:      []string{"ok.txt", "ok", "../../escape.txt", "x"},
+			wantStatus: 400,
+			wantFiles:  map[string]string{"site/ok.txt": "", "site/old.txt": "old"},
+		},
+		{
+			name:       "absolute filename",
+			path:       "site",
+			files:      []string{"/etc/passwd", "x"},
+			wantStatus: 400,
+		},
+		{
+			name:       "duplicate filename",
+			path:       "site",
+			files:      []string{"a.txt", "1", "./a.txt", "2"},
+			wantStatus: 400,
+			wantFiles:  map[string]string{"site/a.txt": ""},
+		},
+		{
+			name:       "target is a file",
+			path:       "site/old.txt",
+			files:      []string{"a.txt", "1"},
+			wantStatus: 400,
+		},
+		{name: "no files", path: "site", wantStatus: 400},
+		{name: "escaping directory", path: "../", files: []string{"a.txt", "1"}, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{"site/old.txt": "old"})
+			useDataDir(t, tmpDir)
+
+			body, contentType := multipartBody(t, tt.files...)
+			req := httptest.NewRequest("POST", "/api/files/upload?path="+tt.path, body)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			handleAPIFilesUpload(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if w.Code == 201 {
+				var resp UploadResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Files) != len(tt.files)/2 {
+					t.Errorf("got %d files in response, want %d: %+v", len(resp.Files), len(tt.files)/2, resp.Files)
+				}
+				for _, f := range resp.Files {
+					if want := int64(len(tt.wantFiles[f.Path])); f.Size != want {
+						t.Errorf("%s size = %d, want %d", f.Path, f.Size, want)
+					}
+				}
+			}
+
+			for path, want := range tt.wantFiles {
+				content, err := os.ReadFile(filepath.Join(tmpDir, path))
+				if want == "" {
+					if err == nil {
+						t.Errorf("%s exists, want it gone", path)
+					}
+					continue
+				}
+				if err != nil || string(content) != want {
+					t.Errorf("%s = %q (%v), want %q", path, content, err, want)
+				}
+			}
+
+			// Failed uploads mustn't leave temp files behind
+			filepath.WalkDir(tmpDir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && strings.Contains(d.Name(), ".tmp-") {
+					t.Errorf("temp file left behind: %s", path)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestAPIFilesUploadNotMultipart(t *testing.T) {
+	useDataDir(t, t.TempDir())
+	w := httptest.NewRecorder()
+	handleAPIFilesUpload(w, httptest.NewRequest("POST", "/api/files/upload", strings.NewReader("raw body")))
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestAPIFilesUploadTooLarge(t *testing.T) {
+	tmpDir := t.TempDir()
+	useDataDir(t, tmpDir)
+	defer func(old int64) { maxUploadBytes = old }(maxUploadBytes)
+	maxUploadBytes = 4
+
+	body, contentType := multipartBody(t, "small.txt", "ok", "big.txt", "too big")
+	req := httptest.NewRequest("POST", "/api/files/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handleAPIFilesUpload(w, req)
+	if w.Code != 413 {
+		t.Fatalf("status = %d, want 413: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "small.txt")); err == nil {
+		t.Error("small.txt was stored from a failed batch")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptSpec is one entry of an Accept-style header, e.g. "text/html;q=0.9"
+type acceptSpec struct {
+	value string
+	q     float64
+}
+
+// parseAccept parses an Accept or Accept-Encoding header value
+func parseAccept(header string) []acceptSpec {
+	var specs []acceptSpec
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+		spec := acceptSpec{value: value, q: 1}
+		for _, param := range fields[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					spec.q = q
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// acceptQuality returns the q-value header gives offer, using the most
+// specific matching entry ("text/html" beats "text/*" beats "*/*" or "*").
+// Returns 0 if nothing matches.
+func acceptQuality(specs []acceptSpec, offer string) float64 {
+	offer = strings.ToLower(offer)
+	bestQ, bestSpecificity := 0.0, -1
+	for _, spec := range specs {
+		specificity := -1
+		switch {
+		case spec.value == offer:
+			specificity = 2
+		case strings.HasSuffix(spec.value, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(spec.value, "*")):
+			specificity = 1
+		case spec.value == "*/*" || spec.value == "*":
+			specificity = 0
+		}
+		if specificity > bestSpecificity {
+			bestQ, bestSpecificity = spec.q, specificity
+		}
+	}
+	return bestQ
+}
+
+// negotiate picks the offer the header prefers, breaking ties by offer
+// order. An empty header accepts anything, so the first offer wins.
+// Returns "" if the header rules out every offer.
+func negotiate(header string, offers ...string) string {
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	specs := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(specs, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// notFoundPath returns the notFound page's path relative to the static
+// directory ("/404.html" and "404.html" are the same page)
+func notFoundPath(notFound string) string {
+	return filepath.FromSlash(strings.TrimPrefix(notFound, "/"))
+}
+
+// validateNotFound checks the notFound page when the config is loaded. It
+// must name a file inside the static directory, e.g. "404.html".
+func validateNotFound(notFound string) error {
+	if notFound != "" && !filepath.IsLocal(notFoundPath(notFound)) {
+		return fmt.Errorf("notFound must be a path inside the static directory, got %q", notFound)
+	}
+	return nil
+}
+
+// serveNotFound answers a request for a missing file with the configured
+// notFound page from the static directories, falling back to the built-in
+// 404 page when there isn't one
+func serveNotFound(w http.ResponseWriter, r *http.Request, config *Config, staticDirs []string) {
+	if config.NotFound == "" || validateNotFound(config.NotFound) != nil {
+		serve404(w, r.URL.Path)
+		return
+	}
+	match, err := findStaticFile(staticDirs, notFoundPath(config.NotFound))
+	if err != nil || match.info.IsDir() {
+		serve404(w, r.URL.Path)
+		return
+	}
+	content, err := readStaticFile(match.path, match.info, config)
+	if err != nil {
+		serve404(w, r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", config.mimeType(match.path))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != "HEAD" {
+		w.Write(content)
+	}
+}
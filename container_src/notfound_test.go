@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotFoundPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		notFound string
+		method   string
+		wantBody string // Substring of the response
+	}{
+		{name: "custom page", notFound: "404.html", wantBody: "<h1>Lost?</h1>"},
+		{name: "leading slash", notFound: "/404.html", wantBody: "<h1>Lost?</h1>"},
+		{name: "nested", notFound: "errors/missing.html", wantBody: "nested page"},
+		{name: "HEAD", notFound: "404.html", method: "HEAD"},
+		{name: "unset", wantBody: "404 - File Not Found"},
+		{name: "page missing", notFound: "nope.html", wantBody: "404 - File Not Found"},
+		{name: "page is a directory", notFound: "errors", wantBody: "404 - File Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":              `{"static": "site", "notFound": "` + tt.notFound + `"}`,
+				"site/index.html":          "home",
+				"site/404.html":            "<h1>Lost?</h1>",
+				"site/errors/missing.html": "nested page",
+			})
+			useDataDir(t, tmpDir)
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest(method, "/does/not/exist", nil))
+			if w.Code != 404 {
+				t.Fatalf("status = %d, want 404", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.method == "HEAD" && w.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNotFoundPageTraversal(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":     `{"static": "site", "notFound": "404.html"}`,
+		"site/index.html": "home",
+		"secret.txt":      "top secret",
+	})
+	useDataDir(t, tmpDir)
+
+	for _, notFound := range []string{"../secret.txt", "/../secret.txt", "errors/../../secret.txt"} {
+		if err := validateNotFound(notFound); err == nil {
+			t.Errorf("validateNotFound(%q) accepted a path outside the static directory", notFound)
+		}
+	}
+
+	// A config pointing outside is rejected, and the secret never served
+	configPath := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"static": "site", "notFound": "../secret.txt"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfigFile(configPath, time.Now()); err == nil {
+		t.Error("config with notFound outside the static directory loaded")
+	}
+	w := httptest.NewRecorder()
+	serveNotFound(w, httptest.NewRequest("GET", "/missing", nil), &Config{NotFound: "../secret.txt"}, []string{filepath.Join(tmpDir, "site")})
+	if w.Code != 404 || strings.Contains(w.Body.String(), "top secret") {
+		t.Errorf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+}
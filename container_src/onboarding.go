@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isFirstRun reports whether this computer is still brand new: the config
+// is the untouched default and the only other files are hidden ones (like
+// shell history). Adding any content or editing the config ends it.
+func isFirstRun() bool {
+	configPath, err := findConfigFile()
+	if err != nil || filepath.Base(configPath) != "config.json" {
+		return false
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil || !bytes.Equal(bytes.TrimSpace(data), []byte(defaultConfig)) {
+		return false
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Name() != "config.json" && !strings.HasPrefix(entry.Name(), ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// serveOnboarding shows the getting-started page in place of the root's
+// 404 on a new computer. It's never cached, so it goes away as soon as
+// there's a real site.
+func serveOnboarding(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	servePage(w, http.StatusOK, "Welcome", `<h1>Welcome to your Cute Computer</h1>
+        <div class="message">
+            <p>Nothing's here yet. This page will disappear once you add some content.</p>
+            <ol>
+                <li>Open the terminal or file manager.</li>
+                <li>Create an <code>index.html</code> to serve it right here.</li>
+                <li>Edit <code>config.json</code> to serve a different directory, e.g. <code>{"static": "dist"}</code>.</li>
+            </ol>
+        </div>`)
+}
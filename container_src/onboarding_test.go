@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFirstRunOnboarding(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  bool
+	}{
+		{name: "default config only", files: map[string]string{"config.json": defaultConfig}, want: true},
+		{name: "hidden files don't count", files: map[string]string{"config.json": defaultConfig + "\n", ".bash_history": "ls"}, want: true},
+		{name: "content added", files: map[string]string{"config.json": defaultConfig, "notes.txt": "hi"}},
+		{name: "index added", files: map[string]string{"config.json": defaultConfig, "index.html": "<h1>mine</h1>"}},
+		{name: "config customized", files: map[string]string{"config.json": `{"static": ".", "autoIndex": true}`}},
+		{name: "jsonc config", files: map[string]string{"config.jsonc": defaultConfig}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, tt.files)
+			useDataDir(t, tmpDir)
+
+			if got := isFirstRun(); got != tt.want {
+				t.Fatalf("isFirstRun() = %v, want %v", got, tt.want)
+			}
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", "/", nil))
+			onboarding := strings.Contains(w.Body.String(), "Welcome to your Cute Computer")
+			if onboarding != tt.want {
+				t.Errorf("onboarding shown = %v, want %v (status %d)", onboarding, tt.want, w.Code)
+			}
+			if tt.want && (w.Code != 200 || w.Header().Get("Cache-Control") != "no-store") {
+				t.Errorf("status = %d, cache-control = %q", w.Code, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestOnboardingOnlyAtRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": defaultConfig})
+	useDataDir(t, tmpDir)
+
+	w := httptest.NewRecorder()
+	handleHTTP(w, httptest.NewRequest("GET", "/missing.html", nil))
+	if w.Code != 404 {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns a file's UID and GID
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return st.Uid, st.Gid, true
+}
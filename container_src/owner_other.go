@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// fileOwner isn't supported here, so detailed listings leave owners blank
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
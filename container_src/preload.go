@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreloadLink is an asset to preload from HTML pages, sent as a
+// `Link: </app.js>; rel=preload; as=script` header so the browser fetches
+// it before it finds it in the page
+type PreloadLink struct {
+	Href string `json:"href"`           // e.g. "/app.js"
+	As   string `json:"as,omitempty"`   // script, style, font, image, fetch...
+	Type string `json:"type,omitempty"` // MIME type, e.g. "font/woff2"
+	// Paths limits the link to pages matching these patterns (same syntax
+	// as immutablePaths); empty means every page
+	Paths []string `json:"paths,omitempty"`
+}
+
+// header formats the link as a Link header value. Fonts are always fetched
+// in CORS mode, so their preload needs crossorigin to be reused.
+func (p *PreloadLink) header() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%s>; rel=preload", p.Href)
+	if p.As != "" {
+		fmt.Fprintf(&b, "; as=%s", p.As)
+	}
+	if p.Type != "" {
+		fmt.Fprintf(&b, "; type=%q", p.Type)
+	}
+	if p.As == "font" {
+		b.WriteString("; crossorigin")
+	}
+	return b.String()
+}
+
+// appliesTo reports whether the link should be sent with the page at
+// relPath (relative to the static directory)
+func (p *PreloadLink) appliesTo(relPath string) bool {
+	if len(p.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range p.Paths {
+		if matchPathGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// preloadLinks returns the Link header values for the HTML page at relPath
+func (c *Config) preloadLinks(relPath string) []string {
+	var links []string
+	for i := range c.Preload {
+		if p := &c.Preload[i]; p.Href != "" && p.appliesTo(relPath) {
+			links = append(links, p.header())
+		}
+	}
+	return links
+}
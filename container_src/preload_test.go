@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestPreloadLinkHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "preload": [
+			{"href": "/app.js", "as": "script"},
+			{"href": "/fonts/inter.woff2", "as": "font", "type": "font/woff2"},
+			{"href": "/docs.css", "as": "style", "paths": ["/docs/**"]}
+		]}`,
+		"index.html":      "<h1>home</h1>",
+		"docs/index.html": "<h1>docs</h1>",
+		"app.js":          "console.log(1)",
+		"logo.svg":        "<svg/>",
+	})
+	useDataDir(t, tmpDir)
+
+	global := []string{
+		"</app.js>; rel=preload; as=script",
+		`</fonts/inter.woff2>; rel=preload; as=font; type="font/woff2"; crossorigin`,
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", global},
+		{"/index.html", global},
+		{"/docs/", append(slices.Clone(global), "</docs.css>; rel=preload; as=style")},
+		{"/app.js", nil},
+		{"/logo.svg", nil},
+	}
+	// A real server, since pages also get a 103 Early Hints response that
+	// a ResponseRecorder would take as the final status
+	server := httptest.NewServer(http.HandlerFunc(handleHTTP))
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+			if got := resp.Header.Values("Link"); !slices.Equal(got, tt.want) {
+				t.Errorf("Link = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// prettyJSON indents JSON API responses for requests with ?pretty=true, for
+// reading them in a browser while debugging. Responses stay compact by
+// default. Other content types, and JSON that turns out not to be one
+// valid value, pass through unchanged.
+func prettyJSON(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pretty") != "true" || r.Header.Get("Upgrade") != "" {
+			h(w, r)
+			return
+		}
+		pw := &prettyResponseWriter{ResponseWriter: w}
+		defer pw.close()
+		h(pw, r)
+	}
+}
+
+// prettyResponseWriter holds back a JSON body until the handler is done,
+// so it can be indented as a whole
+type prettyResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool // Holding back a JSON body; the real header isn't sent yet
+	buf         bytes.Buffer
+}
+
+func (p *prettyResponseWriter) WriteHeader(status int) {
+	if p.wroteHeader {
+		return
+	}
+	p.wroteHeader = true
+	p.status = status
+	if strings.HasPrefix(p.Header().Get("Content-Type"), "application/json") {
+		p.buffering = true
+		return
+	}
+	p.ResponseWriter.WriteHeader(status)
+}
+
+func (p *prettyResponseWriter) Write(b []byte) (int, error) {
+	if !p.wroteHeader {
+		p.WriteHeader(http.StatusOK)
+	}
+	if p.buffering {
+		return p.buf.Write(b)
+	}
+	return p.ResponseWriter.Write(b)
+}
+
+// Flush passes through for bodies that aren't being held back
+func (p *prettyResponseWriter) Flush() {
+	if p.buffering {
+		return
+	}
+	if !p.wroteHeader {
+		p.WriteHeader(http.StatusOK)
+	}
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close sends a held back body, indented
+func (p *prettyResponseWriter) close() {
+	if !p.buffering {
+		return
+	}
+	body := p.buf.Bytes()
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err == nil {
+		body = indented.Bytes()
+	}
+	p.Header().Del("Content-Length")
+	p.ResponseWriter.WriteHeader(p.status)
+	p.ResponseWriter.Write(body)
+}
+
+func (p *prettyResponseWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrettyJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"a.txt": "a"})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	tests := []struct {
+		name  string
+		url   string
+		gzip  bool
+		want  string
+		wantT string // Content-Type
+	}{
+		{
+			name:  "compact by default",
+			url:   "/api/files/exists?path=a.txt",
+			want:  "{\"exists\":true,\"isDir\":false}\n",
+			wantT: "application/json",
+		},
+		{
+			name:  "indented",
+			url:   "/api/files/exists?path=a.txt&pretty=true",
+			want:  "{\n  \"exists\": true,\n  \"isDir\": false\n}\n",
+			wantT: "application/json",
+		},
+		{
+			name:  "indented, gzip accepted",
+			url:   "/api/files/exists?path=a.txt&pretty=true",
+			gzip:  true,
+			want:  "{\n  \"exists\": true,\n  \"isDir\": false\n}\n",
+			wantT: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.gzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			if w.Code != 200 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantT {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantT)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrettyJSONPassthrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"not JSON", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, `{"a":1}`)
+		}, `{"a":1}`},
+		{"invalid JSON", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"a":1}{"b":2}`)
+		}, `{"a":1}{"b":2}`},
+		{"error status is indented too", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "7")
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"a":1}`)
+		}, "{\n  \"a\": 1\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			prettyJSON(tt.handler)(w, httptest.NewRequest("GET", "/api/x?pretty=true", nil))
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != "" {
+				t.Errorf("Content-Length = %q, want it dropped", cl)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// protectedConfigNames matches the config files at the root of the data
+// directory, including per-environment ones like config.prod.json
+var protectedConfigNames = []string{"config.json", "config.jsonc", "config.*.json", "config.*.jsonc"}
+
+// protects reports whether the file API refuses to delete absPath: the
+// config files, which the site can't be served without, and anything
+// matching protectedPaths. c may be nil (the config couldn't be loaded),
+// in which case the config files are still protected.
+func (c *Config) protects(absPath string) bool {
+	relPath := toRelativePath(absPath)
+	for _, name := range protectedConfigNames {
+		if ok, _ := path.Match(name, relPath); ok {
+			return true
+		}
+	}
+	if c == nil {
+		return false
+	}
+	for _, pattern := range c.ProtectedPaths {
+		if matchPathGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectsWithin reports the first path under the directory absPath that
+// the file API refuses to delete, so a recursive delete can refuse the
+// whole directory instead of leaving it half gone
+func (c *Config) protectsWithin(absPath string) (string, bool) {
+	var protected string
+	errFound := errors.New("protected path")
+	err := filepath.WalkDir(absPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable or vanished; RemoveAll will report it
+		}
+		if c.protects(p) {
+			protected = toRelativePath(p)
+			return errFound
+		}
+		return nil
+	})
+	return protected, err == errFound
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ProxyConfig maps URL path prefixes to upstream servers, e.g.
+// {"/api": "http://localhost:3000"} sends /api and /api/* to a backend
+// running in the container, with the path unchanged. Everything else falls
+// through to static files (and the SPA fallback). The longest matching
+// prefix wins. Routes the container serves itself (/api/files, /api/logs,
+// /ws, ...) are matched first and never proxied.
+//
+// Responses are streamed and WebSocket upgrades are passed through, so a
+// dev server's hot reload works too. Upstreams see their own Host, with the
+// original in X-Forwarded-Host.
+type ProxyConfig map[string]string
+
+// validate checks proxy targets when the config is loaded
+func (p ProxyConfig) validate() error {
+	for prefix, target := range p {
+		if proxyPrefix(prefix) == "/" {
+			return fmt.Errorf("proxy prefix %q must not be the root", prefix)
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("proxy %q: target must be an http(s) URL, got %q", prefix, target)
+		}
+	}
+	return nil
+}
+
+// proxyPrefix cleans a configured prefix to "/api" form
+func proxyPrefix(prefix string) string {
+	return path.Clean("/" + prefix)
+}
+
+// proxyFor returns the upstream for a request path, if it's under a
+// configured prefix
+func (p ProxyConfig) proxyFor(requestPath string) (*url.URL, bool) {
+	best := ""
+	var target *url.URL
+	for prefix, upstream := range p {
+		prefix = proxyPrefix(prefix)
+		if requestPath != prefix && !strings.HasPrefix(requestPath, prefix+"/") {
+			continue
+		}
+		if len(prefix) <= len(best) {
+			continue
+		}
+		u, err := url.Parse(upstream)
+		if err != nil {
+			continue
+		}
+		best, target = prefix, u
+	}
+	return target, target != nil
+}
+
+// serveProxy forwards r to target
+func serveProxy(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Proxy to %s failed: %v", target, err)
+			http.Error(w, "Bad gateway", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
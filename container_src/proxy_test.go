@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteMessage(websocket.TextMessage, append([]byte("echo: "), msg...))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.RequestURI(), body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "spa": true, "proxy": {"/api/": "` + upstream.URL + `", "/backend/v2": "http://127.0.0.1:1"}}`,
+		"index.html":  "spa index",
+	})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(newServeMux(&Config{}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "proxied GET", method: "GET", path: "/api/users?page=2", wantStatus: 200, wantBody: "GET /api/users?page=2 "},
+		{name: "proxied POST", method: "POST", path: "/api/users", body: `{"name":"a"}`, wantStatus: 200, wantBody: `POST /api/users {"name":"a"}`},
+		{name: "prefix itself", method: "GET", path: "/api", wantStatus: 200, wantBody: "GET /api "},
+		{name: "not under the prefix", method: "GET", path: "/apiary", wantStatus: 200, wantBody: "spa index"},
+		{name: "spa route", method: "GET", path: "/dashboard/settings", wantStatus: 200, wantBody: "spa index"},
+		{name: "own routes win", method: "GET", path: "/api/files?fields=name", wantStatus: 200},
+		{name: "upstream down", method: "GET", path: "/backend/v2/health", wantStatus: 502},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	// WebSockets are passed through to the upstream
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/socket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := ws.ReadMessage(); err != nil || string(msg) != "echo: hi" {
+		t.Errorf("message = %q, %v", msg, err)
+	}
+}
+
+func TestProxyConfigValidation(t *testing.T) {
+	tests := []struct {
+		proxy   ProxyConfig
+		wantErr bool
+	}{
+		{proxy: ProxyConfig{"/api": "http://localhost:3000"}},
+		{proxy: ProxyConfig{"api/": "https://example.com/base"}},
+		{proxy: ProxyConfig{"/": "http://localhost:3000"}, wantErr: true},
+		{proxy: ProxyConfig{"/api": "localhost:3000"}, wantErr: true},
+		{proxy: ProxyConfig{"/api": "ftp://localhost"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.proxy.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v, wantErr %v", tt.proxy, err, tt.wantErr)
+		}
+	}
+}
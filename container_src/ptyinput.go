@@ -0,0 +1,29 @@
+package main
+
+import "io"
+
+// maxTerminalMessageBytes caps a single WebSocket message to the terminal,
+// e.g. a huge paste. A bigger frame closes the connection (1009, message
+// too big) instead of being buffered in memory.
+var maxTerminalMessageBytes int64 = 16 * 1024 * 1024 // 16 MB
+
+// ptyWriteChunk is how much input goes to the PTY per write, so a paste is
+// fed to the line discipline in pieces rather than one giant write
+const ptyWriteChunk = 4096
+
+// writeInput writes all of data to w in chunks, carrying on after short
+// writes until every byte is written or there's an error
+func writeInput(w io.Writer, data []byte) error {
+	for len(data) > 0 {
+		chunk := data[:min(len(data), ptyWriteChunk)]
+		n, err := w.Write(chunk)
+		data = data[n:]
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shortWriter accepts at most max bytes per write
+type shortWriter struct {
+	buf bytes.Buffer
+	max int
+	err error
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(p) > w.max {
+		p = p[:w.max]
+	}
+	return w.buf.Write(p)
+}
+
+func TestWriteInput(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	w := &shortWriter{max: 999}
+	if err := writeInput(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf.Bytes(), data) {
+		t.Errorf("wrote %d bytes, want all %d in order", w.buf.Len(), len(data))
+	}
+
+	stuck := &shortWriter{max: 0}
+	if err := writeInput(stuck, data); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("writer making no progress: err = %v", err)
+	}
+	broken := &shortWriter{max: 10, err: os.ErrClosed}
+	if err := writeInput(broken, data); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("failing writer: err = %v", err)
+	}
+}
+
+// dialTerminal opens a terminal WebSocket against a test server
+func dialTerminal(t *testing.T) *websocket.Conn {
+	t.Helper()
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+	return ws
+}
+
+// readUntil reads terminal output until it contains marker
+func readUntil(t *testing.T, ws *websocket.Conn, marker string) {
+	t.Helper()
+	var output strings.Builder
+	for !strings.Contains(output.String(), marker) {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q: %v (output so far %q)", marker, err, output.String())
+		}
+		output.Write(data)
+	}
+}
+
+func TestTerminalLargePaste(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	ws := dialTerminal(t)
+
+	var paste strings.Builder
+	for i := 0; paste.Len() < 3*1024*1024; i++ {
+		fmt.Fprintf(&paste, "line %d of a very large paste\n", i)
+	}
+
+	// Raw mode without echo, so the bytes reach head exactly as sent. The
+	// quotes keep the markers out of the echoed command line.
+	command := fmt.Sprintf("stty raw -echo; echo RE''ADY; head -c %d > pasted.txt; echo DO''NE\n", paste.Len())
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(command)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, ws, "READY")
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(paste.String())); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, ws, "DONE")
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "pasted.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != paste.String() {
+		t.Errorf("received %d bytes, want the %d pasted", len(got), paste.Len())
+	}
+}
+
+func TestTerminalMessageLimit(t *testing.T) {
+	old := maxTerminalMessageBytes
+	maxTerminalMessageBytes = 1024
+	t.Cleanup(func() { maxTerminalMessageBytes = old })
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	ws := dialTerminal(t)
+
+	if err := ws.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("x"), 2048)); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+			t.Errorf("err = %v, want close %d", err, websocket.CloseMessageTooBig)
+		}
+		return
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errRangeNotSatisfiable means a Range header lies entirely outside the resource
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is a resolved, in-bounds slice of a resource
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange formats the Content-Range header value for r
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a single "bytes=" range (start-end, start- or -suffix)
+// against a resource of size bytes. ok is false when the header should be
+// ignored and the full body served: no header, a different unit, a syntax
+// error or a multi-range request. Returns errRangeNotSatisfiable when the
+// range starts past the end of the resource.
+func parseRange(header string, size int64) (r byteRange, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	if startStr == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false, nil
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, false, errRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return byteRange{start: size - n, length: n}, true, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return byteRange{}, false, errRangeNotSatisfiable
+	}
+	return byteRange{start: start, length: end - start + 1}, true, nil
+}
+
+// ifRangeMatches reports whether a Range request still applies under its
+// If-Range precondition: it must name the current (strong) ETag or exact
+// modification time, otherwise the file changed and the client gets all of it
+func ifRangeMatches(header, etag string, modTime time.Time) bool {
+	if header == "" {
+		return true
+	}
+	if strings.HasPrefix(header, `"`) {
+		return header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && modTime.Truncate(time.Second).Equal(t)
+}
+
+// serveFileRange handles a Range request for the file at path. It returns
+// false if the Range header should be ignored, in which case nothing has
+// been written and the caller serves the whole file.
+func serveFileRange(w http.ResponseWriter, r *http.Request, path string, size int64, contentType string) bool {
+	br, ok, err := parseRange(r.Header.Get("Range"), size)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "Range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+	if !ok {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(br.start, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Range", br.contentRange(size))
+	w.Header().Set("Content-Length", strconv.FormatInt(br.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method != "HEAD" {
+		io.CopyN(w, f, br.length)
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// canonicalRedirect returns where to send a request that arrived on the
+// wrong host or scheme, or "" if it's fine where it is. The scheme comes
+// from X-Forwarded-Proto, which Cloudflare sets; without it (e.g. hitting
+// the container directly) ForceHTTPS has nothing to go on and is skipped
+// rather than risk a redirect loop.
+func canonicalRedirect(r *http.Request, config *Config) string {
+	scheme := strings.ToLower(r.Header.Get("X-Forwarded-Proto"))
+	targetScheme := scheme
+	if config.ForceHTTPS && scheme == "http" {
+		targetScheme = "https"
+	}
+
+	host := r.Host
+	targetHost := host
+	if config.CanonicalHost != "" && !sameHost(host, config.CanonicalHost) {
+		targetHost = config.CanonicalHost
+	}
+
+	if targetScheme == scheme && targetHost == host {
+		return ""
+	}
+	if targetScheme == "" {
+		targetScheme = "http"
+		if r.TLS != nil {
+			targetScheme = "https"
+		}
+	}
+	return targetScheme + "://" + targetHost + r.URL.RequestURI()
+}
+
+// sameHost compares a request's Host with the configured canonical host,
+// ignoring case, and ignoring the port unless the canonical host has one
+func sameHost(requestHost, canonical string) bool {
+	if _, _, err := net.SplitHostPort(canonical); err != nil {
+		if h, _, err := net.SplitHostPort(requestHost); err == nil {
+			requestHost = h
+		}
+	}
+	return strings.EqualFold(requestHost, canonical)
+}
+
+// redirectStatuses are the statuses a redirect rule can use. 307 and 308
+// keep the request's method and body; 301 and 302 may not.
+var redirectStatuses = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// RedirectRule sends requests for From to To, for URLs that have moved.
+// From is a path, optionally ending in "/*" to match everything below it:
+// the rest of the path is the splat, which replaces ":splat" in To or is
+// appended to it. So {"from": "/blog/*", "to": "/posts/:splat"} sends
+// /blog/2024/hello to /posts/2024/hello. The request's query string is kept
+// unless To has one of its own.
+type RedirectRule struct {
+	From   string `json:"from"`
+	To     string `json:"to"`               // A path or an http(s) URL
+	Status int    `json:"status,omitempty"` // 301 (default), 302, 307 or 308
+}
+
+// validateRedirects checks the rules when the config loads
+func validateRedirects(rules []RedirectRule) error {
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.From, "/") {
+			return fmt.Errorf("redirects[%d]: from must be a path starting with /, got %q", i, rule.From)
+		}
+		if prefix, splat := strings.CutSuffix(rule.From, "*"); strings.Contains(prefix, "*") ||
+			(splat && !strings.HasSuffix(prefix, "/")) {
+			return fmt.Errorf("redirects[%d]: from can only end in /*, got %q", i, rule.From)
+		}
+		if u, err := url.Parse(rule.To); err != nil || (!strings.HasPrefix(rule.To, "/") &&
+			((u.Scheme != "http" && u.Scheme != "https") || u.Host == "")) {
+			return fmt.Errorf("redirects[%d]: to must be a path starting with / or an http(s) URL, got %q", i, rule.To)
+		}
+		if rule.Status != 0 && !slices.Contains(redirectStatuses, rule.Status) {
+			return fmt.Errorf("redirects[%d]: status must be 301, 302, 307 or 308, got %d", i, rule.Status)
+		}
+	}
+	return nil
+}
+
+// matchRedirect returns the first rule matching a request, with where it
+// redirects to, or nil if none does
+func matchRedirect(rules []RedirectRule, r *http.Request) (*RedirectRule, string) {
+	requestPath := path.Clean("/" + r.URL.Path)
+	for i, rule := range rules {
+		target := rule.To
+		if prefix, ok := strings.CutSuffix(rule.From, "/*"); ok {
+			// "/blog/*" matches /blog itself too, with no splat
+			splat, found := strings.CutPrefix(requestPath, prefix+"/")
+			if !found {
+				if requestPath != path.Clean(prefix+"/") {
+					continue
+				}
+				splat = ""
+			}
+			if strings.Contains(target, ":splat") {
+				target = strings.ReplaceAll(target, ":splat", splat)
+			} else if splat != "" {
+				target = strings.TrimSuffix(target, "/") + "/" + splat
+			}
+		} else if requestPath != path.Clean(rule.From) {
+			continue
+		}
+		if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+			target += "?" + r.URL.RawQuery
+		}
+		return &rules[i], target
+	}
+	return nil, ""
+}
+
+// status returns the rule's redirect status
+func (rule *RedirectRule) status() int {
+	if rule.Status == 0 {
+		return http.StatusMovedPermanently
+	}
+	return rule.Status
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		host         string
+		proto        string // X-Forwarded-Proto
+		target       string
+		wantLocation string // Empty means no redirect
+	}{
+		{name: "host mismatch", config: `{"static": ".", "canonicalHost": "example.com"}`, host: "www.example.com", proto: "https", target: "/docs/page.html?q=1", wantLocation: "https://example.com/docs/page.html?q=1"},
+		{name: "to www", config: `{"static": ".", "canonicalHost": "www.example.com"}`, host: "example.com", proto: "https", target: "/", wantLocation: "https://www.example.com/"},
+		{name: "host mismatch keeps scheme", config: `{"static": ".", "canonicalHost": "example.com"}`, host: "www.example.com", proto: "http", target: "/a", wantLocation: "http://example.com/a"},
+		{name: "scheme mismatch", config: `{"static": ".", "forceHTTPS": true}`, host: "example.com", proto: "http", target: "/a?b=c", wantLocation: "https://example.com/a?b=c"},
+		{name: "host and scheme mismatch", config: `{"static": ".", "canonicalHost": "example.com", "forceHTTPS": true}`, host: "www.example.com", proto: "http", target: "/a", wantLocation: "https://example.com/a"},
+		{name: "already canonical", config: `{"static": ".", "canonicalHost": "example.com", "forceHTTPS": true}`, host: "example.com", proto: "https", target: "/index.html"},
+		{name: "host case and port ignored", config: `{"static": ".", "canonicalHost": "example.com"}`, host: "Example.COM:443", proto: "https", target: "/index.html"},
+		{name: "no forwarded proto skips https", config: `{"static": ".", "forceHTTPS": true}`, host: "example.com", target: "/index.html"},
+		{name: "not configured", config: `{"static": "."}`, host: "www.example.com", proto: "http", target: "/index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"index.html":  "home",
+			})
+			useDataDir(t, tmpDir)
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.Host = tt.host
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+
+			if tt.wantLocation == "" {
+				if w.Code != 200 {
+					t.Errorf("status = %d, want 200 (Location %q)", w.Code, w.Header().Get("Location"))
+				}
+				return
+			}
+			if w.Code != 301 {
+				t.Fatalf("status = %d, want 301", w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRedirectRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{
+			"static": ".",
+			"redirects": [
+				{"from": "/old.html", "to": "/new.html"},
+				{"from": "/blog/*", "to": "/posts/:splat", "status": 308},
+				{"from": "/docs/*", "to": "https://docs.example.com/", "status": 302},
+				{"from": "/search", "to": "/find?q=all"}
+			]
+		}`,
+		"old.html": "still here",
+		"new.html": "new",
+	})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"GET", "/old.html", 301, "/new.html"},
+		{"GET", "/old.html?x=1", 301, "/new.html?x=1"},
+		{"GET", "/./old.html", 301, "/new.html"},
+		{"GET", "/blog/2024/hello", 308, "/posts/2024/hello"},
+		{"POST", "/blog/2024/hello", 308, "/posts/2024/hello"},
+		{"GET", "/blog", 308, "/posts/"},
+		{"GET", "/docs/guide/intro", 302, "https://docs.example.com/guide/intro"},
+		{"GET", "/search?q=x", 301, "/find?q=all"},
+		{"GET", "/blogs", 404, ""},
+		{"GET", "/new.html", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRedirectRulesValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr string
+	}{
+		{"relative from", `{"from": "old.html", "to": "/new.html"}`, "from must be a path"},
+		{"wildcard in the middle", `{"from": "/a/*/b", "to": "/b"}`, "can only end in /*"},
+		{"wildcard without a slash", `{"from": "/blog*", "to": "/b"}`, "can only end in /*"},
+		{"relative to", `{"from": "/a", "to": "b.html"}`, "to must be a path"},
+		{"non-http to", `{"from": "/a", "to": "javascript:alert(1)"}`, "to must be a path"},
+		{"bad status", `{"from": "/a", "to": "/b", "status": 200}`, "status must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": `{"static": ".", "redirects": [` + tt.rule + `]}`,
+			})
+			useDataDir(t, tmpDir)
+
+			if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			// Requests get the config error page
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", "/a", nil))
+			if w.Code != 500 || !strings.Contains(w.Body.String(), "Configuration Error") {
+				t.Errorf("status = %d, want the config error page", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveResponse shows how a path given to the file API is interpreted
+type ResolveResponse struct {
+	Input   string `json:"input"`             // The path as given
+	Path    string `json:"path"`              // Cleaned, relative to the base directory
+	AbsPath string `json:"absPath,omitempty"` // Only for valid paths
+	Valid   bool   `json:"valid"`
+	Error   string `json:"error,omitempty"` // Why an invalid path was rejected
+	Exists  bool   `json:"exists"`
+}
+
+// handleAPIFilesResolve reports what validateAndResolvePath makes of
+// ?path=, to help debug paths that are rejected or end up somewhere
+// unexpected. Rejected paths are still a 200, with the reason in error.
+func handleAPIFilesResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	input := r.URL.Query().Get("path")
+	resp := ResolveResponse{
+		Input: input,
+		Path:  strings.TrimPrefix(filepath.ToSlash(filepath.Clean(input)), "/"),
+	}
+	absPath, err := validateAndResolvePath(input)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Valid = true
+		resp.AbsPath = absPath
+		resp.Path = toRelativePath(absPath)
+		_, statErr := os.Lstat(absPath)
+		resp.Exists = statErr == nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIFilesResolve(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":    `{"static": "."}`,
+		"src/bar/app.js": "",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantPath   string
+		wantValid  bool
+		wantExists bool
+	}{
+		{name: "normal", path: "src/bar/app.js", wantPath: "src/bar/app.js", wantValid: true, wantExists: true},
+		{name: "dot-dot within sandbox", path: "src/foo/../bar", wantPath: "src/bar", wantValid: true, wantExists: true},
+		{name: "redundant separators", path: "//src///bar//./app.js", wantPath: "src/bar/app.js", wantValid: true, wantExists: true},
+		{name: "leading slash", path: "/src", wantPath: "src", wantValid: true, wantExists: true},
+		{name: "missing", path: "src/nope.js", wantPath: "src/nope.js", wantValid: true},
+		{name: "root", path: "", wantPath: "", wantValid: true, wantExists: true},
+		{name: "traversal", path: "../etc/passwd", wantPath: "../etc/passwd"},
+		{name: "traversal via subdir", path: "src/../../etc", wantPath: "../etc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/resolve?path="+url.QueryEscape(tt.path), nil))
+			if w.Code != 200 {
+				t.Fatalf("status = %d", w.Code)
+			}
+			var resp ResolveResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Input != tt.path || resp.Path != tt.wantPath || resp.Valid != tt.wantValid || resp.Exists != tt.wantExists {
+				t.Errorf("got %+v", resp)
+			}
+			if tt.wantValid {
+				if want := filepath.Join(tmpDir, tt.wantPath); resp.AbsPath != want || resp.Error != "" {
+					t.Errorf("absPath = %q, error = %q; want %q", resp.AbsPath, resp.Error, want)
+				}
+			} else if resp.AbsPath != "" || resp.Error == "" {
+				t.Errorf("rejected path: absPath = %q, error = %q", resp.AbsPath, resp.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// scrollbackBytes is how much recent output a resumable session keeps to
+// replay when its owner reconnects
+const scrollbackBytes = 100 * 1024
+
+// sessionResumedReason is the close frame reason for a connection replaced
+// by a reconnect to its session
+const sessionResumedReason = "session resumed elsewhere"
+
+// sessionConnectedReason is the close frame reason for an attach that lost
+// the race for a session to another connection
+const sessionConnectedReason = "session connected elsewhere"
+
+// clearTerminal moves the cursor home and clears the screen and scrollback
+const clearTerminal = "\x1b[H\x1b[2J\x1b[3J"
+
+// reconnectGrace returns how long a session outlives its connection,
+// waiting for the owner to reconnect, or 0 if sessions end with their
+// connection (the default)
+func (c *TerminalConfig) reconnectGrace() time.Duration {
+	if c == nil || c.ReconnectGrace <= 0 {
+		return 0
+	}
+	return time.Duration(c.ReconnectGrace)
+}
+
+// scrollback keeps the last max bytes written to it
+type scrollback struct {
+	max  int
+	data []byte
+}
+
+func newScrollback(max int) *scrollback {
+	return &scrollback{max: max}
+}
+
+func (b *scrollback) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.max; over > 0 {
+		// Don't start part way through a character, or the replay isn't
+		// valid UTF-8 and browsers drop the connection
+		for over < len(b.data) && !utf8.RuneStart(b.data[over]) {
+			over++
+		}
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	return len(p), nil
+}
+
+// resumable reports whether the session can be reconnected to: it's still
+// running and kept alive for reconnects
+func (s *ptySession) resumable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closed && s.scrollback != nil
+}
+
+// connected reports whether the session has an owner connection
+func (s *ptySession) connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ws != nil
+}
+
+// attach makes ws the session's owner connection and replays the recent
+// output to it, reporting false if the session isn't resumable (any more),
+// or is still connected and this isn't a takeover. A takeover is a client
+// reconnecting after its own connection dropped, which the server may not
+// have noticed yet; the old connection is closed, as a normal closure so
+// it doesn't reconnect and take the session back. Anyone else (a second
+// browser tab, say) gets the session only once it's free, rather than
+// silently cutting off whoever has it.
+func (s *ptySession) attach(ws *websocket.Conn, takeover bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.scrollback == nil || (s.ws != nil && !takeover) {
+		return false
+	}
+	if s.ws != nil {
+		s.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, sessionResumedReason),
+			time.Now().Add(closeWriteWait))
+		s.ws.Close()
+	}
+	if s.orphanTimer != nil {
+		s.orphanTimer.Stop()
+		s.orphanTimer = nil
+	}
+	s.ws = ws
+	// Under the lock, so no output can come between the replay and what
+	// follows it. The client's terminal may still show what it had before
+	// the drop, so clear it (screen and scrollback) first rather than
+	// showing that output twice.
+	replay := append([]byte(clearTerminal), s.scrollback.data...)
+	ws.SetWriteDeadline(time.Now().Add(ownerWriteWait))
+	ws.WriteMessage(websocket.TextMessage, replay)
+	return true
+}
+
+// disconnect handles ws, the owner connection, going away. A resumable
+// session carries on without it for the reconnect grace period and is then
+// closed; any other session is closed straight away. It reports whether
+// the session is over.
+func (s *ptySession) disconnect(ws *websocket.Conn) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return true
+	}
+	if s.scrollback == nil {
+		s.mu.Unlock()
+		s.close()
+		return true
+	}
+	if s.ws != ws {
+		s.mu.Unlock()
+		return false
+	}
+	s.ws = nil
+	s.orphanTimer = time.AfterFunc(s.grace, s.close)
+	s.mu.Unlock()
+	return false
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestScrollback(t *testing.T) {
+	b := newScrollback(8)
+	b.Write([]byte("abc"))
+	b.Write([]byte("defgh"))
+	if got := string(b.data); got != "abcdefgh" {
+		t.Errorf("at the cap: %q", got)
+	}
+	b.Write([]byte("ij"))
+	if got := string(b.data); got != "cdefghij" {
+		t.Errorf("over the cap: %q", got)
+	}
+
+	// "é" is two bytes; cutting between them would leave invalid UTF-8
+	b.Write([]byte("é1234567"))
+	if !utf8.Valid(b.data) || !bytes.Equal(b.data, []byte("1234567")) {
+		t.Errorf("split character: %q", b.data)
+	}
+}
+
+// dialNamedTerminal opens the terminal session called name on server
+func dialNamedTerminal(t *testing.T, server *httptest.Server, name string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?name="+name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+	return ws
+}
+
+func TestTerminalReconnect(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"reconnectGrace": "10s", "maxSessionsPerIp": 1}}`,
+	})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	first := dialNamedTerminal(t, server, "laptop")
+	first.WriteMessage(websocket.TextMessage, []byte("SECRET=42; echo BEF''ORE\n"))
+	readUntil(t, first, "BEFORE")
+	first.Close()
+
+	// Back in the same shell, which doesn't count as another session,
+	// with the output from before replayed. The server may not have
+	// noticed the drop yet, so it's a takeover.
+	second := dialNamedTerminal(t, server, "laptop&takeover=true")
+	readUntil(t, second, "BEFORE")
+	second.WriteMessage(websocket.TextMessage, []byte("echo AF''TER $SECRET\n"))
+	readUntil(t, second, "AFTER 42")
+
+	// Exiting still ends it for good
+	second.WriteMessage(websocket.TextMessage, []byte("exit\n"))
+	if closeErr := readClose(t, second); closeErr.Code != websocket.CloseNormalClosure {
+		t.Errorf("close = %d %q", closeErr.Code, closeErr.Text)
+	}
+}
+
+func TestTerminalReconnectTimeout(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"reconnectGrace": "100ms"}}`,
+	})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	ws := dialNamedTerminal(t, server, "abandoned")
+	ws.WriteMessage(websocket.TextMessage, []byte("echo RE''ADY\n"))
+	readUntil(t, ws, "READY")
+	ws.Close()
+
+	// Nobody came back, so the shell is killed and the session forgotten
+	deadline := time.Now().Add(5 * time.Second)
+	for terminalSessions.lookup("abandoned") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("session still around after the grace period")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Reconnecting now starts afresh
+	ws = dialNamedTerminal(t, server, "abandoned")
+	readUntil(t, ws, "Welcome")
+}
+
+func TestTerminalAttachConflict(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"reconnectGrace": "10s"}}`,
+	})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+	dial := func(query string) (*websocket.Conn, *http.Response, error) {
+		ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?name=tabs"+query, nil)
+		if err == nil {
+			t.Cleanup(func() { ws.Close() })
+			ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+		}
+		return ws, resp, err
+	}
+
+	first := dialNamedTerminal(t, server, "tabs")
+	first.WriteMessage(websocket.TextMessage, []byte("echo RE''ADY\n"))
+	readUntil(t, first, "READY")
+
+	// A second tab doesn't get to take over a connected session
+	second, _, err := dial("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closeErr := readClose(t, second); closeErr.Code != websocket.CloseTryAgainLater || closeErr.Text != sessionConnectedReason {
+		t.Fatalf("attach to a connected session closed with %d %q", closeErr.Code, closeErr.Text)
+	}
+	first.WriteMessage(websocket.TextMessage, []byte("echo ST''ILL\n"))
+	readUntil(t, first, "STILL")
+
+	// Two attaching at once to a session that's free: one gets it
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for terminalSessions.lookup("tabs").connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("drop not noticed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var wg sync.WaitGroup
+	attached := make([]*websocket.Conn, 2)
+	for i := range attached {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ws, _, err := dial(""); err == nil {
+				// The loser may get the upgrade but then a 1013
+				if _, msg, err := ws.ReadMessage(); err == nil && strings.Contains(string(msg), "READY") {
+					attached[i] = ws
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if (attached[0] == nil) == (attached[1] == nil) {
+		t.Fatalf("attached = %v, want exactly one", attached)
+	}
+
+	// End it, rather than leave it counted against this IP
+	winner := attached[0]
+	if winner == nil {
+		winner = attached[1]
+	}
+	winner.WriteMessage(websocket.TextMessage, []byte("exit\n"))
+	readClose(t, winner)
+}
+
+func TestTerminalTakeoverFromStalledOwner(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"reconnectGrace": "10s"}}`,
+	})
+	useDataDir(t, tmpDir)
+	ownerWriteWait = 200 * time.Millisecond
+	t.Cleanup(func() { ownerWriteWait = 10 * time.Second })
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	// An owner that stops reading, like a laptop gone to sleep, while the
+	// shell keeps writing
+	owner := dialNamedTerminal(t, server, "asleep")
+	owner.WriteMessage(websocket.TextMessage, []byte("echo RE''ADY\n"))
+	readUntil(t, owner, "READY")
+	owner.WriteMessage(websocket.TextMessage, []byte("yes\n"))
+	time.Sleep(300 * time.Millisecond)
+
+	// Reconnecting from elsewhere isn't held up behind it
+	ws := dialNamedTerminal(t, server, "asleep&takeover=true")
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ws.WriteMessage(websocket.TextMessage, []byte("\x03"))
+	ws.WriteMessage(websocket.TextMessage, []byte("echo DO''NE\n"))
+	readUntil(t, ws, "DONE")
+
+	ws.WriteMessage(websocket.TextMessage, []byte("exit\n"))
+	readClose(t, ws)
+}
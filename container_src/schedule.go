@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ScheduleEntry is a command run on a cron schedule, like a crontab line
+type ScheduleEntry struct {
+	Cron    string `json:"cron"`    // e.g. "*/15 * * * *" or "@daily"
+	Command string `json:"command"` // Run with sh -c in the home directory
+}
+
+// ScheduleStatus reports a scheduled command for GET /api/schedule
+type ScheduleStatus struct {
+	Cron         string     `json:"cron"`
+	Command      string     `json:"command"`
+	Error        string     `json:"error,omitempty"` // Invalid cron spec
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastExitCode *int       `json:"lastExitCode,omitempty"`
+	LastError    string     `json:"lastError,omitempty"` // Command couldn't be started
+	Running      bool       `json:"running"`
+	Skipped      int        `json:"skipped"` // Runs skipped because the previous one was still going
+}
+
+// scheduledJob is a schedule entry plus its run state
+type scheduledJob struct {
+	entry    ScheduleEntry
+	schedule *cronSchedule // nil if the spec didn't parse
+	err      error
+
+	running      bool
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastExitCode int
+	lastError    string
+	skipped      int
+}
+
+// scheduler runs the config's schedule entries. Entries are matched across
+// config reloads by cron spec and command, so editing one line of the
+// schedule doesn't reset the state of the others.
+type scheduler struct {
+	mu   sync.Mutex
+	jobs []*scheduledJob
+	// run executes a command, returning its exit code (swapped in tests)
+	run func(command string) (int, error)
+}
+
+var cronScheduler = &scheduler{run: runScheduledCommand}
+
+// sync updates the job list to match the config
+func (s *scheduler) sync(entries []ScheduleEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[ScheduleEntry]*scheduledJob, len(s.jobs))
+	for _, job := range s.jobs {
+		existing[job.entry] = job
+	}
+
+	jobs := make([]*scheduledJob, 0, len(entries))
+	for _, entry := range entries {
+		if job, ok := existing[entry]; ok {
+			jobs = append(jobs, job)
+			delete(existing, entry) // A duplicated line gets its own job
+			continue
+		}
+		job := &scheduledJob{entry: entry}
+		job.schedule, job.err = parseCron(entry.Cron)
+		if job.err != nil {
+			log.Printf("Schedule: %v", job.err)
+		}
+		jobs = append(jobs, job)
+	}
+	s.jobs = jobs
+}
+
+// syncConfig updates the job list to match the config's schedule. Scheduled
+// commands are a way of running commands like the terminal is, so there are
+// none while the terminal is switched off.
+func (s *scheduler) syncConfig(config *Config) {
+	if !config.terminalEnabled() {
+		s.sync(nil)
+		return
+	}
+	s.sync(config.Schedule)
+}
+
+// tick starts every job that is due in the minute containing now
+func (s *scheduler) tick(now time.Time) {
+	minute := now.Truncate(time.Minute)
+	s.mu.Lock()
+	var due []*scheduledJob
+	for _, job := range s.jobs {
+		if job.schedule != nil && job.schedule.next(minute.Add(-time.Minute)).Equal(minute) {
+			due = append(due, job)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range due {
+		s.trigger(job)
+	}
+}
+
+// trigger starts job in the background unless its previous run is still
+// going, reporting whether it started
+func (s *scheduler) trigger(job *scheduledJob) bool {
+	s.mu.Lock()
+	if job.running {
+		job.skipped++
+		s.mu.Unlock()
+		sendLog(fmt.Sprintf("[schedule] Skipping %q: previous run still in progress", job.entry.Command))
+		return false
+	}
+	job.running = true
+	s.mu.Unlock()
+
+	go func() {
+		start := time.Now()
+		sendLog(fmt.Sprintf("[schedule] Running %q", job.entry.Command))
+		code, err := s.run(job.entry.Command)
+		duration := time.Since(start)
+
+		if err != nil {
+			sendLog(fmt.Sprintf("[schedule] %q failed to run: %v", job.entry.Command, err))
+		} else {
+			sendLog(fmt.Sprintf("[schedule] %q exited with code %d in %s", job.entry.Command, code, formatDuration(duration)))
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.running = false
+		job.lastRun = start
+		job.lastDuration = duration
+		job.lastExitCode = code
+		job.lastError = ""
+		if err != nil {
+			job.lastError = err.Error()
+		}
+	}()
+	return true
+}
+
+// status reports every job, with next runs computed from now
+func (s *scheduler) status(now time.Time) []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]ScheduleStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		st := ScheduleStatus{
+			Cron:      job.entry.Cron,
+			Command:   job.entry.Command,
+			LastError: job.lastError,
+			Running:   job.running,
+			Skipped:   job.skipped,
+		}
+		if job.err != nil {
+			st.Error = job.err.Error()
+		} else if next := job.schedule.next(now); !next.IsZero() {
+			st.NextRun = &next
+		}
+		if !job.lastRun.IsZero() {
+			lastRun, code := job.lastRun, job.lastExitCode
+			st.LastRun = &lastRun
+			st.LastDuration = formatDuration(job.lastDuration)
+			if job.lastError == "" {
+				st.LastExitCode = &code
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// loop checks the schedule at the start of every minute, picking up config
+// changes as it goes
+func (s *scheduler) loop() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+
+		if config, err := loadConfig(); err == nil {
+			s.syncConfig(config)
+		}
+		s.tick(time.Now())
+	}
+}
+
+// runScheduledCommand runs command as the user would from the terminal, as
+// the terminal's user, sending its output to the log line by line
+func runScheduledCommand(command string) (int, error) {
+	output := &logLineWriter{prefix: "[schedule] "}
+	defer output.Flush()
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dataDir
+	cmd.Env = commandEnv()
+	// Not as root, see terminalCredential
+	runAsTerminalUser(cmd)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// maxLogLine splits very long output lines so one line can't blow up a log
+// entry
+const maxLogLine = 4096
+
+// logLineWriter sends each complete line written to it to the log
+type logLineWriter struct {
+	prefix string
+	mu     sync.Mutex // Stdout and stderr write concurrently
+	buf    []byte
+}
+
+func (lw *logLineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			if len(lw.buf) >= maxLogLine {
+				i = maxLogLine
+			} else {
+				break
+			}
+		}
+		sendLog(lw.prefix + string(bytes.TrimRight(lw.buf[:i], "\r")))
+		if i < len(lw.buf) && lw.buf[i] == '\n' {
+			i++
+		}
+		lw.buf = lw.buf[i:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any trailing partial line
+func (lw *logLineWriter) Flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if len(lw.buf) > 0 {
+		sendLog(lw.prefix + string(lw.buf))
+		lw.buf = nil
+	}
+}
+
+// handleAPISchedule lists the scheduled commands with their last and next runs
+func handleAPISchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Show the schedule as configured now, not as of the last tick
+	config, err := loadConfig()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	cronScheduler.syncConfig(config)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cronScheduler.status(time.Now()))
+}
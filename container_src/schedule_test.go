@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerOverlapGuard(t *testing.T) {
+	var mu sync.Mutex
+	var logs []string
+	sendLog = func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, msg)
+	}
+	t.Cleanup(func() { sendLog = writeLog })
+
+	release := make(chan struct{})
+	runs := make(chan string, 10)
+	s := &scheduler{run: func(command string) (int, error) {
+		runs <- command
+		<-release
+		return 3, nil
+	}}
+	s.sync([]ScheduleEntry{{Cron: "* * * * *", Command: "slow"}})
+	job := s.jobs[0]
+
+	if !s.trigger(job) {
+		t.Fatal("first trigger didn't start")
+	}
+	<-runs
+	if s.trigger(job) {
+		t.Fatal("second trigger started while the first was running")
+	}
+
+	status := s.status(time.Now())[0]
+	if !status.Running || status.Skipped != 1 {
+		t.Errorf("status while running = %+v", status)
+	}
+
+	waitIdle := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for s.status(time.Now())[0].Running {
+			if time.Now().After(deadline) {
+				t.Fatal("run never finished")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	close(release)
+	waitIdle()
+
+	status = s.status(time.Now())[0]
+	if status.LastRun == nil || status.LastExitCode == nil || *status.LastExitCode != 3 || status.NextRun == nil {
+		t.Errorf("status after run = %+v", status)
+	}
+
+	// Once finished it can run again
+	if !s.trigger(job) {
+		t.Fatal("trigger after completion didn't start")
+	}
+	<-runs
+	waitIdle()
+}
+
+func TestSchedulerSync(t *testing.T) {
+	s := &scheduler{run: func(string) (int, error) { return 0, nil }}
+	s.sync([]ScheduleEntry{
+		{Cron: "@hourly", Command: "a"},
+		{Cron: "not a spec", Command: "b"},
+	})
+	kept := s.jobs[0]
+	kept.skipped = 2
+
+	// Editing one entry keeps the state of the others
+	s.sync([]ScheduleEntry{
+		{Cron: "@hourly", Command: "a"},
+		{Cron: "@daily", Command: "b"},
+	})
+	if s.jobs[0] != kept || s.jobs[0].skipped != 2 {
+		t.Error("unchanged entry lost its state")
+	}
+
+	statuses := s.status(time.Now())
+	if len(statuses) != 2 || statuses[1].Error != "" || statuses[1].NextRun == nil {
+		t.Errorf("statuses = %+v", statuses)
+	}
+
+	s.sync([]ScheduleEntry{{Cron: "bad", Command: "c"}})
+	if statuses := s.status(time.Now()); len(statuses) != 1 || statuses[0].Error == "" || statuses[0].NextRun != nil {
+		t.Errorf("invalid spec status = %+v", statuses)
+	}
+}
+
+func TestRunScheduledCommand(t *testing.T) {
+	useDataDir(t, t.TempDir())
+	var logs []string
+	sendLog = func(msg string) { logs = append(logs, msg) }
+	t.Cleanup(func() { sendLog = writeLog })
+
+	code, err := runScheduledCommand("echo one; echo two; exit 4")
+	if err != nil || code != 4 {
+		t.Fatalf("code = %d, err = %v", code, err)
+	}
+	if len(logs) != 2 || logs[0] != "[schedule] one" || logs[1] != "[schedule] two" {
+		t.Errorf("logs = %q", logs)
+	}
+}
+
+func TestSchedulerTerminalDisabled(t *testing.T) {
+	runs := make(chan string, 10)
+	s := &scheduler{run: func(command string) (int, error) {
+		runs <- command
+		return 0, nil
+	}}
+	off := false
+	config := &Config{
+		Terminal: &TerminalConfig{Enabled: &off},
+		Schedule: []ScheduleEntry{{Cron: "* * * * *", Command: "touch pwned"}},
+	}
+
+	s.syncConfig(config)
+	s.tick(time.Now())
+	if statuses := s.status(time.Now()); len(statuses) != 0 {
+		t.Errorf("statuses with the terminal off = %+v", statuses)
+	}
+
+	// Switching the terminal off drops jobs that were already scheduled
+	config.Terminal = nil
+	s.syncConfig(config)
+	if len(s.jobs) != 1 {
+		t.Fatalf("jobs with the terminal on = %d", len(s.jobs))
+	}
+	config.Terminal = &TerminalConfig{Enabled: &off}
+	s.syncConfig(config)
+	s.tick(time.Now())
+
+	select {
+	case command := <-runs:
+		t.Errorf("ran %q with the terminal off", command)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxSearchResults caps the results of one search (a var so tests can
+// lower it). ?limit= can ask for fewer.
+var maxSearchResults = 500
+
+// SearchResponse lists the files a search found
+type SearchResponse struct {
+	Results []FileInfo `json:"results"`
+	// Truncated is set when there were more matches than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// handleAPISearch finds files and directories by name under ?path= (the
+// base directory by default) without listing the whole tree: ?q= matches
+// names as a case-insensitive substring, or with ?glob=true as a shell glob
+// ("*.go"). Directories that can't be read are skipped rather than failing
+// the search, and symlinks aren't followed out of the tree.
+func handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	glob := r.URL.Query().Get("glob") == "true"
+	if _, err := path.Match(query, ""); glob && err != nil {
+		http.Error(w, fmt.Sprintf("Invalid pattern %q", query), http.StatusBadRequest)
+		return
+	}
+	limit := maxSearchResults
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", param), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchResults)
+	}
+
+	rootPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Directory not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	lowerQuery := strings.ToLower(query)
+	matches := func(name string) bool {
+		if glob {
+			ok, _ := path.Match(query, name)
+			return ok
+		}
+		return strings.Contains(strings.ToLower(name), lowerQuery)
+	}
+
+	resp := SearchResponse{Results: []FileInfo{}}
+	errLimit := errors.New("result limit reached")
+	err = filepath.WalkDir(rootPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == rootPath {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir // Unreadable, keep searching elsewhere
+			}
+			return nil
+		}
+		if p == rootPath || !matches(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed since its directory was read
+		}
+		if len(resp.Results) == limit {
+			resp.Truncated = true
+			return errLimit
+		}
+		resp.Results = append(resp.Results, newFileInfo(toRelativePath(p), info))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
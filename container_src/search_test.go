@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAPISearch(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"README.md":         "r",
+		"src/main.go":       "m",
+		"src/readme.txt":    "r",
+		"src/lib/util.go":   "u",
+		"src/lib/Reader.go": "x",
+		"docs/guide.md":     "g",
+		"secret/notes.txt":  "s",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	// Unreadable directories are skipped, not fatal (root ignores this)
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(filepath.Join(tmpDir, "secret"), 0); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(filepath.Join(tmpDir, "secret"), 0755)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		wantStatus    int
+		want          []string
+		wantTruncated bool
+	}{
+		{
+			name:       "case-insensitive substring",
+			query:      "?q=READ",
+			wantStatus: 200,
+			want:       []string{"README.md", "src/lib/Reader.go", "src/readme.txt"},
+		},
+		{
+			name:       "matches directories",
+			query:      "?q=lib",
+			wantStatus: 200,
+			want:       []string{"src/lib"},
+		},
+		{
+			name:       "under a path",
+			query:      "?q=.go&path=src/lib",
+			wantStatus: 200,
+			want:       []string{"src/lib/Reader.go", "src/lib/util.go"},
+		},
+		{
+			name:       "glob",
+			query:      "?q=*.md&glob=true",
+			wantStatus: 200,
+			want:       []string{"README.md", "docs/guide.md"},
+		},
+		{
+			name:          "limit",
+			query:         "?q=.go&limit=2",
+			wantStatus:    200,
+			want:          []string{"src/lib/Reader.go", "src/lib/util.go"},
+			wantTruncated: true,
+		},
+		{name: "no query", wantStatus: 400},
+		{name: "bad glob", query: "?q=[&glob=true", wantStatus: 400},
+		{name: "bad limit", query: "?q=a&limit=0", wantStatus: 400},
+		{name: "escaping path", query: "?q=a&path=../..", wantStatus: 400},
+		{name: "not a directory", query: "?q=a&path=README.md", wantStatus: 400},
+		{name: "missing directory", query: "?q=a&path=nope", wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/search"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != 200 {
+				return
+			}
+
+			var resp SearchResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range resp.Results {
+				got = append(got, f.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+			if resp.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", resp.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
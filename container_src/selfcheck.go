@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SelfCheck summarizes the container environment, for answering "why
+// isn't my site working" without shelling in. It never includes secrets.
+type SelfCheck struct {
+	DataDir           string `json:"dataDir"`
+	FuseMounted       bool   `json:"fuseMounted"`
+	ConfigFile        string `json:"configFile,omitempty"` // Empty if none was found
+	ConfigValid       bool   `json:"configValid"`
+	ConfigError       string `json:"configError,omitempty"`
+	StaticDir         string `json:"staticDir,omitempty"` // Resolved absolute path(s), comma-separated
+	StaticDirExists   bool   `json:"staticDirExists"`
+	StaticDirError    string `json:"staticDirError,omitempty"`
+	LoggingConfigured bool   `json:"loggingConfigured"`
+	LogsEndpoint      string `json:"logsEndpoint,omitempty"` // Without credentials or query
+	Port              int    `json:"port"`
+}
+
+// selfCheck gathers the current SelfCheck
+func selfCheck() SelfCheck {
+	check := SelfCheck{
+		DataDir:     dataDir,
+		FuseMounted: isFuseMount(dataDir),
+		Port:        serverPort,
+	}
+
+	if configPath, err := findConfigFile(); err == nil {
+		check.ConfigFile = configPath
+	}
+	config, err := loadConfig()
+	if err != nil {
+		check.ConfigError = err.Error()
+	} else {
+		check.ConfigValid = true
+		staticDirs, err := resolveStaticDirs(config.Static, config.Mounts)
+		if err != nil {
+			check.StaticDirError = err.Error()
+		} else {
+			check.StaticDir = strings.Join(staticDirs, ", ")
+			check.StaticDirExists = true
+		}
+	}
+
+	logsEndpoint := os.Getenv("LOGS_ENDPOINT")
+	check.LoggingConfigured = logsEndpoint != "" && os.Getenv("LOGS_TOKEN") != ""
+	check.LogsEndpoint = redactURL(logsEndpoint)
+
+	return check
+}
+
+// redactURL strips credentials and query parameters (which may hold
+// tokens) from a URL
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(unparseable)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// String formats the check as a single log line
+func (c SelfCheck) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Self-check: dataDir=%s fuse=%t", c.DataDir, c.FuseMounted)
+	if c.ConfigFile == "" {
+		b.WriteString(" config=missing")
+	} else {
+		fmt.Fprintf(&b, " config=%s valid=%t", c.ConfigFile, c.ConfigValid)
+	}
+	if c.ConfigError != "" {
+		fmt.Fprintf(&b, " configError=%q", c.ConfigError)
+	}
+	if c.StaticDir != "" {
+		fmt.Fprintf(&b, " static=%s", c.StaticDir)
+	}
+	if c.StaticDirError != "" {
+		fmt.Fprintf(&b, " staticError=%q", c.StaticDirError)
+	}
+	fmt.Fprintf(&b, " logging=%t port=%d", c.LoggingConfigured, c.Port)
+	return b.String()
+}
+
+// runSelfCheck logs the self-check summary at startup
+func runSelfCheck() SelfCheck {
+	check := selfCheck()
+	log.Print(check.String())
+	writeLog(check.String())
+	return check
+}
+
+// handleAPISelfCheck returns the self-check as JSON
+func handleAPISelfCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(selfCheck())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Connection metrics, exposed at /debug/vars. "reused" counts requests
+// served on a connection that had already served one (idle -> active),
+// which is what tells you whether the tunnel is keeping connections alive.
+var (
+	connsNew     = expvar.NewInt("http_conns_new")
+	connsReused  = expvar.NewInt("http_conns_reused")
+	connsClosed  = expvar.NewInt("http_conns_closed")
+	connsActive  = expvar.NewInt("http_conns_active") // Currently serving a request
+	connsIdle    = expvar.NewInt("http_conns_idle")   // Currently waiting for the next request
+	connsRequest = expvar.NewInt("http_conns_requests")
+)
+
+const defaultIdleTimeout = 2 * time.Minute
+
+// KeepAliveConfig tunes HTTP/1.1 keep-alive. The config is read at
+// startup, so changes need a restart.
+type KeepAliveConfig struct {
+	Enabled     *bool    `json:"enabled,omitempty"`     // Default true
+	IdleTimeout Duration `json:"idleTimeout,omitempty"` // Default 2m
+}
+
+func (c *KeepAliveConfig) enabled() bool {
+	return c == nil || c.Enabled == nil || *c.Enabled
+}
+
+func (c *KeepAliveConfig) idleTimeout() time.Duration {
+	if c == nil || c.IdleTimeout <= 0 {
+		return defaultIdleTimeout
+	}
+	return time.Duration(c.IdleTimeout)
+}
+
+// connTracker follows each connection's state to keep the metrics above
+type connTracker struct {
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{states: make(map[net.Conn]http.ConnState)}
+}
+
+// gauge returns the open-connection gauge for a state, if it has one
+func gauge(state http.ConnState) *expvar.Int {
+	switch state {
+	case http.StateActive:
+		return connsActive
+	case http.StateIdle:
+		return connsIdle
+	}
+	return nil
+}
+
+// connState is the http.Server ConnState callback
+func (t *connTracker) connState(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	prev, known := t.states[conn]
+	if state == http.StateClosed || state == http.StateHijacked {
+		delete(t.states, conn)
+	} else {
+		t.states[conn] = state
+	}
+	t.mu.Unlock()
+
+	if known {
+		if g := gauge(prev); g != nil {
+			g.Add(-1)
+		}
+	}
+	if g := gauge(state); g != nil {
+		g.Add(1)
+	}
+
+	switch state {
+	case http.StateNew:
+		connsNew.Add(1)
+	case http.StateActive:
+		connsRequest.Add(1)
+		if prev == http.StateIdle {
+			connsReused.Add(1)
+		}
+	case http.StateClosed:
+		connsClosed.Add(1)
+	}
+}
+
+// newServer builds the HTTP server with the configured keep-alive settings
+func newServer(config *Config, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%d", serverPort),
+		Handler:     handler,
+		IdleTimeout: config.KeepAlive.idleTimeout(),
+		ConnState:   newConnTracker().connState,
+	}
+	server.SetKeepAlivesEnabled(config.KeepAlive.enabled())
+	return server
+}
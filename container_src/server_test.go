@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnReuseMetrics(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name       string
+		keepAlive  *KeepAliveConfig
+		wantNew    int64
+		wantReused int64
+	}{
+		{name: "keep-alive", keepAlive: nil, wantNew: 1, wantReused: 4},
+		{name: "keep-alive disabled", keepAlive: &KeepAliveConfig{Enabled: &disabled}, wantNew: 5, wantReused: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+			})
+			configured := newServer(&Config{KeepAlive: tt.keepAlive}, handler)
+			server := httptest.NewUnstartedServer(handler)
+			server.Config = configured
+			server.Start()
+			defer server.Close()
+
+			newBefore, reusedBefore := connsNew.Value(), connsReused.Value()
+
+			client := &http.Client{Transport: &http.Transport{}}
+			for range 5 {
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			client.CloseIdleConnections()
+
+			if got := connsNew.Value() - newBefore; got != tt.wantNew {
+				t.Errorf("new connections = %d, want %d", got, tt.wantNew)
+			}
+			if got := connsReused.Value() - reusedBefore; got != tt.wantReused {
+				t.Errorf("reused connections = %d, want %d", got, tt.wantReused)
+			}
+		})
+	}
+}
+
+func TestKeepAliveConfig(t *testing.T) {
+	var unset *KeepAliveConfig
+	if !unset.enabled() || unset.idleTimeout() != defaultIdleTimeout {
+		t.Error("unset config should use defaults")
+	}
+	custom := &KeepAliveConfig{IdleTimeout: Duration(30 * time.Second)}
+	if !custom.enabled() || custom.idleTimeout() != 30*time.Second {
+		t.Errorf("custom idle timeout = %v", custom.idleTimeout())
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	serverLogLines     = 1000 // Lines kept in memory
+	defaultLogTailSize = 100
+)
+
+// secretEnvVars are environment variables whose values never appear in
+// /api/logs
+var secretEnvVars = []string{"S3_AUTH_TOKEN", "LOGS_TOKEN"}
+
+// secretPattern catches credentials that aren't in the environment, like
+// bearer tokens and key=value pairs in URLs or command lines
+var secretPattern = regexp.MustCompile(`(?i)(bearer\s+|(?:token|secret|password|passwd|key)=)[^\s&"']+`)
+
+// logRing keeps the most recent server log lines. It's added to the log
+// package's output in main, so everything written with log.Printf lands
+// here as well as on stdout.
+type logRing struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte // Unterminated line from the last Write
+	subs    map[chan string]struct{}
+}
+
+func newLogRing(max int) *logRing {
+	return &logRing{max: max, subs: make(map[chan string]struct{})}
+}
+
+var serverLogs = newLogRing(serverLogLines)
+
+func (lr *logRing) Write(p []byte) (int, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	data := append(lr.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lr.add(redactSecrets(string(data[:i])))
+		data = data[i+1:]
+	}
+	lr.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// add appends a line and fans it out to followers. Callers hold mu.
+func (lr *logRing) add(line string) {
+	lr.lines = append(lr.lines, line)
+	if len(lr.lines) > lr.max {
+		lr.lines = lr.lines[len(lr.lines)-lr.max:]
+	}
+	for ch := range lr.subs {
+		select {
+		case ch <- line:
+		default: // A follower that can't keep up misses lines
+		}
+	}
+}
+
+// tail returns up to the last n lines
+func (lr *logRing) tail(n int) []string {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if n > len(lr.lines) {
+		n = len(lr.lines)
+	}
+	return append([]string(nil), lr.lines[len(lr.lines)-n:]...)
+}
+
+// follow returns the last n lines plus a channel of new lines, atomically
+// so none are missed or repeated. Call the returned func to stop.
+func (lr *logRing) follow(n int) ([]string, <-chan string, func()) {
+	ch := make(chan string, 100)
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if n > len(lr.lines) {
+		n = len(lr.lines)
+	}
+	lines := append([]string(nil), lr.lines[len(lr.lines)-n:]...)
+	lr.subs[ch] = struct{}{}
+	return lines, ch, func() {
+		lr.mu.Lock()
+		defer lr.mu.Unlock()
+		delete(lr.subs, ch)
+	}
+}
+
+// redactSecrets masks secret values in a log line
+func redactSecrets(line string) string {
+	for _, name := range secretEnvVars {
+		if value := os.Getenv(name); len(value) >= 8 {
+			line = strings.ReplaceAll(line, value, "[REDACTED]")
+		}
+	}
+	return secretPattern.ReplaceAllString(line, "${1}[REDACTED]")
+}
+
+// authorizedForLogs checks for "Authorization: Bearer <LOGS_TOKEN>", the
+// token the worker hands the container for its own log shipping. Without
+// a token configured nobody can read the logs.
+func authorizedForLogs(r *http.Request) bool {
+	token := os.Getenv("LOGS_TOKEN")
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// handleAPILogs returns recent server log lines as JSON (?tail=N, default
+// 100), or with ?follow=true streams them as Server-Sent Events
+func handleAPILogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizedForLogs(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	n := defaultLogTailSize
+	if tailStr := r.URL.Query().Get("tail"); tailStr != "" {
+		parsed, err := strconv.Atoi(tailStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "tail must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		n = min(parsed, serverLogLines)
+	}
+
+	if r.URL.Query().Get("follow") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(serverLogs.tail(n))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	lines, ch, stop := serverLogs.follow(n)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, line := range lines {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-ch:
+			fmt.Fprintf(w, "data: %s\n\n", line)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureServerLogs sends the log package's output to serverLogs, as main does
+func captureServerLogs(t *testing.T) {
+	log.SetOutput(io.MultiWriter(os.Stderr, serverLogs))
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func TestAPILogs(t *testing.T) {
+	t.Setenv("LOGS_TOKEN", "test-logs-token")
+	t.Setenv("S3_AUTH_TOKEN", "super-secret-s3-token")
+	captureServerLogs(t)
+
+	log.Printf("first line")
+	log.Printf("mounting with token super-secret-s3-token")
+	log.Printf("calling https://example.com/?token=abc123&x=1")
+	log.Printf("last line")
+
+	get := func(target, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handleAPILogs(w, req)
+		return w
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "test-logs-token"} {
+		if w := get("/api/logs", auth); w.Code != http.StatusUnauthorized {
+			t.Errorf("auth %q: status = %d, want 401", auth, w.Code)
+		}
+	}
+
+	w := get("/api/logs?tail=4", "Bearer test-logs-token")
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var lines []string
+	if err := json.Unmarshal(w.Body.Bytes(), &lines); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "first line") || !strings.HasSuffix(lines[3], "last line") {
+		t.Fatalf("lines = %q", lines)
+	}
+	if strings.Contains(lines[1], "super-secret") || !strings.Contains(lines[1], "[REDACTED]") {
+		t.Errorf("env secret not redacted: %q", lines[1])
+	}
+	if strings.Contains(lines[2], "abc123") || !strings.Contains(lines[2], "token=[REDACTED]&x=1") {
+		t.Errorf("url token not redacted: %q", lines[2])
+	}
+
+	if w := get("/api/logs?tail=1", "Bearer test-logs-token"); !strings.Contains(w.Body.String(), "last line") || strings.Contains(w.Body.String(), "first line") {
+		t.Errorf("tail=1 body = %s", w.Body.String())
+	}
+	if w := get("/api/logs?tail=x", "Bearer test-logs-token"); w.Code != 400 {
+		t.Errorf("invalid tail status = %d", w.Code)
+	}
+}
+
+func TestAPILogsFollow(t *testing.T) {
+	t.Setenv("LOGS_TOKEN", "test-logs-token")
+	captureServerLogs(t)
+	log.Printf("before follow")
+
+	server := httptest.NewServer(http.HandlerFunc(handleAPILogs))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/logs?follow=true&tail=1", nil)
+	req.Header.Set("Authorization", "Bearer test-logs-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+	}()
+
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return ""
+		}
+	}
+
+	if e := next(); !strings.HasSuffix(e, "before follow") {
+		t.Errorf("first event = %q", e)
+	}
+	for i := range 3 {
+		log.Printf("followed %d", i)
+		if e := next(); !strings.HasSuffix(e, fmt.Sprintf("followed %d", i)) {
+			t.Errorf("event = %q", e)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultSessionWarning = 5 * time.Minute
+
+// sessionLimitReason is the close frame reason when a terminal session
+// reaches maxSessionDuration
+const sessionLimitReason = "maximum session duration reached"
+
+// maxSessionDuration returns the hard cap on a terminal session's
+// lifetime, or 0 for none
+func (c *TerminalConfig) maxSessionDuration() time.Duration {
+	if c == nil || c.MaxSessionDuration <= 0 {
+		return 0
+	}
+	return time.Duration(c.MaxSessionDuration)
+}
+
+// sessionWarning returns how long before the limit the user is warned.
+// It's clamped to half the session for short limits, so the warning never
+// comes before the session has started.
+func (c *TerminalConfig) sessionWarning() time.Duration {
+	warning := defaultSessionWarning
+	if c != nil && c.SessionWarning > 0 {
+		warning = time.Duration(c.SessionWarning)
+	}
+	return min(warning, c.maxSessionDuration()/2)
+}
+
+// limitSession ends a terminal session once it has lasted maxDuration,
+// regardless of activity, with a notice printed in the terminal warning
+// before that. The session ends with ClosePolicyViolation and
+// sessionLimitReason (see closecodes.go). Call the returned func to cancel
+// the timers when the session ends first.
+func limitSession(session *ptySession, maxDuration, warning time.Duration) func() {
+	warn := time.AfterFunc(maxDuration-warning, func() {
+		msg := fmt.Sprintf("\r\n\x1b[33mThis session will end in %s (maximum session length %s).\x1b[0m\r\n",
+			warning.Round(time.Second), maxDuration.Round(time.Second))
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if !session.closed && session.ws != nil {
+			session.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+	})
+	end := time.AfterFunc(maxDuration, func() {
+		session.end(websocket.ClosePolicyViolation, sessionLimitReason)
+	})
+	return func() {
+		warn.Stop()
+		end.Stop()
+	}
+}
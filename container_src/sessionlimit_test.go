@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionLimitConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		terminal    *TerminalConfig
+		wantMax     time.Duration
+		wantWarning time.Duration
+	}{
+		{name: "no terminal config"},
+		{name: "no limit", terminal: &TerminalConfig{}},
+		{name: "default warning", terminal: &TerminalConfig{MaxSessionDuration: Duration(8 * time.Hour)}, wantMax: 8 * time.Hour, wantWarning: 5 * time.Minute},
+		{name: "custom warning", terminal: &TerminalConfig{MaxSessionDuration: Duration(time.Hour), SessionWarning: Duration(15 * time.Minute)}, wantMax: time.Hour, wantWarning: 15 * time.Minute},
+		{name: "warning clamped", terminal: &TerminalConfig{MaxSessionDuration: Duration(4 * time.Minute)}, wantMax: 4 * time.Minute, wantWarning: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.terminal.maxSessionDuration(); got != tt.wantMax {
+				t.Errorf("max = %v, want %v", got, tt.wantMax)
+			}
+			if tt.wantMax > 0 {
+				if got := tt.terminal.sessionWarning(); got != tt.wantWarning {
+					t.Errorf("warning = %v, want %v", got, tt.wantWarning)
+				}
+			}
+		})
+	}
+}
+
+func TestTerminalMaxSessionDuration(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"maxSessionDuration": "600ms", "sessionWarning": "400ms"}}`,
+	})
+	useDataDir(t, tmpDir)
+
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer server.Close()
+
+	start := time.Now()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	var warnedAt time.Time
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("read: %v", err)
+			}
+			if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != sessionLimitReason {
+				t.Errorf("close = %d %q", closeErr.Code, closeErr.Text)
+			}
+			closedAt := time.Since(start)
+			if closedAt < 600*time.Millisecond {
+				t.Errorf("closed after %v, before the limit", closedAt)
+			}
+			break
+		}
+		if strings.Contains(string(data), "This session will end in") {
+			warnedAt = time.Now()
+		}
+	}
+
+	if warnedAt.IsZero() {
+		t.Fatal("no warning before the session ended")
+	}
+	if at := warnedAt.Sub(start); at < 200*time.Millisecond || at >= 600*time.Millisecond {
+		t.Errorf("warned after %v, want between 200ms and the 600ms limit", at)
+	}
+}
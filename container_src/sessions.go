@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// sessionManager indexes live terminal sessions by name, so that viewers
+// (/ws?name=<name>&mode=view) and reconnects can find them, and so they can
+// be listed. When two sessions share a name, the most recent wins.
+type sessionManager struct {
+	mu     sync.Mutex
+	byName map[string]*ptySession
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{byName: make(map[string]*ptySession)}
+}
+
+// terminalSessions holds the sessions started by /ws
+var terminalSessions = newSessionManager()
+
+// register makes session the one its name refers to
+func (m *sessionManager) register(session *ptySession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.byName[session.name] = session
+}
+
+// lookup returns the live session registered under name, if any
+func (m *sessionManager) lookup(name string) *ptySession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.byName[name]
+}
+
+// remove takes session out, unless a newer session has its name by now
+func (m *sessionManager) remove(session *ptySession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.byName[session.name] == session {
+		delete(m.byName, session.name)
+	}
+}
+
+// sessions returns the registered sessions, oldest first
+func (m *sessionManager) sessions() []*ptySession {
+	m.mu.Lock()
+	sessions := make([]*ptySession, 0, len(m.byName))
+	for _, session := range m.byName {
+		sessions = append(sessions, session)
+	}
+	m.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].started.Before(sessions[j].started)
+	})
+	return sessions
+}
+
+// SessionInfo describes a running terminal session
+type SessionInfo struct {
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+	Cols    int       `json:"cols"`
+	Rows    int       `json:"rows"`
+	// Connected is false while a resumable session waits for its owner to
+	// reconnect, see resume.go
+	Connected bool `json:"connected"`
+	Viewers   int  `json:"viewers"`
+}
+
+// info describes the session, reporting false if it has closed
+func (s *ptySession) info() (SessionInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return SessionInfo{}, false
+	}
+	info := SessionInfo{
+		Name:      s.name,
+		Started:   s.started,
+		Connected: s.ws != nil,
+		Viewers:   len(s.viewers),
+	}
+	// The PTY knows its size, whoever set it last
+	if rows, cols, err := pty.Getsize(s.ptmx); err == nil {
+		info.Rows, info.Cols = rows, cols
+	}
+	return info, true
+}
+
+// handleAPISessions lists the running terminal sessions, oldest first, for
+// showing e.g. "3 terminals open"
+func handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	infos := []SessionInfo{}
+	for _, session := range terminalSessions.sessions() {
+		// Sessions close without the manager's lock, so one may have
+		// closed since
+		if info, ok := session.info(); ok {
+			infos = append(infos, info)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
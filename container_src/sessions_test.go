@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionManager(t *testing.T) {
+	m := newSessionManager()
+	older := &ptySession{name: "work"}
+	newer := &ptySession{name: "work"}
+
+	m.register(older)
+	m.register(newer)
+	if got := m.lookup("work"); got != newer {
+		t.Errorf("lookup = %p, want the newer session %p", got, newer)
+	}
+	// The older one going away doesn't take the name from the newer
+	m.remove(older)
+	if got := m.lookup("work"); got != newer {
+		t.Errorf("after removing the older one, lookup = %p", got)
+	}
+	m.remove(newer)
+	if got := m.lookup("work"); got != nil {
+		t.Errorf("after removing both, lookup = %p", got)
+	}
+
+	// Safe for concurrent connects and closes (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := &ptySession{name: fmt.Sprintf("s%d", i%5), started: time.Now()}
+			m.register(session)
+			m.lookup(session.name)
+			m.sessions()
+			m.remove(session)
+		}()
+	}
+	wg.Wait()
+	if sessions := m.sessions(); len(sessions) != 0 {
+		t.Errorf("%d sessions left over", len(sessions))
+	}
+}
+
+// listSessions fetches GET /api/sessions
+func listSessions(t *testing.T) []SessionInfo {
+	t.Helper()
+	w := httptest.NewRecorder()
+	newServeMux(&Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/api/sessions", nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var infos []SessionInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	return infos
+}
+
+func TestAPISessions(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(newServeMux(&Config{}))
+	t.Cleanup(server.Close)
+
+	if infos := listSessions(t); len(infos) != 0 {
+		t.Fatalf("sessions before connecting: %+v", infos)
+	}
+
+	ws := dialNamedTerminal(t, server, "editor&cols=100&rows=30")
+	readUntil(t, ws, "Welcome")
+	readUntil(t, dialNamedTerminal(t, server, "logs"), "Welcome")
+
+	infos := listSessions(t)
+	if len(infos) != 2 {
+		t.Fatalf("sessions = %+v, want 2", infos)
+	}
+	got := infos[0]
+	if got.Name != "editor" || got.Cols != 100 || got.Rows != 30 || !got.Connected || got.Started.IsZero() {
+		t.Errorf("first session = %+v", got)
+	}
+	if infos[1].Name != "logs" {
+		t.Errorf("second session = %+v", infos[1])
+	}
+
+	// Closing a session takes it off the list
+	ws.WriteMessage(websocket.TextMessage, []byte("exit\n"))
+	readClose(t, ws)
+	if infos := listSessions(t); len(infos) != 1 || infos[0].Name != "logs" {
+		t.Errorf("after exit, sessions = %+v", infos)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// viewerWriteWait bounds how long a slow viewer can hold up the session's
+// output before it's disconnected
+const viewerWriteWait = 10 * time.Second
+
+// ownerWriteWait bounds how long the owner's connection can hold up the
+// session, which is locked while writing to it. One that's stopped reading
+// (a laptop gone to sleep, say) would otherwise block pings, reconnects and
+// shutdown until the kernel gives up on it. A var so tests can shorten it.
+var ownerWriteWait = 10 * time.Second
+
+// broadcast sends PTY output to the owner and every viewer, and keeps it
+// for replay if the session is resumable. Viewers that can't keep up are
+// dropped. The owner's connection is closed if writing to it fails, which
+// its read loop deals with.
+func (s *ptySession) broadcast(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.scrollback != nil {
+		s.scrollback.Write(data)
+	}
+	for viewer := range s.viewers {
+		viewer.SetWriteDeadline(time.Now().Add(viewerWriteWait))
+		if err := viewer.WriteMessage(websocket.TextMessage, data); err != nil {
+			delete(s.viewers, viewer)
+			viewer.Close()
+		}
+	}
+	if s.ws != nil {
+		s.ws.SetWriteDeadline(time.Now().Add(ownerWriteWait))
+		if err := s.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			s.ws.Close()
+		}
+	}
+}
+
+// pingViewers keeps viewer connections alive alongside the owner's. The
+// caller holds s.mu.
+func (s *ptySession) pingViewers() {
+	for viewer := range s.viewers {
+		if err := viewer.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+			delete(s.viewers, viewer)
+			viewer.Close()
+		}
+	}
+}
+
+// addViewer attaches a read-only connection to the session, reporting false
+// if the session has already ended
+func (s *ptySession) addViewer(ws *websocket.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.viewers == nil {
+		s.viewers = make(map[*websocket.Conn]struct{})
+	}
+	s.viewers[ws] = struct{}{}
+	return true
+}
+
+func (s *ptySession) removeViewer(ws *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.viewers, ws)
+}
+
+// closeViewers tells viewers the session is over with closeMsg. The caller
+// holds s.mu.
+func (s *ptySession) closeViewers(closeMsg []byte) {
+	for viewer := range s.viewers {
+		viewer.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(closeWriteWait))
+		viewer.Close()
+	}
+	s.viewers = nil
+}
+
+// handleViewWebSocket attaches a read-only viewer to the terminal session
+// called name. Viewers see everything the shell prints from the moment they
+// join; anything they send, input or resizes, is ignored.
+func handleViewWebSocket(w http.ResponseWriter, r *http.Request, name string) {
+	session := terminalSessions.lookup(name)
+	if session == nil {
+		http.Error(w, fmt.Sprintf("No terminal session named %q", name), http.StatusNotFound)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+	ws.SetReadLimit(maxTerminalMessageBytes)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	// Say hello before joining, so the notice can't interleave with output
+	notice := fmt.Sprintf("\r\n\x1b[2mViewing terminal session %q (read-only)\x1b[0m\r\n\r\n", name)
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(notice)); err != nil {
+		return
+	}
+	if !session.addViewer(ws) {
+		ws.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"))
+		return
+	}
+	defer session.removeViewer(ws)
+
+	// Drain (and ignore) whatever the viewer sends until it goes away
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTerminalViewer(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?name=pairing"
+
+	// Nothing to view until the owner connects
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"&mode=view", nil); err == nil || resp == nil || resp.StatusCode != 404 {
+		t.Fatalf("viewing a missing session: err = %v, resp = %v", err, resp)
+	}
+
+	owner, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer owner.Close()
+	owner.SetReadDeadline(time.Now().Add(20 * time.Second))
+	readUntil(t, owner, "Welcome")
+
+	viewer, _, err := websocket.DefaultDialer.Dial(wsURL+"&mode=view", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(20 * time.Second))
+	readUntil(t, viewer, "read-only")
+
+	// The viewer sees the owner's output...
+	if err := owner.WriteMessage(websocket.TextMessage, []byte("echo HEL''LO\n")); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, viewer, "HELLO")
+
+	// ...but its own input goes nowhere
+	if err := viewer.WriteMessage(websocket.TextMessage, []byte("touch viewer-was-here\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.WriteMessage(websocket.TextMessage, []byte("touch owner-was-here; echo DO''NE\n")); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, owner, "DONE")
+	if _, err := os.Stat(filepath.Join(tmpDir, "owner-was-here")); err != nil {
+		t.Errorf("owner input didn't run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "viewer-was-here")); err == nil {
+		t.Error("viewer input reached the shell")
+	}
+
+	// Viewers are told when the session ends
+	owner.Close()
+	for {
+		_, _, err := viewer.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+			t.Errorf("viewer read err = %v, want a normal close", err)
+		}
+		break
+	}
+}
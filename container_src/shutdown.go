@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Shutdown on SIGTERM (which Cloudflare sends when it stops the container)
+// goes: hang up terminal sessions and stop running commands, finish
+// in-flight requests, send queued logs, then unmount the FUSE-mounted data directory so
+// tigrisfs flushes everything to S3. Each step is bounded, so a stuck one
+// can't hold up the rest. These are vars so tests can shorten them.
+var (
+	// hangupWait is how long shells have to exit after SIGHUP (saving
+	// their history, say) before they're killed
+	hangupWait = 2 * time.Second
+	// requestDrainTimeout bounds waiting for in-flight requests. Streams
+	// (Server-Sent Events) never finish by themselves, so they're cut off
+	// after it.
+	requestDrainTimeout = 5 * time.Second
+	// unmountTimeout bounds unmounting, which waits for tigrisfs to flush
+	unmountTimeout = 20 * time.Second
+	// logFlushTimeout bounds sending the logs still queued
+	logFlushTimeout = 3 * time.Second
+)
+
+// hangUp sends the shell SIGHUP, as a terminal going away would, so it can
+// exit cleanly. The session is then closed for a server restart rather
+// than with the shell's exit status.
+func (s *ptySession) hangUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.cmd == nil || s.cmd.Process == nil {
+		return
+	}
+	s.hungUp = true
+	s.cmd.Process.Signal(syscall.SIGHUP)
+}
+
+// stopAllExecJobs cancels every running command, waiting until deadline
+// for them to exit
+func stopAllExecJobs(deadline time.Time) {
+	execJobs.Lock()
+	jobs := make([]*execJob, 0, len(execJobs.byID))
+	for _, job := range execJobs.byID {
+		jobs = append(jobs, job)
+	}
+	execJobs.Unlock()
+	for _, job := range jobs {
+		go job.stop()
+	}
+	for _, job := range jobs {
+		select {
+		case <-job.done:
+		case <-time.After(time.Until(deadline)):
+			return
+		}
+	}
+}
+
+// shutdown stops everything cleanly before the server exits, see the vars
+// above. mount is nil when the data directory isn't FUSE-mounted.
+func shutdown(server *http.Server, mount *fuseMount) {
+	// Sessions and commands first: WebSockets are hijacked connections,
+	// which Shutdown doesn't wait for, and both hold the mount busy
+	endAllSessions()
+	stopAllExecJobs(time.Now().Add(execKillGrace))
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestDrainTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Cutting off requests still running: %v", err)
+		server.Close()
+	}
+	if !logShipper.flush(logFlushTimeout) {
+		log.Printf("Gave up sending queued logs")
+	}
+
+	if mount != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), unmountTimeout)
+		defer cancel()
+		if err := mount.unmount(ctx); err != nil {
+			log.Printf("Failed to unmount %s cleanly: %v", mount.dir, err)
+		}
+	}
+}
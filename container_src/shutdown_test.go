@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdown(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	origHangup, origDrain := hangupWait, requestDrainTimeout
+	hangupWait, requestDrainTimeout = 500*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { hangupWait, requestDrainTimeout = origHangup, origDrain })
+
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`})
+	useDataDir(t, tmpDir)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: newServeMux(&Config{})}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+	baseURL := "http://" + ln.Addr().String()
+
+	// One shell that saves its history when hung up on, and one that
+	// ignores the hangup
+	dial := func(input string) *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+		ws.WriteMessage(websocket.TextMessage, []byte(input+"; echo RE''ADY\n"))
+		readUntil(t, ws, "READY")
+		return ws
+	}
+	saver := dial("HISTFILE=$PWD/history.txt")
+	stubborn := dial("trap '' HUP")
+
+	// A stream that never ends by itself
+	resp, err := http.Get(baseURL + "/api/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+		}
+	}()
+
+	start := time.Now()
+	shutdown(server, nil)
+	elapsed := time.Since(start)
+	if elapsed > 5*time.Second {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+
+	// Hung up on rather than killed outright, which gave it the chance to
+	// save its history, and the other was killed once it didn't exit
+	if content, err := os.ReadFile(filepath.Join(tmpDir, "history.txt")); err != nil || !strings.Contains(string(content), "HISTFILE") {
+		t.Errorf("history not saved: %q, %v", content, err)
+	}
+	for _, ws := range []*websocket.Conn{saver, stubborn} {
+		if closeErr := readClose(t, ws); closeErr.Code != websocket.CloseServiceRestart || closeErr.Text != shutdownReason {
+			t.Errorf("close = %d %q", closeErr.Code, closeErr.Text)
+		}
+	}
+	if elapsed < hangupWait {
+		t.Errorf("shutdown took %s, didn't wait for the stubborn shell", elapsed)
+	}
+
+	// The stream was cut off, and the server stopped
+	select {
+	case <-streamDone:
+	case <-time.After(5 * time.Second):
+		t.Error("stream still open after shutdown")
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Serve = %v", err)
+	}
+	if _, err := http.Get(baseURL + "/api"); err == nil {
+		t.Error("still accepting requests")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadOnSIGHUP re-reads the config whenever the server gets SIGHUP, the
+// conventional way to tell a Unix daemon its config changed. Like POST
+// /api/config/reload, it picks up edits the mtime check missed without a
+// restart, and a broken config is logged while the previous one stays in
+// effect. Call the returned func to stop listening; it returns once any
+// reload in progress is done.
+func reloadOnSIGHUP() func() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-sigChan:
+				reloadFromSignal()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+		// A reload in flight finishes first
+		<-exited
+	}
+}
+
+// reloadFromSignal reloads the config for a SIGHUP and logs the outcome
+func reloadFromSignal() {
+	config, configPath, err := reloadConfig()
+	if err != nil {
+		log.Printf("SIGHUP: keeping the previous config: %v", err)
+		return
+	}
+	log.Printf("SIGHUP: reloaded %s (static=%s)", toRelativePath(configPath), config.Static)
+}
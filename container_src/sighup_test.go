@@ -0,0 +1,68 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "mimeTypes": {".foo": "text/x-foo"}}`,
+	})
+	useDataDir(t, tmpDir)
+	stop := reloadOnSIGHUP()
+	defer stop()
+
+	mimeType := func() string {
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.MimeTypes[".foo"]
+	}
+	if got := mimeType(); got != "text/x-foo" {
+		t.Fatalf("mime type = %q", got)
+	}
+
+	// Rewrite the config keeping its mtime, so only a reload notices
+	configPath := filepath.Join(tmpDir, "config.json")
+	rewrite := func(content string) {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(configPath, time.Now(), info.ModTime())
+	}
+	sighup := func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rewrite(`{"static": ".", "mimeTypes": {".foo": "application/x-foo"}}`)
+	sighup()
+	deadline := time.Now().Add(5 * time.Second)
+	for mimeType() != "application/x-foo" {
+		if time.Now().After(deadline) {
+			t.Fatal("config not reloaded after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A broken config leaves the last good one in place
+	rewrite(`{"static": ".", "mimeTypes": {`)
+	sighup()
+	time.Sleep(100 * time.Millisecond)
+	if got := mimeType(); got != "application/x-foo" {
+		t.Errorf("after a bad reload: mime type = %q", got)
+	}
+}
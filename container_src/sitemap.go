@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SitemapConfig generates /sitemap.xml from the HTML pages in the static
+// directories, with each page's mtime as its lastmod. A sitemap.xml in the
+// static directory always wins over the generated one. Dotfiles and the
+// notFound page are left out, and index.html is listed as its directory.
+//
+// Sitemaps need absolute URLs. BaseURL (e.g. "https://example.com") sets
+// the origin; without it, it's the one the request came in on, adjusted
+// for canonicalHost and forceHTTPS. "sitemap": true turns it on with that
+// default.
+type SitemapConfig struct {
+	BaseURL string `json:"baseUrl,omitempty"`
+
+	disabled bool // "sitemap": false
+}
+
+func (c *SitemapConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*c = SitemapConfig{disabled: !enabled}
+		return nil
+	}
+	// A distinct type so decoding the object doesn't recurse back here
+	type sitemapConfig SitemapConfig
+	var cfg sitemapConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("sitemap must be true, false or an object: %w", err)
+	}
+	*c = SitemapConfig(cfg)
+	return nil
+}
+
+func (c *SitemapConfig) enabled() bool {
+	return c != nil && !c.disabled
+}
+
+// baseURL returns the origin that sitemap URLs are relative to
+func (c *SitemapConfig) baseURL(r *http.Request, config *Config) string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	scheme := strings.ToLower(r.Header.Get("X-Forwarded-Proto"))
+	if config.ForceHTTPS || (scheme == "" && r.TLS != nil) {
+		scheme = "https"
+	} else if scheme == "" {
+		scheme = "http"
+	}
+	host := r.Host
+	if config.CanonicalHost != "" {
+		host = config.CanonicalHost
+	}
+	return scheme + "://" + host
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapCache holds the last generated sitemap, keyed by the static tree's
+// fingerprint and the base URL, so it's only rebuilt when a file changes
+var sitemapCache struct {
+	sync.Mutex
+	key  string
+	body []byte
+}
+
+// serveSitemap answers /sitemap.xml with a generated sitemap
+func serveSitemap(w http.ResponseWriter, r *http.Request, config *Config, staticDirs []string) {
+	base := config.Sitemap.baseURL(r, config)
+	fingerprint := staticFingerprint(staticDirs)
+	etag := fmt.Sprintf(`"sitemap-%x"`, fingerprint)
+	key := etag + base
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		writeNotModified(w)
+		return
+	}
+
+	sitemapCache.Lock()
+	body := sitemapCache.body
+	if sitemapCache.key != key {
+		var err error
+		if body, err = buildSitemap(staticDirs, base, config.NotFound); err != nil {
+			sitemapCache.Unlock()
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sitemapCache.key, sitemapCache.body = key, body
+	}
+	sitemapCache.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
+
+// buildSitemap walks the static directories for HTML pages. Earlier layers
+// win when the same page is in several.
+func buildSitemap(staticDirs []string, base, notFound string) ([]byte, error) {
+	pages := make(map[string]sitemapURL)
+	for _, dir := range staticDirs {
+		filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // Vanished mid-walk
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != dir {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			ext := strings.ToLower(filepath.Ext(p))
+			if d.IsDir() || (ext != ".html" && ext != ".htm") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if notFound != "" && rel == strings.TrimPrefix(notFound, "/") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			urlPath := "/" + rel
+			if path.Base(rel) == "index.html" {
+				urlPath = strings.TrimSuffix(urlPath, "index.html")
+			}
+			if _, ok := pages[urlPath]; !ok {
+				pages[urlPath] = sitemapURL{
+					Loc:     base + (&url.URL{Path: urlPath}).EscapedPath(),
+					LastMod: info.ModTime().UTC().Format("2006-01-02"),
+				}
+			}
+			return nil
+		})
+	}
+
+	urlSet := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, page := range pages {
+		urlSet.URLs = append(urlSet.URLs, page)
+	}
+	sort.Slice(urlSet.URLs, func(i, j int) bool { return urlSet.URLs[i].Loc < urlSet.URLs[j].Loc })
+
+	body, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":          `{"static": ["site", "shared"], "sitemap": true, "notFound": "404.html"}`,
+		"site/index.html":      "home",
+		"site/about.html":      "about",
+		"site/blog/index.html": "blog",
+		"site/blog/a post.htm": "post",
+		"site/404.html":        "not found",
+		"site/app.js":          "js",
+		"site/.drafts/x.html":  "draft",
+		"shared/about.html":    "shadowed",
+		"shared/terms.html":    "terms",
+	})
+	mtime := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(tmpDir, "site/about.html"), mtime, mtime)
+	useDataDir(t, tmpDir)
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/sitemap.xml", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handleHTTP(w, req)
+		return w
+	}
+
+	w := get(map[string]string{"X-Forwarded-Proto": "https"})
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var urlSet sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &urlSet); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://example.com/",
+		"https://example.com/about.html",
+		"https://example.com/blog/",
+		"https://example.com/blog/a%20post.htm",
+		"https://example.com/terms.html",
+	}
+	if len(urlSet.URLs) != len(want) {
+		t.Fatalf("got %d URLs, want %d: %+v", len(urlSet.URLs), len(want), urlSet.URLs)
+	}
+	for i, loc := range want {
+		if urlSet.URLs[i].Loc != loc {
+			t.Errorf("url %d = %q, want %q", i, urlSet.URLs[i].Loc, loc)
+		}
+	}
+	if got := urlSet.URLs[1].LastMod; got != "2024-03-15" {
+		t.Errorf("about.html lastmod = %q, want 2024-03-15", got)
+	}
+
+	// Unchanged tree: revalidates. A new page: new ETag and a new entry.
+	etag := w.Header().Get("ETag")
+	if w := get(map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("revalidation status = %d, want 304", w.Code)
+	}
+	writeTestFiles(t, tmpDir, map[string]string{"site/contact.html": "contact"})
+	w = get(nil)
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged after adding a page")
+	}
+	urlSet = sitemapURLSet{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &urlSet); err != nil {
+		t.Fatal(err)
+	}
+	if len(urlSet.URLs) != len(want)+1 || urlSet.URLs[4].Loc != "http://example.com/contact.html" {
+		t.Errorf("after adding a page: %+v", urlSet.URLs)
+	}
+}
+
+func TestSitemapConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		files    map[string]string
+		wantCode int
+		wantBody string // Exact body, for a user-provided sitemap
+		wantLoc  string // First URL otherwise
+	}{
+		{name: "off by default", config: `{"static": "."}`, wantCode: 404},
+		{name: "explicitly off", config: `{"static": ".", "sitemap": false}`, wantCode: 404},
+		{name: "base URL", config: `{"static": ".", "sitemap": {"baseUrl": "https://cute.example/"}}`, wantCode: 200, wantLoc: "https://cute.example/"},
+		{name: "canonical host", config: `{"static": ".", "sitemap": true, "canonicalHost": "localhost", "forceHTTPS": true}`, wantCode: 200, wantLoc: "https://localhost/"},
+		{
+			name:     "user sitemap wins",
+			config:   `{"static": ".", "sitemap": true}`,
+			files:    map[string]string{"sitemap.xml": "<urlset>mine</urlset>"},
+			wantCode: 200,
+			wantBody: "<urlset>mine</urlset>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			files := map[string]string{"config.json": tt.config, "index.html": "home"}
+			for k, v := range tt.files {
+				files[k] = v
+			}
+			writeTestFiles(t, tmpDir, files)
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", "http://localhost:8080/sitemap.xml", nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantLoc != "" {
+				var urlSet sitemapURLSet
+				if err := xml.Unmarshal(w.Body.Bytes(), &urlSet); err != nil {
+					t.Fatal(err)
+				}
+				if len(urlSet.URLs) == 0 || urlSet.URLs[0].Loc != tt.wantLoc {
+					t.Errorf("urls = %+v, want %q first", urlSet.URLs, tt.wantLoc)
+				}
+			}
+		})
+	}
+}
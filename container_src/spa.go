@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SPAConfig serves a single-page app's entry point for routes that don't
+// exist as files, so client-side routing works on reload and deep links.
+// Only extensionless paths fall back: a missing /logo.png is still a 404,
+// not an HTML page.
+//
+// Include and Exclude (glob patterns as for immutablePaths, e.g. "/app/**")
+// scope the fallback, so one static directory can hold an SPA alongside
+// regular pages or backend routes: with include ["/app/**"] and exclude
+// ["/app/api/**"], /app/settings falls back but /docs/missing and
+// /app/api/users 404. Exclude wins; an empty Include means every path.
+// Paths under /api/ never fall back, so a typo'd API call isn't answered
+// with HTML.
+//
+// "spa": true is shorthand for {} (fall back to the root index.html).
+//
+// The fallback only covers paths that don't exist at all. A directory
+// still gets its own index.html, and one without an index.html keeps its
+// usual handling (the directory listing with autoIndex, else a 404), since
+// the SPA's routes shouldn't shadow real directories.
+type SPAConfig struct {
+	Fallback string   `json:"fallback,omitempty"` // Default "index.html"
+	Include  []string `json:"include,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+
+	disabled bool // "spa": false
+}
+
+func (c *SPAConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*c = SPAConfig{disabled: !enabled}
+		return nil
+	}
+	// A distinct type so decoding the object doesn't recurse back here
+	type spaConfig SPAConfig
+	var cfg spaConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("spa must be true, false or an object: %w", err)
+	}
+	*c = SPAConfig(cfg)
+	return nil
+}
+
+// fallbackFor returns the file to serve in place of a missing requestPath
+// (relative to the static directory), if the SPA fallback applies to it
+func (c *SPAConfig) fallbackFor(requestPath string) (string, bool) {
+	if c == nil || c.disabled {
+		return "", false
+	}
+	requestPath = strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if path.Ext(requestPath) != "" || requestPath == "api" || strings.HasPrefix(requestPath, "api/") {
+		return "", false
+	}
+
+	for _, pattern := range c.Exclude {
+		if matchPathGlob(pattern, requestPath) {
+			return "", false
+		}
+	}
+	included := len(c.Include) == 0
+	for _, pattern := range c.Include {
+		if matchPathGlob(pattern, requestPath) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return "", false
+	}
+
+	if c.Fallback == "" {
+		return "index.html", true
+	}
+	return strings.TrimPrefix(c.Fallback, "/"), true
+}
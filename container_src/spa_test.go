@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSPAFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		spa        string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no spa config", spa: ``, path: "/settings", wantStatus: 404},
+		{name: "falls back everywhere by default", spa: `{}`, path: "/settings/profile", wantStatus: 200, wantBody: "root index"},
+		{name: "existing files still served", spa: `{}`, path: "/about.html", wantStatus: 200, wantBody: "about"},
+		{name: "missing asset still 404s", spa: `{}`, path: "/logo.png", wantStatus: 404},
+		{name: "custom fallback", spa: `{"fallback": "/app/index.html"}`, path: "/anything", wantStatus: 200, wantBody: "app index"},
+		{name: "included path", spa: `{"fallback": "app/index.html", "include": ["/app/**"]}`, path: "/app/settings", wantStatus: 200, wantBody: "app index"},
+		{name: "include matches the directory itself", spa: `{"fallback": "app/index.html", "include": ["/app/**"]}`, path: "/app/missing", wantStatus: 200, wantBody: "app index"},
+		{name: "not included", spa: `{"fallback": "app/index.html", "include": ["/app/**"]}`, path: "/docs/missing", wantStatus: 404},
+		{name: "excluded", spa: `{"exclude": ["/api/**"]}`, path: "/api/users", wantStatus: 404},
+		{name: "not excluded", spa: `{"exclude": ["/api/**"]}`, path: "/apiary", wantStatus: 200, wantBody: "root index"},
+		{name: "exclude beats include", spa: `{"fallback": "app/index.html", "include": ["/app/**"], "exclude": ["/app/api/**"]}`, path: "/app/api/users", wantStatus: 404},
+		{name: "glob include", spa: `{"fallback": "app/index.html", "include": ["/app/*"]}`, path: "/app/settings", wantStatus: 200, wantBody: "app index"},
+		{name: "glob include doesn't recurse", spa: `{"fallback": "app/index.html", "include": ["/app/*"]}`, path: "/app/settings/deep", wantStatus: 404},
+		{name: "missing fallback file", spa: `{"fallback": "nope.html"}`, path: "/settings", wantStatus: 404},
+		{name: "spa: true", spa: `true`, path: "/dashboard/settings", wantStatus: 200, wantBody: "root index"},
+		{name: "spa: false", spa: `false`, path: "/dashboard/settings", wantStatus: 404},
+		{name: "api paths never fall back", spa: `true`, path: "/api/users", wantStatus: 404},
+		{name: "missing stylesheet", spa: `true`, path: "/assets/app.css", wantStatus: 404},
+		{name: "directory without index isn't shadowed", spa: `true`, path: "/docs/", wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `{"static": "."}`
+			if tt.spa != "" {
+				config = `{"static": ".", "spa": ` + tt.spa + `}`
+			}
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json":    config,
+				"index.html":     "root index",
+				"about.html":     "about",
+				"app/index.html": "app index",
+				"docs/a.html":    "docs",
+			})
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// staticETag builds a strong ETag from a file's size and mtime. encoding
+// names the variant being served (e.g. "gzip" for a .gz sidecar) so that
+// compressed and identity responses never share a validator.
+func staticETag(info os.FileInfo, encoding string) string {
+	tag := fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModifiedSince reports whether an If-Modified-Since header shows the
+// client already has the version last modified at modTime. HTTP dates
+// have whole-second precision, so the mtime is truncated to match.
+func notModifiedSince(header string, modTime time.Time) bool {
+	since, err := http.ParseTime(header)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// notModified evaluates a request's conditional headers against a file's
+// validators. If-None-Match wins when both are sent (RFC 9110 13.2.2).
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		return notModifiedSince(ims, modTime)
+	}
+	return false
+}
+
+// streamStaticMinBytes is the size from which static files are streamed
+// from disk instead of read into memory, so a big video doesn't need a
+// buffer the size of the whole file per request
+var streamStaticMinBytes int64 = 4 * 1024 * 1024 // 4 MB
+
+// streamStaticFile serves the whole file at path by copying it to w,
+// optionally asking the kernel to drop it from the page cache afterwards
+func streamStaticFile(w http.ResponseWriter, r *http.Request, path string, size int64, contentType string, dropCache bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == "HEAD" {
+		return
+	}
+	staticFileReads.Add(1)
+	io.CopyN(w, f, size)
+	if dropCache {
+		dropPageCache(f)
+	}
+}
+
+// gzipSidecar looks for a precompressed "<path>.gz" next to path. It
+// returns the sidecar's path and stat info if one exists.
+func gzipSidecar(path string) (string, os.FileInfo, bool) {
+	gzPath := path + ".gz"
+	info, err := os.Stat(gzPath)
+	if err != nil || info.IsDir() {
+		return "", nil, false
+	}
+	return gzPath, info, true
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows encoding
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	return acceptQuality(parseAccept(r.Header.Get("Accept-Encoding")), encoding) > 0
+}
+
+// writeNotModified sends a 304. The caller has already set ETag (and Vary);
+// a 304 carries no body, so entity headers describing one are dropped.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// staticMatch is a file found in one of the static directories
+type staticMatch struct {
+	root string // The static directory it was found in
+	path string
+	info os.FileInfo
+}
+
+// pathWithin reports whether the clean path p is dir itself or inside it.
+// Comparing whole path elements matters: /srv/public-secret shares a string
+// prefix with /srv/public, but isn't inside it.
+func pathWithin(p, dir string) bool {
+	if p == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+// findStaticFile looks requestPath up in each static directory in order,
+// returning the first file found. Directories resolve to their index.html;
+// a directory without one falls through to later layers, and is only
+// returned (for auto-indexing) if no layer has a file for the path.
+func findStaticFile(staticDirs []string, requestPath string) (staticMatch, error) {
+	var dirMatch *staticMatch
+	for _, staticDir := range staticDirs {
+		fullPath := filepath.Join(staticDir, requestPath)
+
+		// Security: ensure the resolved path is still within staticDir
+		if !pathWithin(fullPath, staticDir) {
+			continue
+		}
+
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+				continue
+			}
+			return staticMatch{}, err
+		}
+
+		if !info.IsDir() {
+			return staticMatch{root: staticDir, path: fullPath, info: info}, nil
+		}
+		indexPath := filepath.Join(fullPath, "index.html")
+		if indexInfo, err := os.Stat(indexPath); err == nil && !indexInfo.IsDir() {
+			return staticMatch{root: staticDir, path: indexPath, info: indexInfo}, nil
+		}
+		if dirMatch == nil {
+			dirMatch = &staticMatch{root: staticDir, path: fullPath, info: info}
+		}
+	}
+	if dirMatch != nil {
+		return *dirMatch, nil
+	}
+	return staticMatch{}, os.ErrNotExist
+}
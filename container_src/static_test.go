@@ -0,0 +1,493 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrecompressedConditionalRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "precompressed": true}`,
+		"app.js":      "console.log('identity');",
+		"app.js.gz":   "fake gzip bytes",
+		"plain.css":   "body {}",
+	})
+	useDataDir(t, tmpDir)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handleHTTP(w, req)
+		return w
+	}
+
+	// Learn both variants' validators
+	gz := get("/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	identity := get("/app.js", nil)
+	gzETag, identityETag := gz.Header().Get("ETag"), identity.Header().Get("ETag")
+
+	if gz.Header().Get("Content-Encoding") != "gzip" || gz.Body.String() != "fake gzip bytes" {
+		t.Fatalf("gzip variant: encoding = %q, body = %q", gz.Header().Get("Content-Encoding"), gz.Body.String())
+	}
+	if ct := gz.Header().Get("Content-Type"); !strings.Contains(ct, "text/javascript") {
+		t.Errorf("gzip variant content-type = %q, want text/javascript", ct)
+	}
+	if identity.Header().Get("Content-Encoding") != "" || identity.Body.String() != "console.log('identity');" {
+		t.Fatalf("identity variant: encoding = %q, body = %q", identity.Header().Get("Content-Encoding"), identity.Body.String())
+	}
+	if gzETag == "" || gzETag == identityETag {
+		t.Fatalf("variants must have distinct ETags, got gzip=%q identity=%q", gzETag, identityETag)
+	}
+	for _, w := range []*httptest.ResponseRecorder{gz, identity} {
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+		}
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantStatus   int
+		wantETag     string
+		wantEncoding string
+	}{
+		{
+			name:       "gzip etag, accepts gzip",
+			headers:    map[string]string{"Accept-Encoding": "gzip", "If-None-Match": gzETag},
+			wantStatus: 304,
+			wantETag:   gzETag,
+		},
+		{
+			name:       "identity etag, identity request",
+			headers:    map[string]string{"If-None-Match": identityETag},
+			wantStatus: 304,
+			wantETag:   identityETag,
+		},
+		{
+			name:         "identity etag, accepts gzip",
+			headers:      map[string]string{"Accept-Encoding": "gzip", "If-None-Match": identityETag},
+			wantStatus:   200,
+			wantETag:     gzETag,
+			wantEncoding: "gzip",
+		},
+		{
+			name:       "gzip etag, identity request",
+			headers:    map[string]string{"If-None-Match": gzETag},
+			wantStatus: 200,
+			wantETag:   identityETag,
+		},
+		{
+			name:       "one of several etags matches",
+			headers:    map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"nope", W/` + gzETag},
+			wantStatus: 304,
+			wantETag:   gzETag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get("/app.js", tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("etag = %q, want %q", got, tt.wantETag)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("content-encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantStatus == 304 {
+				if w.Body.Len() != 0 {
+					t.Errorf("304 has body %q", w.Body.String())
+				}
+				if cl := w.Header().Get("Content-Length"); cl != "" {
+					t.Errorf("304 has content-length %q", cl)
+				}
+			}
+		})
+	}
+
+	// Files without a sidecar don't vary on encoding
+	plain := get("/plain.css", map[string]string{"Accept-Encoding": "gzip"})
+	if plain.Header().Get("Vary") != "" || plain.Header().Get("Content-Encoding") != "" {
+		t.Errorf("plain file: vary = %q, encoding = %q", plain.Header().Get("Vary"), plain.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestLayeredStaticDirs(t *testing.T) {
+	files := map[string]string{
+		"overrides/app.js":          "patched",
+		"overrides/docs/readme.txt": "override readme",
+		"dist/app.js":               "built",
+		"dist/index.html":           "built index",
+		"dist/docs/index.html":      "built docs",
+		"dist/other.css":            "built css",
+		"dist/listed/a.txt":         "a",
+	}
+
+	tests := []struct {
+		name       string
+		static     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "first layer wins", static: `["overrides", "dist"]`, path: "/app.js", wantStatus: 200, wantBody: "patched"},
+		{name: "falls through to later layer", static: `["overrides", "dist"]`, path: "/other.css", wantStatus: 200, wantBody: "built css"},
+		{name: "order matters", static: `["dist", "overrides"]`, path: "/app.js", wantStatus: 200, wantBody: "built"},
+		{name: "root index from later layer", static: `["overrides", "dist"]`, path: "/", wantStatus: 200, wantBody: "built index"},
+		{name: "directory index falls through", static: `["overrides", "dist"]`, path: "/docs/", wantStatus: 200, wantBody: "built docs"},
+		{name: "file in overridden directory", static: `["overrides", "dist"]`, path: "/docs/readme.txt", wantStatus: 200, wantBody: "override readme"},
+		{name: "missing everywhere", static: `["overrides", "dist"]`, path: "/nope.txt", wantStatus: 404},
+		{name: "missing layer is skipped", static: `["patches", "dist"]`, path: "/app.js", wantStatus: 200, wantBody: "built"},
+		{name: "all layers missing", static: `["patches", "build"]`, path: "/app.js", wantStatus: 500},
+		{name: "layer outside sandbox", static: `["/etc", "dist"]`, path: "/app.js", wantStatus: 500},
+		{name: "single string still works", static: `"dist"`, path: "/app.js", wantStatus: 200, wantBody: "built"},
+		{name: "empty array is invalid", static: `[]`, path: "/app.js", wantStatus: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, files)
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": `{"static": ` + tt.static + `}`,
+			})
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":     `{"static": "."}`,
+		"photo.jpg":       "jpeg bytes",
+		"docs/index.html": "<h1>docs</h1>",
+	})
+	useDataDir(t, tmpDir)
+
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	for _, name := range []string{"photo.jpg", "docs/index.html"} {
+		if err := os.Chtimes(filepath.Join(tmpDir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logged []string
+	oldSendLog := sendLog
+	sendLog = func(msg string) { logged = append(logged, msg) }
+	t.Cleanup(func() { sendLog = oldSendLog })
+
+	lastModified := "Fri, 01 Mar 2024 12:00:00 GMT"
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "no conditions", path: "/photo.jpg", wantStatus: 200},
+		{name: "same time", path: "/photo.jpg", headers: map[string]string{"If-Modified-Since": lastModified}, wantStatus: 304},
+		{name: "later time", path: "/photo.jpg", headers: map[string]string{"If-Modified-Since": "Sat, 02 Mar 2024 00:00:00 GMT"}, wantStatus: 304},
+		{name: "earlier time", path: "/photo.jpg", headers: map[string]string{"If-Modified-Since": "Thu, 29 Feb 2024 00:00:00 GMT"}, wantStatus: 200},
+		{name: "unparseable", path: "/photo.jpg", headers: map[string]string{"If-Modified-Since": "yesterday"}, wantStatus: 200},
+		{name: "etag mismatch wins", path: "/photo.jpg", headers: map[string]string{"If-Modified-Since": lastModified, "If-None-Match": `"stale"`}, wantStatus: 200},
+		{name: "directory index", path: "/docs/", headers: map[string]string{"If-Modified-Since": lastModified}, wantStatus: 304},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged = nil
+			req := httptest.NewRequest("GET", tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Last-Modified"); got != lastModified {
+				t.Errorf("Last-Modified = %q, want %q", got, lastModified)
+			}
+			if tt.wantStatus == 304 {
+				if w.Body.Len() != 0 {
+					t.Errorf("304 has body %q", w.Body.String())
+				}
+				if len(logged) != 1 || !strings.HasSuffix(logged[0], ", 0 B)") {
+					t.Errorf("logged %q, want 0 bytes", logged)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": "."}`,
+		"video.mp4":   "0123456789",
+		"app.js":      strings.Repeat("a", 2048),
+	})
+	useDataDir(t, tmpDir)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handleHTTP(w, req)
+		return w
+	}
+	etag := get("/video.mp4", nil).Header().Get("ETag")
+
+	tests := []struct {
+		name             string
+		path             string
+		headers          map[string]string
+		wantStatus       int
+		wantBody         string
+		wantContentRange string
+	}{
+		{name: "no range", path: "/video.mp4", wantStatus: 200, wantBody: "0123456789"},
+		{name: "middle", path: "/video.mp4", headers: map[string]string{"Range": "bytes=2-5"}, wantStatus: 206, wantBody: "2345", wantContentRange: "bytes 2-5/10"},
+		{name: "open-ended", path: "/video.mp4", headers: map[string]string{"Range": "bytes=7-"}, wantStatus: 206, wantBody: "789", wantContentRange: "bytes 7-9/10"},
+		{name: "suffix", path: "/video.mp4", headers: map[string]string{"Range": "bytes=-2"}, wantStatus: 206, wantBody: "89", wantContentRange: "bytes 8-9/10"},
+		{name: "past the end", path: "/video.mp4", headers: map[string]string{"Range": "bytes=20-"}, wantStatus: 416, wantContentRange: "bytes */10"},
+		{name: "multi-range falls back", path: "/video.mp4", headers: map[string]string{"Range": "bytes=0-1,4-5"}, wantStatus: 200, wantBody: "0123456789"},
+		{name: "current If-Range", path: "/video.mp4", headers: map[string]string{"Range": "bytes=0-0", "If-Range": etag}, wantStatus: 206, wantBody: "0", wantContentRange: "bytes 0-0/10"},
+		{name: "stale If-Range", path: "/video.mp4", headers: map[string]string{"Range": "bytes=0-0", "If-Range": `"stale"`}, wantStatus: 200, wantBody: "0123456789"},
+		// Ranges don't apply to a gzipped response
+		{name: "gzipped", path: "/app.js", headers: map[string]string{"Range": "bytes=0-0", "Accept-Encoding": "gzip"}, wantStatus: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.path, tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.wantContentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantContentRange)
+			}
+			if tt.wantStatus != 416 && w.Header().Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+				t.Errorf("Content-Length = %q for %d bytes", w.Header().Get("Content-Length"), w.Body.Len())
+			}
+			wantAcceptRanges := "bytes"
+			if w.Header().Get("Content-Encoding") != "" {
+				wantAcceptRanges = "none"
+			}
+			if got := w.Header().Get("Accept-Ranges"); got != wantAcceptRanges {
+				t.Errorf("Accept-Ranges = %q, want %q", got, wantAcceptRanges)
+			}
+		})
+	}
+
+	// Files over the threshold are streamed in full rather than buffered
+	old := streamStaticMinBytes
+	streamStaticMinBytes = 5
+	t.Cleanup(func() { streamStaticMinBytes = old })
+	if w := get("/video.mp4", nil); w.Code != 200 || w.Body.String() != "0123456789" || w.Header().Get("Content-Length") != "10" {
+		t.Errorf("streamed: status = %d, body = %q, Content-Length = %q", w.Code, w.Body.String(), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestStaticAcceptRanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":     `{"static": "."}`,
+		"video.mp4":       "0123456789",
+		"app.js":          strings.Repeat("a", 2048),
+		"dev/config.json": `{"static": ".", "devMode": true}`,
+		"dev/index.html":  "<html><body>hi</body></html>",
+	})
+
+	tests := []struct {
+		name    string
+		dir     string
+		method  string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "plain GET", dir: tmpDir, method: "GET", path: "/video.mp4", want: "bytes"},
+		{name: "HEAD", dir: tmpDir, method: "HEAD", path: "/video.mp4", want: "bytes"},
+		{name: "not compressed without Accept-Encoding", dir: tmpDir, method: "GET", path: "/app.js", want: "bytes"},
+		{name: "compressed on the fly", dir: tmpDir, method: "GET", path: "/app.js", headers: map[string]string{"Accept-Encoding": "gzip"}, want: "none"},
+		{name: "live-reload page", dir: filepath.Join(tmpDir, "dev"), method: "GET", path: "/", want: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDataDir(t, tt.dir)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != 200 {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := w.Header().Get("Accept-Ranges"); got != tt.want {
+				t.Errorf("Accept-Ranges = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticSiblingDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":              `{"static": "public"}`,
+		"public/index.html":        "home",
+		"public-secret/secret.txt": "top secret",
+	})
+	useDataDir(t, tmpDir)
+
+	staticDir := filepath.Join(tmpDir, "public")
+	for _, requestPath := range []string{"../public-secret/secret.txt", "../public-secret", "sub/../../public-secret/secret.txt"} {
+		if match, err := findStaticFile([]string{staticDir}, requestPath); err == nil {
+			t.Errorf("findStaticFile(%q) = %s, want not found", requestPath, match.path)
+		}
+	}
+	for _, path := range []string{"/../public-secret/secret.txt", "/%2e%2e/public-secret/secret.txt", "/public-secret/secret.txt"} {
+		w := httptest.NewRecorder()
+		handleHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 404 || strings.Contains(w.Body.String(), "top secret") {
+			t.Errorf("GET %s: status = %d, body = %q", path, w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/srv/public", "/srv/public", true},
+		{"/srv/public/a.txt", "/srv/public", true},
+		{"/srv/public-secret/a.txt", "/srv/public", false},
+		{"/srv/publicity", "/srv/public", false},
+		{"/srv", "/srv/public", false},
+		{"/etc/passwd", "/", true},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.path, tt.dir); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSymlinkedStaticRoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		link       string // Where the data directory's "site" symlink points
+		static     string
+		mount      bool // Whether outside/ is mounted
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "inside", link: "builds/v2", static: "site", wantStatus: 200, wantBody: "v2"},
+		{name: "outside", link: "{outside}", static: "site", wantStatus: 500},
+		{name: "outside, but mounted", link: "{outside}", static: "site", mount: true, wantStatus: 200, wantBody: "outside"},
+		{name: "climbing out", link: "..", static: "site", wantStatus: 500},
+		{name: "absolute path through an alias", static: "{alias}/builds/v2", wantStatus: 200, wantBody: "v2"},
+		{name: "absolute path outside", static: "{outside}", wantStatus: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dataDir, outside, alias := filepath.Join(root, "data"), filepath.Join(root, "outside"), filepath.Join(root, "alias")
+			expand := strings.NewReplacer("{outside}", outside, "{alias}", alias).Replace
+
+			if tt.mount {
+				t.Setenv(mountsEnv, `[{"prefix": "ext", "path": "`+outside+`"}]`)
+			}
+			writeTestFiles(t, dataDir, map[string]string{
+				"config.json":          `{"static": "` + expand(tt.static) + `"}`,
+				"builds/v2/index.html": "v2",
+			})
+			writeTestFiles(t, outside, map[string]string{"index.html": "outside"})
+			if err := os.Symlink(dataDir, alias); err != nil {
+				t.Fatal(err)
+			}
+			if tt.link != "" {
+				if err := os.Symlink(expand(tt.link), filepath.Join(dataDir, "site")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			useDataDir(t, dataDir)
+
+			w := httptest.NewRecorder()
+			handleHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHeadSkipsRead(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "precompressed": true, "compression": {"enabled": false}}`,
+		"small.txt":   "hello",
+		"app.js":      strings.Repeat("x", 2000),
+		"app.js.gz":   "not really gzip",
+	})
+	useDataDir(t, tmpDir)
+
+	tests := []struct {
+		name              string
+		path              string
+		acceptEncoding    string
+		wantContentLength string
+		wantEncoding      string
+	}{
+		{name: "identity", path: "/small.txt", wantContentLength: "5"},
+		{name: "sidecar", path: "/app.js", acceptEncoding: "gzip", wantContentLength: "15", wantEncoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("HEAD", tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			before := staticFileReads.Value()
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+
+			if w.Code != 200 || w.Body.Len() != 0 {
+				t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+			}
+			if got := staticFileReads.Value() - before; got != 0 {
+				t.Errorf("file reads = %d, want 0", got)
+			}
+			if got := w.Header().Get("Content-Length"); got != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantContentLength)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+		})
+	}
+}
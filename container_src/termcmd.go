@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// terminalCommand builds the command a new terminal session runs. By
+// default that's an interactive shell, without rc files so they can't
+// override the prompt. ?cmd= (plus repeated ?arg=) runs that program
+// instead, e.g. htop or python, exec'd directly so nothing in it is
+// interpreted by a shell. Pipes and the like need ?shell=true, which runs
+// cmd as a command line with the shell's -c, the args becoming $1, $2, ...
+func terminalCommand(query url.Values) (*exec.Cmd, error) {
+	name := query.Get("cmd")
+	args := query["arg"]
+	if name == "" {
+		if len(args) > 0 {
+			return nil, errors.New("arg needs a cmd query parameter")
+		}
+		return exec.Command(getShell(), "--norc", "--noprofile"), nil
+	}
+
+	if query.Get("shell") == "true" {
+		shell := getShell()
+		// The first argument after the command line is $0
+		return exec.Command(shell, append([]string{"-c", name, shell}, args...)...), nil
+	}
+	// Catch a typo before upgrading, rather than closing straight after.
+	// A path (./repl.py) is relative to the data directory, where the
+	// session starts; a bare name is looked up in $PATH.
+	if strings.Contains(name, "/") {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dataDir, path)
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return nil, fmt.Errorf("command not found: %s", name)
+		}
+		return exec.Command(name, args...), nil
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("command not found: %s", name)
+	}
+	return exec.Command(name, args...), nil
+}
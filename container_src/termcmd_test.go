@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTerminalCommand(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json":  `{"static": "."}`,
+		"bin/hello.sh": "#!/bin/sh\necho HELLO from \"$1\"\n",
+	})
+	if err := os.Chmod(filepath.Join(tmpDir, "bin/hello.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int // Of the handshake, if it fails
+		wantOutput string
+		wantReason string
+	}{
+		{
+			name:       "program with args",
+			query:      url.Values{"cmd": {"echo"}, "arg": {"a;b", "$HOME"}},
+			wantOutput: "a;b $HOME", // Not interpreted by a shell
+			wantReason: "exit status 0",
+		},
+		{
+			name:       "script relative to the data directory",
+			query:      url.Values{"cmd": {"./bin/hello.sh"}, "arg": {"cutie"}},
+			wantOutput: "HELLO from cutie",
+			wantReason: "exit status 0",
+		},
+		{
+			name:       "command line through the shell",
+			query:      url.Values{"cmd": {`echo "$1" | tr a-z A-Z; exit 7`}, "arg": {"piped"}, "shell": {"true"}},
+			wantOutput: "PIPED",
+			wantReason: "exit status 7",
+		},
+		{
+			name:       "unknown program",
+			query:      url.Values{"cmd": {"no-such-program"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "missing script",
+			query:      url.Values{"cmd": {"./bin/missing.sh"}},
+			wantStatus: 400,
+		},
+		{
+			name:       "args without a program",
+			query:      url.Values{"arg": {"-l"}},
+			wantStatus: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + tt.query.Encode()
+			ws, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			if tt.wantStatus != 0 {
+				if err == nil || resp == nil || resp.StatusCode != tt.wantStatus {
+					t.Fatalf("handshake: err = %v, resp = %v, want status %d", err, resp, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			ws.SetReadDeadline(time.Now().Add(20 * time.Second))
+
+			// The session ends when the program does
+			var output strings.Builder
+			for {
+				_, data, err := ws.ReadMessage()
+				if err == nil {
+					output.Write(data)
+					continue
+				}
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) {
+					t.Fatalf("closed without a close frame: %v", err)
+				}
+				if closeErr.Code != websocket.CloseNormalClosure || closeErr.Text != tt.wantReason {
+					t.Errorf("close = %d %q, want 1000 %q", closeErr.Code, closeErr.Text, tt.wantReason)
+				}
+				break
+			}
+			if !strings.Contains(output.String(), tt.wantOutput) {
+				t.Errorf("output = %q, want %q in it", output.String(), tt.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "os"
+
+// defaultTerminalUser is the unprivileged user the image creates, whose
+// home is the data directory
+const defaultTerminalUser = "cutie"
+
+// terminalUserEnv names a different user for the terminal ("root" keeps it
+// as root). It's the operator's to set: the config file lives in the data
+// directory, which the terminal's user can write to, so a setting there
+// would let them undo their own privilege drop.
+const terminalUserEnv = "CUTE_TERMINAL_USER"
+
+// terminalUser returns the user terminal shells should run as
+func terminalUser() string {
+	if name := os.Getenv(terminalUserEnv); name != "" {
+		return name
+	}
+	return defaultTerminalUser
+}
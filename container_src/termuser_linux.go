@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// geteuid is a var so tests can pretend not to be root
+var geteuid = os.Geteuid
+
+// terminalCredential looks up who a terminal's shell, and other commands
+// run for the user, should run as, see terminalUser. It's nil, leaving
+// them running as the server does, when the server isn't root (it can't
+// switch, and has nothing to drop), when the operator asks for root, or
+// when the user doesn't exist, e.g. in a local Docker image without it.
+// That last one is logged, since a root shell has the run of the whole
+// container.
+func terminalCredential() (*syscall.Credential, *user.User) {
+	if geteuid() != 0 {
+		return nil, nil
+	}
+	name := terminalUser()
+	if name == "root" {
+		return nil, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		log.Printf("WARNING: terminal and commands running as root: can't switch to user %q: %v", name, err)
+		return nil, nil
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		log.Printf("WARNING: terminal and commands running as root: user %q has UID %q", name, u.Uid)
+		return nil, nil
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		log.Printf("WARNING: terminal and commands running as root: user %q has GID %q", name, u.Gid)
+		return nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	// Supplementary groups, or it'd keep root's
+	groupIDs, _ := u.GroupIds()
+	for _, id := range groupIDs {
+		if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(g))
+		}
+	}
+	return cred, u
+}
+
+// runAsTerminalUser makes cmd, a command run on the user's behalf, run as
+// the same user as the terminal, see terminalCredential
+func runAsTerminalUser(cmd *exec.Cmd) {
+	cred, u := terminalCredential()
+	if cred == nil {
+		return
+	}
+	cmd.Env = append(cmd.Env, "HOME="+u.HomeDir, "USER="+u.Username)
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = cred
+}
+
+// giveToTerminalUser makes a file the server created for the terminal
+// (like the shell history) belong to the terminal's user
+func giveToTerminalUser(path string) error {
+	cred, _ := terminalCredential()
+	if cred == nil {
+		return nil
+	}
+	return os.Chown(path, int(cred.Uid), int(cred.Gid))
+}
+
+// startTerminal starts cmd on a new PTY as the user from
+// terminalCredential. The PTY is handed over to that user, since programs
+// like tty and mesg expect to own their terminal, and HOME and USER are
+// theirs.
+func startTerminal(cmd *exec.Cmd) (*os.File, error) {
+	cred, u := terminalCredential()
+	if cred == nil {
+		return pty.Start(cmd)
+	}
+	cmd.Env = append(cmd.Env, "HOME="+u.HomeDir, "USER="+u.Username)
+	// The shell starts out there, and won't get far if it can't write to it
+	if info, err := os.Stat(cmd.Dir); err == nil {
+		if uid, _, ok := fileOwner(info); ok && uid != cred.Uid && info.Mode().Perm()&0002 == 0 {
+			log.Printf("WARNING: %s belongs to UID %d, so the terminal's user %s may not be able to write to it",
+				cmd.Dir, uid, u.Username)
+		}
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+	if err := tty.Chown(int(cred.Uid), int(cred.Gid)); err != nil {
+		log.Printf("Failed to hand the terminal to %s: %v", u.Username, err)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Credential: cred}
+	if err := cmd.Start(); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	return ptmx, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTerminalCredential(t *testing.T) {
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("no nobody user")
+	}
+	tests := []struct {
+		name    string
+		euid    int
+		user    string
+		wantUID int // -1 for no switch
+	}{
+		{name: "not root", euid: 1000, user: "nobody", wantUID: -1},
+		{name: "root, switching", euid: 0, user: "nobody", wantUID: 65534},
+		{name: "root, asked to stay root", euid: 0, user: "root", wantUID: -1},
+		{name: "root, no such user", euid: 0, user: "no-such-user", wantUID: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := geteuid
+			geteuid = func() int { return tt.euid }
+			t.Cleanup(func() { geteuid = orig })
+
+			t.Setenv(terminalUserEnv, tt.user)
+			cred, u := terminalCredential()
+			if tt.wantUID == -1 {
+				if cred != nil {
+					t.Errorf("switching to %+v", cred)
+				}
+				return
+			}
+			if cred == nil || int(cred.Uid) != tt.wantUID || u.Username != tt.user {
+				t.Errorf("credential = %+v, user = %+v", cred, u)
+			}
+		})
+	}
+
+	// The default is the image's cutie user
+	t.Setenv(terminalUserEnv, "")
+	if got := terminalUser(); got != "cutie" {
+		t.Errorf("default user = %q", got)
+	}
+}
+
+func TestTerminalRunsAsUser(t *testing.T) {
+	if _, err := os.Stat(getShell()); err != nil {
+		t.Skip("no shell available")
+	}
+	// The shell starts in the data directory, so nobody needs to get in
+	tmpDir := useUnprivilegedDataDir(t)
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	ws := dialNamedTerminal(t, server, "unprivileged")
+	ws.WriteMessage(websocket.TextMessage, []byte(`echo "UID=$(id -u) USER=$USER TTY=$(stat -c %u "$(tty)") PWD=$PWD"`+"\n"))
+	readUntil(t, ws, "UID=65534 USER=nobody TTY=65534 PWD="+tmpDir)
+}
+
+// useUnprivilegedDataDir sets up a data directory, with commands running as
+// nobody, who can get into it
+func useUnprivilegedDataDir(t *testing.T) string {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to switch users")
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("no nobody user")
+	}
+	t.Setenv(terminalUserEnv, "nobody")
+	tmpDir := t.TempDir()
+	// Only the operator gets to choose, so the terminal can't make itself
+	// root by editing the config
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "terminal": {"user": "root"}}`,
+	})
+	for _, dir := range []string{tmpDir, filepath.Dir(tmpDir)} {
+		if err := os.Chmod(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useDataDir(t, tmpDir)
+	return tmpDir
+}
+
+func TestScheduledCommandRunsAsUser(t *testing.T) {
+	useUnprivilegedDataDir(t)
+	var logs []string
+	sendLog = func(msg string) { logs = append(logs, msg) }
+	t.Cleanup(func() { sendLog = writeLog })
+
+	if code, err := runScheduledCommand(`echo "UID=$(id -u) USER=$USER"`); err != nil || code != 0 {
+		t.Fatalf("code = %d, err = %v", code, err)
+	}
+	if len(logs) != 1 || logs[0] != "[schedule] UID=65534 USER=nobody" {
+		t.Errorf("logs = %q", logs)
+	}
+}
+
+func TestExecRunsAsUser(t *testing.T) {
+	useUnprivilegedDataDir(t)
+	var out bytes.Buffer
+	job, ctx := newExecJob(context.Background(), 10*time.Second)
+	defer job.unregister()
+	exit := job.run(ctx, "sh", []string{"-c", `echo "UID=$(id -u) USER=$USER"`}, &cappedWriter{out: &out, max: 1024})
+	if exit.Code != 0 || strings.TrimSpace(out.String()) != "UID=65534 USER=nobody" {
+		t.Errorf("exit = %+v, output = %q", exit, out.String())
+	}
+}
+
+func TestHistoryFileBelongsToUser(t *testing.T) {
+	tmpDir := useUnprivilegedDataDir(t)
+	historyPath := filepath.Join(tmpDir, ".bash_history")
+	// Left behind by a server from before shells ran as nobody
+	if err := os.WriteFile(historyPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if env := historyEnv(&Config{Terminal: &TerminalConfig{PersistHistory: true}}); env == nil {
+		t.Fatal("history off")
+	}
+
+	// Appending as nobody, as the shell does, not as the server
+	cmd := exec.Command("sh", "-c", `echo "echo hi" >> "$0"`, historyPath)
+	runAsTerminalUser(cmd)
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil || cmd.SysProcAttr.Credential.Uid != 65534 {
+		t.Fatalf("not running as nobody: %+v", cmd.SysProcAttr)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("nobody can't append to the history: %v: %s", err, out)
+	}
+	if content, _ := os.ReadFile(historyPath); string(content) != "echo hi\n" {
+		t.Errorf("history = %q", content)
+	}
+}
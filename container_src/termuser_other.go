@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+)
+
+// startTerminal starts cmd on a new PTY. Switching users is only done on
+// Linux, where the server runs as root in the container; elsewhere it's
+// a development machine and the shell runs as the developer.
+func startTerminal(cmd *exec.Cmd) (*os.File, error) {
+	return pty.Start(cmd)
+}
+
+// runAsTerminalUser leaves cmd running as the server, as startTerminal does
+func runAsTerminalUser(cmd *exec.Cmd) {}
+
+// giveToTerminalUser has nothing to do, since the terminal runs as the
+// server
+func giveToTerminalUser(path string) error { return nil }
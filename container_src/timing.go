@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serverTiming measures the phases of serving a request for the
+// Server-Timing header, which browser devtools show alongside the
+// network timings. Only sent when "debug" is on in config.
+type serverTiming struct {
+	last    time.Time
+	metrics []timingMetric
+}
+
+type timingMetric struct {
+	name string
+	dur  time.Duration
+}
+
+func newServerTiming() *serverTiming {
+	return &serverTiming{last: time.Now()}
+}
+
+// mark records the time since the previous mark (or the start) as name
+func (st *serverTiming) mark(name string) {
+	now := time.Now()
+	st.metrics = append(st.metrics, timingMetric{name: name, dur: now.Sub(st.last)})
+	st.last = now
+}
+
+// String formats the metrics as a Server-Timing value, e.g.
+// `config;dur=0.042;desc="42.00µs", resolve;dur=0.130;desc="130.00µs"`
+func (st *serverTiming) String() string {
+	parts := make([]string, len(st.metrics))
+	for i, m := range st.metrics {
+		ms := float64(m.dur.Nanoseconds()) / float64(time.Millisecond)
+		parts[i] = fmt.Sprintf("%s;dur=%.3f;desc=%q", m.name, ms, formatDuration(m.dur))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// setHeader adds the Server-Timing header if debug is on. It has to be
+// called before the response is written.
+func (st *serverTiming) setHeader(w http.ResponseWriter, config *Config) {
+	if config.Debug && len(st.metrics) > 0 {
+		w.Header().Set("Server-Timing", st.String())
+	}
+}
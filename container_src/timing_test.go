@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestServerTimingHeader(t *testing.T) {
+	metric := regexp.MustCompile(`^[a-z]+;dur=\d+\.\d{3};desc="[^"]+"$`)
+
+	tests := []struct {
+		name        string
+		config      string
+		headers     map[string]string
+		wantMetrics []string
+	}{
+		{name: "debug off", config: `{"static": "."}`},
+		{name: "debug on", config: `{"static": ".", "debug": true}`, wantMetrics: []string{"config", "resolve", "read"}},
+		{
+			name:        "compressed",
+			config:      `{"static": ".", "debug": true, "compression": {"minBytes": 1}}`,
+			headers:     map[string]string{"Accept-Encoding": "gzip"},
+			wantMetrics: []string{"config", "resolve", "read", "compress"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, map[string]string{
+				"config.json": tt.config,
+				"index.html":  "<h1>hi</h1>",
+			})
+			useDataDir(t, tmpDir)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handleHTTP(w, req)
+			header := w.Header().Get("Server-Timing")
+			if tt.wantMetrics == nil {
+				if header != "" {
+					t.Errorf("Server-Timing = %q, want none", header)
+				}
+				return
+			}
+
+			parts := strings.Split(header, ", ")
+			if len(parts) != len(tt.wantMetrics) {
+				t.Fatalf("Server-Timing = %q, want metrics %v", header, tt.wantMetrics)
+			}
+			for i, part := range parts {
+				if !metric.MatchString(part) || !strings.HasPrefix(part, tt.wantMetrics[i]+";") {
+					t.Errorf("metric %d = %q, want a well-formed %s", i, part, tt.wantMetrics[i])
+				}
+			}
+
+			// Revalidations are timed too, minus the read
+			req = httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w = httptest.NewRecorder()
+			handleHTTP(w, req)
+			if w.Code != 304 || strings.Count(w.Header().Get("Server-Timing"), "dur=") != 2 {
+				t.Errorf("304: status %d, Server-Timing = %q", w.Code, w.Header().Get("Server-Timing"))
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// TransactionWrite is one file in a transaction
+type TransactionWrite struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary content, default plain text
+}
+
+// TransactionRequest writes several files together
+type TransactionRequest struct {
+	Writes []TransactionWrite `json:"writes"`
+}
+
+// TransactionResponse describes a committed transaction
+type TransactionResponse struct {
+	Paths []string `json:"paths"`
+	Bytes int64    `json:"bytes"`
+}
+
+// stagedWrite tracks one file through staging, commit and rollback
+type stagedWrite struct {
+	target  string // Final absolute path
+	staged  string // New content, waiting in the staging directory
+	backup  string // Copy of the file it replaces, if there was one
+	applied bool
+}
+
+// handleAPIFilesTransaction writes several files so they appear together,
+// for deploying a site update without readers seeing half of it.
+//
+// This is best effort: a filesystem can't rename several paths as one
+// atomic step. Every file is first written in full to a staging directory,
+// so nothing is touched until all the content has arrived and been
+// written. Then each file is renamed into place one after another, which
+// keeps the window where some files are new and others old as short as
+// possible. If any of those renames fail, the files already moved are
+// rolled back to their previous content (or removed, if they're new).
+// Readers in that short window, or a crash during it, can still see a mix.
+func handleAPIFilesTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// File content travels in the body, so this uses the upload limit
+	// rather than the small one for JSON control requests
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	var req TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body too large (limit %s)", formatBytes(maxUploadBytes)), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Writes) == 0 {
+		http.Error(w, "writes must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Validate everything before touching the filesystem
+	writes := make([]*stagedWrite, len(req.Writes))
+	contents := make([][]byte, len(req.Writes))
+	seen := make(map[string]bool)
+	for i, write := range req.Writes {
+		if write.Path == "" {
+			http.Error(w, "path is required for every write", http.StatusBadRequest)
+			return
+		}
+		target, err := validateAndResolveWritePath(write.Path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid path %q: %v", write.Path, err), pathErrorStatus(err))
+			return
+		}
+		if target == dataDir {
+			http.Error(w, "Cannot write to the base directory", http.StatusBadRequest)
+			return
+		}
+		if seen[target] {
+			http.Error(w, fmt.Sprintf("Duplicate path %q", write.Path), http.StatusBadRequest)
+			return
+		}
+		seen[target] = true
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			http.Error(w, fmt.Sprintf("Path is a directory: %q", write.Path), http.StatusBadRequest)
+			return
+		}
+
+		switch write.Encoding {
+		case "":
+			contents[i] = []byte(write.Content)
+		case "base64":
+			if contents[i], err = base64.StdEncoding.DecodeString(write.Content); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid base64 content for %q", write.Path), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, fmt.Sprintf("Unknown encoding %q", write.Encoding), http.StatusBadRequest)
+			return
+		}
+		writes[i] = &stagedWrite{target: target}
+	}
+
+	// Stage on the same filesystem so commits are renames, not copies
+	stageDir, err := os.MkdirTemp(dataDir, ".transaction-*")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create staging directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stageDir)
+
+	var total int64
+	for i, write := range writes {
+		write.staged = filepath.Join(stageDir, fmt.Sprintf("%d", i))
+		if err := os.WriteFile(write.staged, contents[i], 0644); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to stage %q: %v", req.Writes[i].Path, err), http.StatusInternalServerError)
+			return
+		}
+		total += int64(len(contents[i]))
+	}
+
+	if err := commitTransaction(writes, stageDir); err != nil {
+		http.Error(w, fmt.Sprintf("Transaction rolled back: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	paths := make([]string, len(writes))
+	for i, write := range writes {
+		paths[i] = toRelativePath(write.target)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionResponse{Paths: paths, Bytes: total})
+}
+
+// commitTransaction moves staged files into place, rolling back the ones
+// already moved if any fails
+func commitTransaction(writes []*stagedWrite, stageDir string) error {
+	for i, write := range writes {
+		if err := commitWrite(write, filepath.Join(stageDir, fmt.Sprintf("%d.bak", i))); err != nil {
+			rollbackTransaction(writes)
+			return fmt.Errorf("%s: %w", toRelativePath(write.target), err)
+		}
+	}
+	return nil
+}
+
+// commitWrite backs up the file being replaced, then renames the staged
+// file over it. The backup is a copy rather than a move so the target
+// never disappears, even briefly.
+func commitWrite(write *stagedWrite, backupPath string) error {
+	if err := os.MkdirAll(filepath.Dir(write.target), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directories: %w", err)
+	}
+	if _, err := os.Stat(write.target); err == nil {
+		if err := copyFile(write.target, backupPath); err != nil {
+			return fmt.Errorf("failed to back up: %w", err)
+		}
+		write.backup = backupPath
+	}
+	if err := os.Rename(write.staged, write.target); err != nil {
+		return err
+	}
+	write.applied = true
+	return nil
+}
+
+// rollbackTransaction restores every applied write's previous state
+func rollbackTransaction(writes []*stagedWrite) {
+	for _, write := range writes {
+		if !write.applied {
+			continue
+		}
+		var err error
+		if write.backup != "" {
+			err = os.Rename(write.backup, write.target)
+		} else {
+			err = os.Remove(write.target)
+		}
+		if err != nil {
+			log.Printf("Transaction rollback of %s failed: %v", write.target, err)
+		}
+	}
+}
+
+// copyFile copies src to dst, keeping src's permissions
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIFilesTransaction(t *testing.T) {
+	existing := map[string]string{
+		"config.json":     `{"static": "site"}`,
+		"site/index.html": "old index",
+		"site/app.js":     "old app",
+		"site/blocker":    "a file where a directory is needed",
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFiles  map[string]string // Expected content afterwards ("" = must not exist)
+	}{
+		{
+			name:       "success",
+			body:       `{"writes": [{"path": "site/index.html", "content": "new index"}, {"path": "site/app.js", "content": "new app"}, {"path": "site/assets/logo.bin", "content": "AAEC/w==", "encoding": "base64"}]}`,
+			wantStatus: 200,
+			wantFiles:  map[string]string{"site/index.html": "new index", "site/app.js": "new app", "site/assets/logo.bin": "\x00\x01\x02\xff"},
+		},
+		{
+			name:       "mid-transaction failure rolls back",
+			body:       `{"writes": [{"path": "site/index.html", "content": "new index"}, {"path": "site/new.js", "content": "new"}, {"path": "site/blocker/file.txt", "content": "can't be written"}]}`,
+			wantStatus: 500,
+			wantFiles:  map[string]string{"site/index.html": "old index", "site/app.js": "old app", "site/new.js": ""},
+		},
+		{
+			name:       "invalid path rejected up front",
+			body:       `{"writes": [{"path": "site/index.html", "content": "new index"}, {"path": "../escape", "content": "x"}]}`,
+			wantStatus: 400,
+			wantFiles:  map[string]string{"site/index.html": "old index"},
+		},
+		{
+			name:       "duplicate path",
+			body:       `{"writes": [{"path": "site/a", "content": "1"}, {"path": "site/./a", "content": "2"}]}`,
+			wantStatus: 400,
+			wantFiles:  map[string]string{"site/a": ""},
+		},
+		{
+			name:       "bad base64",
+			body:       `{"writes": [{"path": "site/index.html", "content": "new"}, {"path": "site/b", "content": "!!", "encoding": "base64"}]}`,
+			wantStatus: 400,
+			wantFiles:  map[string]string{"site/index.html": "old index"},
+		},
+		{name: "empty", body: `{"writes": []}`, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeTestFiles(t, tmpDir, existing)
+			useDataDir(t, tmpDir)
+
+			w := httptest.NewRecorder()
+			handleAPIFilesTransaction(w, httptest.NewRequest("POST", "/api/files/transaction", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			for path, want := range tt.wantFiles {
+				content, err := os.ReadFile(filepath.Join(tmpDir, path))
+				if want == "" {
+					if err == nil {
+						t.Errorf("%s exists, want it gone", path)
+					}
+					continue
+				}
+				if err != nil || string(content) != want {
+					t.Errorf("%s = %q (%v), want %q", path, content, err, want)
+				}
+			}
+
+			// No staging directory is left behind
+			matches, _ := filepath.Glob(filepath.Join(tmpDir, ".transaction-*"))
+			if len(matches) != 0 {
+				t.Errorf("left staging directories: %v", matches)
+			}
+
+			if tt.wantStatus == 200 {
+				var resp TransactionResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+				if len(resp.Paths) != 3 || resp.Paths[0] != "site/index.html" || resp.Bytes != int64(len("new index")+len("new app")+4) {
+					t.Errorf("response = %+v", resp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+const maxTreeDepth = 16
+
+// maxTreeNodes caps the nodes in one tree response (a var so tests can
+// lower it)
+var maxTreeNodes = 10000
+
+// TreeNode is a file or directory in a nested tree listing. Children is
+// only set on directories that were read: it's empty for an empty
+// directory, and missing past the requested depth, so tree UIs know which
+// directories still need loading.
+type TreeNode struct {
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"isDir"`
+	Children []*TreeNode `json:"children,omitzero"`
+}
+
+// handleAPIFilesTree returns a directory as nested JSON, ?depth=N levels
+// deep (1 by default, at most maxTreeDepth). Directories are read breadth
+// first, so when a big tree hits maxTreeNodes the response still has the
+// top levels complete; it's flagged with X-Listing-Truncated like listings.
+func handleAPIFilesTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	absPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	depth := 1
+	if param := r.URL.Query().Get("depth"); param != "" {
+		depth, err = strconv.Atoi(param)
+		if err != nil || depth < 1 || depth > maxTreeDepth {
+			http.Error(w, fmt.Sprintf("invalid depth %q: must be 1 to %d", param, maxTreeDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Directory not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	tree, truncated, err := buildTree(absPath, depth, maxTreeNodes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if truncated {
+		w.Header().Set("X-Listing-Truncated", "true")
+	}
+	json.NewEncoder(w).Encode(tree)
+}
+
+// buildTree reads the directory absPath depth levels deep, stopping once
+// the tree has maxNodes nodes below the root
+func buildTree(absPath string, depth, maxNodes int) (*TreeNode, bool, error) {
+	root := &TreeNode{Name: path.Base("/" + toRelativePath(absPath)), IsDir: true}
+	if root.Name == "/" {
+		root.Name = ""
+	}
+
+	type pending struct {
+		node  *TreeNode
+		path  string
+		level int
+	}
+	queue := []pending{{root, absPath, 1}}
+	nodes := 0
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		entries, err := os.ReadDir(dir.path)
+		if err != nil {
+			if dir.node != root && (os.IsNotExist(err) || os.IsPermission(err)) {
+				continue // Removed since its parent was read, or unreadable
+			}
+			return nil, false, err
+		}
+		dir.node.Children = []*TreeNode{}
+		for _, entry := range entries {
+			if nodes == maxNodes {
+				return root, true, nil
+			}
+			nodes++
+			child := &TreeNode{Name: entry.Name(), IsDir: entry.IsDir()}
+			dir.node.Children = append(dir.node.Children, child)
+			if child.IsDir && dir.level < depth {
+				queue = append(queue, pending{child, filepath.Join(dir.path, entry.Name()), dir.level + 1})
+			}
+		}
+	}
+	return root, false, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIFilesTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"readme.md":         "r",
+		"src/main.go":       "m",
+		"src/lib/util.go":   "u",
+		"src/lib/deep/x.go": "x",
+	})
+	if err := os.Mkdir(filepath.Join(tmpDir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "default depth",
+			wantStatus: 200,
+			want: `{"name":"","isDir":true,"children":[
+				{"name":"empty","isDir":true},
+				{"name":"readme.md","isDir":false},
+				{"name":"src","isDir":true}]}`,
+		},
+		{
+			name:       "two levels",
+			query:      "?depth=2",
+			wantStatus: 200,
+			want: `{"name":"","isDir":true,"children":[
+				{"name":"empty","isDir":true,"children":[]},
+				{"name":"readme.md","isDir":false},
+				{"name":"src","isDir":true,"children":[
+					{"name":"lib","isDir":true},
+					{"name":"main.go","isDir":false}]}]}`,
+		},
+		{
+			name:       "subdirectory, all the way down",
+			query:      "?path=src/lib&depth=16",
+			wantStatus: 200,
+			want: `{"name":"lib","isDir":true,"children":[
+				{"name":"deep","isDir":true,"children":[{"name":"x.go","isDir":false}]},
+				{"name":"util.go","isDir":false}]}`,
+		},
+		{name: "depth too big", query: "?depth=17", wantStatus: 400},
+		{name: "depth zero", query: "?depth=0", wantStatus: 400},
+		{name: "not a directory", query: "?path=readme.md", wantStatus: 400},
+		{name: "missing", query: "?path=nope", wantStatus: 404},
+		{name: "escape", query: "?path=../", wantStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/tree"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.want == "" {
+				return
+			}
+			var got, want any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("tree = %s\nwant   %s", gotJSON, wantJSON)
+			}
+			if w.Header().Get("X-Listing-Truncated") != "" {
+				t.Error("unexpected truncation header")
+			}
+		})
+	}
+}
+
+func TestAPIFilesTreeNodeCap(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"a/1.txt": "1", "a/2.txt": "2", "a/3.txt": "3",
+		"b/1.txt": "1", "b/2.txt": "2",
+		"c.txt": "c",
+	})
+	useDataDir(t, tmpDir)
+	old := maxTreeNodes
+	maxTreeNodes = 5
+	t.Cleanup(func() { maxTreeNodes = old })
+
+	w := httptest.NewRecorder()
+	handleAPIFilesTree(w, httptest.NewRequest("GET", "/api/files/tree?depth=2", nil))
+	if w.Code != 200 || w.Header().Get("X-Listing-Truncated") != "true" {
+		t.Fatalf("status = %d, truncated = %q", w.Code, w.Header().Get("X-Listing-Truncated"))
+	}
+	var tree TreeNode
+	if err := json.Unmarshal(w.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	// Breadth first: the top level is complete, then a's children until
+	// the cap, and b is never read
+	if len(tree.Children) != 3 {
+		t.Fatalf("top level has %d children, want 3", len(tree.Children))
+	}
+	a, b := tree.Children[0], tree.Children[1]
+	if len(a.Children) != 2 || b.Children != nil {
+		t.Errorf("a has %d children, b = %v", len(a.Children), b.Children)
+	}
+}
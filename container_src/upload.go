@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxUploadBytes caps the size of a single uploaded file (a var so tests
+// can lower it)
+var maxUploadBytes int64 = 1024 * 1024 * 1024 // 1 GB
+
+// uploadMessage is a control frame on the upload WebSocket. The client
+// sends {"type":"done"} after its last chunk; the server sends "ack" after
+// each chunk, then "complete" or "error".
+type uploadMessage struct {
+	Type  string `json:"type"`
+	Bytes int64  `json:"bytes,omitempty"` // Running total received
+	Path  string `json:"path,omitempty"`  // Final path (on complete)
+	Error string `json:"error,omitempty"`
+}
+
+// handleUploadWebSocket receives a file over a WebSocket so the client can
+// show progress. The destination comes from ?path=. Binary frames are
+// chunks of the file, each acked with the running byte count; the file is
+// written to a temp file and renamed into place once the client sends
+// "done", so an aborted upload never clobbers the existing file.
+func handleUploadWebSocket(w http.ResponseWriter, r *http.Request) {
+	relPath := r.URL.Query().Get("path")
+	if relPath == "" {
+		http.Error(w, "path query parameter is required", http.StatusBadRequest)
+		return
+	}
+	absPath, err := validateAndResolveWritePath(relPath)
+	if err != nil {
+		http.Error(w, err.Error(), pathErrorStatus(err))
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	send := func(msg uploadMessage) error {
+		data, _ := json.Marshal(msg)
+		return ws.WriteMessage(websocket.TextMessage, data)
+	}
+	fail := func(reason string) {
+		send(uploadMessage{Type: "error", Error: reason})
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+			time.Now().Add(time.Second))
+	}
+
+	// Chunks flow through a pipe into the same atomic writer HTTP uploads use
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		_, err := writeFileAtomic(absPath, pr, maxUploadBytes)
+		pr.CloseWithError(err) // unblock the loop below if writing failed
+		written <- err
+	}()
+
+	var received int64
+	for {
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			// Client went away mid-upload, discard the partial file
+			pw.CloseWithError(err)
+			<-written
+			return
+		}
+
+		if msgType == websocket.BinaryMessage {
+			if received+int64(len(data)) > maxUploadBytes {
+				pw.CloseWithError(errTooLarge)
+				<-written
+				fail(fmt.Sprintf("File too large (limit %s)", formatBytes(maxUploadBytes)))
+				return
+			}
+			if _, err := pw.Write(data); err != nil {
+				<-written
+				fail(fmt.Sprintf("Failed to write file: %v", err))
+				return
+			}
+			received += int64(len(data))
+			if err := send(uploadMessage{Type: "ack", Bytes: received}); err != nil {
+				pw.CloseWithError(err)
+				<-written
+				return
+			}
+			continue
+		}
+
+		var msg uploadMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "done" {
+			continue
+		}
+		pw.Close()
+		if err := <-written; err != nil {
+			if errors.Is(err, errTooLarge) {
+				fail(fmt.Sprintf("File too large (limit %s)", formatBytes(maxUploadBytes)))
+			} else {
+				fail(fmt.Sprintf("Failed to write file: %v", err))
+			}
+			return
+		}
+		send(uploadMessage{Type: "complete", Bytes: received, Path: toRelativePath(absPath)})
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		return
+	}
+}
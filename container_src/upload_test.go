@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialUpload opens an upload WebSocket for dest against a test server
+func dialUpload(t *testing.T, dest string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(handleUploadWebSocket))
+	t.Cleanup(server.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/upload?path=" + dest
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return ws
+}
+
+func readUploadMessage(t *testing.T, ws *websocket.Conn) uploadMessage {
+	t.Helper()
+	var msg uploadMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestUploadWebSocket(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"uploads/video.mp4": "old content"})
+	useDataDir(t, tmpDir)
+	ws := dialUpload(t, "uploads/video.mp4")
+
+	chunks := []string{strings.Repeat("a", 1000), strings.Repeat("b", 500), "c"}
+	var total int64
+	for _, chunk := range chunks {
+		if err := ws.WriteMessage(websocket.BinaryMessage, []byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+		total += int64(len(chunk))
+		ack := readUploadMessage(t, ws)
+		if ack.Type != "ack" || ack.Bytes != total {
+			t.Fatalf("ack = %+v, want ack of %d bytes", ack, total)
+		}
+
+		// Nothing is visible at the destination until the upload completes
+		content, _ := os.ReadFile(filepath.Join(tmpDir, "uploads/video.mp4"))
+		if string(content) != "old content" {
+			t.Fatalf("destination changed mid-upload")
+		}
+	}
+
+	done, _ := json.Marshal(uploadMessage{Type: "done"})
+	if err := ws.WriteMessage(websocket.TextMessage, done); err != nil {
+		t.Fatal(err)
+	}
+	complete := readUploadMessage(t, ws)
+	if complete.Type != "complete" || complete.Bytes != total || complete.Path != "uploads/video.mp4" {
+		t.Fatalf("complete = %+v", complete)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "uploads/video.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != strings.Join(chunks, "") {
+		t.Errorf("content = %d bytes, want %d", len(content), total)
+	}
+	entries, _ := os.ReadDir(filepath.Join(tmpDir, "uploads"))
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestUploadWebSocketSizeCap(t *testing.T) {
+	tmpDir := t.TempDir()
+	useDataDir(t, tmpDir)
+	oldMax := maxUploadBytes
+	maxUploadBytes = 100
+	t.Cleanup(func() { maxUploadBytes = oldMax })
+
+	ws := dialUpload(t, "big.bin")
+	ws.WriteMessage(websocket.BinaryMessage, make([]byte, 60))
+	if ack := readUploadMessage(t, ws); ack.Type != "ack" {
+		t.Fatalf("first chunk: %+v", ack)
+	}
+	ws.WriteMessage(websocket.BinaryMessage, make([]byte, 60))
+	if msg := readUploadMessage(t, ws); msg.Type != "error" || !strings.Contains(msg.Error, "too large") {
+		t.Fatalf("over the cap: %+v", msg)
+	}
+
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("rejected upload left files behind: %v", entries)
+	}
+}
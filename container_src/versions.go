@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// versionsDirName holds saved versions, mirroring the data directory:
+	// the versions of src/app.js are .versions/src/app.js/<id>
+	versionsDirName     = ".versions"
+	defaultVersionsKeep = 10
+	// versionIDFormat names versions by when they were saved, so they sort
+	// oldest first
+	versionIDFormat = "20060102T150405.000000000Z"
+)
+
+// VersionsConfig turns on versioning: every overwrite through PUT
+// /api/files/<path> first saves the content it replaces, as a lightweight
+// undo. Only the newest Keep versions of each file are kept.
+type VersionsConfig struct {
+	Keep int `json:"keep,omitempty"` // Default 10
+}
+
+// versionsKeep returns how many versions to keep per file, or 0 if
+// versioning is off
+func (c *Config) versionsKeep() int {
+	if c == nil || c.Versions == nil {
+		return 0
+	}
+	if c.Versions.Keep <= 0 {
+		return defaultVersionsKeep
+	}
+	return c.Versions.Keep
+}
+
+// FileVersion is a saved version of a file
+type FileVersion struct {
+	ID    string    `json:"id"`
+	Size  int64     `json:"size"`
+	Saved time.Time `json:"saved"`
+}
+
+// versionsDir is where absPath's versions are saved
+func versionsDir(absPath string) string {
+	return filepath.Join(dataDir, versionsDirName, toRelativePath(absPath))
+}
+
+// inVersionsDir reports whether absPath is a saved version itself, which
+// isn't versioned again
+func inVersionsDir(absPath string) bool {
+	root := filepath.Join(dataDir, versionsDirName)
+	return absPath == root || strings.HasPrefix(absPath, root+string(filepath.Separator))
+}
+
+// saveVersion copies absPath's current content into its versions,
+// returning where it went, or "" if there's no file to save
+func saveVersion(absPath string) (string, error) {
+	info, err := os.Stat(absPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+	dir := versionsDir(absPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	saved := time.Now().UTC()
+	versionPath := filepath.Join(dir, saved.Format(versionIDFormat))
+	for {
+		if _, err := os.Lstat(versionPath); os.IsNotExist(err) {
+			break
+		}
+		saved = saved.Add(time.Nanosecond)
+		versionPath = filepath.Join(dir, saved.Format(versionIDFormat))
+	}
+	return versionPath, copyFile(absPath, versionPath)
+}
+
+// listVersions returns absPath's saved versions, newest first
+func listVersions(absPath string) ([]FileVersion, error) {
+	entries, err := os.ReadDir(versionsDir(absPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	versions := []FileVersion{}
+	for _, entry := range entries {
+		saved, err := time.Parse(versionIDFormat, entry.Name())
+		if err != nil || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, FileVersion{ID: entry.Name(), Size: info.Size(), Saved: saved})
+	}
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// pruneVersions deletes all but absPath's newest keep versions
+func pruneVersions(absPath string, keep int) error {
+	versions, err := listVersions(absPath)
+	if err != nil || len(versions) <= keep {
+		return err
+	}
+	for _, version := range versions[keep:] {
+		if err := os.Remove(filepath.Join(versionsDir(absPath), version.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionsTarget reports whether a /api/files/ path addresses a file's
+// versions: "<file>/versions" for the list, "<file>/versions/<id>" for one
+// version. <file> must be a regular file or have saved versions (it may
+// have been deleted since); either way "<file>/versions" can't also be a
+// real path.
+func versionsTarget(filePath string) (target, id string, ok bool) {
+	if t, found := strings.CutSuffix(filePath, "/versions"); found {
+		target = t
+	} else if i := strings.LastIndex(filePath, "/versions/"); i >= 0 {
+		target, id = filePath[:i], filePath[i+len("/versions/"):]
+		if id == "" || strings.Contains(id, "/") {
+			return "", "", false
+		}
+	} else {
+		return "", "", false
+	}
+
+	absPath, err := validateAndResolvePath(target)
+	if err != nil {
+		return "", "", false
+	}
+	if info, err := os.Stat(absPath); err == nil {
+		return target, id, info.Mode().IsRegular()
+	}
+	if info, err := os.Stat(versionsDir(absPath)); err == nil && info.IsDir() {
+		return target, id, true
+	}
+	return "", "", false
+}
+
+// handleAPIFileVersions serves a file's saved versions, see VersionsConfig.
+// GET /api/files/<path>/versions lists them, newest first; GET
+// .../versions/<id> returns one version's content, and POST
+// .../versions/<id> restores it (saving the current content as a version
+// first, when versioning is on, so a restore can be undone too).
+func handleAPIFileVersions(w http.ResponseWriter, r *http.Request, target, id string) {
+	absPath, err := validateAndResolvePath(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if id == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		versions, err := listVersions(absPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+		return
+	}
+
+	// Only well-formed IDs, which also keeps the path inside the versions
+	if _, err := time.Parse(versionIDFormat, id); err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	version, err := os.Open(filepath.Join(versionsDir(absPath), id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer version.Close()
+
+	switch r.Method {
+	case "GET":
+		config, _ := loadConfig()
+		w.Header().Set("Content-Type", config.mimeType(absPath))
+		io.Copy(w, version)
+	case "POST":
+		if absPath, err = validateAndResolveWritePath(target); err != nil {
+			http.Error(w, err.Error(), pathErrorStatus(err))
+			return
+		}
+		if info, err := os.Stat(absPath); err == nil && info.IsDir() {
+			http.Error(w, "Path is a directory", http.StatusConflict)
+			return
+		}
+		config, _ := loadConfig()
+		if keep := config.versionsKeep(); keep > 0 {
+			if _, err := saveVersion(absPath); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to save current version: %v", err), http.StatusInternalServerError)
+				return
+			}
+			defer pruneVersions(absPath, keep)
+		}
+		if _, err := writeFileAtomic(absPath, version, 0); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to restore version: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// putFile writes content through the file API, returning the status
+func putFile(t *testing.T, mux http.Handler, path, content string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", "/api/files/"+path, strings.NewReader(content)))
+	return w.Code
+}
+
+// getVersions lists path's versions through the file API
+func getVersions(t *testing.T, mux http.Handler, path string) []FileVersion {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/"+path+"/versions", nil))
+	if w.Code != 200 {
+		t.Fatalf("list versions: status = %d: %s", w.Code, w.Body.String())
+	}
+	var versions []FileVersion
+	if err := json.NewDecoder(w.Body).Decode(&versions); err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestFileVersions(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"config.json": `{"static": ".", "versions": {"keep": 3}}`,
+		"notes.txt":   "v1",
+	})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	// A new file has nothing to save
+	if code := putFile(t, mux, "new.txt", "first"); code != 200 {
+		t.Fatalf("put new file: status = %d", code)
+	}
+	if versions := getVersions(t, mux, "new.txt"); len(versions) != 0 {
+		t.Errorf("new file has versions: %+v", versions)
+	}
+
+	// Each overwrite saves what it replaced, newest first
+	for _, content := range []string{"v2", "v3"} {
+		if code := putFile(t, mux, "notes.txt", content); code != 200 {
+			t.Fatalf("put %s: status = %d", content, code)
+		}
+	}
+	versions := getVersions(t, mux, "notes.txt")
+	if len(versions) != 2 || versions[0].Size != 2 || !versions[0].Saved.After(versions[1].Saved) {
+		t.Fatalf("versions = %+v", versions)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/files/notes.txt/versions/"+versions[1].ID, nil))
+	if w.Code != 200 || w.Body.String() != "v1" {
+		t.Errorf("oldest version = %d %q, want v1", w.Code, w.Body.String())
+	}
+
+	// Restoring brings the content back, and saves what it replaced
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/files/notes.txt/versions/"+versions[1].ID, nil))
+	if w.Code != 200 {
+		t.Fatalf("restore: status = %d: %s", w.Code, w.Body.String())
+	}
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "notes.txt")); string(content) != "v1" {
+		t.Errorf("after restore = %q, want v1", content)
+	}
+	if versions := getVersions(t, mux, "notes.txt"); len(versions) != 3 {
+		t.Errorf("after restore: %d versions, want 3", len(versions))
+	}
+
+	// Past the limit, the oldest go
+	for _, content := range []string{"v4", "v5"} {
+		putFile(t, mux, "notes.txt", content)
+	}
+	versions = getVersions(t, mux, "notes.txt")
+	if len(versions) != 3 {
+		t.Fatalf("after pruning: %d versions, want 3", len(versions))
+	}
+	var contents []string
+	for _, v := range versions {
+		content, _ := os.ReadFile(filepath.Join(tmpDir, versionsDirName, "notes.txt", v.ID))
+		contents = append(contents, string(content))
+	}
+	if got := strings.Join(contents, ","); got != "v4,v1,v3" {
+		t.Errorf("kept versions = %s, want v4,v1,v3", got)
+	}
+
+	// A failed write leaves no version behind
+	req := httptest.NewRequest("PUT", "/api/files/notes.txt", strings.NewReader("v6"))
+	req.Header.Set("X-Content-SHA256", strings.Repeat("0", 64))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad checksum: status = %d", w.Code)
+	}
+	if after := getVersions(t, mux, "notes.txt"); len(after) != 3 || after[0].ID != versions[0].ID {
+		t.Errorf("versions changed by a failed write: %+v", after)
+	}
+
+	// Versions outlive the file
+	os.Remove(filepath.Join(tmpDir, "notes.txt"))
+	if versions := getVersions(t, mux, "notes.txt"); len(versions) != 3 {
+		t.Errorf("deleted file: %d versions, want 3", len(versions))
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+	}{
+		{"unknown version", "GET", "/api/files/notes.txt/versions/20000101T000000.000000000Z", 404},
+		{"malformed id", "GET", "/api/files/notes.txt/versions/latest", 404},
+		{"no such file", "GET", "/api/files/missing.txt/versions", 404},
+		{"post to the list", "POST", "/api/files/new.txt/versions", 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestFileVersionsOff(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"config.json": `{"static": "."}`, "a.txt": "old"})
+	useDataDir(t, tmpDir)
+	mux := newServeMux(&Config{})
+
+	putFile(t, mux, "a.txt", "new")
+	if _, err := os.Stat(filepath.Join(tmpDir, versionsDirName)); !os.IsNotExist(err) {
+		t.Errorf("versions saved with versioning off: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// watchInterval is how often a watched directory is rescanned (a var so
+// tests can shorten it)
+var watchInterval = time.Second
+
+// maxWatchers caps concurrent /api/watch streams, and maxWatchEntries the
+// files under one watched directory, since every stream rescans its whole
+// tree each interval (vars so tests can lower them)
+var (
+	maxWatchers     int32 = 16
+	maxWatchEntries       = 10000
+)
+
+// activeWatchers counts open /api/watch streams
+var activeWatchers atomic.Int32
+
+// WatchEvent is one change to a watched directory. Kind is "create",
+// "modify", "delete" or "rename"; renames also have From.
+type WatchEvent struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	From  string `json:"from,omitempty"`
+	IsDir bool   `json:"isDir"`
+}
+
+// watchedFile is what a scan remembers about each file
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// handleAPIWatch streams changes under ?path= (the base directory by
+// default) as Server-Sent Events: "event: change" with a WatchEvent as the
+// data, for live file explorers that would otherwise poll the listing.
+//
+// Changes are found by rescanning the tree every watchInterval and
+// comparing sizes and mtimes, not with inotify: the data directory is an
+// S3 mount, which doesn't emit change events (the same reason live reload
+// polls). So events arrive up to an interval late, several changes to a
+// file in one interval are a single "modify", and a rename is only
+// recognized as one when the file keeps its size and mtime and moves
+// within one interval; otherwise it's a delete and a create. The stream
+// ends with "event: error" if the tree grows past maxWatchEntries.
+func handleAPIWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rootPath, err := validateAndResolvePath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(rootPath); err != nil || !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if activeWatchers.Add(1) > maxWatchers {
+		activeWatchers.Add(-1)
+		http.Error(w, "Too many watchers", http.StatusTooManyRequests)
+		return
+	}
+	defer activeWatchers.Add(-1)
+
+	last, ok := scanWatchedTree(rootPath, maxWatchEntries)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Too many files to watch (limit %d)", maxWatchEntries), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, ": watching\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			current, ok := scanWatchedTree(rootPath, maxWatchEntries)
+			if !ok {
+				fmt.Fprintf(w, "event: error\ndata: {\"error\": \"too many files to watch (limit %d)\"}\n\n", maxWatchEntries)
+				flusher.Flush()
+				return
+			}
+			events := diffWatchedTrees(last, current)
+			last = current
+			for _, event := range events {
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			}
+			if len(events) > 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// scanWatchedTree records every file and directory under rootPath by
+// relative path, reporting false if there are more than maxEntries.
+// Unreadable directories are skipped, and symlinks aren't followed.
+func scanWatchedTree(rootPath string, maxEntries int) (map[string]watchedFile, bool) {
+	files := make(map[string]watchedFile)
+	complete := true
+	filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == rootPath {
+			return nil // Vanished or unreadable, the next scan will see it
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if len(files) == maxEntries {
+			complete = false
+			return filepath.SkipAll
+		}
+		files[toRelativePath(path)] = watchedFile{size: info.Size(), modTime: info.ModTime(), isDir: d.IsDir()}
+		return nil
+	})
+	return files, complete
+}
+
+// diffWatchedTrees lists the changes from one scan to the next, sorted by
+// path. Directories are only reported when they appear or disappear: their
+// mtimes change with their contents, which get events of their own.
+func diffWatchedTrees(before, after map[string]watchedFile) []WatchEvent {
+	var events []WatchEvent
+	var deleted []string
+	for path, old := range before {
+		cur, ok := after[path]
+		switch {
+		case !ok:
+			deleted = append(deleted, path)
+		case !old.isDir && !cur.isDir && (cur.size != old.size || !cur.modTime.Equal(old.modTime)):
+			events = append(events, WatchEvent{Path: path, Kind: "modify"})
+		}
+	}
+	sort.Strings(deleted)
+
+	var created []string
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			created = append(created, path)
+		}
+	}
+	sort.Strings(created)
+
+	// A file that disappeared and an identical one that appeared is taken
+	// to be a rename
+	renamedFrom := make(map[string]bool)
+	for _, path := range created {
+		cur := after[path]
+		from := ""
+		if !cur.isDir {
+			for _, old := range deleted {
+				if prev := before[old]; !renamedFrom[old] && !prev.isDir && prev.size == cur.size && prev.modTime.Equal(cur.modTime) {
+					from = old
+					break
+				}
+			}
+		}
+		if from != "" {
+			renamedFrom[from] = true
+			events = append(events, WatchEvent{Path: path, Kind: "rename", From: from})
+			continue
+		}
+		events = append(events, WatchEvent{Path: path, Kind: "create", IsDir: cur.isDir})
+	}
+	for _, path := range deleted {
+		if !renamedFrom[path] {
+			events = append(events, WatchEvent{Path: path, Kind: "delete", IsDir: before[path].isDir})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
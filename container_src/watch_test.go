@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffWatchedTrees(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Second)
+	before := map[string]watchedFile{
+		"same.txt":    {size: 1, modTime: t0},
+		"edited.txt":  {size: 1, modTime: t0},
+		"gone.txt":    {size: 5, modTime: t0},
+		"old-name.md": {size: 9, modTime: t0},
+		"src":         {isDir: true, modTime: t0},
+		"olddir":      {isDir: true, modTime: t0},
+	}
+	after := map[string]watchedFile{
+		"same.txt":     {size: 1, modTime: t0},
+		"edited.txt":   {size: 1, modTime: t1},
+		"new-name.md":  {size: 9, modTime: t0},
+		"src":          {isDir: true, modTime: t1}, // Changed contents only
+		"src/added.go": {size: 3, modTime: t1},
+		"newdir":       {isDir: true, modTime: t1},
+	}
+	want := []WatchEvent{
+		{Path: "edited.txt", Kind: "modify"},
+		{Path: "gone.txt", Kind: "delete"},
+		{Path: "new-name.md", Kind: "rename", From: "old-name.md"},
+		{Path: "newdir", Kind: "create", IsDir: true},
+		{Path: "olddir", Kind: "delete", IsDir: true},
+		{Path: "src/added.go", Kind: "create"},
+	}
+	if got := diffWatchedTrees(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got %+v\nwant %+v", got, want)
+	}
+	if got := diffWatchedTrees(after, after); len(got) != 0 {
+		t.Errorf("no changes: got %+v", got)
+	}
+}
+
+func TestAPIWatch(t *testing.T) {
+	old := watchInterval
+	watchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { watchInterval = old })
+
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"site/index.html": "hi", "other.txt": "x"})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(newServeMux(&Config{}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/watch?path=site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	if line := <-lines; line != ": watching" {
+		t.Fatalf("first line = %q", line)
+	}
+
+	// Outside the watched directory, so no event
+	if err := os.WriteFile(filepath.Join(tmpDir, "other.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "site/app.js"), []byte("js"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			var event WatchEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			if want := (WatchEvent{Path: "site/app.js", Kind: "create"}); event != want {
+				t.Fatalf("event = %+v, want %+v", event, want)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no event after a file was created")
+		}
+	}
+}
+
+func TestAPIWatchLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{"a.txt": "a", "b.txt": "b", "sub/c.txt": "c"})
+	useDataDir(t, tmpDir)
+	server := httptest.NewServer(newServeMux(&Config{}))
+	defer server.Close()
+
+	oldWatchers, oldEntries := maxWatchers, maxWatchEntries
+	t.Cleanup(func() { maxWatchers, maxWatchEntries = oldWatchers, oldEntries })
+	maxWatchers = 1
+
+	first, err := server.Client().Get(server.URL + "/api/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.StatusCode != 200 {
+		t.Fatalf("first watcher: status = %d", first.StatusCode)
+	}
+	second, err := server.Client().Get(server.URL + "/api/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	if second.StatusCode != 429 {
+		t.Errorf("second watcher: status = %d, want 429", second.StatusCode)
+	}
+
+	// Disconnecting frees the slot
+	first.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for activeWatchers.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher still counted after disconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	maxWatchEntries = 2
+	w := httptest.NewRecorder()
+	handleAPIWatch(w, httptest.NewRequest("GET", "/api/watch", nil))
+	if w.Code != 400 {
+		t.Errorf("too many files: status = %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handleAPIWatch(w, httptest.NewRequest("GET", "/api/watch?path=a.txt", nil))
+	if w.Code != 400 {
+		t.Errorf("not a directory: status = %d, want 400", w.Code)
+	}
+}
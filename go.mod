@@ -3,6 +3,7 @@ module github.com/maxmcd/cute-computer
 go 1.25.2
 
 require (
-	github.com/creack/pty v1.1.24 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/creack/pty v1.1.24
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
 )